@@ -1,14 +1,18 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
 	"gopkg.in/yaml.v3"
 
 	"github.com/supamanluva/ircd/internal/logger"
@@ -17,12 +21,23 @@ import (
 
 var (
 	configPath = flag.String("config", "config/config.yaml", "Path to configuration file")
+	genPass    = flag.Bool("genpass", false, "Print a bcrypt hash for an operator password and exit")
+	password   = flag.String("password", "", "Password to hash with -genpass (prompts if empty)")
+	hashCost   = flag.Int("cost", bcrypt.DefaultCost, "bcrypt cost used by -genpass")
 	version    = "0.1.0"
 )
 
 func main() {
 	flag.Parse()
 
+	if *genPass {
+		if err := runGenPass(*password, *hashCost); err != nil {
+			fmt.Fprintln(os.Stderr, "genpass:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Initialize logger
 	log := logger.New()
 	log.Info("Starting IRC Server", "version", version)
@@ -72,6 +87,55 @@ func main() {
 	log.Info("Server stopped")
 }
 
+// runGenPass hashes an operator password and prints it in a form that can be
+// pasted into the operators section of the config file.
+func runGenPass(pass string, cost int) error {
+	if pass == "" {
+		var err error
+		if pass, err = readPassword(); err != nil {
+			return fmt.Errorf("failed to read password: %w", err)
+		}
+	}
+
+	hash, err := hashOperPassword(pass, cost)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(hash)
+	return nil
+}
+
+// readPassword prompts for a password on a terminal without echoing it, or
+// reads a line when the password is piped in
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, "Password: ")
+		pass, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(pass), err
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// hashOperPassword returns the bcrypt hash of an operator password.
+func hashOperPassword(pass string, cost int) (string, error) {
+	if pass == "" {
+		return "", fmt.Errorf("password must not be empty")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(pass), cost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
 func loadConfig(path string) (*server.Config, error) {
 	// Read config file
 	data, err := os.ReadFile(path)
@@ -98,13 +162,65 @@ func loadConfig(path string) (*server.Config, error) {
 			Host         string `yaml:"host"`
 			Port         int    `yaml:"port"`
 			MaxClients   int    `yaml:"max_clients"`
+			MaxPerUserHost int  `yaml:"max_per_userhost"`
 			Timeout      int    `yaml:"timeout_seconds"`
+			RegTimeout   int    `yaml:"registration_timeout_seconds"`
+			IdleKick     int    `yaml:"idle_kick_seconds"`
 			PingInterval int    `yaml:"ping_interval_seconds"`
+			UserLen      int    `yaml:"userlen"`
+			MaxTargets   int    `yaml:"max_targets"`
+			MaxISON      int    `yaml:"max_ison"`
+			Version      string `yaml:"version"`
+			HideBuild    bool   `yaml:"hide_build_info"`
+			StatusGrace  int    `yaml:"status_grace_seconds"`
+			SendPaceLines int   `yaml:"send_pace_lines"`
+			SendPaceMS   int    `yaml:"send_pace_interval_ms"`
+			ConnectNotices []string `yaml:"connect_notices"`
+			MOTDFile     string `yaml:"motd_file"`
+			NoStdReplies bool   `yaml:"disable_standard_replies"`
+			WhowasSize   int    `yaml:"whowas_size"`
+			MaxAccept    int    `yaml:"max_accept"`
+			OperMaxFailures int `yaml:"oper_max_failures"`
+			OperLockout  int    `yaml:"oper_lockout_seconds"`
+			NoticeLoopLimit  int `yaml:"notice_loop_limit"`
+			NoticeLoopWindow int `yaml:"notice_loop_window_seconds"`
+			MaxListEntries int  `yaml:"max_list_entries"`
+			MaxListTotal int    `yaml:"max_list_total"`
+			KickCooldown int    `yaml:"kick_cooldown_seconds"`
+			TopicChanges int    `yaml:"topic_changes"`
+			TopicWindow  int    `yaml:"topic_window_seconds"`
+			InviteExpiry int    `yaml:"invite_expiry_seconds"`
+			ResyncDuplicateJoin bool `yaml:"resync_duplicate_join"`
+			NickProtectGrace int `yaml:"nick_protect_grace_seconds"`
+			GuestNickPattern string `yaml:"guest_nick_pattern"`
+			Lockdown     bool   `yaml:"lockdown"`
+			ChannelExpiryHours int `yaml:"channel_expiry_hours"`
+			CTCP         struct {
+				Replies bool    `yaml:"server_replies"`
+				Rate    float64 `yaml:"queries_per_second"`
+				Burst   float64 `yaml:"burst"`
+			} `yaml:"ctcp"`
+			MessageTags  struct {
+				ClientTags []string `yaml:"client_tags"`
+				MaxLength  int      `yaml:"max_length"`
+			} `yaml:"message_tags"`
+			JoinPart     struct {
+				Rate  float64 `yaml:"per_second"`
+				Burst float64 `yaml:"burst"`
+			} `yaml:"join_part"`
+			Lookups struct {
+				DNS           bool `yaml:"dns"`
+				Ident         bool `yaml:"ident"`
+				MaxConcurrent int  `yaml:"max_concurrent"`
+				QueueWaitMS   int  `yaml:"queue_wait_ms"`
+				Timeout       int  `yaml:"timeout_seconds"`
+			} `yaml:"lookups"`
 			TLS          struct {
 				Enabled  bool   `yaml:"enabled"`
 				Port     int    `yaml:"port"`
 				CertFile string `yaml:"cert_file"`
 				KeyFile  string `yaml:"key_file"`
+				StrictALPN bool `yaml:"alpn_strict"`
 			} `yaml:"tls"`
 		} `yaml:"server"`
 		WebSocket struct {
@@ -112,6 +228,7 @@ func loadConfig(path string) (*server.Config, error) {
 			Host           string   `yaml:"host"`
 			Port           int      `yaml:"port"`
 			AllowedOrigins []string `yaml:"allowed_origins"`
+			ResumeSeconds  int      `yaml:"resume_seconds"`
 			TLS            struct {
 				Enabled  bool   `yaml:"enabled"`
 				CertFile string `yaml:"cert_file"`
@@ -123,8 +240,12 @@ func loadConfig(path string) (*server.Config, error) {
 			Host        string `yaml:"host"`
 			Port        int    `yaml:"port"`
 			ServerID    string `yaml:"server_id"`
+			StrictSID   bool   `yaml:"server_id_strict"`
 			Description string `yaml:"description"`
 			Password    string `yaml:"password"`
+			MaxLineLen  int    `yaml:"max_line_length"`
+			MaxLinks    int    `yaml:"max_links"`
+			MaxUsers    int    `yaml:"max_users_per_link"`
 			Links       []struct {
 				Name        string `yaml:"name"`
 				SID         string `yaml:"sid"`
@@ -133,12 +254,27 @@ func loadConfig(path string) (*server.Config, error) {
 				Password    string `yaml:"password"`
 				AutoConnect bool   `yaml:"auto_connect"`
 				IsHub       bool   `yaml:"is_hub"`
+				TLS         bool   `yaml:"tls"`
+				Fingerprint string `yaml:"tls_fingerprint"`
 			} `yaml:"links"`
+			TLS struct {
+				Enabled          bool   `yaml:"enabled"`
+				Host             string `yaml:"host"`
+				Port             int    `yaml:"port"`
+				CertFile         string `yaml:"cert_file"`
+				KeyFile          string `yaml:"key_file"`
+				DisablePlaintext bool   `yaml:"disable_plaintext"`
+			} `yaml:"tls"`
 		} `yaml:"linking"`
 		Operators []struct {
 			Name     string `yaml:"name"`
 			Password string `yaml:"password"`
 		} `yaml:"operators"`
+		Accounts []struct {
+			Name     string   `yaml:"name"`
+			Password string   `yaml:"password"`
+			Nicks    []string `yaml:"nicks"`
+		} `yaml:"accounts"`
 	}
 
 	if err := yaml.Unmarshal(data, &configData); err != nil {
@@ -154,6 +290,16 @@ func loadConfig(path string) (*server.Config, error) {
 		}
 	}
 
+	// Build accounts list
+	accounts := make([]server.Account, len(configData.Accounts))
+	for i, a := range configData.Accounts {
+		accounts[i] = server.Account{
+			Name:     a.Name,
+			Password: a.Password,
+			Nicks:    a.Nicks,
+		}
+	}
+
 	// Build links list
 	links := make([]server.LinkConfig, len(configData.Linking.Links))
 	for i, link := range configData.Linking.Links {
@@ -165,6 +311,8 @@ func loadConfig(path string) (*server.Config, error) {
 			Password:    link.Password,
 			AutoConnect: link.AutoConnect,
 			IsHub:       link.IsHub,
+			TLS:         link.TLS,
+			TLSFingerprint: link.Fingerprint,
 		}
 	}
 
@@ -174,13 +322,58 @@ func loadConfig(path string) (*server.Config, error) {
 		Host:             configData.Server.Host,
 		Port:             configData.Server.Port,
 		MaxClients:       configData.Server.MaxClients,
+		MaxPerUserHost:   configData.Server.MaxPerUserHost,
 		TLSEnabled:       configData.Server.TLS.Enabled,
 		TLSPort:          configData.Server.TLS.Port,
 		TLSCertFile:      configData.Server.TLS.CertFile,
 		TLSKeyFile:       configData.Server.TLS.KeyFile,
+		TLSStrictALPN:    configData.Server.TLS.StrictALPN,
 		PingInterval:     time.Duration(configData.Server.PingInterval) * time.Second,
 		Timeout:          time.Duration(configData.Server.Timeout) * time.Second,
+		RegistrationTimeout: time.Duration(configData.Server.RegTimeout) * time.Second,
+		IdleKick:         time.Duration(configData.Server.IdleKick) * time.Second,
 		Operators:        operators,
+		Accounts:         accounts,
+		UserLen:          configData.Server.UserLen,
+		CTCPRate:         configData.Server.CTCP.Rate,
+		CTCPBurst:        configData.Server.CTCP.Burst,
+		CTCPReplies:      configData.Server.CTCP.Replies,
+		JoinPartRate:     configData.Server.JoinPart.Rate,
+		JoinPartBurst:    configData.Server.JoinPart.Burst,
+		HostnameLookup:   configData.Server.Lookups.DNS,
+		IdentLookup:      configData.Server.Lookups.Ident,
+		MaxLookups:       configData.Server.Lookups.MaxConcurrent,
+		LookupQueueWait:  time.Duration(configData.Server.Lookups.QueueWaitMS) * time.Millisecond,
+		LookupTimeout:    time.Duration(configData.Server.Lookups.Timeout) * time.Second,
+		MaxTargets:       configData.Server.MaxTargets,
+		MaxISON:          configData.Server.MaxISON,
+		Version:          configData.Server.Version,
+		HideBuildInfo:    configData.Server.HideBuild,
+		StatusGrace:      time.Duration(configData.Server.StatusGrace) * time.Second,
+		SendPaceLines:    configData.Server.SendPaceLines,
+		SendPaceInterval: time.Duration(configData.Server.SendPaceMS) * time.Millisecond,
+		ConnectNotices:   configData.Server.ConnectNotices,
+		MOTDFile:         configData.Server.MOTDFile,
+		NoStandardReplies: configData.Server.NoStdReplies,
+		WhowasSize:       configData.Server.WhowasSize,
+		MaxAccept:        configData.Server.MaxAccept,
+		OperMaxFailures:  configData.Server.OperMaxFailures,
+		OperLockout:      time.Duration(configData.Server.OperLockout) * time.Second,
+		NoticeLoopLimit:  configData.Server.NoticeLoopLimit,
+		NoticeLoopWindow: time.Duration(configData.Server.NoticeLoopWindow) * time.Second,
+		MaxListEntries:   configData.Server.MaxListEntries,
+		MaxListTotal:     configData.Server.MaxListTotal,
+		KickCooldown:     time.Duration(configData.Server.KickCooldown) * time.Second,
+		TopicChanges:     configData.Server.TopicChanges,
+		TopicWindow:      time.Duration(configData.Server.TopicWindow) * time.Second,
+		InviteExpiry:     time.Duration(configData.Server.InviteExpiry) * time.Second,
+		ResyncDuplicateJoin: configData.Server.ResyncDuplicateJoin,
+		NickProtectGrace: time.Duration(configData.Server.NickProtectGrace) * time.Second,
+		GuestNickPattern: configData.Server.GuestNickPattern,
+		Lockdown:         configData.Server.Lockdown,
+		ClientTags:       configData.Server.MessageTags.ClientTags,
+		MaxTagLength:     configData.Server.MessageTags.MaxLength,
+		ChannelExpiry:    time.Duration(configData.Server.ChannelExpiryHours) * time.Hour,
 		WebSocketEnabled: configData.WebSocket.Enabled,
 		WebSocketHost:    configData.WebSocket.Host,
 		WebSocketPort:    configData.WebSocket.Port,
@@ -188,13 +381,24 @@ func loadConfig(path string) (*server.Config, error) {
 		WebSocketTLS:     configData.WebSocket.TLS.Enabled,
 		WebSocketCert:    configData.WebSocket.TLS.CertFile,
 		WebSocketKey:     configData.WebSocket.TLS.KeyFile,
+		WebSocketResume:  time.Duration(configData.WebSocket.ResumeSeconds) * time.Second,
 		LinkingEnabled:   configData.Linking.Enabled,
 		LinkingHost:      configData.Linking.Host,
 		LinkingPort:      configData.Linking.Port,
 		ServerID:         configData.Linking.ServerID,
+		ServerIDStrict:   configData.Linking.StrictSID,
 		ServerDesc:       configData.Linking.Description,
 		LinkPassword:     configData.Linking.Password,
 		Links:            links,
+		LinkMaxLineLength: configData.Linking.MaxLineLen,
+		MaxLinks:         configData.Linking.MaxLinks,
+		LinkMaxUsers:     configData.Linking.MaxUsers,
+		LinkTLSEnabled:   configData.Linking.TLS.Enabled,
+		LinkTLSHost:      configData.Linking.TLS.Host,
+		LinkTLSPort:      configData.Linking.TLS.Port,
+		LinkTLSCert:      configData.Linking.TLS.CertFile,
+		LinkTLSKey:       configData.Linking.TLS.KeyFile,
+		LinkPlaintextDisabled: configData.Linking.TLS.DisablePlaintext,
 	}
 
 	// Set defaults for missing values
@@ -234,6 +438,9 @@ func loadConfig(path string) (*server.Config, error) {
 	if config.LinkingHost == "" {
 		config.LinkingHost = "0.0.0.0"
 	}
+	if config.LinkTLSPort == 0 {
+		config.LinkTLSPort = 7778
+	}
 
 	return config, nil
 }
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashOperPassword(t *testing.T) {
+	hash, err := hashOperPassword("hunter2", bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hashOperPassword: %v", err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte("hunter2")); err != nil {
+		t.Fatalf("hash does not verify: %v", err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte("wrong")); err == nil {
+		t.Fatal("hash verified a wrong password")
+	}
+	if cost, _ := bcrypt.Cost([]byte(hash)); cost != bcrypt.MinCost {
+		t.Errorf("cost = %d, want %d", cost, bcrypt.MinCost)
+	}
+
+	if _, err := hashOperPassword("", bcrypt.MinCost); err == nil {
+		t.Error("expected error for empty password")
+	}
+}
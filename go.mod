@@ -1,9 +1,12 @@
 module github.com/supamanluva/ircd
 
-go 1.23
+go 1.24.0
 
 require (
-	github.com/gorilla/websocket v1.5.3 // indirect
-	golang.org/x/crypto v0.43.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	github.com/gorilla/websocket v1.5.3
+	golang.org/x/crypto v0.43.0
+	golang.org/x/term v0.36.0
+	gopkg.in/yaml.v3 v3.0.1
 )
+
+require golang.org/x/sys v0.37.0 // indirect
@@ -1,23 +1,61 @@
 package channel
 
 import (
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/supamanluva/ircd/internal/client"
+	"github.com/supamanluva/ircd/internal/security"
 )
 
+// Member status ranks, from lowest to highest
+const (
+	RankNone  = iota // Regular member
+	RankVoice        // +v
+	RankHalfop       // +h
+	RankOp           // +o
+	RankAdmin        // +a
+	RankOwner        // +q
+)
+
+// rankPrefixes maps each rank to its NAMES/WHO prefix
+var rankPrefixes = [...]string{"", "+", "%", "@", "&", "~"}
+
 // Channel represents an IRC channel (chat room)
 type Channel struct {
 	name      string
 	topic     string
+	topicBy   string                     // nick!user@host of whoever set the topic
+	topicTime time.Time                  // when the topic was set
 	key       string                     // channel key for +k mode
+	limit     int                        // +l: maximum members (0 = no limit)
 	createdAt time.Time
+	lastActivity time.Time                // last join, part, message or topic change
 	members   map[string]*client.Client // nickname -> client
+	owners    map[string]bool            // nickname -> is owner (+q)
+	admins    map[string]bool            // nickname -> is admin (+a)
 	operators map[string]bool            // nickname -> is operator
+	halfops   map[string]bool            // nickname -> is halfop (+h)
 	voiced    map[string]bool            // nickname -> has voice (+v)
+	hidden    map[string]bool            // nickname -> joined under +D and not announced yet
 	modes     map[rune]bool              // channel modes (i, m, n, t, etc.)
 	banList   []string                   // ban masks (nick!user@host patterns)
+	quietList []string                   // quiet masks (+q mask): may join but not speak
+	exceptList []string                  // ban exception masks (+e): override a matching ban
+	invexList  []string                  // invite exception masks (+I): may join while +i
+	floodLines   int                              // +f: messages allowed per member...
+	floodSeconds int                              // ...within this many seconds
+	floodBudgets map[string]*security.RateLimiter // nickname -> message budget for +f
+	joinLimit    int                              // +j: joins allowed...
+	joinSeconds  int                              // ...within this many seconds
+	joinTimes    []time.Time                      // recent joins inside the +j window
+	topicLimit   int                              // +T: topic changes allowed...
+	topicSeconds int                              // ...within this many seconds
+	topicTimes   []time.Time                      // recent topic changes inside the window
+	kickedUntil  map[string]time.Time             // user@host -> rejoin refused until (kick cooldown)
+	invites      map[string]time.Time             // lowercased nickname -> invite expiry
 	mu        sync.RWMutex
 }
 
@@ -26,11 +64,19 @@ func New(name string) *Channel {
 	ch := &Channel{
 		name:      name,
 		createdAt: time.Now(),
+		lastActivity: time.Now(),
 		members:   make(map[string]*client.Client),
+		owners:    make(map[string]bool),
+		admins:    make(map[string]bool),
 		operators: make(map[string]bool),
+		halfops:   make(map[string]bool),
 		voiced:    make(map[string]bool),
+		hidden:    make(map[string]bool),
 		modes:     make(map[rune]bool),
 		banList:   make([]string, 0),
+		quietList: make([]string, 0),
+		exceptList: make([]string, 0),
+		invexList:  make([]string, 0),
 	}
 	
 	// Set default modes
@@ -45,6 +91,20 @@ func (ch *Channel) GetName() string {
 	return ch.name
 }
 
+// GetCreatedAt returns the channel creation time (its TS)
+func (ch *Channel) GetCreatedAt() time.Time {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return ch.createdAt
+}
+
+// SetCreatedAt overrides the channel creation time, e.g. after losing a TS merge
+func (ch *Channel) SetCreatedAt(t time.Time) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.createdAt = t
+}
+
 // GetTopic returns the channel topic
 func (ch *Channel) GetTopic() string {
 	ch.mu.RLock()
@@ -59,6 +119,42 @@ func (ch *Channel) SetTopic(topic string) {
 	ch.topic = topic
 }
 
+// SetTopicInfo sets the channel topic along with who set it and when
+func (ch *Channel) SetTopicInfo(topic, setBy string, setAt time.Time) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.topic = topic
+	ch.topicBy = setBy
+	ch.topicTime = setAt
+	ch.lastActivity = time.Now()
+}
+
+// Touch records activity in the channel (e.g. a message)
+func (ch *Channel) Touch() {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.lastActivity = time.Now()
+}
+
+// GetLastActivity returns when the channel was last used
+func (ch *Channel) GetLastActivity() time.Time {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return ch.lastActivity
+}
+
+// IsPermanent returns whether the channel is registered (+P) and survives being empty
+func (ch *Channel) IsPermanent() bool {
+	return ch.HasMode('P')
+}
+
+// GetTopicInfo returns who set the topic and when
+func (ch *Channel) GetTopicInfo() (setBy string, setAt time.Time) {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return ch.topicBy, ch.topicTime
+}
+
 // AddMember adds a client to the channel
 func (ch *Channel) AddMember(c *client.Client) {
 	ch.mu.Lock()
@@ -66,13 +162,54 @@ func (ch *Channel) AddMember(c *client.Client) {
 	
 	nick := c.GetNickname()
 	ch.members[nick] = c
+	ch.lastActivity = time.Now()
 	
-	// First member becomes operator
-	if len(ch.members) == 1 {
+	// First member becomes operator, except in a permanent (+P) channel
+	// kept while empty: whoever rejoins it first must not take it over
+	if len(ch.members) == 1 && !ch.modes['P'] {
 		ch.operators[nick] = true
 	}
 }
 
+// ReplaceMember swaps a member's connection for another client with the same
+// nickname, keeping their status. It returns false if old was not a member.
+func (ch *Channel) ReplaceMember(old, c *client.Client) bool {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	
+	nick := old.GetNickname()
+	if ch.members[nick] != old {
+		return false
+	}
+	ch.members[nick] = c
+	return true
+}
+
+// RenameMember re-keys a member and their status after a nick change. It
+// returns false if oldNick is not a member.
+func (ch *Channel) RenameMember(oldNick, newNick string) bool {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	c, ok := ch.members[oldNick]
+	if !ok {
+		return false
+	}
+	delete(ch.members, oldNick)
+	ch.members[newNick] = c
+	for _, held := range []map[string]bool{ch.owners, ch.admins, ch.operators, ch.halfops, ch.voiced, ch.hidden} {
+		if held[oldNick] {
+			delete(held, oldNick)
+			held[newNick] = true
+		}
+	}
+	if budget, ok := ch.floodBudgets[oldNick]; ok {
+		delete(ch.floodBudgets, oldNick)
+		ch.floodBudgets[newNick] = budget
+	}
+	return true
+}
+
 // RemoveMember removes a client from the channel
 func (ch *Channel) RemoveMember(c *client.Client) {
 	ch.mu.Lock()
@@ -80,8 +217,19 @@ func (ch *Channel) RemoveMember(c *client.Client) {
 	
 	nick := c.GetNickname()
 	delete(ch.members, nick)
+	ch.lastActivity = time.Now()
+	delete(ch.owners, nick)
+	delete(ch.admins, nick)
 	delete(ch.operators, nick)
+	delete(ch.halfops, nick)
 	delete(ch.voiced, nick)
+	delete(ch.hidden, nick)
+	delete(ch.floodBudgets, nick)
+	
+	// Outstanding invites don't outlive the channel's last member
+	if len(ch.members) == 0 {
+		ch.invites = nil
+	}
 }
 
 // HasMember checks if a client is in the channel
@@ -94,6 +242,42 @@ func (ch *Channel) HasMember(c *client.Client) bool {
 	return exists
 }
 
+// SetHidden marks a member whose JOIN was held back under +D (delayed join),
+// or clears the mark once they have been announced
+func (ch *Channel) SetHidden(c *client.Client, hidden bool) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	
+	nick := c.GetNickname()
+	if hidden {
+		ch.hidden[nick] = true
+	} else {
+		delete(ch.hidden, nick)
+	}
+}
+
+// IsHidden reports whether a member joined under +D and has not been
+// announced to the rest of the channel yet
+func (ch *Channel) IsHidden(c *client.Client) bool {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return ch.hidden[c.GetNickname()]
+}
+
+// GetHiddenMembers returns the members whose JOIN is still held back
+func (ch *Channel) GetHiddenMembers() []*client.Client {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	
+	var hidden []*client.Client
+	for nick := range ch.hidden {
+		if c, ok := ch.members[nick]; ok {
+			hidden = append(hidden, c)
+		}
+	}
+	return hidden
+}
+
 // GetMembers returns a slice of all members
 func (ch *Channel) GetMembers() []*client.Client {
 	ch.mu.RLock()
@@ -135,6 +319,103 @@ func (ch *Channel) SetOperator(c *client.Client, isOp bool) {
 	}
 }
 
+// IsOwner checks if a client is a channel owner (+q)
+func (ch *Channel) IsOwner(c *client.Client) bool {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return ch.owners[c.GetNickname()]
+}
+
+// SetOwner sets or unsets owner status for a client
+func (ch *Channel) SetOwner(c *client.Client, isOwner bool) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	
+	nick := c.GetNickname()
+	if isOwner {
+		ch.owners[nick] = true
+	} else {
+		delete(ch.owners, nick)
+	}
+}
+
+// IsAdmin checks if a client is a channel admin (+a)
+func (ch *Channel) IsAdmin(c *client.Client) bool {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return ch.admins[c.GetNickname()]
+}
+
+// SetAdmin sets or unsets admin status for a client
+func (ch *Channel) SetAdmin(c *client.Client, isAdmin bool) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	
+	nick := c.GetNickname()
+	if isAdmin {
+		ch.admins[nick] = true
+	} else {
+		delete(ch.admins, nick)
+	}
+}
+
+// IsHalfop checks if a client is a channel halfop (+h)
+func (ch *Channel) IsHalfop(c *client.Client) bool {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return ch.halfops[c.GetNickname()]
+}
+
+// SetHalfop sets or unsets halfop status for a client
+func (ch *Channel) SetHalfop(c *client.Client, isHalfop bool) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	
+	nick := c.GetNickname()
+	if isHalfop {
+		ch.halfops[nick] = true
+	} else {
+		delete(ch.halfops, nick)
+	}
+}
+
+// Outranks reports whether c holds a strictly higher status than target
+func (ch *Channel) Outranks(c, target *client.Client) bool {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return ch.rankOf(c.GetNickname()) > ch.rankOf(target.GetNickname())
+}
+
+// GetRank returns the highest status rank a member holds
+func (ch *Channel) GetRank(c *client.Client) int {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return ch.rankOf(c.GetNickname())
+}
+
+// GetPrefix returns the prefix for a member's highest status ("~", "&", "@", "%", "+" or "")
+func (ch *Channel) GetPrefix(c *client.Client) string {
+	return rankPrefixes[ch.GetRank(c)]
+}
+
+// rankOf returns the rank for a nickname; callers must hold ch.mu
+func (ch *Channel) rankOf(nick string) int {
+	switch {
+	case ch.owners[nick]:
+		return RankOwner
+	case ch.admins[nick]:
+		return RankAdmin
+	case ch.operators[nick]:
+		return RankOp
+	case ch.halfops[nick]:
+		return RankHalfop
+	case ch.voiced[nick]:
+		return RankVoice
+	default:
+		return RankNone
+	}
+}
+
 // IsVoiced checks if a client has voice
 func (ch *Channel) IsVoiced(c *client.Client) bool {
 	ch.mu.RLock()
@@ -167,9 +448,8 @@ func (ch *Channel) CanSpeak(c *client.Client) bool {
 		return true
 	}
 	
-	nick := c.GetNickname()
-	// Operators and voiced users can speak in moderated channels
-	return ch.operators[nick] || ch.voiced[nick]
+	// Voiced users and above can speak in moderated channels
+	return ch.rankOf(c.GetNickname()) >= RankVoice
 }
 
 // Broadcast sends a message to all members except the sender
@@ -213,18 +493,59 @@ func (ch *Channel) GetMemberNicks() []string {
 	
 	nicks := make([]string, 0, len(ch.members))
 	for nick := range ch.members {
-		// Prefix operators with @, voiced with +
-		if ch.operators[nick] {
-			nicks = append(nicks, "@"+nick)
-		} else if ch.voiced[nick] {
-			nicks = append(nicks, "+"+nick)
-		} else {
-			nicks = append(nicks, nick)
-		}
+		// Prefix with the highest status held (~ & @ % +)
+		nicks = append(nicks, rankPrefixes[ch.rankOf(nick)]+nick)
 	}
 	return nicks
 }
 
+// GetMemberNames returns the members as listed in NAMES for viewer.
+// multiPrefix lists every status held instead of only the highest (NAMESX);
+// userhost lists nick!user@host instead of the nickname (UHNAMES). Members
+// hidden by +D are only listed to themselves.
+func (ch *Channel) GetMemberNames(viewer *client.Client, multiPrefix, userhost bool) []string {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	names := make([]string, 0, len(ch.members))
+	for nick, member := range ch.members {
+		if ch.hidden[nick] && member != viewer {
+			continue
+		}
+		prefix := rankPrefixes[ch.rankOf(nick)]
+		if multiPrefix {
+			prefix = ch.prefixesOf(nick)
+		}
+		name := nick
+		if userhost {
+			name = member.GetHostmask()
+		}
+		names = append(names, prefix+name)
+	}
+	return names
+}
+
+// prefixesOf returns every status prefix a nickname holds, highest first;
+// callers must hold ch.mu
+func (ch *Channel) prefixesOf(nick string) string {
+	var prefixes strings.Builder
+	for _, held := range []struct {
+		members map[string]bool
+		rank    int
+	}{
+		{ch.owners, RankOwner},
+		{ch.admins, RankAdmin},
+		{ch.operators, RankOp},
+		{ch.halfops, RankHalfop},
+		{ch.voiced, RankVoice},
+	} {
+		if held.members[nick] {
+			prefixes.WriteString(rankPrefixes[held.rank])
+		}
+	}
+	return prefixes.String()
+}
+
 // SetMode sets or unsets a channel mode
 func (ch *Channel) SetMode(mode rune, enabled bool) {
 	ch.mu.Lock()
@@ -248,32 +569,97 @@ func (ch *Channel) GetModes() string {
 	ch.mu.RLock()
 	defer ch.mu.RUnlock()
 	
-	modes := ""
-	for mode := range ch.modes {
-		modes += string(mode)
+	var modes []rune
+	for mode, set := range ch.modes {
+		if set {
+			modes = append(modes, mode)
+		}
 	}
-	if modes == "" {
+	if len(modes) == 0 {
 		return ""
 	}
-	return "+" + modes
+	sort.Slice(modes, func(i, j int) bool { return modes[i] < modes[j] })
+	return "+" + string(modes)
+}
+
+// ExtbanTypes lists the extended ban types we understand (for RPL_ISUPPORT):
+// ~a:account, ~q:mask (quiet) and ~r:realname
+const ExtbanTypes = "aqr"
+
+// ParseExtban splits an extended ban like "~a:account" into its type and
+// value. ok is false for plain masks and unknown types.
+func ParseExtban(mask string) (kind byte, value string, ok bool) {
+	if len(mask) < 3 || mask[0] != '~' || mask[2] != ':' {
+		return 0, "", false
+	}
+	if !strings.ContainsRune(ExtbanTypes, rune(mask[1])) {
+		return 0, "", false
+	}
+	return mask[1], mask[3:], true
+}
+
+// NormalizeMask completes a partial mask to nick!user@host form, filling
+// missing parts with *: "nick" -> "nick!*@*", "*@host" -> "*!*@host",
+// "nick!user" -> "nick!user@*". Extended bans keep their prefix; only the
+// mask of a quiet (~q:) is completed.
+func NormalizeMask(mask string) string {
+	if kind, value, ok := ParseExtban(mask); ok {
+		if kind == 'q' {
+			value = NormalizeMask(value)
+		}
+		return "~" + string(kind) + ":" + value
+	}
+
+	nick, user, host := "*", "*", "*"
+	
+	rest := mask
+	if i := strings.Index(rest, "!"); i >= 0 {
+		nick, rest = rest[:i], rest[i+1:]
+		if at := strings.LastIndex(rest, "@"); at >= 0 {
+			user, host = rest[:at], rest[at+1:]
+		} else {
+			user = rest
+		}
+	} else if at := strings.LastIndex(rest, "@"); at >= 0 {
+		user, host = rest[:at], rest[at+1:]
+	} else {
+		nick = rest
+	}
+	
+	if nick == "" {
+		nick = "*"
+	}
+	if user == "" {
+		user = "*"
+	}
+	if host == "" {
+		host = "*"
+	}
+	return nick + "!" + user + "@" + host
 }
 
-// AddBan adds a ban mask to the channel
-func (ch *Channel) AddBan(mask string) {
+// AddBan adds a ban mask to the channel, completing partial masks. It
+// reports whether the mask was new.
+func (ch *Channel) AddBan(mask string) bool {
+	mask = NormalizeMask(mask)
+	
 	ch.mu.Lock()
 	defer ch.mu.Unlock()
 	
 	// Check if already banned
 	for _, ban := range ch.banList {
 		if ban == mask {
-			return
+			return false
 		}
 	}
 	ch.banList = append(ch.banList, mask)
+	return true
 }
 
 // RemoveBan removes a ban mask from the channel
 func (ch *Channel) RemoveBan(mask string) bool {
+	mask = NormalizeMask(mask)
+	
 	ch.mu.Lock()
 	defer ch.mu.Unlock()
 	
@@ -286,6 +672,30 @@ func (ch *Channel) RemoveBan(mask string) bool {
 	return false
 }
 
+// ClearList empties one of the mask lists (b bans, e exceptions, I invite
+// exceptions, q quiets) and returns the masks that were removed
+func (ch *Channel) ClearList(mode rune) []string {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	var list *[]string
+	switch mode {
+	case 'b':
+		list = &ch.banList
+	case 'e':
+		list = &ch.exceptList
+	case 'I':
+		list = &ch.invexList
+	case 'q':
+		list = &ch.quietList
+	default:
+		return nil
+	}
+	masks := *list
+	*list = nil
+	return masks
+}
+
 // GetBanList returns a copy of the ban list
 func (ch *Channel) GetBanList() []string {
 	ch.mu.RLock()
@@ -309,17 +719,472 @@ func (ch *Channel) IsBanned(hostmask string) bool {
 	return false
 }
 
+// IsBannedClient checks if a client matches any ban, including the account
+// (~a:) and realname (~r:) extended bans. Quiets (~q:) don't stop a join.
+func (ch *Channel) IsBannedClient(c *client.Client) bool {
+	hostmask := c.GetHostmask()
+
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	for _, ban := range ch.banList {
+		kind, value, ok := ParseExtban(ban)
+		if !ok {
+			if matchMask(ban, hostmask) {
+				return true
+			}
+			continue
+		}
+		switch kind {
+		case 'a':
+			if account := c.GetAccount(); account != "" && strings.EqualFold(value, account) {
+				return true
+			}
+		case 'r':
+			if matchMask(value, c.GetRealname()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AddException adds a ban exception mask to the channel, completing partial
+// masks. It reports whether the mask was new.
+func (ch *Channel) AddException(mask string) bool {
+	mask = NormalizeMask(mask)
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	for _, except := range ch.exceptList {
+		if except == mask {
+			return false
+		}
+	}
+	ch.exceptList = append(ch.exceptList, mask)
+	return true
+}
+
+// RemoveException removes a ban exception mask from the channel
+func (ch *Channel) RemoveException(mask string) bool {
+	mask = NormalizeMask(mask)
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	for i, except := range ch.exceptList {
+		if except == mask {
+			ch.exceptList = append(ch.exceptList[:i], ch.exceptList[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// GetExceptionList returns a copy of the ban exception list
+func (ch *Channel) GetExceptionList() []string {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	excepts := make([]string, len(ch.exceptList))
+	copy(excepts, ch.exceptList)
+	return excepts
+}
+
+// IsExcepted checks if a hostmask matches any ban exception
+func (ch *Channel) IsExcepted(hostmask string) bool {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	for _, except := range ch.exceptList {
+		if matchMask(except, hostmask) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddInviteException adds an invite exception mask to the channel,
+// completing partial masks. It reports whether the mask was new.
+func (ch *Channel) AddInviteException(mask string) bool {
+	mask = NormalizeMask(mask)
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	for _, invex := range ch.invexList {
+		if invex == mask {
+			return false
+		}
+	}
+	ch.invexList = append(ch.invexList, mask)
+	return true
+}
+
+// RemoveInviteException removes an invite exception mask from the channel
+func (ch *Channel) RemoveInviteException(mask string) bool {
+	mask = NormalizeMask(mask)
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	for i, invex := range ch.invexList {
+		if invex == mask {
+			ch.invexList = append(ch.invexList[:i], ch.invexList[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// GetInviteExceptionList returns a copy of the invite exception list
+func (ch *Channel) GetInviteExceptionList() []string {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	invexes := make([]string, len(ch.invexList))
+	copy(invexes, ch.invexList)
+	return invexes
+}
+
+// IsInviteExcepted checks if a hostmask matches any invite exception
+func (ch *Channel) IsInviteExcepted(hostmask string) bool {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	for _, invex := range ch.invexList {
+		if matchMask(invex, hostmask) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddQuiet adds a quiet mask to the channel, completing partial masks. It
+// reports whether the mask was new.
+func (ch *Channel) AddQuiet(mask string) bool {
+	mask = NormalizeMask(mask)
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	for _, quiet := range ch.quietList {
+		if quiet == mask {
+			return false
+		}
+	}
+	ch.quietList = append(ch.quietList, mask)
+	return true
+}
+
+// RemoveQuiet removes a quiet mask from the channel
+func (ch *Channel) RemoveQuiet(mask string) bool {
+	mask = NormalizeMask(mask)
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	for i, quiet := range ch.quietList {
+		if quiet == mask {
+			ch.quietList = append(ch.quietList[:i], ch.quietList[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// GetQuietList returns a copy of the quiet list
+func (ch *Channel) GetQuietList() []string {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	quiets := make([]string, len(ch.quietList))
+	copy(quiets, ch.quietList)
+	return quiets
+}
+
+// IsQuieted checks if a client matches the quiet list or a quiet extban
+// (~q:mask) on the channel
+func (ch *Channel) IsQuieted(c *client.Client) bool {
+	hostmask := c.GetHostmask()
+
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	for _, quiet := range ch.quietList {
+		if matchMask(quiet, hostmask) {
+			return true
+		}
+	}
+	for _, ban := range ch.banList {
+		if kind, value, ok := ParseExtban(ban); ok && kind == 'q' && matchMask(value, hostmask) {
+			return true
+		}
+	}
+	return false
+}
+
 // matchMask checks if a mask matches a hostmask
 // Supports * (any sequence) and ? (any single char)
 func matchMask(mask, hostmask string) bool {
-	// Simple implementation - can be enhanced with proper wildcard matching
-	if mask == hostmask {
+	// IRC masks compare case-insensitively, as hostnames do
+	mask = strings.ToLower(mask)
+	hostmask = strings.ToLower(hostmask)
+
+	// Glob match: * is any run of characters (including none), ? is exactly
+	// one. On a mismatch, backtrack to the last * and let it swallow one more.
+	m, h := 0, 0
+	star, starH := -1, 0
+	for h < len(hostmask) {
+		switch {
+		case m < len(mask) && (mask[m] == '?' || mask[m] == hostmask[h]):
+			m++
+			h++
+		case m < len(mask) && mask[m] == '*':
+			star, starH = m, h
+			m++
+		case star >= 0:
+			starH++
+			m, h = star+1, starH
+		default:
+			return false
+		}
+	}
+	for m < len(mask) && mask[m] == '*' {
+		m++
+	}
+	return m == len(mask)
+}
+
+// SetFloodLimit configures flood protection (+f lines:seconds).
+// A non-positive lines or seconds disables it.
+func (ch *Channel) SetFloodLimit(lines, seconds int) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	
+	if lines <= 0 || seconds <= 0 {
+		lines, seconds = 0, 0
+	}
+	ch.floodLines = lines
+	ch.floodSeconds = seconds
+	ch.floodBudgets = nil
+}
+
+// GetFloodLimit returns the flood protection settings (0, 0 when disabled)
+func (ch *Channel) GetFloodLimit() (lines, seconds int) {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return ch.floodLines, ch.floodSeconds
+}
+
+// CheckFlood records a message from a member and reports whether it
+// exceeded the channel's flood limit
+func (ch *Channel) CheckFlood(c *client.Client) bool {
+	ch.mu.Lock()
+	if ch.floodLines == 0 {
+		ch.mu.Unlock()
+		return false
+	}
+	
+	nick := c.GetNickname()
+	if ch.floodBudgets == nil {
+		ch.floodBudgets = make(map[string]*security.RateLimiter)
+	}
+	budget, ok := ch.floodBudgets[nick]
+	if !ok {
+		rate := float64(ch.floodLines) / float64(ch.floodSeconds)
+		budget = security.NewRateLimiter(rate, float64(ch.floodLines))
+		ch.floodBudgets[nick] = budget
+	}
+	ch.mu.Unlock()
+	
+	return !budget.Allow()
+}
+
+// SetJoinThrottle configures join throttling (+j joins:seconds).
+// A non-positive joins or seconds disables it.
+func (ch *Channel) SetJoinThrottle(joins, seconds int) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	
+	if joins <= 0 || seconds <= 0 {
+		joins, seconds = 0, 0
+	}
+	ch.joinLimit = joins
+	ch.joinSeconds = seconds
+	ch.joinTimes = nil
+}
+
+// GetJoinThrottle returns the join throttle settings (0, 0 when disabled)
+func (ch *Channel) GetJoinThrottle() (joins, seconds int) {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return ch.joinLimit, ch.joinSeconds
+}
+
+// AllowJoin records a join attempt and reports whether it fits within the
+// channel's +j limit. Refused joins are not counted.
+func (ch *Channel) AllowJoin() bool {
+	return ch.allowJoinAt(time.Now())
+}
+
+// allowJoinAt is AllowJoin with an explicit clock
+func (ch *Channel) allowJoinAt(now time.Time) bool {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	
+	if ch.joinLimit == 0 {
 		return true
 	}
 	
-	// TODO: Implement proper wildcard matching with * and ?
-	// For now, exact match only
-	return false
+	// Drop joins that have slid out of the window
+	cutoff := now.Add(-time.Duration(ch.joinSeconds) * time.Second)
+	recent := ch.joinTimes[:0]
+	for _, t := range ch.joinTimes {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	ch.joinTimes = recent
+	
+	if len(ch.joinTimes) >= ch.joinLimit {
+		return false
+	}
+	ch.joinTimes = append(ch.joinTimes, now)
+	return true
+}
+
+// SetTopicThrottle configures topic change throttling (+T changes:seconds).
+// A non-positive changes or seconds disables it.
+func (ch *Channel) SetTopicThrottle(changes, seconds int) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if changes <= 0 || seconds <= 0 {
+		changes, seconds = 0, 0
+	}
+	ch.topicLimit = changes
+	ch.topicSeconds = seconds
+	ch.topicTimes = nil
+}
+
+// GetTopicThrottle returns the topic throttle settings (0, 0 when disabled)
+func (ch *Channel) GetTopicThrottle() (changes, seconds int) {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return ch.topicLimit, ch.topicSeconds
+}
+
+// AllowTopicChange records a topic change and reports how long the channel
+// must wait before another is allowed (0 = allowed now). The channel's +T
+// limit takes precedence over the given server default; refused changes are
+// not counted.
+func (ch *Channel) AllowTopicChange(changes int, window time.Duration) time.Duration {
+	return ch.allowTopicChangeAt(time.Now(), changes, window)
+}
+
+// allowTopicChangeAt is AllowTopicChange with an explicit clock
+func (ch *Channel) allowTopicChangeAt(now time.Time, changes int, window time.Duration) time.Duration {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if ch.topicLimit > 0 {
+		changes = ch.topicLimit
+		window = time.Duration(ch.topicSeconds) * time.Second
+	}
+	if changes <= 0 || window <= 0 {
+		return 0
+	}
+
+	// Drop changes that have slid out of the window
+	cutoff := now.Add(-window)
+	recent := ch.topicTimes[:0]
+	for _, t := range ch.topicTimes {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	ch.topicTimes = recent
+
+	if len(ch.topicTimes) >= changes {
+		return ch.topicTimes[len(ch.topicTimes)-changes].Sub(cutoff)
+	}
+	ch.topicTimes = append(ch.topicTimes, now)
+	return 0
+}
+
+// AddInvite invites a nickname to the channel until the given time
+func (ch *Channel) AddInvite(nick string, until time.Time) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if ch.invites == nil {
+		ch.invites = make(map[string]time.Time)
+	}
+	ch.invites[strings.ToLower(nick)] = until
+}
+
+// IsInvited reports whether a nickname holds an unexpired invite
+func (ch *Channel) IsInvited(nick string) bool {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	until, ok := ch.invites[strings.ToLower(nick)]
+	return ok && until.After(time.Now())
+}
+
+// RemoveInvite drops a nickname's invite, e.g. once they have joined
+func (ch *Channel) RemoveInvite(nick string) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	delete(ch.invites, strings.ToLower(nick))
+}
+
+// SweepInvites removes invites that expired by now and returns how many
+// were removed
+func (ch *Channel) SweepInvites(now time.Time) int {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	removed := 0
+	for nick, until := range ch.invites {
+		if !until.After(now) {
+			delete(ch.invites, nick)
+			removed++
+		}
+	}
+	return removed
+}
+
+// SetKickCooldown refuses rejoins from a kicked user@host until the given time
+func (ch *Channel) SetKickCooldown(userhost string, until time.Time) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	now := time.Now()
+	for uh, t := range ch.kickedUntil {
+		if !t.After(now) {
+			delete(ch.kickedUntil, uh)
+		}
+	}
+	if ch.kickedUntil == nil {
+		ch.kickedUntil = make(map[string]time.Time)
+	}
+	ch.kickedUntil[strings.ToLower(userhost)] = until
+}
+
+// KickCooldown returns how much longer a kicked user@host must wait before
+// rejoining (0 if they may rejoin now)
+func (ch *Channel) KickCooldown(userhost string, now time.Time) time.Duration {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	until, ok := ch.kickedUntil[strings.ToLower(userhost)]
+	if !ok || !until.After(now) {
+		return 0
+	}
+	return until.Sub(now)
 }
 
 // GetMemberByNick returns a member by nickname
@@ -355,3 +1220,17 @@ func (ch *Channel) CheckKey(providedKey string) bool {
 	
 	return ch.key == providedKey
 }
+
+// SetLimit sets the user limit for +l (0 removes it)
+func (ch *Channel) SetLimit(limit int) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.limit = limit
+}
+
+// GetLimit returns the user limit, or 0 if none is set
+func (ch *Channel) GetLimit() int {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return ch.limit
+}
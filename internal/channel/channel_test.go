@@ -229,6 +229,75 @@ func TestBanList(t *testing.T) {
 	}
 }
 
+func TestIsBannedWildcards(t *testing.T) {
+	tests := []struct {
+		mask     string
+		hostmask string
+		want     bool
+	}{
+		{"*!*@evil.com", "bob!bob@evil.com", true},
+		{"*!*@evil.com", "bob!bob@EVIL.COM", true},
+		{"*!*@evil.com", "bob!bob@notevil.com", false},
+		{"*!*@evil.com", "bob!bob@evil.com.au", false},
+		{"baduser!*@*", "baduser!u@host.example", true},
+		{"baduser!*@*", "gooduser!u@host.example", false},
+		{"a?ice!*@*", "alice!a@host", true},
+		{"a?ice!*@*", "aice!a@host", false},
+		{"a?ice!*@*", "allice!a@host", false},
+		{"*!*spam*@*.example.*", "x!xspamx@mail.example.org", true},
+		{"*!*spam*@*.example.*", "x!ham@mail.example.org", false},
+		{"*", "anyone!at@all", true},
+		{"nick!user@host", "nick!user@host", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mask+" "+tt.hostmask, func(t *testing.T) {
+			ch := New("#test")
+			ch.AddBan(tt.mask)
+			if got := ch.IsBanned(tt.hostmask); got != tt.want {
+				t.Errorf("IsBanned(%q) with ban %q = %v, want %v", tt.hostmask, tt.mask, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeMask(t *testing.T) {
+	tests := []struct {
+		mask string
+		want string
+	}{
+		{"nick", "nick!*@*"},
+		{"*@host", "*!*@host"},
+		{"user@host", "*!user@host"},
+		{"nick!user", "nick!user@*"},
+		{"nick!user@host", "nick!user@host"},
+		{"nick!@host", "nick!*@host"},
+		{"*", "*!*@*"},
+		{"~a:account", "~a:account"},
+		{"~r:Real Name", "~r:Real Name"},
+		{"~q:nick", "~q:nick!*@*"},
+		{"~x:nick", "~x:nick!*@*"},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.mask, func(t *testing.T) {
+			if got := NormalizeMask(tt.mask); got != tt.want {
+				t.Errorf("NormalizeMask(%q) = %q, want %q", tt.mask, got, tt.want)
+			}
+		})
+	}
+	
+	// Bans are stored and removed in normalized form
+	ch := New("#test")
+	ch.AddBan("baduser")
+	if bans := ch.GetBanList(); len(bans) != 1 || bans[0] != "baduser!*@*" {
+		t.Errorf("ban list = %v, want [baduser!*@*]", bans)
+	}
+	if !ch.RemoveBan("baduser!*@*") {
+		t.Error("expected normalized ban to be removed")
+	}
+}
+
 func TestGetMemberByNick(t *testing.T) {
 	ch := New("#test")
 	c1 := createTestClient("alice")
@@ -330,3 +399,289 @@ func TestConcurrentAccess(t *testing.T) {
 		t.Errorf("Expected 10 members after concurrent adds, got %d", count)
 	}
 }
+
+func TestStatusRanks(t *testing.T) {
+	ch := New("#test")
+	owner := createTestClient("owner")
+	admin := createTestClient("admin")
+	op := createTestClient("op")
+	voice := createTestClient("voice")
+	user := createTestClient("user")
+
+	for _, c := range []*client.Client{owner, admin, op, voice, user} {
+		ch.AddMember(c)
+	}
+	ch.SetOperator(owner, false) // first member is auto-opped
+	ch.SetOwner(owner, true)
+	ch.SetAdmin(admin, true)
+	ch.SetOperator(op, true)
+	ch.SetVoice(voice, true)
+
+	tests := []struct {
+		client *client.Client
+		rank   int
+		prefix string
+	}{
+		{owner, RankOwner, "~"},
+		{admin, RankAdmin, "&"},
+		{op, RankOp, "@"},
+		{voice, RankVoice, "+"},
+		{user, RankNone, ""},
+	}
+
+	for _, tt := range tests {
+		if got := ch.GetRank(tt.client); got != tt.rank {
+			t.Errorf("GetRank(%s) = %d, want %d", tt.client.GetNickname(), got, tt.rank)
+		}
+		if got := ch.GetPrefix(tt.client); got != tt.prefix {
+			t.Errorf("GetPrefix(%s) = %q, want %q", tt.client.GetNickname(), got, tt.prefix)
+		}
+	}
+
+	if !(RankOwner > RankAdmin && RankAdmin > RankOp && RankOp > RankVoice && RankVoice > RankNone) {
+		t.Error("status ranks are not ordered owner > admin > op > voice > none")
+	}
+
+	// The highest status wins when several are held
+	ch.SetOperator(admin, true)
+	if got := ch.GetPrefix(admin); got != "&" {
+		t.Errorf("admin+op prefix = %q, want &", got)
+	}
+
+	nicks := make(map[string]bool)
+	for _, nick := range ch.GetMemberNicks() {
+		nicks[nick] = true
+	}
+	for _, want := range []string{"~owner", "&admin", "@op", "+voice", "user"} {
+		if !nicks[want] {
+			t.Errorf("GetMemberNicks missing %q: %v", want, nicks)
+		}
+	}
+
+	// Leaving clears every status
+	ch.RemoveMember(owner)
+	if ch.IsOwner(owner) {
+		t.Error("owner status should be cleared on part")
+	}
+}
+
+func TestOutranks(t *testing.T) {
+	ch := New("#test")
+	op := createTestClient("op")
+	halfop := createTestClient("halfop")
+	voice := createTestClient("voice")
+
+	ch.AddMember(op) // first member is auto-opped
+	ch.AddMember(halfop)
+	ch.AddMember(voice)
+	ch.SetHalfop(halfop, true)
+	ch.SetVoice(voice, true)
+
+	tests := []struct {
+		name   string
+		a, b   *client.Client
+		expect bool
+	}{
+		{"op over halfop", op, halfop, true},
+		{"halfop over voice", halfop, voice, true},
+		{"halfop over op", halfop, op, false},
+		{"equal rank", op, op, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ch.Outranks(tt.a, tt.b); got != tt.expect {
+				t.Errorf("Outranks = %v, want %v", got, tt.expect)
+			}
+		})
+	}
+
+	if got := ch.GetPrefix(halfop); got != "%" {
+		t.Errorf("halfop prefix = %q, want %%", got)
+	}
+}
+
+func TestJoinThrottle(t *testing.T) {
+	ch := New("#test")
+	start := time.Now()
+
+	// Disabled by default
+	for i := 0; i < 10; i++ {
+		if !ch.allowJoinAt(start) {
+			t.Fatal("join refused without +j")
+		}
+	}
+
+	ch.SetJoinThrottle(3, 10)
+	if joins, seconds := ch.GetJoinThrottle(); joins != 3 || seconds != 10 {
+		t.Fatalf("GetJoinThrottle = %d:%d, want 3:10", joins, seconds)
+	}
+
+	for i := 0; i < 3; i++ {
+		if !ch.allowJoinAt(start.Add(time.Duration(i) * time.Second)) {
+			t.Fatalf("join %d refused within limit", i+1)
+		}
+	}
+	if ch.allowJoinAt(start.Add(5 * time.Second)) {
+		t.Error("join beyond the limit was allowed")
+	}
+
+	// Only the first join has left the window 10.5 seconds in
+	if !ch.allowJoinAt(start.Add(10500 * time.Millisecond)) {
+		t.Error("join refused after the window cleared")
+	}
+	if ch.allowJoinAt(start.Add(10500 * time.Millisecond)) {
+		t.Error("window should be full again")
+	}
+
+	ch.SetJoinThrottle(0, 0)
+	if !ch.allowJoinAt(start.Add(11 * time.Second)) {
+		t.Error("join refused after -j")
+	}
+}
+
+func TestTopicThrottle(t *testing.T) {
+	ch := New("#test")
+	start := time.Now()
+
+	// No limit without +T or a server default
+	for i := 0; i < 10; i++ {
+		if wait := ch.allowTopicChangeAt(start, 0, time.Minute); wait != 0 {
+			t.Fatalf("topic change refused without a limit (wait %v)", wait)
+		}
+	}
+
+	// The server default applies when +T is unset
+	ch = New("#test")
+	for i := 0; i < 2; i++ {
+		if wait := ch.allowTopicChangeAt(start, 2, time.Minute); wait != 0 {
+			t.Fatalf("topic change %d refused within the default limit", i+1)
+		}
+	}
+	if wait := ch.allowTopicChangeAt(start.Add(20*time.Second), 2, time.Minute); wait != 40*time.Second {
+		t.Errorf("wait = %v, want 40s", wait)
+	}
+
+	// +T overrides the server default
+	ch.SetTopicThrottle(3, 10)
+	if changes, seconds := ch.GetTopicThrottle(); changes != 3 || seconds != 10 {
+		t.Fatalf("GetTopicThrottle = %d:%d, want 3:10", changes, seconds)
+	}
+	for i := 0; i < 3; i++ {
+		if wait := ch.allowTopicChangeAt(start.Add(time.Duration(i)*time.Second), 2, time.Minute); wait != 0 {
+			t.Fatalf("topic change %d refused within the +T limit", i+1)
+		}
+	}
+	if wait := ch.allowTopicChangeAt(start.Add(5*time.Second), 2, time.Minute); wait == 0 {
+		t.Error("topic change beyond the limit was allowed")
+	}
+	if wait := ch.allowTopicChangeAt(start.Add(10500*time.Millisecond), 2, time.Minute); wait != 0 {
+		t.Error("topic change refused after the window cleared")
+	}
+}
+
+func TestInviteExpiry(t *testing.T) {
+	ch := New("#test")
+	now := time.Now()
+
+	ch.AddInvite("Alice", now.Add(time.Hour))
+	ch.AddInvite("bob", now.Add(-time.Second))
+	if !ch.IsInvited("alice") {
+		t.Error("invite not found (nicknames are case-insensitive)")
+	}
+	if ch.IsInvited("bob") {
+		t.Error("expired invite still counts")
+	}
+
+	if removed := ch.SweepInvites(now); removed != 1 {
+		t.Errorf("SweepInvites removed %d invites, want 1", removed)
+	}
+	if !ch.IsInvited("alice") {
+		t.Error("sweep removed an unexpired invite")
+	}
+
+	// The channel emptying clears what's left
+	member := client.NewMock(logger.New())
+	member.SetNickname("carol")
+	ch.AddMember(member)
+	ch.RemoveMember(member)
+	if ch.IsInvited("alice") {
+		t.Error("invite survived the channel emptying")
+	}
+}
+
+func TestExceptionList(t *testing.T) {
+	ch := New("#test")
+
+	if !ch.AddException("trusted") || ch.AddException("trusted!*@*") {
+		t.Error("AddException should report only new masks")
+	}
+	ch.AddException("*!*@*.corp.example")
+	if excepts := ch.GetExceptionList(); len(excepts) != 2 || excepts[0] != "trusted!*@*" {
+		t.Errorf("exception list = %v, want [trusted!*@* *!*@*.corp.example]", excepts)
+	}
+
+	if !ch.IsExcepted("trusted!t@isp.example") || !ch.IsExcepted("bob!b@vpn.corp.example") {
+		t.Error("expected matching hostmasks to be excepted")
+	}
+	if ch.IsExcepted("mallory!m@isp.example") {
+		t.Error("unmatched hostmask was excepted")
+	}
+
+	if !ch.RemoveException("trusted") || ch.IsExcepted("trusted!t@isp.example") {
+		t.Error("exception not removed")
+	}
+}
+
+func TestInviteExceptionList(t *testing.T) {
+	ch := New("#test")
+
+	if !ch.AddInviteException("friend") || ch.AddInviteException("friend!*@*") {
+		t.Error("AddInviteException should report only new masks")
+	}
+	if invexes := ch.GetInviteExceptionList(); len(invexes) != 1 || invexes[0] != "friend!*@*" {
+		t.Errorf("invite exception list = %v, want [friend!*@*]", invexes)
+	}
+
+	if !ch.IsInviteExcepted("friend!f@isp.example") || ch.IsInviteExcepted("mallory!m@isp.example") {
+		t.Error("invite exception matched the wrong hostmasks")
+	}
+
+	if !ch.RemoveInviteException("friend") || ch.IsInviteExcepted("friend!f@isp.example") {
+		t.Error("invite exception not removed")
+	}
+}
+
+func TestRenameMember(t *testing.T) {
+	ch := New("#test")
+	log := logger.New()
+
+	op := client.NewMock(log)
+	op.SetNickname("alice")
+	voiced := client.NewMock(log)
+	voiced.SetNickname("bob")
+	ch.AddMember(op) // First member is opped
+	ch.AddMember(voiced)
+	ch.SetVoice(voiced, true)
+
+	op.SetNickname("alicia")
+	if !ch.RenameMember("alice", "alicia") {
+		t.Fatal("RenameMember failed for a member")
+	}
+	if !ch.HasMember(op) || !ch.IsOperator(op) {
+		t.Error("renamed member lost membership or operator status")
+	}
+	if ch.GetMemberByNick("alice") != nil || ch.GetMemberByNick("alicia") != op {
+		t.Error("member is still listed under the old nick")
+	}
+
+	voiced.SetNickname("robert")
+	ch.RenameMember("bob", "robert")
+	if !ch.IsVoiced(voiced) || ch.IsOperator(voiced) {
+		t.Error("voice did not follow the nick change")
+	}
+
+	if ch.RenameMember("nobody", "someone") {
+		t.Error("RenameMember succeeded for a non-member")
+	}
+}
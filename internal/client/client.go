@@ -4,7 +4,10 @@ import (
 	"bufio"
 	"fmt"
 	"net"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/supamanluva/ircd/internal/logger"
@@ -19,42 +22,85 @@ const (
 	WebSocket
 )
 
+// String returns the transport name
+func (t ConnectionType) String() string {
+	if t == WebSocket {
+		return "WebSocket"
+	}
+	return "TCP"
+}
+
+// droppedMessages counts lines dropped because a client's send queue was full
+var droppedMessages atomic.Uint64
+
+// DroppedMessages returns how many lines have been dropped for full send
+// queues since the server started, across all clients
+func DroppedMessages() uint64 {
+	return droppedMessages.Load()
+}
+
 // Client represents a connected IRC client
 type Client struct {
 	conn           net.Conn
+	reader         *bufio.Reader   // Kept across Receive calls so pipelined lines aren't lost
 	nickname       string
+	nickTS         int64           // When the nickname was set (unix seconds), compared on nick collisions
 	username       string
 	realname       string
 	hostname       string
+	ident          string          // Username confirmed by an ident lookup (empty if unverified)
 	uid            string          // Unique ID for server linking (TS6 format: SIDAAAAAA)
+	account        string          // Account the client is logged in to (empty if none)
+	password       string          // PASS given before registration
 	registered     bool
 	channels       map[string]bool // channel names the client has joined
 	modes          map[rune]bool   // user modes (o=operator, i=invisible, etc.)
+	snomasks       map[rune]bool   // server notice masks, used with user mode +s
 	awayMessage    string          // away message (empty if not away)
+	accepted       map[string]string // ACCEPT list for user mode +g, lowercased nick -> nick
+	callerIDNotice time.Time       // When we last told this +g user someone was blocked
+	caps           map[string]bool // Capabilities enabled with CAP REQ or PROTOCTL
+	capNegotiating bool            // CAP LS/REQ seen before registration; registration waits for CAP END
 	connType       ConnectionType
+	secure         bool            // Connected over TLS (plain or WebSocket)
 	lastActivity   time.Time
 	lastPing       time.Time
+	lastCommand    time.Time       // Last command other than PING/PONG
 	connectTime    time.Time       // When client connected
 	mu             sync.RWMutex
 	logger         *logger.Logger
 	sendQueue      chan string
+	paceLines      int             // Lines written per paceInterval (0 = no pacing)
+	paceInterval   time.Duration
+	paceMu         sync.Mutex
+	paced          []string        // Lines waiting for pacing, oldest first
+	paceWake       chan struct{}   // Tells the send worker lines were paced
+	sendDone       chan struct{}   // Closed when the send worker exits
 	disconnected   bool
 	rateLimiter    *security.RateLimiter
+	ctcpLimiter    *security.RateLimiter // Created on first CTCP query when CTCP limiting is enabled
+	joinPartLimiter *security.RateLimiter // Created on first JOIN/PART when channel hopping limiting is enabled
+	service        ServiceHandler  // Set for internal service pseudo-clients, which have no connection
 }
 
 // New creates a new client instance
 func New(conn net.Conn, log *logger.Logger) *Client {
 	c := &Client{
 		conn:         conn,
+		reader:       bufio.NewReader(conn),
 		hostname:     conn.RemoteAddr().String(),
 		channels:     make(map[string]bool),
 		modes:        make(map[rune]bool),
+		snomasks:     make(map[rune]bool),
 		connType:     TCP,
 		lastActivity: time.Now(),
 		lastPing:     time.Now(),
+		lastCommand:  time.Now(),
 		connectTime:  time.Now(),
 		logger:       log,
 		sendQueue:    make(chan string, 100),
+		paceWake:     make(chan struct{}, 1),
+		sendDone:     make(chan struct{}),
 		disconnected: false,
 		rateLimiter:  security.NewRateLimiter(5.0, 10.0), // 5 msg/sec, burst of 10
 	}
@@ -70,31 +116,178 @@ func (c *Client) Send(message string) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	if c.disconnected {
+	if c.disconnected || c.service != nil {
+		return
+	}
+
+	if c.paceLines > 0 {
+		c.queuePaced(message)
 		return
 	}
 
 	select {
 	case c.sendQueue <- message:
 	default:
+		droppedMessages.Add(1)
 		c.logger.Warn("Send queue full, dropping message", "client", c.nickname)
 	}
 }
 
-// sendWorker handles sending messages to the client
+// maxPacedBacklog is how many lines may wait for pacing before new ones are
+// dropped
+const maxPacedBacklog = 2000
+
+// pacedFlushTimeout bounds how long the paced backlog of a disconnecting
+// client is written for before its connection is closed
+const pacedFlushTimeout = 5 * time.Second
+
+// SetSendPacing limits how many lines are written to the client per
+// interval. Lines over the limit wait their turn instead of being dropped.
+// lines <= 0 disables pacing. Call it before the first Send.
+func (c *Client) SetSendPacing(lines int, interval time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if interval <= 0 {
+		lines = 0
+	}
+	c.paceLines = lines
+	c.paceInterval = interval
+}
+
+// getSendPacing returns the current pacing limit
+func (c *Client) getSendPacing() (int, time.Duration) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.paceLines, c.paceInterval
+}
+
+// queuePaced adds a line to the paced backlog and wakes the send worker
+func (c *Client) queuePaced(message string) {
+	c.paceMu.Lock()
+	if len(c.paced) >= maxPacedBacklog {
+		c.paceMu.Unlock()
+		droppedMessages.Add(1)
+		c.logger.Warn("Send backlog full, dropping message", "client", c.nickname)
+		return
+	}
+	c.paced = append(c.paced, message)
+	c.paceMu.Unlock()
+
+	select {
+	case c.paceWake <- struct{}{}:
+	default: // Already woken
+	}
+}
+
+// nextPaced returns the oldest paced line without removing it
+func (c *Client) nextPaced() (string, bool) {
+	c.paceMu.Lock()
+	defer c.paceMu.Unlock()
+	if len(c.paced) == 0 {
+		return "", false
+	}
+	return c.paced[0], true
+}
+
+// popPaced removes the oldest paced line
+func (c *Client) popPaced() {
+	c.paceMu.Lock()
+	defer c.paceMu.Unlock()
+	c.paced[0] = ""
+	c.paced = c.paced[1:]
+}
+
+// flushPaced writes what is left of the paced backlog, ignoring the rate,
+// for at most pacedFlushTimeout
+func (c *Client) flushPaced() {
+	deadline := time.Now().Add(pacedFlushTimeout)
+	c.conn.SetWriteDeadline(deadline)
+	for time.Now().Before(deadline) {
+		msg, ok := c.nextPaced()
+		if !ok {
+			return
+		}
+		if _, err := fmt.Fprintf(c.conn, "%s\r\n", msg); err != nil {
+			return
+		}
+		c.popPaced()
+	}
+}
+
+// sendPacer counts lines written in the current pacing window
+type sendPacer struct {
+	windowStart time.Time
+	sent        int
+}
+
+// delay returns how long to wait before the next line may be written
+func (p *sendPacer) delay(now time.Time, lines int, interval time.Duration) time.Duration {
+	if now.Sub(p.windowStart) >= interval {
+		p.windowStart = now
+		p.sent = 0
+	}
+	if p.sent < lines {
+		return 0
+	}
+	return interval - now.Sub(p.windowStart)
+}
+
+// writeLine writes one line to the connection
+func (c *Client) writeLine(msg string) bool {
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := fmt.Fprintf(c.conn, "%s\r\n", msg)
+	if err != nil {
+		c.logger.Error("Failed to send message", "error", err, "client", c.nickname)
+		return false
+	}
+	return true
+}
+
+// sendWorker handles sending messages to the client. Unpaced lines are
+// written as they are queued; paced lines are written no faster than the
+// configured rate.
 func (c *Client) sendWorker() {
 	defer func() {
 		if r := recover(); r != nil {
 			c.logger.Error("Panic in send worker", "error", r)
 		}
+		close(c.sendDone)
 	}()
 
-	for msg := range c.sendQueue {
-		c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-		_, err := fmt.Fprintf(c.conn, "%s\r\n", msg)
-		if err != nil {
-			c.logger.Error("Failed to send message", "error", err, "client", c.nickname)
-			return
+	var pacer sendPacer
+	var wake <-chan time.Time
+
+	for {
+		select {
+		case msg, ok := <-c.sendQueue:
+			if !ok {
+				c.flushPaced()
+				return
+			}
+			if !c.writeLine(msg) {
+				return
+			}
+		case <-c.paceWake:
+		case <-wake:
+			wake = nil
+		}
+
+		// Write as much of the paced backlog as the rate allows
+		for wake == nil {
+			msg, ok := c.nextPaced()
+			if !ok {
+				break
+			}
+			lines, interval := c.getSendPacing()
+			if wait := pacer.delay(time.Now(), lines, interval); wait > 0 {
+				wake = time.After(wait)
+				break
+			}
+			if !c.writeLine(msg) {
+				return
+			}
+			c.popPaced()
+			pacer.sent++
 		}
 	}
 }
@@ -103,9 +296,13 @@ func (c *Client) sendWorker() {
 func (c *Client) Receive() (string, error) {
 	c.mu.Lock()
 	c.lastActivity = time.Now()
+	if c.reader == nil {
+		c.reader = bufio.NewReader(c.conn)
+	}
+	reader := c.reader
 	c.mu.Unlock()
 
-	reader := bufio.NewReader(c.conn)
+	// Lines already buffered (pipelined commands) are returned without blocking
 	c.conn.SetReadDeadline(time.Now().Add(5 * time.Minute))
 	
 	line, err := reader.ReadString('\n')
@@ -129,6 +326,14 @@ func (c *Client) SetNickname(nick string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.nickname = nick
+	c.nickTS = time.Now().Unix()
+}
+
+// GetNickTS returns when the client's nickname was set, in unix seconds
+func (c *Client) GetNickTS() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.nickTS
 }
 
 // GetNickname returns the client's nickname
@@ -204,7 +409,30 @@ func (c *Client) Disconnect() {
 
 	c.disconnected = true
 	close(c.sendQueue)
-	c.conn.Close()
+	if c.conn == nil {
+		return
+	}
+	if c.paceLines == 0 {
+		c.conn.Close()
+		return
+	}
+
+	// Give the send worker time to write out the paced backlog first
+	conn := c.conn
+	go func() {
+		select {
+		case <-c.sendDone:
+		case <-time.After(pacedFlushTimeout):
+		}
+		conn.Close()
+	}()
+}
+
+// IsDisconnected reports whether Disconnect has been called
+func (c *Client) IsDisconnected() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.disconnected
 }
 
 // GetHostmask returns the client's hostmask (nick!user@host)
@@ -219,6 +447,54 @@ func (c *Client) CheckRateLimit() bool {
 	return c.rateLimiter.Allow()
 }
 
+// CheckCTCPRateLimit checks if the client may send another CTCP query.
+// The limiter is created on first use with the given rate and burst.
+func (c *Client) CheckCTCPRateLimit(rate, burst float64) bool {
+	c.mu.Lock()
+	if c.ctcpLimiter == nil {
+		c.ctcpLimiter = security.NewRateLimiter(rate, burst)
+	}
+	limiter := c.ctcpLimiter
+	c.mu.Unlock()
+	
+	return limiter.Allow()
+}
+
+// CheckJoinPartRateLimit checks if the client may join or part another
+// channel. JOIN and PART share one limiter, created on first use.
+func (c *Client) CheckJoinPartRateLimit(rate, burst float64) bool {
+	c.mu.Lock()
+	if c.joinPartLimiter == nil {
+		c.joinPartLimiter = security.NewRateLimiter(rate, burst)
+	}
+	limiter := c.joinPartLimiter
+	c.mu.Unlock()
+
+	return limiter.Allow()
+}
+
+// SetConnectionType records the client's transport and whether it uses TLS
+func (c *Client) SetConnectionType(connType ConnectionType, secure bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connType = connType
+	c.secure = secure
+}
+
+// GetConnectionType returns the client's transport
+func (c *Client) GetConnectionType() ConnectionType {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.connType
+}
+
+// IsSecure returns whether the client connected over TLS
+func (c *Client) IsSecure() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.secure
+}
+
 // GetLastActivity returns the time of last activity
 func (c *Client) GetLastActivity() time.Time {
 	c.mu.RLock()
@@ -240,6 +516,67 @@ func (c *Client) UpdatePingTime() {
 	c.lastPing = time.Now()
 }
 
+// UpdateCommandTime records that the client sent a command other than PING/PONG
+func (c *Client) UpdateCommandTime() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastCommand = time.Now()
+}
+
+// SetCap enables or disables a capability for the client
+func (c *Client) SetCap(name string, enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !enabled {
+		delete(c.caps, name)
+		return
+	}
+	if c.caps == nil {
+		c.caps = make(map[string]bool)
+	}
+	c.caps[name] = true
+}
+
+// HasCap reports whether the client enabled a capability
+func (c *Client) HasCap(name string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.caps[name]
+}
+
+// GetCaps returns the enabled capabilities, sorted
+func (c *Client) GetCaps() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	caps := make([]string, 0, len(c.caps))
+	for name := range c.caps {
+		caps = append(caps, name)
+	}
+	sort.Strings(caps)
+	return caps
+}
+
+// SetCapNegotiating marks whether registration waits for CAP END
+func (c *Client) SetCapNegotiating(negotiating bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.capNegotiating = negotiating
+}
+
+// IsCapNegotiating reports whether the client is still negotiating capabilities
+func (c *Client) IsCapNegotiating() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.capNegotiating
+}
+
+// GetLastCommand returns when the client last sent a command other than PING/PONG
+func (c *Client) GetLastCommand() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastCommand
+}
+
 // IsIdle checks if the client has been idle for too long
 func (c *Client) IsIdle(timeout time.Duration) bool {
 	c.mu.RLock()
@@ -277,21 +614,58 @@ func (c *Client) HasMode(mode rune) bool {
 	return c.modes[mode]
 }
 
-// GetModes returns a string representation of user modes
+// GetModes returns a string representation of user modes, in alphabetical order
 func (c *Client) GetModes() string {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	
-	modes := ""
-	for mode := range c.modes {
-		modes += string(mode)
-	}
+	modes := sortedModes(c.modes)
 	if modes == "" {
 		return ""
 	}
 	return "+" + modes
 }
 
+// SetSnomask sets or clears a server notice mask
+func (c *Client) SetSnomask(mask rune, enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if enabled {
+		c.snomasks[mask] = true
+	} else {
+		delete(c.snomasks, mask)
+	}
+}
+
+// HasSnomask checks if a user has a specific server notice mask
+func (c *Client) HasSnomask(mask rune) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.snomasks[mask]
+}
+
+// GetSnomasks returns the server notice masks (e.g. "+cfk"), or "" if none are set
+func (c *Client) GetSnomasks() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	
+	masks := sortedModes(c.snomasks)
+	if masks == "" {
+		return ""
+	}
+	return "+" + masks
+}
+
+// sortedModes returns the set mode letters in alphabetical order
+func sortedModes(modes map[rune]bool) string {
+	letters := make([]rune, 0, len(modes))
+	for mode := range modes {
+		letters = append(letters, mode)
+	}
+	sort.Slice(letters, func(i, j int) bool { return letters[i] < letters[j] })
+	return string(letters)
+}
+
 // IsServerOperator checks if the client is a server operator
 func (c *Client) IsServerOperator() bool {
 	return c.HasMode('o')
@@ -332,6 +706,34 @@ func (c *Client) GetUID() string {
 	return c.uid
 }
 
+// SetAccount sets the account the client is logged in to (empty = logged out)
+func (c *Client) SetAccount(account string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.account = account
+}
+
+// GetAccount returns the account the client is logged in to
+func (c *Client) GetAccount() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.account
+}
+
+// SetPassword records the password the client sent with PASS
+func (c *Client) SetPassword(password string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.password = password
+}
+
+// GetPassword returns the password the client sent with PASS
+func (c *Client) GetPassword() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.password
+}
+
 // GetUsername returns the client's username
 func (c *Client) GetUsername() string {
 	c.mu.RLock()
@@ -353,6 +755,89 @@ func (c *Client) GetHostname() string {
 	return c.hostname
 }
 
+// SetHostname replaces the client's hostname, e.g. with a resolved name
+func (c *Client) SetHostname(hostname string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hostname = hostname
+}
+
+// SetIdent records the username reported by the client's ident server
+func (c *Client) SetIdent(username string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ident = username
+}
+
+// GetIdent returns the ident-verified username, or "" if there is none
+func (c *Client) GetIdent() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ident
+}
+
+// AddAccept puts a nick on the client's ACCEPT list. It reports false if
+// the nick was already there.
+func (c *Client) AddAccept(nick string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := strings.ToLower(nick)
+	if _, ok := c.accepted[key]; ok {
+		return false
+	}
+	if c.accepted == nil {
+		c.accepted = make(map[string]string)
+	}
+	c.accepted[key] = nick
+	return true
+}
+
+// RemoveAccept takes a nick off the client's ACCEPT list. It reports false
+// if the nick wasn't on it.
+func (c *Client) RemoveAccept(nick string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := strings.ToLower(nick)
+	if _, ok := c.accepted[key]; !ok {
+		return false
+	}
+	delete(c.accepted, key)
+	return true
+}
+
+// IsAccepted checks if a nick is on the client's ACCEPT list
+func (c *Client) IsAccepted(nick string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.accepted[strings.ToLower(nick)]
+	return ok
+}
+
+// GetAcceptList returns the nicks on the client's ACCEPT list, sorted
+func (c *Client) GetAcceptList() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	nicks := make([]string, 0, len(c.accepted))
+	for _, nick := range c.accepted {
+		nicks = append(nicks, nick)
+	}
+	sort.Strings(nicks)
+	return nicks
+}
+
+// NotifyCallerID reports whether a +g user should be told about a blocked
+// message, which happens at most once per interval
+func (c *Client) NotifyCallerID(interval time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if now.Sub(c.callerIDNotice) < interval {
+		return false
+	}
+	c.callerIDNotice = now
+	return true
+}
+
 // GetIP returns the client's IP address
 func (c *Client) GetIP() string {
 	c.mu.RLock()
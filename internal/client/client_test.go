@@ -0,0 +1,155 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/supamanluva/ircd/internal/logger"
+)
+
+func TestReceivePipelinedCommands(t *testing.T) {
+	server, remote := net.Pipe()
+	defer server.Close()
+	defer remote.Close()
+
+	c := NewMock(logger.New())
+	c.SetConn(server)
+
+	// Three commands arrive in a single write
+	go remote.Write([]byte("NICK alice\r\nUSER alice 0 * :Alice\r\nJOIN #test\n"))
+
+	want := []string{"NICK alice", "USER alice 0 * :Alice", "JOIN #test"}
+	for i, expected := range want {
+		line, err := c.Receive()
+		if err != nil {
+			t.Fatalf("Receive %d failed: %v", i, err)
+		}
+		if line != expected {
+			t.Errorf("line %d = %q, want %q", i, line, expected)
+		}
+	}
+}
+
+func TestSendPacing(t *testing.T) {
+	server, remote := net.Pipe()
+	defer server.Close()
+	defer remote.Close()
+
+	const (
+		lines    = 20
+		interval = 50 * time.Millisecond
+		total    = 150 // More than the send queue holds
+	)
+
+	c := NewMock(logger.New())
+	c.SetConn(server)
+	c.SetSendPacing(lines, interval)
+	go c.sendWorker()
+
+	// Read concurrently: net.Pipe writes block until the other side reads
+	type arrival struct {
+		line string
+		at   time.Time
+	}
+	arrivals := make(chan arrival, total)
+	go func() {
+		reader := bufio.NewReader(remote)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				close(arrivals)
+				return
+			}
+			arrivals <- arrival{line, time.Now()}
+		}
+	}()
+
+	// The whole burst is queued at once; none of it may be dropped
+	for i := 0; i < total; i++ {
+		c.Send(fmt.Sprintf("line %d", i))
+	}
+
+	arrived := make([]time.Time, 0, total)
+	timeout := time.After(5 * time.Second)
+	for i := 0; i < total; i++ {
+		select {
+		case a, ok := <-arrivals:
+			if !ok {
+				t.Fatalf("connection closed after %d lines", i)
+			}
+			if want := fmt.Sprintf("line %d\r\n", i); a.line != want {
+				t.Fatalf("line %d = %q, want %q", i, a.line, want)
+			}
+			arrived = append(arrived, a.at)
+		case <-timeout:
+			t.Fatalf("only %d of %d lines delivered", i, total)
+		}
+	}
+
+	// No more than lines were written within any one interval
+	slack := 10 * time.Millisecond
+	for i := lines; i < total; i++ {
+		if gap := arrived[i].Sub(arrived[i-lines]); gap < interval-slack {
+			t.Fatalf("lines %d and %d arrived %v apart, want at least %v", i-lines, i, gap, interval)
+		}
+	}
+	if elapsed := arrived[total-1].Sub(arrived[0]); elapsed < (total/lines-1)*interval {
+		t.Errorf("burst delivered in %v, too fast for the configured rate", elapsed)
+	}
+}
+
+func TestDisconnectFlushesPacedBacklog(t *testing.T) {
+	server, remote := net.Pipe()
+	defer remote.Close()
+
+	c := NewMock(logger.New())
+	c.SetConn(server)
+	c.SetSendPacing(2, time.Hour)
+	go c.sendWorker()
+
+	const total = 10
+	for i := 0; i < total; i++ {
+		c.Send(fmt.Sprintf("line %d", i))
+	}
+	c.Disconnect()
+
+	// The backlog is written out at once and then the connection closes
+	done := make(chan int)
+	go func() {
+		n := 0
+		scanner := bufio.NewScanner(remote)
+		for scanner.Scan() {
+			n++
+		}
+		done <- n
+	}()
+	select {
+	case n := <-done:
+		if n != total {
+			t.Errorf("%d of %d lines written before close", n, total)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("connection not closed after flushing the backlog")
+	}
+}
+
+func TestDroppedMessagesCounter(t *testing.T) {
+	c := NewMock(logger.New())
+	before := DroppedMessages()
+
+	// Nothing drains a mock's queue, so sends past its capacity are dropped
+	capacity := cap(c.sendQueue)
+	for i := 0; i < capacity+5; i++ {
+		c.Send(fmt.Sprintf("line %d", i))
+	}
+
+	if got := DroppedMessages() - before; got != 5 {
+		t.Errorf("dropped messages grew by %d, want 5", got)
+	}
+	if got := len(c.SentMessages()); got != capacity {
+		t.Errorf("queued %d messages, want %d", got, capacity)
+	}
+}
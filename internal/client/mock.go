@@ -2,6 +2,7 @@ package client
 
 import (
 	"net"
+	"time"
 
 	"github.com/supamanluva/ircd/internal/logger"
 )
@@ -13,9 +14,15 @@ func NewMock(log *logger.Logger) *Client {
 		hostname:     "test.host",
 		channels:     make(map[string]bool),
 		modes:        make(map[rune]bool),
+		snomasks:     make(map[rune]bool),
 		connType:     TCP,
+		lastActivity: time.Now(),
+		lastCommand:  time.Now(),
+		connectTime:  time.Now(),
 		logger:       log,
 		sendQueue:    make(chan string, 100),
+		paceWake:     make(chan struct{}, 1),
+		sendDone:     make(chan struct{}),
 		disconnected: false,
 	}
 }
@@ -25,4 +32,21 @@ func (c *Client) SetConn(conn net.Conn) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.conn = conn
+	c.reader = nil
+}
+
+// SentMessages drains and returns the messages queued for a mock client
+func (c *Client) SentMessages() []string {
+	var msgs []string
+	for {
+		select {
+		case msg, ok := <-c.sendQueue:
+			if !ok {
+				return msgs // Closed by Disconnect
+			}
+			msgs = append(msgs, msg)
+		default:
+			return msgs
+		}
+	}
 }
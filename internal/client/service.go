@@ -0,0 +1,50 @@
+package client
+
+import (
+	"time"
+
+	"github.com/supamanluva/ircd/internal/logger"
+)
+
+// ServiceHandler handles a PRIVMSG sent to a service pseudo-client such as
+// NickServ. service is the pseudo-client itself, from the sender.
+type ServiceHandler func(service, from *Client, message string)
+
+// NewService creates an internal service client with no network connection.
+// It is registered under nick and its PRIVMSGs go to handler; anything else
+// sent to it is discarded.
+func NewService(nick, host string, handler ServiceHandler, log *logger.Logger) *Client {
+	return &Client{
+		nickname:     nick,
+		username:     "services",
+		realname:     nick + " service",
+		hostname:     host,
+		registered:   true,
+		channels:     make(map[string]bool),
+		modes:        make(map[rune]bool),
+		snomasks:     make(map[rune]bool),
+		connType:     TCP,
+		lastActivity: time.Now(),
+		lastCommand:  time.Now(),
+		connectTime:  time.Now(),
+		logger:       log,
+		sendQueue:    make(chan string, 1),
+		paceWake:     make(chan struct{}, 1),
+		service:      handler,
+	}
+}
+
+// IsService reports whether the client is an internal service pseudo-client
+func (c *Client) IsService() bool {
+	return c.service != nil
+}
+
+// HandleServiceMessage passes a PRIVMSG from another client to the service's
+// handler. It reports false if c is not a service.
+func (c *Client) HandleServiceMessage(from *Client, message string) bool {
+	if c.service == nil {
+		return false
+	}
+	c.service(c, from, message)
+	return true
+}
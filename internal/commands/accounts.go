@@ -0,0 +1,137 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/supamanluva/ircd/internal/client"
+)
+
+// stickyUserModes are the user modes remembered for an account between sessions
+const stickyUserModes = "iw"
+
+// AccountStore persists per-account settings across sessions
+type AccountStore interface {
+	// StickyModes returns the user modes and snomasks saved for an account
+	StickyModes(account string) (modes, snomasks string)
+	// SaveStickyModes records the user modes and snomasks to restore on the next login
+	SaveStickyModes(account, modes, snomasks string)
+	// NickOwner returns the account a nickname is reserved to, or ""
+	NickOwner(nick string) string
+	// ReserveNick reserves a nickname to an account
+	ReserveNick(account, nick string)
+}
+
+// savedModes is what a MemoryAccountStore remembers for one account
+type savedModes struct {
+	modes    string
+	snomasks string
+}
+
+// MemoryAccountStore is an AccountStore kept in memory for the life of the process
+type MemoryAccountStore struct {
+	mu    sync.Mutex
+	modes map[string]savedModes // keyed by lower-cased account name
+	nicks map[string]string     // lower-cased nickname -> owning account
+}
+
+// NewMemoryAccountStore creates an empty in-memory account store
+func NewMemoryAccountStore() *MemoryAccountStore {
+	return &MemoryAccountStore{
+		modes: make(map[string]savedModes),
+		nicks: make(map[string]string),
+	}
+}
+
+// StickyModes returns the user modes and snomasks saved for an account
+func (s *MemoryAccountStore) StickyModes(account string) (modes, snomasks string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved := s.modes[strings.ToLower(account)]
+	return saved.modes, saved.snomasks
+}
+
+// SaveStickyModes records the user modes and snomasks to restore on the next login
+func (s *MemoryAccountStore) SaveStickyModes(account, modes, snomasks string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.modes[strings.ToLower(account)] = savedModes{modes: modes, snomasks: snomasks}
+}
+
+// NickOwner returns the account a nickname is reserved to, or ""
+func (s *MemoryAccountStore) NickOwner(nick string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nicks[strings.ToLower(nick)]
+}
+
+// ReserveNick reserves a nickname to an account
+func (s *MemoryAccountStore) ReserveNick(account, nick string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nicks[strings.ToLower(nick)] = account
+}
+
+// SetAccountStore replaces the store used to remember per-account settings
+func (h *Handler) SetAccountStore(store AccountStore) {
+	h.accounts = store
+}
+
+// LoginAccount logs a client in to an account and reapplies the sticky user
+// modes saved for it by an earlier session
+func (h *Handler) LoginAccount(c *client.Client, account string) {
+	c.SetAccount(account)
+	h.protectNick(c)
+
+	modes, _ := h.accounts.StickyModes(account)
+	var changes modeChanges
+	for _, m := range modes {
+		if strings.ContainsRune(stickyUserModes, m) && !c.HasMode(m) {
+			c.SetMode(m, true)
+			changes.add(true, m)
+		}
+	}
+	if applied := changes.String(); applied != "" {
+		c.Send(fmt.Sprintf(":%s MODE %s :%s", c.GetHostmask(), c.GetNickname(), applied))
+	}
+}
+
+// saveStickyModes remembers a logged-in client's sticky modes and snomasks
+func (h *Handler) saveStickyModes(c *client.Client) {
+	account := c.GetAccount()
+	if account == "" {
+		return
+	}
+
+	var modes strings.Builder
+	for _, m := range stickyUserModes {
+		if c.HasMode(m) {
+			modes.WriteRune(m)
+		}
+	}
+	// Snomasks only change while opered; dropping +o keeps the saved set
+	_, snomasks := h.accounts.StickyModes(account)
+	if c.HasMode('s') {
+		snomasks = strings.TrimPrefix(c.GetSnomasks(), "+")
+	} else if c.HasMode('o') {
+		snomasks = ""
+	}
+	h.accounts.SaveStickyModes(account, modes.String(), snomasks)
+}
+
+// restoreSnomasks turns on the server notices an operator's account had
+// selected in an earlier session
+func (h *Handler) restoreSnomasks(c *client.Client) {
+	account := c.GetAccount()
+	if account == "" || c.HasMode('s') {
+		return
+	}
+	_, snomasks := h.accounts.StickyModes(account)
+	if snomasks == "" {
+		return
+	}
+	applySnomasks(c, "+"+snomasks)
+	c.SetMode('s', true)
+	c.Send(fmt.Sprintf(":%s MODE %s :+s", c.GetHostmask(), c.GetNickname()))
+}
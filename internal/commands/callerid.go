@@ -0,0 +1,126 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/supamanluva/ircd/internal/client"
+	"github.com/supamanluva/ircd/internal/parser"
+)
+
+// callerIDNotifyInterval is how often a +g user is told that someone tried
+// to message them
+const callerIDNotifyInterval = time.Minute
+
+// handleAccept handles the ACCEPT command
+// ACCEPT <nick>[,-<nick>...] adds nicks to (or with -, removes them from) the
+// users allowed to message a +g user; ACCEPT * lists them
+func (h *Handler) handleAccept(c *client.Client, msg *parser.Message) error {
+	if msg.GetParam(0) == "*" {
+		for _, nick := range c.GetAcceptList() {
+			h.sendNumeric(c, RPL_ACCEPTLIST, nick)
+		}
+		h.sendNumeric(c, RPL_ENDOFACCEPT, ":End of /ACCEPT list.")
+		return nil
+	}
+
+	for _, nick := range strings.Split(msg.GetParam(0), ",") {
+		if nick, remove := strings.CutPrefix(nick, "-"); remove {
+			if nick != "" && !c.RemoveAccept(nick) {
+				h.sendNumeric(c, ERR_ACCEPTNOT, nick+" :is not on your accept list")
+			}
+			continue
+		}
+		if nick == "" {
+			continue
+		}
+
+		current := h.currentNick(nick)
+		if current == "" {
+			h.sendNumeric(c, ERR_NOSUCHNICK, nick+" :No such nick/channel")
+			continue
+		}
+		nick = current
+		if c.IsAccepted(nick) {
+			h.sendNumeric(c, ERR_ACCEPTEXIST, nick+" :is already on your accept list")
+			continue
+		}
+		if len(c.GetAcceptList()) >= h.opts.MaxAccept {
+			h.sendNumeric(c, ERR_ACCEPTFULL, ":Accept list is full")
+			continue
+		}
+		c.AddAccept(nick)
+	}
+	return nil
+}
+
+// ForgetAccepted takes nick off every local ACCEPT list. It is called when
+// the user holding the nick quits or changes it, so that whoever takes the
+// nick next isn't let through.
+func (h *Handler) ForgetAccepted(nick string) {
+	for _, c := range h.clients.GetClients() {
+		c.RemoveAccept(nick)
+	}
+}
+
+// currentNick returns nick as spelled by the local or remote user using it,
+// or "" if nobody is
+func (h *Handler) currentNick(nick string) string {
+	if target := h.clients.GetClient(nick); target != nil {
+		return target.GetNickname()
+	}
+	if h.router != nil {
+		if user, ok := h.router.GetRemoteUserByNick(nick); ok {
+			return user.Nick
+		}
+	}
+	return ""
+}
+
+// CallerIDAllows reports whether a message from nick (user@host) may be
+// delivered to target. A +g target only hears from users on its ACCEPT list
+// and is told, at most once per callerIDNotifyInterval, about the others.
+func (h *Handler) CallerIDAllows(target *client.Client, nick, userhost string) bool {
+	allowed, _ := h.callerID(target, nick, userhost)
+	return allowed
+}
+
+// callerID is CallerIDAllows, also reporting whether target was notified
+func (h *Handler) callerID(target *client.Client, nick, userhost string) (allowed, notified bool) {
+	if !target.HasMode('g') || target.IsAccepted(nick) {
+		return true, false
+	}
+	if target.NotifyCallerID(callerIDNotifyInterval) {
+		h.sendNumeric(target, RPL_UMODEGMSG, fmt.Sprintf("%s %s :is messaging you, and you have umode +g.", nick, userhost))
+		notified = true
+	}
+	return false, notified
+}
+
+// allowPrivate checks caller ID for a private message from c to target,
+// telling c when it is blocked. Operators are never blocked. NOTICEs get no
+// reply so that they can't start a loop.
+func (h *Handler) allowPrivate(c, target *client.Client, cmdType string) bool {
+	// A +g sender accepts whoever they message so that replies get through
+	targetNick := target.GetNickname()
+	if c.HasMode('g') && !c.IsAccepted(targetNick) && len(c.GetAcceptList()) < h.opts.MaxAccept {
+		c.AddAccept(targetNick)
+	}
+	if c == target || c.HasMode('o') {
+		return true
+	}
+
+	allowed, notified := h.callerID(target, c.GetNickname(), c.GetUsername()+"@"+c.GetHostname())
+	if allowed {
+		return true
+	}
+	if cmdType == "PRIVMSG" {
+		h.sendNumeric(c, RPL_TARGUMODEG, targetNick+" :is in +g mode (server-side ignore.)")
+		if notified {
+			h.sendNumeric(c, RPL_TARGNOTIFY, targetNick+" :has been informed that you messaged them.")
+		}
+	}
+	h.logger.Debug("Message blocked by caller ID", "from", c.GetNickname(), "to", targetNick)
+	return false
+}
@@ -0,0 +1,115 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/supamanluva/ircd/internal/client"
+	"github.com/supamanluva/ircd/internal/parser"
+)
+
+// Capabilities offered in CAP LS
+const (
+	capMultiPrefix     = "multi-prefix"      // NAMES lists every status prefix
+	capUserhostInNames = "userhost-in-names" // NAMES lists nick!user@host
+	capMessageTags     = "message-tags"      // Client-only (+) tags are relayed with messages
+	capStandardReplies = "standard-replies"  // FAIL/WARN/NOTE replace some numerics and notices
+)
+
+// supportedCaps lists the capabilities offered in CAP LS, in order
+var supportedCaps = []string{capReadMarker, capMultiPrefix, capUserhostInNames, capMessageTags, capStandardReplies}
+
+// offeredCaps returns the capabilities offered in CAP LS, leaving out those
+// disabled in the options
+func (h *Handler) offeredCaps() []string {
+	offered := make([]string, 0, len(supportedCaps))
+	for _, name := range supportedCaps {
+		if name == capStandardReplies && h.opts.NoStandardReplies {
+			continue
+		}
+		offered = append(offered, name)
+	}
+	return offered
+}
+
+// protoctlTokens maps the PROTOCTL extensions older clients send to the
+// capability they enable: NAMESX is multi-prefix, UHNAMES userhost-in-names
+var protoctlTokens = map[string]string{
+	"NAMESX":  capMultiPrefix,
+	"UHNAMES": capUserhostInNames,
+}
+
+// handleProtoctl enables extensions for clients that don't negotiate
+// capabilities. Unknown tokens are ignored.
+func (h *Handler) handleProtoctl(c *client.Client, msg *parser.Message) error {
+	for _, param := range msg.Params {
+		for _, token := range strings.Fields(param) {
+			if capName, ok := protoctlTokens[strings.ToUpper(token)]; ok {
+				c.SetCap(capName, true)
+			}
+		}
+	}
+	return nil
+}
+
+// handleCap handles capability negotiation (CAP LS, LIST, REQ and END).
+// LS or REQ before registration holds registration until CAP END.
+func (h *Handler) handleCap(c *client.Client, msg *parser.Message) error {
+	nick := c.GetNickname()
+	if nick == "" {
+		nick = "*"
+	}
+	reply := func(sub, caps string) {
+		c.Send(fmt.Sprintf(":%s CAP %s %s :%s", h.serverName, nick, sub, caps))
+	}
+
+	subcommand := strings.ToUpper(msg.GetParam(0))
+	switch subcommand {
+	case "LS":
+		if !c.IsRegistered() {
+			c.SetCapNegotiating(true)
+		}
+		reply("LS", strings.Join(h.offeredCaps(), " "))
+	case "LIST":
+		reply("LIST", strings.Join(c.GetCaps(), " "))
+	case "REQ":
+		if !c.IsRegistered() {
+			c.SetCapNegotiating(true)
+		}
+		requested := msg.GetParam(1)
+		changes := strings.Fields(requested)
+		// The request is applied all or nothing
+		for _, change := range changes {
+			if !h.isOfferedCap(strings.TrimPrefix(change, "-")) {
+				reply("NAK", requested)
+				return nil
+			}
+		}
+		for _, change := range changes {
+			name, disable := strings.CutPrefix(change, "-")
+			c.SetCap(name, !disable)
+		}
+		reply("ACK", requested)
+	case "END":
+		if c.IsRegistered() || !c.IsCapNegotiating() {
+			return nil
+		}
+		c.SetCapNegotiating(false)
+		if err := h.tryRegister(c); err != nil {
+			return err
+		}
+	default:
+		h.sendNumeric(c, ERR_INVALIDCAPCMD, subcommand+" :Invalid CAP command")
+	}
+	return nil
+}
+
+// isOfferedCap reports whether a capability is offered in CAP LS
+func (h *Handler) isOfferedCap(name string) bool {
+	for _, supported := range h.offeredCaps() {
+		if name == supported {
+			return true
+		}
+	}
+	return false
+}
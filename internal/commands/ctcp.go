@@ -0,0 +1,100 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/supamanluva/ircd/internal/client"
+)
+
+// serverVersion is the real version, reported unless overridden by Options.Version
+const serverVersion = "ircd-0.1.0"
+
+// ctcpDelim frames CTCP messages inside PRIVMSG/NOTICE text
+const ctcpDelim = "\x01"
+
+// parseCTCP extracts the command and arguments from a \x01-framed CTCP message.
+// The closing delimiter is optional, as many clients omit it.
+func parseCTCP(message string) (command, args string, ok bool) {
+	if len(message) < 2 || !strings.HasPrefix(message, ctcpDelim) {
+		return "", "", false
+	}
+
+	body := strings.TrimSuffix(message[1:], ctcpDelim)
+	command, args, _ = strings.Cut(body, " ")
+	if command == "" {
+		return "", "", false
+	}
+
+	return strings.ToUpper(command), args, true
+}
+
+// replyCTCP answers a CTCP query addressed to the server itself
+func (h *Handler) replyCTCP(c *client.Client, command, args string) {
+	var reply string
+	switch command {
+	case "VERSION":
+		reply = h.advertisedVersion(c)
+	case "PING":
+		reply = args
+	case "TIME":
+		reply = time.Now().Format(time.RFC1123)
+	case "CLIENTINFO":
+		reply = "CLIENTINFO PING TIME VERSION"
+	default:
+		command, reply = "ERRMSG", command+" :Unknown query"
+	}
+
+	c.Send(fmt.Sprintf(":%s NOTICE %s :%s%s %s%s", h.serverName, c.GetNickname(), ctcpDelim, command, reply, ctcpDelim))
+}
+
+// noticePair counts CTCP reply NOTICEs exchanged between two users
+type noticePair struct {
+	windowStart time.Time
+	count       int
+}
+
+// noticePairKey identifies two users regardless of direction
+func noticePairKey(a, b string) string {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	if a > b {
+		a, b = b, a
+	}
+	return a + " " + b
+}
+
+// isNoticeLoop reports whether a CTCP reply NOTICE from one user to another
+// should be dropped because the pair exceeded NoticeLoopLimit replies
+// (in either direction) within NoticeLoopWindow, which is what two bots
+// auto-replying to each other look like
+func (h *Handler) isNoticeLoop(from, to, message string) bool {
+	if h.opts.NoticeLoopLimit <= 0 {
+		return false
+	}
+	if _, _, ok := parseCTCP(message); !ok {
+		return false
+	}
+
+	now := time.Now()
+	h.noticeMu.Lock()
+	defer h.noticeMu.Unlock()
+	if h.noticePairs == nil {
+		h.noticePairs = make(map[string]*noticePair)
+	}
+
+	key := noticePairKey(from, to)
+	pair := h.noticePairs[key]
+	if pair == nil || now.Sub(pair.windowStart) >= h.opts.NoticeLoopWindow {
+		// Forget pairs that went quiet while we're here
+		for k, p := range h.noticePairs {
+			if now.Sub(p.windowStart) >= h.opts.NoticeLoopWindow {
+				delete(h.noticePairs, k)
+			}
+		}
+		pair = &noticePair{windowStart: now}
+		h.noticePairs[key] = pair
+	}
+	pair.count++
+	return pair.count > h.opts.NoticeLoopLimit
+}
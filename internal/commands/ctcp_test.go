@@ -0,0 +1,144 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/supamanluva/ircd/internal/client"
+	"github.com/supamanluva/ircd/internal/logger"
+	"github.com/supamanluva/ircd/internal/parser"
+)
+
+func TestParseCTCP(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		command string
+		args    string
+		ok      bool
+	}{
+		{"Version", "\x01VERSION\x01", "VERSION", "", true},
+		{"Ping with args", "\x01PING 12345\x01", "PING", "12345", true},
+		{"Action", "\x01ACTION waves\x01", "ACTION", "waves", true},
+		{"Lowercase unterminated", "\x01time", "TIME", "", true},
+		{"Plain text", "hello", "", "", false},
+		{"Empty CTCP", "\x01\x01", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			command, args, ok := parseCTCP(tt.message)
+			if command != tt.command || args != tt.args || ok != tt.ok {
+				t.Errorf("parseCTCP(%q) = (%q, %q, %v), want (%q, %q, %v)",
+					tt.message, command, args, ok, tt.command, tt.args, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCTCPServerReplies(t *testing.T) {
+	log := logger.New()
+	handler := New("testserver", log, newMockClientRegistry(), newMockChannelRegistry(), nil)
+	handler.SetOptions(Options{CTCPReplies: true})
+
+	c := client.NewMock(log)
+	c.SetNickname("alice")
+	c.SetRegistered(true)
+
+	msg, _ := parser.Parse("PRIVMSG testserver :\x01VERSION\x01")
+	handler.handlePrivmsg(c, msg)
+
+	sent := strings.Join(c.SentMessages(), "\n")
+	want := ":testserver NOTICE alice :\x01VERSION " + serverVersion + "\x01"
+	if !strings.Contains(sent, want) {
+		t.Errorf("expected %q, got %q", want, sent)
+	}
+
+	// With replies disabled the server name is just an unknown nick
+	handler.SetOptions(Options{})
+	handler.handlePrivmsg(c, msg)
+	if sent := strings.Join(c.SentMessages(), "\n"); !strings.Contains(sent, " "+ERR_NOSUCHNICK+" ") {
+		t.Errorf("expected ERR_NOSUCHNICK with replies disabled, got %q", sent)
+	}
+}
+
+func TestCTCPFloodThrottled(t *testing.T) {
+	log := logger.New()
+	clientReg := newMockClientRegistry()
+	handler := New("testserver", log, clientReg, newMockChannelRegistry(), nil)
+	handler.SetOptions(Options{CTCPRate: 0.001, CTCPBurst: 2})
+
+	alice := client.NewMock(log)
+	alice.SetNickname("alice")
+	alice.SetRegistered(true)
+
+	bob := client.NewMock(log)
+	bob.SetNickname("bob")
+	bob.SetRegistered(true)
+	clientReg.AddClient(bob)
+
+	msg, _ := parser.Parse("PRIVMSG bob :\x01VERSION\x01")
+	for i := 0; i < 5; i++ {
+		handler.handlePrivmsg(alice, msg)
+	}
+	if got := len(bob.SentMessages()); got != 2 {
+		t.Errorf("bob received %d CTCP queries, want 2", got)
+	}
+
+	// Ordinary messages and ACTIONs are not counted as CTCP queries
+	for _, text := range []string{"PRIVMSG bob :hello", "PRIVMSG bob :\x01ACTION waves\x01"} {
+		msg, _ = parser.Parse(text)
+		handler.handlePrivmsg(alice, msg)
+	}
+	if got := len(bob.SentMessages()); got != 2 {
+		t.Errorf("bob received %d plain messages, want 2", got)
+	}
+}
+
+func TestNoticeLoopThrottled(t *testing.T) {
+	log := logger.New()
+
+	for _, enabled := range []bool{false, true} {
+		clientReg := newMockClientRegistry()
+		handler := New("testserver", log, clientReg, newMockChannelRegistry(), nil)
+		if enabled {
+			handler.SetOptions(Options{NoticeLoopLimit: 4, NoticeLoopWindow: time.Minute})
+		}
+
+		newBot := func(nick string) *client.Client {
+			c := client.NewMock(log)
+			c.SetNickname(nick)
+			c.SetRegistered(true)
+			clientReg.AddClient(c)
+			return c
+		}
+		botA, botB := newBot("botA"), newBot("botB")
+
+		// Two bots answering each other's CTCP replies
+		for i := 0; i < 5; i++ {
+			msg, _ := parser.Parse("NOTICE botB :\x01PING 1\x01")
+			handler.handleNotice(botA, msg)
+			msg, _ = parser.Parse("NOTICE botA :\x01PING 1\x01")
+			handler.handleNotice(botB, msg)
+		}
+
+		wantEach := 5
+		if enabled {
+			wantEach = 2 // 4 replies for the pair, whichever side sends them
+		}
+		if got := len(botB.SentMessages()); got != wantEach {
+			t.Errorf("enabled=%v: botB received %d replies, want %d", enabled, got, wantEach)
+		}
+		if got := len(botA.SentMessages()); got != wantEach {
+			t.Errorf("enabled=%v: botA received %d replies, want %d", enabled, got, wantEach)
+		}
+
+		// Plain notices between the pair are never dropped
+		msg, _ := parser.Parse("NOTICE botB :hello")
+		handler.handleNotice(botA, msg)
+		if got := len(botB.SentMessages()); got != 1 {
+			t.Errorf("enabled=%v: plain NOTICE not delivered", enabled)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/supamanluva/ircd/internal/channel"
+	"github.com/supamanluva/ircd/internal/client"
+)
+
+// revealMember announces a member whose JOIN was held back by +D (delayed
+// join) to the rest of the channel and to linked servers. It is called
+// before anything they do becomes visible (speaking, TOPIC, MODE), when they
+// gain status or are kicked, and for everyone still hidden when +D is
+// removed.
+func (h *Handler) revealMember(ch *channel.Channel, c *client.Client) {
+	if !ch.IsHidden(c) {
+		return
+	}
+	ch.SetHidden(c, false)
+	ch.Broadcast(fmt.Sprintf(":%s JOIN %s", c.GetHostmask(), ch.GetName()), c)
+	h.propagateJoin(c, ch.GetName())
+}
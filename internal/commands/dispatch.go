@@ -0,0 +1,122 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/supamanluva/ircd/internal/client"
+	"github.com/supamanluva/ircd/internal/parser"
+)
+
+// commandEntry is a dispatch table entry
+type commandEntry struct {
+	fn          CommandFunc
+	requiresReg bool // Reply ERR_NOTREGISTERED before calling fn for unregistered clients
+	minParams   int  // Reply ERR_NEEDMOREPARAMS if fewer parameters are given
+	core        bool // Built-in command
+}
+
+// registerBuiltins fills the dispatch table with the built-in commands.
+// NICK, PRIVMSG, NOTICE and WHOIS have a minimum of 0 because they answer
+// missing parameters with their own numerics (431, 411, 412).
+func (h *Handler) registerBuiltins() {
+	builtins := map[string]commandEntry{
+		"NICK":      {fn: h.handleNick},
+		"USER":      {fn: h.handleUser, minParams: 4},
+		"PING":      {fn: h.handlePing, minParams: 1},
+		"PONG":      {fn: h.handlePong},
+		"QUIT":      {fn: h.handleQuit},
+		"JOIN":      {fn: h.handleJoin, requiresReg: true, minParams: 1},
+		"PART":      {fn: h.handlePart, requiresReg: true, minParams: 1},
+		"PRIVMSG":   {fn: h.handlePrivmsg, requiresReg: true},
+		"NOTICE":    {fn: h.handleNotice, requiresReg: true},
+		"WALLCHOPS": {fn: h.handleWallchops, requiresReg: true, minParams: 2},
+		"WALLOPS":   {fn: h.handleWallops, requiresReg: true, minParams: 1},
+		"NAMES":     {fn: h.handleNames, requiresReg: true},
+		"TOPIC":     {fn: h.handleTopic, requiresReg: true, minParams: 1},
+		"MODE":      {fn: h.handleMode, requiresReg: true, minParams: 1},
+		"KICK":      {fn: h.handleKick, requiresReg: true, minParams: 2},
+		"WHO":       {fn: h.handleWho, requiresReg: true, minParams: 1},
+		"WHOIS":     {fn: h.handleWhois, requiresReg: true},
+		"WHOWAS":    {fn: h.handleWhowas, requiresReg: true, minParams: 1},
+		"ACCEPT":    {fn: h.handleAccept, requiresReg: true, minParams: 1},
+		"LIST":      {fn: h.handleList, requiresReg: true},
+		"INVITE":    {fn: h.handleInvite, requiresReg: true},
+		"OPER":      {fn: h.handleOper, requiresReg: true, minParams: 2},
+		"PASS":      {fn: h.handlePass, minParams: 1},
+		"LOCKDOWN":  {fn: h.handleLockdown, requiresReg: true},
+		"AWAY":      {fn: h.handleAway, requiresReg: true},
+		"USERHOST":  {fn: h.handleUserhost, requiresReg: true, minParams: 1},
+		"VERSION":   {fn: h.handleVersion, requiresReg: true},
+		"LUSERS":    {fn: h.handleLusers, requiresReg: true},
+		"MOTD":      {fn: h.handleMotd, requiresReg: true},
+		"ISON":      {fn: h.handleIson, requiresReg: true, minParams: 1},
+		"SQUIT":     {fn: h.handleSquit, requiresReg: true, minParams: 1},
+		"LINKS":     {fn: h.handleLinks, requiresReg: true},
+		"SAJOIN":    {fn: h.handleSajoin, requiresReg: true, minParams: 2},
+		"SAPART":    {fn: h.handleSapart, requiresReg: true, minParams: 2},
+		"CLEARBANS": {fn: h.handleClearbans, requiresReg: true, minParams: 1},
+		"OMODE":     {fn: h.handleOmode, requiresReg: true, minParams: 2},
+		"PROTOCTL":  {fn: h.handleProtoctl, minParams: 1},
+		"CAP":       {fn: h.handleCap, minParams: 1},
+		"STATS":     {fn: h.handleStats, requiresReg: true},
+		"MARKREAD":  {fn: h.handleMarkread, requiresReg: true},
+	}
+
+	h.commands = make(map[string]commandEntry, len(builtins))
+	for name, entry := range builtins {
+		entry.core = true
+		h.commands[name] = entry
+	}
+}
+
+// RegisterCommand adds a custom command to the dispatch table. Built-in
+// commands can only be replaced after AllowCommandOverride(true).
+func (h *Handler) RegisterCommand(name string, fn CommandFunc, requiresReg bool) error {
+	if name == "" || fn == nil {
+		return fmt.Errorf("command name and function are required")
+	}
+	name = strings.ToUpper(name)
+
+	h.cmdMu.Lock()
+	defer h.cmdMu.Unlock()
+
+	if existing, ok := h.commands[name]; ok && existing.core && !h.allowOverride {
+		return fmt.Errorf("cannot override built-in command %s", name)
+	}
+
+	h.commands[name] = commandEntry{fn: fn, requiresReg: requiresReg}
+	return nil
+}
+
+// AllowCommandOverride controls whether RegisterCommand may replace built-in commands
+func (h *Handler) AllowCommandOverride(allow bool) {
+	h.cmdMu.Lock()
+	defer h.cmdMu.Unlock()
+	h.allowOverride = allow
+}
+
+// dispatch runs the handler registered for msg.Command
+func (h *Handler) dispatch(c *client.Client, msg *parser.Message) error {
+	h.cmdMu.RLock()
+	entry, ok := h.commands[msg.Command]
+	h.cmdMu.RUnlock()
+
+	if !ok {
+		// Unknown command
+		h.sendNumeric(c, ERR_UNKNOWNCOMMAND, msg.Command+" :Unknown command")
+		return nil
+	}
+
+	if entry.requiresReg && !c.IsRegistered() {
+		h.sendNumeric(c, ERR_NOTREGISTERED, ":You have not registered")
+		return nil
+	}
+
+	if len(msg.Params) < entry.minParams {
+		h.sendNumeric(c, ERR_NEEDMOREPARAMS, msg.Command+" :Not enough parameters")
+		return nil
+	}
+
+	return entry.fn(c, msg)
+}
@@ -0,0 +1,86 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/supamanluva/ircd/internal/channel"
+	"github.com/supamanluva/ircd/internal/client"
+)
+
+// rankModes maps member ranks back to the status mode that grants them
+var rankModes = map[int]rune{
+	channel.RankVoice:  'v',
+	channel.RankHalfop: 'h',
+	channel.RankOp:     'o',
+	channel.RankAdmin:  'a',
+	channel.RankOwner:  'q',
+}
+
+// heldStatus is a channel status kept for an account that disconnected
+type heldStatus struct {
+	rank int
+	left time.Time
+}
+
+// graceKey identifies an account's status in one channel
+func graceKey(account, channelName string) string {
+	return strings.ToLower(account) + " " + strings.ToLower(channelName)
+}
+
+// holdStatus remembers the channel status of a logged-in client that is
+// disconnecting, so it can be restored if they rejoin within StatusGrace
+func (h *Handler) holdStatus(c *client.Client, ch *channel.Channel) {
+	account := c.GetAccount()
+	if h.opts.StatusGrace <= 0 || account == "" {
+		return
+	}
+	rank := ch.GetRank(c)
+	if rank == channel.RankNone {
+		return
+	}
+
+	h.graceMu.Lock()
+	defer h.graceMu.Unlock()
+	if h.heldStatus == nil {
+		h.heldStatus = make(map[string]heldStatus)
+	}
+	now := time.Now()
+	h.pruneHeldStatus(now)
+	h.heldStatus[graceKey(account, ch.GetName())] = heldStatus{rank: rank, left: now}
+}
+
+// pruneHeldStatus drops statuses whose grace period is over; callers must
+// hold graceMu
+func (h *Handler) pruneHeldStatus(now time.Time) {
+	for key, held := range h.heldStatus {
+		if now.Sub(held.left) > h.opts.StatusGrace {
+			delete(h.heldStatus, key)
+		}
+	}
+}
+
+// restoreStatus re-grants a held channel status to a returning account
+func (h *Handler) restoreStatus(c *client.Client, ch *channel.Channel) {
+	account := c.GetAccount()
+	if h.opts.StatusGrace <= 0 || account == "" {
+		return
+	}
+
+	key := graceKey(account, ch.GetName())
+	h.graceMu.Lock()
+	held, ok := h.heldStatus[key]
+	delete(h.heldStatus, key)
+	h.graceMu.Unlock()
+
+	if !ok || time.Since(held.left) > h.opts.StatusGrace || ch.GetRank(c) >= held.rank {
+		return
+	}
+
+	mode := rankModes[held.rank]
+	h.revealMember(ch, c)
+	setMemberStatus(ch, c, mode, true)
+	ch.BroadcastAll(fmt.Sprintf(":%s MODE %s +%c %s", h.serverName, ch.GetName(), mode, c.GetNickname()))
+	h.logger.Info("Restored channel status after reconnect", "nickname", c.GetNickname(), "account", account, "channel", ch.GetName(), "mode", string(mode))
+}
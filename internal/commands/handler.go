@@ -1,8 +1,12 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -12,8 +16,13 @@ import (
 	"github.com/supamanluva/ircd/internal/linking"
 	"github.com/supamanluva/ircd/internal/logger"
 	"github.com/supamanluva/ircd/internal/parser"
+	"github.com/supamanluva/ircd/internal/security"
 )
 
+// ErrCloseLink is returned by a command handler that has sent the client a
+// closing ERROR; the connection should be dropped
+var ErrCloseLink = errors.New("closing link")
+
 // Handler processes IRC commands
 type Handler struct {
 	serverName string
@@ -22,6 +31,36 @@ type Handler struct {
 	channels   ChannelRegistry
 	operators  map[string]string // name -> bcrypt password hash
 	router     MessageRouter     // Message router for server linking (Phase 7.4)
+	opts       Options           // Tunable behaviour (limits, policies)
+	accounts   AccountStore      // Per-account settings kept between sessions
+	logins     map[string]Account // Lower-cased name -> configured account, for NickServ IDENTIFY
+
+	cmdMu         sync.RWMutex
+	commands      map[string]commandEntry // Dispatch table, keyed by upper-case command
+	allowOverride bool                    // RegisterCommand may replace built-in commands
+
+	luserMu        sync.Mutex
+	maxLocalUsers  int // Peak local user count seen by LUSERS
+	maxGlobalUsers int // Peak network user count seen by LUSERS
+
+	graceMu    sync.Mutex
+	heldStatus map[string]heldStatus // account+channel -> status kept for StatusGrace
+
+	markers readMarkers // MARKREAD positions per account or session
+	whowas  whowasHistory // Recently departed users for WHOWAS
+
+	noticeMu    sync.Mutex
+	noticePairs map[string]*noticePair // CTCP reply NOTICEs per user pair, for NoticeLoopLimit
+
+	nickMu     sync.Mutex
+	nickTimers map[*client.Client]*time.Timer // Pending renames of unauthenticated users of reserved nicks
+	guestSeq   atomic.Uint64                  // Last number used for a guest nick
+
+	lockdown atomic.Bool // Only operators may register (LOCKDOWN)
+
+	operMu            sync.Mutex
+	operFailsByClient map[*client.Client]*operFailures // Failed OPER attempts per connection
+	operFailsByIP     map[string]*operFailures         // Failed OPER attempts per IP
 }
 
 // ClientRegistry interface for managing clients
@@ -29,7 +68,10 @@ type ClientRegistry interface {
 	GetClient(nickname string) *client.Client
 	AddClient(c *client.Client) error
 	RemoveClient(c *client.Client)
+	RenameClient(oldNick, newNick string) error
 	IsNicknameInUse(nickname string) bool
+	GetClientsByAccount(account string) []*client.Client
+	GetClients() []*client.Client
 }
 
 // ChannelRegistry interface for managing channels
@@ -37,6 +79,8 @@ type ChannelRegistry interface {
 	GetChannel(name string) *channel.Channel
 	CreateChannel(name string) *channel.Channel
 	RemoveChannel(name string)
+	GetChannels() []*channel.Channel
+	ListChannels() []*channel.Channel // All channels sorted by name, for LIST
 }
 
 // MessageRouter interface for routing messages to remote servers (Phase 7.4)
@@ -65,8 +109,16 @@ type MessageRouter interface {
 	PropagateTopic(nick, user, host, uid, channel, topic string, ts int64) error
 	// PropagateKick propagates a KICK to remote servers (Phase 7.4.4)
 	PropagateKick(nick, user, host, uid, channel, target, reason string) error
+	// PropagateServerMode propagates a MODE change made by this server itself
+	PropagateServerMode(channel, modeString string, ts int64) error
+	// PropagateServerKick propagates a KICK made by this server itself
+	PropagateServerKick(channel, target, reason string) error
 	// PropagateInvite propagates an INVITE to remote servers (Phase 7.4.4)
 	PropagateInvite(nick, user, host, uid, target, channel string) error
+	// PropagateWallops sends an operator's WALLOPS to remote servers
+	PropagateWallops(nick, user, host, uid, text string) error
+	// PropagateAway tells remote servers a user is away ("" when back)
+	PropagateAway(uid, message string) error
 	
 	// PropagateUser propagates a new user registration to remote servers
 	PropagateUser(nick, user, host, uid, realname string, ts int64) error
@@ -75,9 +127,28 @@ type MessageRouter interface {
 	GetRemoteChannel(name string) (*linking.RemoteChannel, bool)
 	// GetRemoteUserByUID gets a remote user by UID (for NAMES list)
 	GetRemoteUserByUID(uid string) (*linking.RemoteUser, bool)
+	// GetRemoteUserByNick gets a remote user by nickname (for ISON/USERHOST)
+	GetRemoteUserByNick(nick string) (*linking.RemoteUser, bool)
+	// GetRemoteUserCount returns how many users are on linked servers (for LUSERS)
+	GetRemoteUserCount() int
+	// GetRemoteOperCount returns how many operators are on linked servers (for LUSERS)
+	GetRemoteOperCount() int
 	
 	// DisconnectServer disconnects a linked server (Phase 7.4.5)
 	DisconnectServer(serverName, reason string) error
+	
+	// GetLinkedServers returns all servers known to the network (for LINKS)
+	GetLinkedServers() []*linking.Server
+	// GetServerUplink returns the server a remote server is linked behind,
+	// or nil if it is linked to us directly
+	GetServerUplink(srv *linking.Server) *linking.Server
+	
+	// RouteSajoin asks a remote user's server to force them into a channel
+	// on behalf of the operator with UID operUID
+	RouteSajoin(operUID, targetNick, channel string) error
+	// RouteSapart asks a remote user's server to force them out of a channel
+	// on behalf of the operator with UID operUID
+	RouteSapart(operUID, targetNick, channel, reason string) error
 }
 
 // CommandFunc is the signature for command handler functions
@@ -97,14 +168,19 @@ func New(serverName string, log *logger.Logger, clients ClientRegistry, channels
 		operMap[op.Name] = op.Password
 	}
 	
-	return &Handler{
+	h := &Handler{
 		serverName: serverName,
 		logger:     log,
 		clients:    clients,
 		channels:   channels,
 		operators:  operMap,
 		router:     nil, // Will be set by SetRouter if linking is enabled
+		opts:       DefaultOptions(),
+		accounts:   NewMemoryAccountStore(),
 	}
+	h.registerBuiltins()
+	
+	return h
 }
 
 // SetRouter sets the message router for server linking (Phase 7.4)
@@ -121,56 +197,25 @@ func (h *Handler) Handle(c *client.Client, msg *parser.Message) error {
 	h.logger.Debug("Handling command", "command", msg.Command, "client", c.GetNickname())
 
 	// Route to appropriate handler
-	switch msg.Command {
-	case "NICK":
-		return h.handleNick(c, msg)
-	case "USER":
-		return h.handleUser(c, msg)
-	case "PING":
-		return h.handlePing(c, msg)
-	case "PONG":
-		return h.handlePong(c, msg)
-	case "JOIN":
-		return h.handleJoin(c, msg)
-	case "PART":
-		return h.handlePart(c, msg)
-	case "PRIVMSG":
-		return h.handlePrivmsg(c, msg)
-	case "NOTICE":
-		return h.handleNotice(c, msg)
-	case "NAMES":
-		return h.handleNames(c, msg)
-	case "TOPIC":
-		return h.handleTopic(c, msg)
-	case "MODE":
-		return h.handleMode(c, msg)
-	case "KICK":
-		return h.handleKick(c, msg)
-	case "QUIT":
-		return h.handleQuit(c, msg)
-	case "WHO":
-		return h.handleWho(c, msg)
-	case "WHOIS":
-		return h.handleWhois(c, msg)
-	case "LIST":
-		return h.handleList(c, msg)
-	case "INVITE":
-		return h.handleInvite(c, msg)
-	case "OPER":
-		return h.handleOper(c, msg)
-	case "AWAY":
-		return h.handleAway(c, msg)
-	case "USERHOST":
-		return h.handleUserhost(c, msg)
-	case "ISON":
-		return h.handleIson(c, msg)
-	case "SQUIT":
-		return h.handleSquit(c, msg)
-	default:
-		// Unknown command
-		h.sendNumeric(c, ERR_UNKNOWNCOMMAND, msg.Command+" :Unknown command")
-		return nil
+	return h.dispatch(c, msg)
+}
+
+// HandleMalformed answers a line the parser rejected with ERR_UNKNOWNCOMMAND
+func (h *Handler) HandleMalformed(c *client.Client, msg *parser.Message) {
+	// Echo only printable characters of the offending command
+	cmd := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, msg.Command)
+	if len(cmd) > 32 {
+		cmd = cmd[:32]
+	}
+	if cmd == "" {
+		cmd = "*"
 	}
+	h.sendNumeric(c, ERR_UNKNOWNCOMMAND, cmd+" :Unknown command")
 }
 
 // sendNumeric sends a numeric reply to the client
@@ -188,13 +233,22 @@ func (h *Handler) sendWelcome(c *client.Client) {
 	h.sendNumeric(c, RPL_WELCOME, fmt.Sprintf(":Welcome to the Internet Relay Network %s", c.GetHostmask()))
 	
 	// 002 RPL_YOURHOST
-	h.sendNumeric(c, RPL_YOURHOST, fmt.Sprintf(":Your host is %s, running version ircd-0.1.0", h.serverName))
+	h.sendNumeric(c, RPL_YOURHOST, fmt.Sprintf(":Your host is %s, running version %s", h.serverName, h.advertisedVersion(c)))
 	
 	// 003 RPL_CREATED
 	h.sendNumeric(c, RPL_CREATED, ":This server was created just now")
 	
 	// 004 RPL_MYINFO
-	h.sendNumeric(c, RPL_MYINFO, fmt.Sprintf("%s ircd-0.1.0 o o", h.serverName))
+	h.sendNumeric(c, RPL_MYINFO, fmt.Sprintf("%s %s o %s", h.serverName, h.advertisedVersion(c), channelModeChars))
+	
+	// 005 RPL_ISUPPORT
+	h.sendISupport(c)
+	
+	// 251-255, 265, 266 LUSERS
+	h.sendLusers(c)
+	
+	// 375, 372, 376 MOTD (or 422)
+	h.sendMotd(c)
 	
 	h.logger.Info("Client registered", "nickname", nick, "hostmask", c.GetHostmask())
 }
@@ -223,82 +277,27 @@ func (h *Handler) handleNick(c *client.Client, msg *parser.Message) error {
 
 	oldNick := c.GetNickname()
 	
-	// If changing nickname (already registered), update the registry map
-	if c.IsRegistered() && oldNick != "" && oldNick != newNick {
-		// Remove old nickname from registry
-		h.clients.RemoveClient(c)
-	}
-	
-	c.SetNickname(newNick)
-	
-	// If changing nickname (already registered), add with new nickname
+	// If changing nickname (already registered), re-key the registry and
+	// channel memberships
 	if c.IsRegistered() && oldNick != "" && oldNick != newNick {
-		if err := h.clients.AddClient(c); err != nil {
-			h.logger.Warn("Failed to re-add client with new nickname", "error", err, "oldNick", oldNick, "newNick", newNick)
-			// Try to restore old nickname if registration fails
-			c.SetNickname(oldNick)
-			h.clients.AddClient(c)
+		if err := h.renameClient(c, oldNick, newNick); err != nil {
+			h.logger.Warn("Failed to rename client", "error", err, "oldNick", oldNick, "newNick", newNick)
 			h.sendNumeric(c, ERR_NICKNAMEINUSE, newNick+" :Nickname is already in use")
 			return nil
 		}
+	} else {
+		c.SetNickname(newNick)
 	}
 
 	// If client is already registered, broadcast the nick change
 	if c.IsRegistered() && oldNick != "" {
-		// Notify the client and all channels they're in
-		notification := fmt.Sprintf(":%s NICK :%s", oldNick, newNick)
-		c.Send(notification)
-		
-		// Broadcast to all channels
-		for _, channelName := range c.GetChannels() {
-			if ch := h.channels.GetChannel(channelName); ch != nil {
-				ch.Broadcast(notification, c)
-			}
-		}
-		
-		// Propagate NICK to remote servers (Phase 7.4.3)
-		if h.router != nil {
-			parts := strings.SplitN(c.GetHostmask(), "!", 2)
-			user := ""
-			host := ""
-			if len(parts) == 2 {
-				userhost := strings.SplitN(parts[1], "@", 2)
-				if len(userhost) == 2 {
-					user = userhost[0]
-					host = userhost[1]
-				}
-			}
-			
-			uid := c.GetUID()
-			if uid == "" {
-				uid = newNick
-			}
-			
-			if err := h.router.PropagateNick(oldNick, newNick, user, host, uid, time.Now().Unix()); err != nil {
-				h.logger.Debug("Failed to propagate NICK", "error", err)
-			}
-		}
-	}
-
-	// Check if client should be registered now
-	h.tryRegister(c)
-	
-	// If client just became registered, add them to the registry (for UID assignment and propagation)
-	if c.IsRegistered() && oldNick == "" {
-		h.logger.Info("Attempting to add newly registered client", "nick", newNick, "isRegistered", c.IsRegistered(), "oldNick", oldNick)
-		if err := h.clients.AddClient(c); err != nil {
-			h.logger.Warn("Failed to add client to registry - nickname collision detected", "error", err, "nick", newNick)
-			// Nickname collision during registration - force disconnect
-			c.SetRegistered(false)
-			c.Send(fmt.Sprintf(":%s %s %s :Nickname collision detected during registration", 
-				h.serverName, ERR_NICKNAMEINUSE, newNick))
-			return fmt.Errorf("nickname collision")
-		} else {
-			h.logger.Info("Successfully added client to registry", "nick", newNick)
-		}
+		h.announceNickChange(c, oldNick, newNick)
+		h.protectNick(c)
 	}
 
-	return nil
+	// Check if client should be registered now (this also adds them to the
+	// registry)
+	return h.tryRegister(c)
 }
 
 // handleUser handles the USER command
@@ -315,26 +314,31 @@ func (h *Handler) handleUser(c *client.Client, msg *parser.Message) error {
 		return nil
 	}
 
-	username := msg.GetParam(0)
-	realname := msg.GetParam(3)
+	// Usernames not confirmed by an ident lookup are marked unverified (~)
+	username := security.SanitizeUsername(msg.GetParam(0))
+	if username == "" {
+		h.sendNumeric(c, ERR_INVALIDUSERNAME, "USER :Invalid username")
+		return nil
+	}
+	if ident := security.SanitizeUsername(c.GetIdent()); ident != "" {
+		username = security.TruncateString(ident, h.opts.UserLen)
+	} else {
+		username = security.TruncateString("~"+username, h.opts.UserLen)
+	}
+	realname := security.SanitizeRealname(msg.GetParam(3))
 
 	c.SetUsername(username, realname)
 
-	// Check if client should be registered now
-	wasRegistered := c.IsRegistered()
-	h.tryRegister(c)
-	
-	// If client just became registered, add them to the registry (for UID assignment and propagation)
-	if !wasRegistered && c.IsRegistered() {
-		h.logger.Info("Attempting to add newly registered client from USER", "nick", c.GetNickname(), "user", username)
-		if err := h.clients.AddClient(c); err != nil {
-			h.logger.Warn("Failed to add client to registry", "error", err, "nick", c.GetNickname())
-		} else {
-			h.logger.Info("Successfully added client to registry from USER", "nick", c.GetNickname())
-		}
+	// RFC 2812 mode bitmask: bit 2 (4) requests +w, bit 3 (8) requests +i.
+	// Anything else, including RFC 1459 hostnames, is ignored.
+	if bits, err := strconv.Atoi(msg.GetParam(1)); err == nil {
+		c.SetMode('w', bits&4 != 0)
+		c.SetMode('i', bits&8 != 0)
 	}
 
-	return nil
+	// Check if client should be registered now (this also adds them to the
+	// registry)
+	return h.tryRegister(c)
 }
 
 // handlePing handles the PING command
@@ -370,11 +374,32 @@ func (h *Handler) handleQuit(c *client.Client, msg *parser.Message) error {
 
 	h.logger.Info("Client quit", "nickname", c.GetNickname(), "message", quitMsg)
 
+	h.QuitClient(c, quitMsg)
+
+	// Send ERROR to client
+	c.Send(fmt.Sprintf("ERROR :Closing Link: %s (%s)", c.GetHostmask(), quitMsg))
+
+	return fmt.Errorf("client quit: %s", quitMsg)
+}
+
+// QuitClient removes a client from all its channels, telling the other
+// members and linked servers that it quit. It is used by QUIT and when the
+// server drops a connection; the caller sends the closing ERROR.
+func (h *Handler) QuitClient(c *client.Client, quitMsg string) {
+	h.rememberQuit(c)
+	h.ForgetAccepted(c.GetNickname())
+	h.markers.forget(c)
+	h.cancelNickEnforcement(c)
+
 	// Broadcast quit to all channels
 	quitNotice := fmt.Sprintf(":%s QUIT :%s", c.GetHostmask(), quitMsg)
 	for _, channelName := range c.GetChannels() {
+		c.PartChannel(channelName)
 		if ch := h.channels.GetChannel(channelName); ch != nil {
-			ch.Broadcast(quitNotice, c)
+			h.holdStatus(c, ch)
+			if !ch.IsHidden(c) {
+				ch.Broadcast(quitNotice, c)
+			}
 			ch.RemoveMember(c)
 			// Remove empty channels
 			if ch.IsEmpty() {
@@ -405,11 +430,6 @@ func (h *Handler) handleQuit(c *client.Client, msg *parser.Message) error {
 			h.logger.Debug("Failed to propagate QUIT", "error", err)
 		}
 	}
-
-	// Send ERROR to client
-	c.Send(fmt.Sprintf("ERROR :Closing Link: %s (%s)", c.GetHostmask(), quitMsg))
-
-	return fmt.Errorf("client quit: %s", quitMsg)
 }
 
 // handleJoin handles the JOIN command
@@ -443,11 +463,40 @@ func (h *Handler) handleJoin(c *client.Client, msg *parser.Message) error {
 			continue
 		}
 
+		// Joins and parts share a per-client budget against channel hopping
+		if existing := h.channels.GetChannel(channelName); (existing == nil || !existing.HasMember(c)) && !h.allowJoinPart(c, "join", channelName) {
+			continue
+		}
+
 		// Get or create channel
 		ch := h.channels.CreateChannel(channelName)
 
-		// Check if already a member
+		// Already a member: ignore it, or resend the topic and names so a
+		// confused client can resync
 		if ch.HasMember(c) {
+			if h.opts.ResyncDuplicateJoin {
+				h.sendTopic(c, ch)
+				h.sendNamesList(c, ch)
+			}
+			continue
+		}
+
+		// Check bans; a matching exception (+e) lets the user in anyway
+		if ch.IsBannedClient(c) && !ch.IsExcepted(c.GetHostmask()) {
+			h.sendNumeric(c, ERR_BANNEDFROMCHAN, channelName+" :Cannot join channel (+b)")
+			continue
+		}
+
+		// Recently kicked users wait out the kick cooldown
+		if wait := ch.KickCooldown(c.GetUsername()+"@"+c.GetHostname(), time.Now()); wait > 0 {
+			seconds := int((wait + time.Second - 1) / time.Second)
+			h.sendNumeric(c, ERR_BANNEDFROMCHAN, fmt.Sprintf("%s :Cannot join channel (kicked, try again in %d seconds)", channelName, seconds))
+			continue
+		}
+
+		// Invite-only channels need an unexpired invite or a matching +I
+		if ch.HasMode('i') && !ch.IsInvited(c.GetNickname()) && !ch.IsInviteExcepted(c.GetHostmask()) {
+			h.sendNumeric(c, ERR_INVITEONLYCHAN, channelName+" :Cannot join channel (+i)")
 			continue
 		}
 
@@ -464,55 +513,91 @@ func (h *Handler) handleJoin(c *client.Client, msg *parser.Message) error {
 			}
 		}
 
-		// Add client to channel
-		ch.AddMember(c)
-		c.JoinChannel(channelName)
+		// Full channels (+l) take no more members
+		if limit := ch.GetLimit(); limit > 0 && ch.GetMemberCount() >= limit {
+			h.sendNumeric(c, ERR_CHANNELISFULL, channelName+" :Cannot join channel (+l)")
+			continue
+		}
+
+		// Check join throttle if +j mode is set
+		if ch.HasMode('j') && !ch.AllowJoin() {
+			h.sendNumeric(c, ERR_CHANNELISFULL, channelName+" :Cannot join channel (+j), too many joins, try again later")
+			continue
+		}
+
+		h.joinChannel(c, ch)
+	}
+
+	return nil
+}
+
+// joinChannel adds a client to a channel, announces the JOIN locally and to
+// remote servers, and sends the topic and NAMES list. Callers must have
+// already checked any join restrictions.
+func (h *Handler) joinChannel(c *client.Client, ch *channel.Channel) {
+	channelName := ch.GetName()
+
+	// Add client to channel; joining uses up any invite
+	ch.AddMember(c)
+	c.JoinChannel(channelName)
+	ch.RemoveInvite(c.GetNickname())
 
-		h.logger.Info("Client joined channel", "nickname", c.GetNickname(), "channel", channelName)
+	h.logger.Info("Client joined channel", "nickname", c.GetNickname(), "channel", channelName)
 
-		// Send JOIN confirmation to the client
-		joinMsg := fmt.Sprintf(":%s JOIN %s", c.GetHostmask(), channelName)
-		c.Send(joinMsg)
+	// Send JOIN confirmation to the client
+	joinMsg := fmt.Sprintf(":%s JOIN %s", c.GetHostmask(), channelName)
+	c.Send(joinMsg)
 
-		// Broadcast JOIN to other members
+	// Broadcast JOIN to other members and links; under +D it waits until
+	// they speak
+	if ch.HasMode('D') {
+		ch.SetHidden(c, true)
+	} else {
 		ch.Broadcast(joinMsg, c)
-		
-		// Propagate JOIN to remote servers (Phase 7.4.3)
-		if h.router != nil {
-			parts := strings.SplitN(c.GetHostmask(), "!", 2)
-			user := ""
-			host := ""
-			if len(parts) == 2 {
-				userhost := strings.SplitN(parts[1], "@", 2)
-				if len(userhost) == 2 {
-					user = userhost[0]
-					host = userhost[1]
-				}
-			}
-			
-			uid := c.GetUID()
-			if uid == "" {
-				uid = c.GetNickname() // Fallback if no UID
-			}
-			
-			if err := h.router.PropagateJoin(c.GetNickname(), user, host, uid, channelName, time.Now().Unix()); err != nil {
-				h.logger.Debug("Failed to propagate JOIN", "error", err, "channel", channelName)
+		h.propagateJoin(c, channelName)
+		// Remote servers learn status from MODE only, including the
+		// operator status of whoever created the channel
+		if ch.GetMemberCount() == 1 && ch.IsOperator(c) && h.router != nil {
+			if err := h.router.PropagateServerMode(channelName, "+o "+c.GetNickname(), time.Now().Unix()); err != nil {
+				h.logger.Debug("Failed to propagate creator status", "error", err, "channel", channelName)
 			}
 		}
+	}
 
-		// Send topic if it exists
-		topic := ch.GetTopic()
-		if topic != "" {
-			h.sendNumeric(c, RPL_TOPIC, fmt.Sprintf("%s :%s", channelName, topic))
-		} else {
-			h.sendNumeric(c, RPL_NOTOPIC, fmt.Sprintf("%s :No topic is set", channelName))
-		}
+	// Returning account holders get back the status they had
+	h.restoreStatus(c, ch)
 
-		// Send NAMES list
-		h.sendNamesList(c, ch)
-	}
+	// Send topic if it exists
+	h.sendTopic(c, ch)
 
-	return nil
+	// Send NAMES list
+	h.sendNamesList(c, ch)
+}
+
+// propagateJoin tells remote servers that c joined a channel (Phase 7.4.3)
+func (h *Handler) propagateJoin(c *client.Client, channelName string) {
+	if h.router == nil {
+		return
+	}
+	parts := strings.SplitN(c.GetHostmask(), "!", 2)
+	user := ""
+	host := ""
+	if len(parts) == 2 {
+		userhost := strings.SplitN(parts[1], "@", 2)
+		if len(userhost) == 2 {
+			user = userhost[0]
+			host = userhost[1]
+		}
+	}
+	
+	uid := c.GetUID()
+	if uid == "" {
+		uid = c.GetNickname() // Fallback if no UID
+	}
+	
+	if err := h.router.PropagateJoin(c.GetNickname(), user, host, uid, channelName, time.Now().Unix()); err != nil {
+		h.logger.Debug("Failed to propagate JOIN", "error", err, "channel", channelName)
+	}
 }
 
 // handlePart handles the PART command
@@ -551,46 +636,83 @@ func (h *Handler) handlePart(c *client.Client, msg *parser.Message) error {
 			continue
 		}
 
-		h.logger.Info("Client left channel", "nickname", c.GetNickname(), "channel", channelName)
+		if !h.allowJoinPart(c, "part", channelName) {
+			continue
+		}
+
+		h.partChannel(c, ch, partMsg)
+	}
+
+	return nil
+}
+
+// allowJoinPart reports whether the client may join or part another channel
+// under the JoinPartRate limit, telling them to slow down when they may not.
+// IRC operators are exempt.
+func (h *Handler) allowJoinPart(c *client.Client, action, channelName string) bool {
+	if h.opts.JoinPartRate <= 0 || c.HasMode('o') {
+		return true
+	}
+	if c.CheckJoinPartRateLimit(h.opts.JoinPartRate, h.opts.JoinPartBurst) {
+		return true
+	}
+	h.logger.Warn("Channel hopping throttled", "client", c.GetNickname(), "channel", channelName, "action", action)
+	description := fmt.Sprintf("Cannot %s %s: you are joining and parting channels too fast, slow down", action, channelName)
+	if !h.sendStandardReply(c, replyFail, strings.ToUpper(action), codeRateLimited, description, channelName) {
+		c.Send(fmt.Sprintf(":%s NOTICE %s :*** %s", h.serverName, c.GetNickname(), description))
+	}
+	return false
+}
+
+// partChannel removes a client from a channel with a PART message, announcing
+// it locally and to remote servers, and drops the channel once empty
+func (h *Handler) partChannel(c *client.Client, ch *channel.Channel, partMsg string) {
+	channelName := ch.GetName()
+
+	h.logger.Info("Client left channel", "nickname", c.GetNickname(), "channel", channelName)
 
-		// Send PART to everyone including the client
-		partNotice := fmt.Sprintf(":%s PART %s :%s", c.GetHostmask(), channelName, partMsg)
+	// Send PART to everyone including the client; nobody else saw a member
+	// still hidden by +D join
+	partNotice := fmt.Sprintf(":%s PART %s :%s", c.GetHostmask(), channelName, partMsg)
+	hidden := ch.IsHidden(c)
+	if hidden {
+		c.Send(partNotice)
+	} else {
 		ch.BroadcastAll(partNotice)
+	}
 
-		// Remove client from channel
-		ch.RemoveMember(c)
-		c.PartChannel(channelName)
-		
-		// Propagate PART to remote servers (Phase 7.4.3)
-		if h.router != nil {
-			parts := strings.SplitN(c.GetHostmask(), "!", 2)
-			user := ""
-			host := ""
-			if len(parts) == 2 {
-				userhost := strings.SplitN(parts[1], "@", 2)
-				if len(userhost) == 2 {
-					user = userhost[0]
-					host = userhost[1]
-				}
-			}
-			
-			uid := c.GetUID()
-			if uid == "" {
-				uid = c.GetNickname()
-			}
-			
-			if err := h.router.PropagatePart(c.GetNickname(), user, host, uid, channelName, partMsg); err != nil {
-				h.logger.Debug("Failed to propagate PART", "error", err, "channel", channelName)
+	// Remove client from channel
+	ch.RemoveMember(c)
+	c.PartChannel(channelName)
+	
+	// Propagate PART to remote servers (Phase 7.4.3), which only heard of
+	// the JOIN if the member was revealed
+	if h.router != nil && !hidden {
+		parts := strings.SplitN(c.GetHostmask(), "!", 2)
+		user := ""
+		host := ""
+		if len(parts) == 2 {
+			userhost := strings.SplitN(parts[1], "@", 2)
+			if len(userhost) == 2 {
+				user = userhost[0]
+				host = userhost[1]
 			}
 		}
-
-		// Remove empty channels
-		if ch.IsEmpty() {
-			h.channels.RemoveChannel(channelName)
+		
+		uid := c.GetUID()
+		if uid == "" {
+			uid = c.GetNickname()
+		}
+		
+		if err := h.router.PropagatePart(c.GetNickname(), user, host, uid, channelName, partMsg); err != nil {
+			h.logger.Debug("Failed to propagate PART", "error", err, "channel", channelName)
 		}
 	}
 
-	return nil
+	// Remove empty channels
+	if ch.IsEmpty() {
+		h.channels.RemoveChannel(channelName)
+	}
 }
 
 // handlePrivmsg handles the PRIVMSG command
@@ -603,6 +725,57 @@ func (h *Handler) handleNotice(c *client.Client, msg *parser.Message) error {
 	return h.handleMessage(c, msg, "NOTICE")
 }
 
+// handleWallchops handles the WALLCHOPS command
+// WALLCHOPS <channel> :<text> sends a NOTICE to the channel's operators
+func (h *Handler) handleWallchops(c *client.Client, msg *parser.Message) error {
+	if !c.IsRegistered() {
+		h.sendNumeric(c, ERR_NOTREGISTERED, ":You have not registered")
+		return nil
+	}
+
+	if !msg.HasParam(1) {
+		h.sendNumeric(c, ERR_NEEDMOREPARAMS, "WALLCHOPS :Not enough parameters")
+		return nil
+	}
+
+	channelName := msg.GetParam(0)
+	text := msg.GetParam(1)
+
+	ch := h.channels.GetChannel(channelName)
+	if ch == nil {
+		h.sendNumeric(c, ERR_NOSUCHCHANNEL, channelName+" :No such channel")
+		return nil
+	}
+
+	if !ch.HasMember(c) {
+		h.sendNumeric(c, ERR_NOTONCHANNEL, channelName+" :You're not on that channel")
+		return nil
+	}
+
+	h.SendWallchops(ch, c.GetHostmask(), text, c)
+
+	// Operators on other servers get it from their own server
+	if h.router != nil {
+		if err := h.router.RouteChannelMessage(c.GetNickname(), c.GetUsername(), c.GetHostname(), ch.GetName(), text, "WALLCHOPS"); err != nil {
+			h.logger.Debug("Failed to route WALLCHOPS", "error", err, "channel", channelName)
+		}
+	}
+
+	h.logger.Debug("WALLCHOPS", "from", c.GetNickname(), "channel", channelName)
+	return nil
+}
+
+// SendWallchops delivers a WALLCHOPS from source to the local operators of
+// ch other than except
+func (h *Handler) SendWallchops(ch *channel.Channel, source, text string, except *client.Client) {
+	notice := fmt.Sprintf(":%s NOTICE @%s :%s", source, ch.GetName(), text)
+	for _, member := range ch.GetMembers() {
+		if member != except && ch.GetRank(member) >= channel.RankOp {
+			member.Send(notice)
+		}
+	}
+}
+
 // handleMessage is a common handler for PRIVMSG and NOTICE
 func (h *Handler) handleMessage(c *client.Client, msg *parser.Message, cmdType string) error {
 	// Check if registered
@@ -625,6 +798,26 @@ func (h *Handler) handleMessage(c *client.Client, msg *parser.Message, cmdType s
 	target := msg.GetParam(0)
 	message := msg.GetParam(1)
 
+	// Client-only tags go along to recipients that understand them
+	tags, ok := h.relayedTags(c, msg)
+	if !ok {
+		return nil
+	}
+
+	// CTCP queries may be throttled and, when addressed to us, answered directly
+	if cmdType == "PRIVMSG" {
+		if command, args, ok := parseCTCP(message); ok && command != "ACTION" {
+			if h.opts.CTCPRate > 0 && !c.CheckCTCPRateLimit(h.opts.CTCPRate, h.opts.CTCPBurst) {
+				h.logger.Warn("CTCP flood throttled", "client", c.GetNickname(), "target", target, "ctcp", command)
+				return nil
+			}
+			if h.opts.CTCPReplies && strings.EqualFold(target, h.serverName) {
+				h.replyCTCP(c, command, args)
+				return nil
+			}
+		}
+	}
+
 	// Check if target is a channel
 	if isValidChannelName(target) {
 		ch := h.channels.GetChannel(target)
@@ -645,9 +838,47 @@ func (h *Handler) handleMessage(c *client.Client, msg *parser.Message, cmdType s
 			return nil
 		}
 
+		// Quieted (~q:mask) users may not speak unless voiced or above
+		if ch.IsQuieted(c) && ch.GetRank(c) < channel.RankVoice {
+			h.sendNumeric(c, ERR_CANNOTSENDTOCHAN, target+" :Cannot send to channel (you are quieted)")
+			return nil
+		}
+
+		// Registered-only speech (+M): voiced users and above are exempt
+		if ch.HasMode('M') && c.GetAccount() == "" && ch.GetRank(c) < channel.RankVoice {
+			h.sendNumeric(c, ERR_NEEDREGGEDNICK, target+" :You need to be logged in to speak in this channel (+M)")
+			return nil
+		}
+
+		// No CTCP (+C): only ACTION may be sent to the channel
+		if ch.HasMode('C') {
+			if command, _, ok := parseCTCP(message); ok && command != "ACTION" {
+				h.sendNumeric(c, ERR_CANNOTSENDTOCHAN, target+" :Cannot send CTCP to channel (+C)")
+				return nil
+			}
+		}
+
+		// Flood protection (+f): halfops and above are exempt
+		if ch.GetRank(c) < channel.RankHalfop && ch.CheckFlood(c) {
+			h.floodKickban(c, ch)
+			return nil
+		}
+
+		// A member hidden by +D is announced before their first message
+		h.revealMember(ch, c)
+
 		// Broadcast message to channel (excluding sender)
 		msgText := fmt.Sprintf(":%s %s %s :%s", c.GetHostmask(), cmdType, target, message)
-		ch.Broadcast(msgText, c)
+		if tags == "" {
+			ch.Broadcast(msgText, c)
+		} else {
+			for _, member := range ch.GetMembers() {
+				if member != c {
+					h.sendTagged(member, tags, msgText)
+				}
+			}
+		}
+		ch.Touch()
 
 		// Route to remote servers with channel members (Phase 7.4)
 		if h.router != nil {
@@ -669,9 +900,30 @@ func (h *Handler) handleMessage(c *client.Client, msg *parser.Message, cmdType s
 		}
 
 		h.logger.Debug("Channel message", "from", c.GetNickname(), "channel", target)
-	} else {
-		// Private message to user
-		targetClient := h.clients.GetClient(target)
+	} else if account, ok := strings.CutPrefix(target, accountTargetPrefix); ok {
+		// Message to every session logged in to an account
+		sessions := h.clients.GetClientsByAccount(account)
+		if len(sessions) == 0 {
+			h.sendNumeric(c, ERR_NOSUCHNICK, target+" :No such nick/channel")
+			return nil
+		}
+
+		for _, session := range sessions {
+			if session != c {
+				h.sendTagged(session, tags, fmt.Sprintf(":%s %s %s :%s", c.GetHostmask(), cmdType, session.GetNickname(), message))
+			}
+		}
+
+		h.logger.Debug("Account message", "from", c.GetNickname(), "account", account, "sessions", len(sessions))
+	} else {
+		// Drop rapid CTCP reply NOTICEs between the same two users (bot loops)
+		if cmdType == "NOTICE" && h.isNoticeLoop(c.GetNickname(), target, message) {
+			h.logger.Debug("Dropping looping CTCP reply NOTICE", "from", c.GetNickname(), "to", target)
+			return nil
+		}
+
+		// Private message to user
+		targetClient := h.clients.GetClient(target)
 		if targetClient == nil {
 			// Check if user exists on remote server (Phase 7.4)
 			if h.router != nil && !h.router.IsUserLocal(target) {
@@ -708,8 +960,21 @@ func (h *Handler) handleMessage(c *client.Client, msg *parser.Message, cmdType s
 			return nil
 		}
 
+		// Services (NickServ, ChanServ) handle their PRIVMSGs in-process
+		if targetClient.IsService() {
+			if cmdType == "PRIVMSG" {
+				targetClient.HandleServiceMessage(c, message)
+			}
+			return nil
+		}
+
+		// Caller ID (+g): only accepted users get through
+		if !h.allowPrivate(c, targetClient, cmdType) {
+			return nil
+		}
+
 		msgText := fmt.Sprintf(":%s %s %s :%s", c.GetHostmask(), cmdType, target, message)
-		targetClient.Send(msgText)
+		h.sendTagged(targetClient, tags, msgText)
 
 		// If target is away, notify sender (only for PRIVMSG, not NOTICE)
 		if cmdType == "PRIVMSG" && targetClient.IsAway() {
@@ -722,6 +987,9 @@ func (h *Handler) handleMessage(c *client.Client, msg *parser.Message, cmdType s
 	return nil
 }
 
+// accountTargetPrefix addresses PRIVMSG/NOTICE to all sessions of an account ($a:<account>)
+const accountTargetPrefix = "$a:"
+
 // handleNames handles the NAMES command
 func (h *Handler) handleNames(c *client.Client, msg *parser.Message) error {
 	// Check if registered
@@ -787,20 +1055,29 @@ func (h *Handler) handleTopic(c *client.Client, msg *parser.Message) error {
 
 	// If no topic parameter, return current topic
 	if !msg.HasParam(1) {
-		topic := ch.GetTopic()
-		if topic != "" {
-			h.sendNumeric(c, RPL_TOPIC, fmt.Sprintf("%s :%s", channelName, topic))
-		} else {
-			h.sendNumeric(c, RPL_NOTOPIC, fmt.Sprintf("%s :No topic is set", channelName))
-		}
+		h.sendTopic(c, ch)
 		return nil
 	}
 
+	// Throttle topic wars (+T, or the server default); opers are exempt
+	if !c.HasMode('o') {
+		if wait := ch.AllowTopicChange(h.opts.TopicChanges, h.opts.TopicWindow); wait > 0 {
+			seconds := int((wait + time.Second - 1) / time.Second)
+			description := fmt.Sprintf("Topic changed too often, try again in %d seconds", seconds)
+			if !h.sendStandardReply(c, replyFail, "TOPIC", codeRateLimited, description, channelName) {
+				c.Send(fmt.Sprintf(":%s NOTICE %s :%s %s", h.serverName, c.GetNickname(), channelName, description))
+			}
+			return nil
+		}
+	}
+
 	// Set new topic
 	newTopic := msg.GetParam(1)
-	ch.SetTopic(newTopic)
+	setAt := time.Now()
+	ch.SetTopicInfo(newTopic, c.GetHostmask(), setAt)
 
 	// Broadcast topic change to all members
+	h.revealMember(ch, c)
 	topicMsg := fmt.Sprintf(":%s TOPIC %s :%s", c.GetHostmask(), channelName, newTopic)
 	ch.BroadcastAll(topicMsg)
 
@@ -822,7 +1099,7 @@ func (h *Handler) handleTopic(c *client.Client, msg *parser.Message) error {
 			uid = c.GetNickname()
 		}
 		
-		if err := h.router.PropagateTopic(c.GetNickname(), user, host, uid, channelName, newTopic, time.Now().Unix()); err != nil {
+		if err := h.router.PropagateTopic(c.GetNickname(), user, host, uid, channelName, newTopic, setAt.Unix()); err != nil {
 			h.logger.Debug("Failed to propagate TOPIC", "error", err)
 		}
 	}
@@ -832,9 +1109,25 @@ func (h *Handler) handleTopic(c *client.Client, msg *parser.Message) error {
 	return nil
 }
 
+// sendTopic sends the channel topic (with setter and time) or RPL_NOTOPIC
+func (h *Handler) sendTopic(c *client.Client, ch *channel.Channel) {
+	channelName := ch.GetName()
+	topic := ch.GetTopic()
+	if topic == "" {
+		h.sendNumeric(c, RPL_NOTOPIC, fmt.Sprintf("%s :No topic is set", channelName))
+		return
+	}
+
+	h.sendNumeric(c, RPL_TOPIC, fmt.Sprintf("%s :%s", channelName, topic))
+	if setBy, setAt := ch.GetTopicInfo(); setBy != "" {
+		h.sendNumeric(c, RPL_TOPICWHOTIME, fmt.Sprintf("%s %s %d", channelName, setBy, setAt.Unix()))
+	}
+}
+
 // sendNamesList sends the NAMES list for a channel
 func (h *Handler) sendNamesList(c *client.Client, ch *channel.Channel) {
-	nicks := ch.GetMemberNicks()
+	userhost := c.HasCap(capUserhostInNames)
+	nicks := ch.GetMemberNames(c, c.HasCap(capMultiPrefix), userhost)
 	
 	// Add remote users from network state if we have a router (server linking enabled)
 	if h.router != nil {
@@ -844,17 +1137,13 @@ func (h *Handler) sendNamesList(c *client.Client, ch *channel.Channel) {
 			for uid := range remoteChan.Members {
 				if remoteUser, ok := h.router.GetRemoteUserByUID(uid); ok {
 					// Don't duplicate local users
-					isLocal := false
-					for _, localNick := range nicks {
-						cleanNick := strings.TrimPrefix(strings.TrimPrefix(localNick, "@"), "+")
-						if cleanNick == remoteUser.Nick {
-							isLocal = true
-							break
-						}
-					}
-					if !isLocal {
+					if ch.GetMemberByNick(remoteUser.Nick) == nil {
 						// Add remote user (no prefix since we don't track their op status locally)
-						nicks = append(nicks, remoteUser.Nick)
+						name := remoteUser.Nick
+						if userhost {
+							name += "!" + remoteUser.User + "@" + remoteUser.Host
+						}
+						nicks = append(nicks, name)
 					}
 				}
 			}
@@ -870,15 +1159,15 @@ func (h *Handler) sendNamesList(c *client.Client, ch *channel.Channel) {
 }
 
 // tryRegister attempts to register the client if all requirements are met
-func (h *Handler) tryRegister(c *client.Client) {
+func (h *Handler) tryRegister(c *client.Client) error {
 	// Already registered?
 	if c.IsRegistered() {
-		return
+		return nil
 	}
 
-	// Check if we have both nickname and username
-	if c.GetNickname() == "" || !c.HasUsername() {
-		return
+	// Check if we have both nickname and username, and CAP negotiation is over
+	if c.GetNickname() == "" || !c.HasUsername() || c.IsCapNegotiating() {
+		return nil
 	}
 	
 	// Double-check nickname isn't in use (race condition protection)
@@ -886,16 +1175,70 @@ func (h *Handler) tryRegister(c *client.Client) {
 		h.logger.Warn("Nickname collision during registration attempt", "nick", c.GetNickname())
 		// Send error message to client
 		h.sendNumeric(c, ERR_NICKNAMEINUSE, c.GetNickname()+" :Nickname is already in use")
-		return
+		return nil
+	}
+
+	// Limit how many clients may share one user@host
+	if limit := h.opts.MaxPerUserHost; limit > 0 && h.countUserHost(c) >= limit {
+		userHost := c.GetUsername() + "@" + c.GetHostname()
+		h.logger.Warn("Refusing client over the per-user@host limit", "nick", c.GetNickname(), "userhost", userHost, "limit", limit)
+		c.Send(fmt.Sprintf("ERROR :Closing Link: %s (Too many connections from %s, limit is %d)", c.GetHostname(), userHost, limit))
+		return ErrCloseLink
 	}
 
-	// Mark as registered
+	// PASS <name>:<password> opers the client on connect; during a lockdown
+	// nobody else gets in
+	operName, operOK := h.operFromPass(c)
+	if !operOK && h.lockdown.Load() {
+		h.logger.Warn("Refusing registration during lockdown", "nick", c.GetNickname(), "host", c.GetHostname())
+		c.Send("NOTICE AUTH :*** This server is locked down for maintenance; only IRC operators may connect")
+		c.Send(fmt.Sprintf("ERROR :Closing Link: %s (Server is in maintenance lockdown, try again later)", c.GetHostname()))
+		return ErrCloseLink
+	}
+
+	// Mark as registered and claim the nick. AddClient checks and adds in one
+	// step, so when two connections race for a nick only one gets it; the
+	// other is told the nick is taken and may pick another.
 	c.SetRegistered(true)
+	if err := h.clients.AddClient(c); err != nil {
+		nick := c.GetNickname()
+		h.logger.Warn("Nickname collision during registration", "error", err, "nick", nick)
+		c.SetRegistered(false)
+		c.SetNickname("")
+		h.sendNumeric(c, ERR_NICKNAMEINUSE, nick+" :Nickname is already in use")
+		return nil
+	}
+	h.logger.Info("Added newly registered client to registry", "nick", c.GetNickname())
 
 	// Send welcome messages
 	h.sendWelcome(c)
+	h.protectNick(c)
+	if operOK {
+		h.grantOper(c, operName)
+	}
+
+	// Confirm any modes requested with USER
+	if modes := c.GetModes(); modes != "" {
+		c.Send(fmt.Sprintf(":%s MODE %s :%s", c.GetHostmask(), c.GetNickname(), modes))
+	}
 	
 	// Note: User propagation is handled in AddClient() where UID is assigned
+	return nil
+}
+
+// countUserHost counts the registered clients other than c sharing its
+// user@host. IRC operators are not counted.
+func (h *Handler) countUserHost(c *client.Client) int {
+	count := 0
+	for _, other := range h.clients.GetClients() {
+		if other == c || !other.IsRegistered() || other.HasMode('o') {
+			continue
+		}
+		if strings.EqualFold(other.GetUsername(), c.GetUsername()) && strings.EqualFold(other.GetHostname(), c.GetHostname()) {
+			count++
+		}
+	}
+	return count
 }
 
 // isValidNickname checks if a nickname is valid according to RFC 2812
@@ -994,16 +1337,15 @@ func (h *Handler) handleUserMode(c *client.Client, msg *parser.Message) error {
 
 	// If no mode string, return current modes
 	if len(msg.Params) < 2 {
-		modes := c.GetModes()
-		if modes == "" {
-			modes = "+"
-		}
-		h.sendNumeric(c, RPL_UMODEIS, modes)
+		h.sendNumeric(c, RPL_UMODEIS, userModeString(c))
 		return nil
 	}
 
 	modeString := msg.Params[1]
+	argIndex := 2
 	adding := true
+	var changes modeChanges
+	unknown := false
 
 	for _, ch := range modeString {
 		switch ch {
@@ -1011,27 +1353,155 @@ func (h *Handler) handleUserMode(c *client.Client, msg *parser.Message) error {
 			adding = true
 		case '-':
 			adding = false
-		case 'i': // invisible
-			c.SetMode('i', adding)
+		case 'g', 'i', 'w': // caller ID, invisible, wallops
+			if c.HasMode(ch) != adding {
+				c.SetMode(ch, adding)
+				changes.add(adding, ch)
+			}
 		case 'o': // operator (can only be removed, not added by user)
-			if !adding {
+			if !adding && c.HasMode('o') {
 				c.SetMode('o', false)
+				changes.add(false, 'o')
+				// Server notices are an operator privilege
+				if c.HasMode('s') {
+					c.SetMode('s', false)
+					changes.add(false, 's')
+				}
+			}
+		case 's': // server notices, optionally followed by a snomask change
+			var maskArg string
+			if argIndex < len(msg.Params) {
+				maskArg = msg.Params[argIndex]
+				argIndex++
+			}
+			if adding && !c.HasMode('o') {
+				h.sendNumeric(c, ERR_NOPRIVILEGES, ":Permission Denied- You're not an IRC operator")
+				continue
+			}
+			if !adding {
+				if c.HasMode('s') {
+					c.SetMode('s', false)
+					changes.add(false, 's')
+				}
+				continue
+			}
+			applySnomasks(c, maskArg)
+			if !c.HasMode('s') {
+				c.SetMode('s', true)
+				changes.add(true, 's')
 			}
-		case 'w': // wallops
-			c.SetMode('w', adding)
 		default:
-			h.sendNumeric(c, ERR_UMODEUNKNOWNFLAG, ":Unknown MODE flag")
+			unknown = true
+		}
+	}
+
+	if unknown {
+		h.sendNumeric(c, ERR_UMODEUNKNOWNFLAG, ":Unknown MODE flag")
+	}
+
+	// Confirm the modes that actually changed in a single line
+	if applied := changes.String(); applied != "" {
+		c.Send(fmt.Sprintf(":%s MODE %s :%s", c.GetHostmask(), c.GetNickname(), applied))
+		h.saveStickyModes(c)
+		if !c.HasMode('o') && strings.Contains(applied, "o") {
+			h.propagateUserMode(c, "-o")
+		}
+	}
+
+	return nil
+}
+
+// propagateUserMode tells linked servers about a change to c's network-visible
+// user modes (currently only +o/-o)
+func (h *Handler) propagateUserMode(c *client.Client, modeString string) {
+	if h.router == nil || c.GetUID() == "" {
+		return
+	}
+	if err := h.router.PropagateMode(c.GetNickname(), c.GetUsername(), c.GetHostname(), c.GetUID(), c.GetUID(), modeString, time.Now().Unix()); err != nil {
+		h.logger.Debug("Failed to propagate user MODE", "error", err)
+	}
+}
+
+// snomaskChars lists the server notice masks users may select with +s
+const snomaskChars = "cfklo"
+
+// defaultSnomasks are set by +s when no mask parameter is given
+const defaultSnomasks = "+cko"
+
+// applySnomasks applies a snomask change such as "+cf-k", ignoring unknown masks
+func applySnomasks(c *client.Client, maskArg string) {
+	if maskArg == "" {
+		if c.GetSnomasks() != "" {
+			return
+		}
+		maskArg = defaultSnomasks
+	}
+
+	adding := true
+	for _, m := range maskArg {
+		switch {
+		case m == '+':
+			adding = true
+		case m == '-':
+			adding = false
+		case strings.ContainsRune(snomaskChars, m):
+			c.SetSnomask(m, adding)
 		}
 	}
+}
 
-	// Confirm mode change
+// userModeString returns the RPL_UMODEIS text, e.g. "+iws +cfk"
+func userModeString(c *client.Client) string {
 	modes := c.GetModes()
 	if modes == "" {
-		modes = "+"
+		return "+"
 	}
-	c.Send(fmt.Sprintf(":%s MODE %s %s", c.GetHostmask(), c.GetNickname(), modes))
+	if c.HasMode('s') {
+		if masks := c.GetSnomasks(); masks != "" {
+			modes += " " + masks
+		}
+	}
+	return modes
+}
 
-	return nil
+// modeChanges accumulates applied mode changes into a "+ab-c" string,
+// keeping the arguments of modes that take one in the same order
+type modeChanges struct {
+	buf    strings.Builder
+	args   []string
+	adding bool
+	any    bool
+}
+
+// add records one applied mode change
+func (m *modeChanges) add(adding bool, mode rune) {
+	if !m.any || m.adding != adding {
+		if adding {
+			m.buf.WriteByte('+')
+		} else {
+			m.buf.WriteByte('-')
+		}
+		m.adding = adding
+		m.any = true
+	}
+	m.buf.WriteRune(mode)
+}
+
+// addArg records one applied mode change that carries an argument
+func (m *modeChanges) addArg(adding bool, mode rune, arg string) {
+	m.add(adding, mode)
+	m.args = append(m.args, arg)
+}
+
+// String returns the accumulated changes
+func (m *modeChanges) String() string {
+	return m.buf.String()
+}
+
+// Line returns the changes followed by their arguments, as sent in a MODE
+// line: "+o-v nick1 nick2"
+func (m *modeChanges) Line() string {
+	return strings.Join(append([]string{m.buf.String()}, m.args...), " ")
 }
 
 // handleChannelMode handles MODE for channels
@@ -1053,77 +1523,262 @@ func (h *Handler) handleChannelMode(c *client.Client, msg *parser.Message) error
 	// If no mode string, return current modes
 	if len(msg.Params) < 2 {
 		modes := ch.GetModes()
+		if limit := ch.GetLimit(); limit > 0 {
+			modes += " " + strconv.Itoa(limit)
+		}
 		h.sendNumeric(c, RPL_CHANNELMODEIS, channelName+" "+modes)
 		return nil
 	}
 
-	// Check if user is channel operator
-	if !ch.IsOperator(c) {
+	// A bare "b" (no mask) lists bans, which any member may do; likewise "q"
+	// lists quiets
+	if len(msg.Params) == 2 && strings.Trim(msg.Params[1], "+-") == "b" {
+		h.sendBanList(c, ch)
+		return nil
+	}
+	if len(msg.Params) == 2 && strings.Trim(msg.Params[1], "+-") == "q" {
+		h.sendQuietList(c, ch)
+		return nil
+	}
+
+	// Check if user is channel operator (or higher). IRC operators without
+	// channel status use OMODE, which is logged.
+	if ch.GetRank(c) < channel.RankHalfop {
 		h.sendNumeric(c, ERR_CHANOPRIVSNEEDED, channelName+" :You're not channel operator")
 		return nil
 	}
 
-	modeString := msg.Params[1]
-	modeArgs := msg.Params[2:]
+	h.applyChannelModes(c, ch, msg.Params[1], msg.Params[2:], false, c.GetHostmask())
+	return nil
+}
+
+// applyChannelModes applies a mode string to ch on behalf of c, broadcasts
+// the result from source and propagates it. ircOper lifts the channel status
+// checks. It returns the applied changes with their arguments.
+func (h *Handler) applyChannelModes(c *client.Client, ch *channel.Channel, modeString string, modeArgs []string, ircOper bool, source string) string {
+	channelName := ch.GetName()
 	argIndex := 0
 	adding := true
-	changes := ""
+	var changes modeChanges
 
 	for _, modeChar := range modeString {
+		// Halfops may only manage voices and bans
+		if !ircOper && ch.GetRank(c) < channel.RankOp && strings.ContainsRune("CDMimnpstkfjlT", modeChar) {
+			h.sendNumeric(c, ERR_CHANOPRIVSNEEDED, channelName+" :You're not channel operator")
+			if strings.ContainsRune("kfjlT", modeChar) && adding {
+				argIndex++ // Skip the mode's parameter so later arguments stay aligned
+			}
+			continue
+		}
+
 		switch modeChar {
 		case '+':
 			adding = true
-			changes += "+"
 		case '-':
 			adding = false
-			changes += "-"
-		case 'o': // operator
-			if argIndex < len(modeArgs) {
-				targetNick := modeArgs[argIndex]
+		case 'q', 'a', 'o', 'h', 'v': // member status
+			if modeChar == 'q' && argIndex >= len(modeArgs) {
+				// No argument left: list the quiets instead
+				h.sendQuietList(c, ch)
+				continue
+			}
+			if modeChar == 'q' && isQuietMask(modeArgs[argIndex]) {
+				// A mask rather than a nickname: quiet list, not owner status
+				mask := channel.NormalizeMask(modeArgs[argIndex])
 				argIndex++
-				targetClient := ch.GetMemberByNick(targetNick)
-				if targetClient != nil {
-					ch.SetOperator(targetClient, adding)
-					changes += "o"
+				if adding {
+					if h.listFull(c, ch, 'q', mask) {
+						continue
+					}
+					ch.AddQuiet(mask)
+				} else {
+					ch.RemoveQuiet(mask)
 				}
+				changes.addArg(adding, 'q', mask)
+				continue
 			}
-		case 'v': // voice
 			if argIndex < len(modeArgs) {
 				targetNick := modeArgs[argIndex]
 				argIndex++
 				targetClient := ch.GetMemberByNick(targetNick)
-				if targetClient != nil {
-					ch.SetVoice(targetClient, adding)
-					changes += "v"
+				if targetClient == nil {
+					continue
+				}
+				if !ircOper && !canChangeStatus(ch, c, targetClient, modeChar, adding) {
+					h.sendNumeric(c, ERR_CHANOPRIVSNEEDED, fmt.Sprintf("%s :You're not allowed to change %s's +%c status", channelName, targetNick, modeChar))
+					continue
+				}
+				if adding {
+					h.revealMember(ch, targetClient)
 				}
+				setMemberStatus(ch, targetClient, modeChar, adding)
+				changes.addArg(adding, modeChar, targetClient.GetNickname())
 			}
 		case 'i': // invite-only
 			ch.SetMode('i', adding)
-			changes += "i"
+			changes.add(adding, 'i')
 		case 'm': // moderated
 			ch.SetMode('m', adding)
-			changes += "m"
+			changes.add(adding, 'm')
 		case 'n': // no external messages
 			ch.SetMode('n', adding)
-			changes += "n"
+			changes.add(adding, 'n')
 		case 't': // topic protection
 			ch.SetMode('t', adding)
-			changes += "t"
+			changes.add(adding, 't')
+		case 's': // secret: hidden from LIST for non-members
+			ch.SetMode('s', adding)
+			changes.add(adding, 's')
+		case 'p': // private: shown as Prv in LIST to non-members
+			ch.SetMode('p', adding)
+			changes.add(adding, 'p')
+		case 'C': // no CTCP (ACTION still allowed)
+			ch.SetMode('C', adding)
+			changes.add(adding, 'C')
+		case 'M': // only logged-in users may speak
+			ch.SetMode('M', adding)
+			changes.add(adding, 'M')
+		case 'D': // delayed join: JOINs are shown when the member first speaks
+			ch.SetMode('D', adding)
+			changes.add(adding, 'D')
+			if !adding {
+				for _, member := range ch.GetHiddenMembers() {
+					h.revealMember(ch, member)
+				}
+			}
+		case 'P': // permanent (registered): kept while empty until it expires
+			if !ircOper {
+				h.sendNumeric(c, ERR_NOPRIVILEGES, ":Permission Denied- You're not an IRC operator")
+				continue
+			}
+			ch.SetMode('P', adding)
+			changes.add(adding, 'P')
 		case 'b': // ban
+			if argIndex >= len(modeArgs) {
+				// No mask left: list the bans instead
+				h.sendBanList(c, ch)
+				continue
+			}
+			mask := channel.NormalizeMask(modeArgs[argIndex])
+			argIndex++
+			if adding {
+				if h.listFull(c, ch, 'b', mask) {
+					continue
+				}
+				ch.AddBan(mask)
+			} else {
+				ch.RemoveBan(mask)
+			}
+			changes.addArg(adding, 'b', mask)
+		case 'e': // ban exception
+			if argIndex >= len(modeArgs) {
+				// No mask left: list the exceptions instead
+				h.sendExceptList(c, ch)
+				continue
+			}
+			mask := channel.NormalizeMask(modeArgs[argIndex])
+			argIndex++
+			if adding {
+				if h.listFull(c, ch, 'e', mask) {
+					continue
+				}
+				ch.AddException(mask)
+			} else {
+				ch.RemoveException(mask)
+			}
+			changes.addArg(adding, 'e', mask)
+		case 'I': // invite exception
+			if argIndex >= len(modeArgs) {
+				// No mask left: list the invite exceptions instead
+				h.sendInvexList(c, ch)
+				continue
+			}
+			mask := channel.NormalizeMask(modeArgs[argIndex])
+			argIndex++
+			if adding {
+				if h.listFull(c, ch, 'I', mask) {
+					continue
+				}
+				ch.AddInviteException(mask)
+			} else {
+				ch.RemoveInviteException(mask)
+			}
+			changes.addArg(adding, 'I', mask)
+		case 'f': // flood protection (lines:seconds)
+			if adding {
+				if argIndex < len(modeArgs) {
+					param := modeArgs[argIndex]
+					argIndex++
+					lines, seconds, ok := ParseFloodParam(param)
+					if !ok {
+						h.sendNumeric(c, ERR_INVALIDMODEPARAM, fmt.Sprintf("%s f %s :Invalid flood parameter, expected <lines>:<seconds>", channelName, param))
+						continue
+					}
+					ch.SetFloodLimit(lines, seconds)
+					ch.SetMode('f', true)
+					changes.addArg(true, 'f', param)
+				}
+			} else {
+				ch.SetFloodLimit(0, 0)
+				ch.SetMode('f', false)
+				changes.add(false, 'f')
+			}
+		case 'j': // join throttle (joins:seconds)
+			if adding {
+				if argIndex < len(modeArgs) {
+					param := modeArgs[argIndex]
+					argIndex++
+					joins, seconds, ok := ParseFloodParam(param)
+					if !ok {
+						h.sendNumeric(c, ERR_INVALIDMODEPARAM, fmt.Sprintf("%s j %s :Invalid join throttle parameter, expected <joins>:<seconds>", channelName, param))
+						continue
+					}
+					ch.SetJoinThrottle(joins, seconds)
+					ch.SetMode('j', true)
+					changes.addArg(true, 'j', param)
+				}
+			} else {
+				ch.SetJoinThrottle(0, 0)
+				ch.SetMode('j', false)
+				changes.add(false, 'j')
+			}
+		case 'T': // topic throttle (changes:seconds)
 			if adding {
 				if argIndex < len(modeArgs) {
-					mask := modeArgs[argIndex]
+					param := modeArgs[argIndex]
 					argIndex++
-					ch.AddBan(mask)
-					changes += "b"
+					topicChanges, seconds, ok := ParseFloodParam(param)
+					if !ok {
+						h.sendNumeric(c, ERR_INVALIDMODEPARAM, fmt.Sprintf("%s T %s :Invalid topic throttle parameter, expected <changes>:<seconds>", channelName, param))
+						continue
+					}
+					ch.SetTopicThrottle(topicChanges, seconds)
+					ch.SetMode('T', true)
+					changes.addArg(true, 'T', param)
 				}
 			} else {
+				ch.SetTopicThrottle(0, 0)
+				ch.SetMode('T', false)
+				changes.add(false, 'T')
+			}
+		case 'l': // user limit
+			if adding {
 				if argIndex < len(modeArgs) {
-					mask := modeArgs[argIndex]
+					param := modeArgs[argIndex]
 					argIndex++
-					ch.RemoveBan(mask)
-					changes += "b"
+					limit, err := strconv.Atoi(param)
+					if err != nil || limit <= 0 {
+						h.sendNumeric(c, ERR_INVALIDMODEPARAM, fmt.Sprintf("%s l %s :Invalid limit parameter, expected a positive number", channelName, param))
+						continue
+					}
+					ch.SetLimit(limit)
+					ch.SetMode('l', true)
+					changes.addArg(true, 'l', strconv.Itoa(limit))
 				}
+			} else {
+				ch.SetLimit(0)
+				ch.SetMode('l', false)
+				changes.add(false, 'l')
 			}
 		case 'k': // channel key (password)
 			if adding {
@@ -1132,13 +1787,13 @@ func (h *Handler) handleChannelMode(c *client.Client, msg *parser.Message) error
 					argIndex++
 					ch.SetKey(key)
 					ch.SetMode('k', true)
-					changes += "k"
+					changes.addArg(true, 'k', key)
 				}
 			} else {
 				// Removing key
 				ch.SetKey("")
 				ch.SetMode('k', false)
-				changes += "k"
+				changes.add(false, 'k')
 			}
 		default:
 			h.sendNumeric(c, ERR_UNKNOWNMODE, string(modeChar)+" :is unknown mode char to me")
@@ -1146,92 +1801,16 @@ func (h *Handler) handleChannelMode(c *client.Client, msg *parser.Message) error
 	}
 
 	// Broadcast mode change
-	if changes != "" {
-		ch.BroadcastAll(fmt.Sprintf(":%s MODE %s %s", c.GetHostmask(), channelName, changes))
-		
-		// Propagate MODE to remote servers (Phase 7.4.4)
-		if h.router != nil {
-			parts := strings.SplitN(c.GetHostmask(), "!", 2)
-			user := ""
-			host := ""
-			if len(parts) == 2 {
-				userhost := strings.SplitN(parts[1], "@", 2)
-				if len(userhost) == 2 {
-					user = userhost[0]
-					host = userhost[1]
-				}
-			}
-			
-			uid := c.GetUID()
-			if uid == "" {
-				uid = c.GetNickname()
-			}
-			
-			// Build full mode string with args for propagation
-			fullModeStr := changes
-			if len(modeArgs) > 0 {
-				fullModeStr += " " + strings.Join(modeArgs[:argIndex], " ")
-			}
-			
-			if err := h.router.PropagateMode(c.GetNickname(), user, host, uid, channelName, fullModeStr, time.Now().Unix()); err != nil {
-				h.logger.Debug("Failed to propagate MODE", "error", err)
-			}
-		}
-	}
-
-	return nil
-}
-
-// handleKick handles the KICK command
-// KICK <channel> <user> [<comment>]
-func (h *Handler) handleKick(c *client.Client, msg *parser.Message) error {
-	if !c.IsRegistered() {
-		h.sendNumeric(c, ERR_NOTREGISTERED, ":You have not registered")
-		return nil
-	}
-
-	if len(msg.Params) < 2 {
-		h.sendNumeric(c, ERR_NEEDMOREPARAMS, "KICK :Not enough parameters")
-		return nil
-	}
-
-	channelName := msg.Params[0]
-	targetNick := msg.Params[1]
-	reason := "Kicked"
-	if len(msg.Params) > 2 {
-		reason = msg.Params[2]
+	if changes.String() == "" {
+		return ""
 	}
-
-	ch := h.channels.GetChannel(channelName)
-	if ch == nil {
-		h.sendNumeric(c, ERR_NOSUCHCHANNEL, channelName+" :No such channel")
-		return nil
-	}
-
-	// Check if kicker is in channel
-	if !ch.HasMember(c) {
-		h.sendNumeric(c, ERR_NOTONCHANNEL, channelName+" :You're not on that channel")
-		return nil
-	}
-
-	// Check if kicker is channel operator
-	if !ch.IsOperator(c) {
-		h.sendNumeric(c, ERR_CHANOPRIVSNEEDED, channelName+" :You're not channel operator")
-		return nil
-	}
-
-	// Get target client
-	targetClient := ch.GetMemberByNick(targetNick)
-	if targetClient == nil {
-		h.sendNumeric(c, ERR_USERNOTINCHANNEL, targetNick+" "+channelName+" :They aren't on that channel")
-		return nil
+	// A setter still hidden by +D is announced before their change
+	if source == c.GetHostmask() {
+		h.revealMember(ch, c)
 	}
-
-	// Broadcast KICK message
-	kickMsg := fmt.Sprintf(":%s KICK %s %s :%s", c.GetHostmask(), channelName, targetNick, reason)
-	ch.BroadcastAll(kickMsg)
-
-	// Propagate KICK to remote servers (Phase 7.4.4)
+	ch.BroadcastAll(fmt.Sprintf(":%s MODE %s %s", source, channelName, changes.Line()))
+	
+	// Propagate MODE to remote servers (Phase 7.4.4)
 	if h.router != nil {
 		parts := strings.SplitN(c.GetHostmask(), "!", 2)
 		user := ""
@@ -1249,14 +1828,258 @@ func (h *Handler) handleKick(c *client.Client, msg *parser.Message) error {
 			uid = c.GetNickname()
 		}
 		
-		if err := h.router.PropagateKick(c.GetNickname(), user, host, uid, channelName, targetNick, reason); err != nil {
-			h.logger.Debug("Failed to propagate KICK", "error", err)
+		// Only the accepted changes go out, each with its own argument
+		if err := h.router.PropagateMode(c.GetNickname(), user, host, uid, channelName, changes.Line(), time.Now().Unix()); err != nil {
+			h.logger.Debug("Failed to propagate MODE", "error", err)
 		}
 	}
 
-	// Remove target from channel
-	ch.RemoveMember(targetClient)
+	return changes.Line()
+}
+
+// sendBanList sends RPL_BANLIST for each ban followed by RPL_ENDOFBANLIST
+func (h *Handler) sendBanList(c *client.Client, ch *channel.Channel) {
+	channelName := ch.GetName()
+	for _, mask := range ch.GetBanList() {
+		h.sendNumeric(c, RPL_BANLIST, fmt.Sprintf("%s %s", channelName, mask))
+	}
+	h.sendNumeric(c, RPL_ENDOFBANLIST, channelName+" :End of channel ban list")
+}
+
+// sendExceptList sends RPL_EXCEPTLIST for each ban exception followed by
+// RPL_ENDOFEXCEPTLIST
+func (h *Handler) sendExceptList(c *client.Client, ch *channel.Channel) {
+	channelName := ch.GetName()
+	for _, mask := range ch.GetExceptionList() {
+		h.sendNumeric(c, RPL_EXCEPTLIST, fmt.Sprintf("%s %s", channelName, mask))
+	}
+	h.sendNumeric(c, RPL_ENDOFEXCEPTLIST, channelName+" :End of channel exception list")
+}
+
+// sendInvexList sends RPL_INVEXLIST for each invite exception followed by
+// RPL_ENDOFINVEXLIST
+func (h *Handler) sendInvexList(c *client.Client, ch *channel.Channel) {
+	channelName := ch.GetName()
+	for _, mask := range ch.GetInviteExceptionList() {
+		h.sendNumeric(c, RPL_INVEXLIST, fmt.Sprintf("%s %s", channelName, mask))
+	}
+	h.sendNumeric(c, RPL_ENDOFINVEXLIST, channelName+" :End of channel invite exception list")
+}
+
+// sendQuietList sends RPL_QUIETLIST for each quiet followed by
+// RPL_ENDOFQUIETLIST
+func (h *Handler) sendQuietList(c *client.Client, ch *channel.Channel) {
+	channelName := ch.GetName()
+	for _, mask := range ch.GetQuietList() {
+		h.sendNumeric(c, RPL_QUIETLIST, fmt.Sprintf("%s q %s", channelName, mask))
+	}
+	h.sendNumeric(c, RPL_ENDOFQUIETLIST, channelName+" q :End of channel quiet list")
+}
+
+// listFull reports whether adding mask to the +b, +e, +I or +q list of ch
+// would go over MaxListEntries or MaxListTotal, telling c with ERR_BANLISTFULL
+// if so. Masks already on the list don't grow it and are always accepted.
+func (h *Handler) listFull(c *client.Client, ch *channel.Channel, mode rune, mask string) bool {
+	bans, excepts, invexes, quiets := ch.GetBanList(), ch.GetExceptionList(), ch.GetInviteExceptionList(), ch.GetQuietList()
+	list := bans
+	switch mode {
+	case 'e':
+		list = excepts
+	case 'I':
+		list = invexes
+	case 'q':
+		list = quiets
+	}
+	for _, listed := range list {
+		if listed == mask {
+			return false
+		}
+	}
+
+	if len(list) < h.opts.MaxListEntries && (h.opts.MaxListTotal <= 0 || len(bans)+len(excepts)+len(invexes)+len(quiets) < h.opts.MaxListTotal) {
+		return false
+	}
+	h.sendNumeric(c, ERR_BANLISTFULL, fmt.Sprintf("%s %c :Channel list is full", ch.GetName(), mode))
+	return true
+}
+
+// isQuietMask reports whether a +q argument is a quiet mask rather than a
+// nickname. Nicknames can't contain any of these characters.
+func isQuietMask(arg string) bool {
+	return strings.ContainsAny(arg, "!@*?")
+}
+
+// ParseFloodParam parses a +f, +j or +T parameter of the form <count>:<seconds>
+func ParseFloodParam(param string) (lines, seconds int, ok bool) {
+	l, s, found := strings.Cut(param, ":")
+	if !found {
+		return 0, 0, false
+	}
+	lines, err := strconv.Atoi(l)
+	if err != nil || lines <= 0 {
+		return 0, 0, false
+	}
+	seconds, err = strconv.Atoi(s)
+	if err != nil || seconds <= 0 {
+		return 0, 0, false
+	}
+	return lines, seconds, true
+}
+
+// floodKickban bans and kicks a member who tripped the channel's +f limit
+func (h *Handler) floodKickban(c *client.Client, ch *channel.Channel) {
+	channelName := ch.GetName()
+	nick := c.GetNickname()
+	mask := c.GetHostmask()
+	lines, seconds := ch.GetFloodLimit()
+	reason := fmt.Sprintf("Channel flood (%d lines in %ds)", lines, seconds)
+
+	ch.AddBan(mask)
+	ch.BroadcastAll(fmt.Sprintf(":%s MODE %s +b %s", h.serverName, channelName, mask))
+	ch.BroadcastAll(fmt.Sprintf(":%s KICK %s %s :%s", h.serverName, channelName, nick, reason))
+
+	ch.RemoveMember(c)
+	c.PartChannel(channelName)
+
+	h.logger.Warn("Channel flood kick-ban", "channel", channelName, "nickname", nick, "mask", mask)
+
+	if h.router != nil {
+		if err := h.router.PropagateServerMode(channelName, "+b "+mask, time.Now().Unix()); err != nil {
+			h.logger.Debug("Failed to propagate flood ban", "error", err, "channel", channelName)
+		}
+		if err := h.router.PropagateServerKick(channelName, nick, reason); err != nil {
+			h.logger.Debug("Failed to propagate flood kick", "error", err, "channel", channelName)
+		}
+	}
+
+	if ch.IsEmpty() {
+		h.channels.RemoveChannel(channelName)
+	}
+}
+
+// statusModeRanks is the rank needed to grant each member status mode
+var statusModeRanks = map[rune]int{
+	'q': channel.RankOwner,
+	'a': channel.RankOwner,
+	'o': channel.RankOp,
+	'h': channel.RankOp,
+	'v': channel.RankHalfop,
+}
+
+// canChangeStatus reports whether c may grant or remove a member status on
+// target. Removing status also requires outranking the target, except when
+// users drop their own status.
+func canChangeStatus(ch *channel.Channel, c, target *client.Client, mode rune, adding bool) bool {
+	if !adding && target == c {
+		return true
+	}
+	if ch.GetRank(c) < statusModeRanks[mode] {
+		return false
+	}
+	return adding || ch.Outranks(c, target)
+}
+
+// setMemberStatus applies a member status mode (q/a/o/h/v)
+func setMemberStatus(ch *channel.Channel, target *client.Client, mode rune, adding bool) {
+	switch mode {
+	case 'q':
+		ch.SetOwner(target, adding)
+	case 'a':
+		ch.SetAdmin(target, adding)
+	case 'o':
+		ch.SetOperator(target, adding)
+	case 'h':
+		ch.SetHalfop(target, adding)
+	case 'v':
+		ch.SetVoice(target, adding)
+	}
+}
+
+// handleKick handles the KICK command
+// KICK <channel> <user> [<comment>]
+func (h *Handler) handleKick(c *client.Client, msg *parser.Message) error {
+	if !c.IsRegistered() {
+		h.sendNumeric(c, ERR_NOTREGISTERED, ":You have not registered")
+		return nil
+	}
+
+	if len(msg.Params) < 2 {
+		h.sendNumeric(c, ERR_NEEDMOREPARAMS, "KICK :Not enough parameters")
+		return nil
+	}
+
+	channelName := msg.Params[0]
+	targetNick := msg.Params[1]
+	reason := "Kicked"
+	if len(msg.Params) > 2 {
+		reason = msg.Params[2]
+	}
+
+	ch := h.channels.GetChannel(channelName)
+	if ch == nil {
+		h.sendNumeric(c, ERR_NOSUCHCHANNEL, channelName+" :No such channel")
+		return nil
+	}
+
+	// Check if kicker is in channel
+	if !ch.HasMember(c) {
+		h.sendNumeric(c, ERR_NOTONCHANNEL, channelName+" :You're not on that channel")
+		return nil
+	}
+
+	// Check if kicker is channel operator (halfops may kick too)
+	if ch.GetRank(c) < channel.RankHalfop {
+		h.sendNumeric(c, ERR_CHANOPRIVSNEEDED, channelName+" :You're not channel operator")
+		return nil
+	}
+
+	// Get target client
+	targetClient := ch.GetMemberByNick(targetNick)
+	if targetClient == nil {
+		h.sendNumeric(c, ERR_USERNOTINCHANNEL, targetNick+" "+channelName+" :They aren't on that channel")
+		return nil
+	}
+
+	// Users can only kick those ranked below them
+	if targetClient != c && !ch.Outranks(c, targetClient) {
+		h.sendNumeric(c, ERR_CHANOPRIVSNEEDED, fmt.Sprintf("%s :You cannot kick %s, they are ranked equal or higher", channelName, targetNick))
+		return nil
+	}
+
+	// Broadcast KICK message, announcing a target still hidden by +D first
+	h.revealMember(ch, targetClient)
+	kickMsg := fmt.Sprintf(":%s KICK %s %s :%s", c.GetHostmask(), channelName, targetNick, reason)
+	ch.BroadcastAll(kickMsg)
+
+	// Propagate KICK to remote servers (Phase 7.4.4)
+	if h.router != nil {
+		parts := strings.SplitN(c.GetHostmask(), "!", 2)
+		user := ""
+		host := ""
+		if len(parts) == 2 {
+			userhost := strings.SplitN(parts[1], "@", 2)
+			if len(userhost) == 2 {
+				user = userhost[0]
+				host = userhost[1]
+			}
+		}
+		
+		uid := c.GetUID()
+		if uid == "" {
+			uid = c.GetNickname()
+		}
+		
+		if err := h.router.PropagateKick(c.GetNickname(), user, host, uid, channelName, targetNick, reason); err != nil {
+			h.logger.Debug("Failed to propagate KICK", "error", err)
+		}
+	}
+
+	// Remove target from channel
+	ch.RemoveMember(targetClient)
 	targetClient.PartChannel(channelName)
+	if h.opts.KickCooldown > 0 {
+		ch.SetKickCooldown(targetClient.GetUsername()+"@"+targetClient.GetHostname(), time.Now().Add(h.opts.KickCooldown))
+	}
 
 	h.logger.Info("User kicked from channel", "channel", channelName, "target", targetNick, "by", c.GetNickname())
 
@@ -1277,30 +2100,29 @@ func (h *Handler) handleWho(c *client.Client, msg *parser.Message) error {
 		return nil
 	}
 
-	mask := msg.Params[0]
-
-	// Check if mask is a channel
-	if strings.HasPrefix(mask, "#") {
+	masks := h.limitTargets(c, "WHO", strings.Split(msg.Params[0], ","), h.opts.MaxTargets)
+	for _, mask := range masks {
+		// Only channel masks are answered for now (could implement pattern matching)
+		if !strings.HasPrefix(mask, "#") {
+			continue
+		}
 		ch := h.channels.GetChannel(mask)
 		if ch == nil {
-			// No such channel, just send end of WHO
-			h.sendNumeric(c, RPL_ENDOFWHO, mask+" :End of WHO list")
-			return nil
+			continue
 		}
 
-		// Send WHO reply for each member
+		// Send WHO reply for each member; those hidden by +D only see themselves
 		members := ch.GetMembers()
 		for _, member := range members {
+			if member != c && ch.IsHidden(member) {
+				continue
+			}
 			h.sendWhoReply(c, member, mask, ch)
 		}
-	} else {
-		// For now, just return all registered users (could implement pattern matching)
-		// This is a simplified implementation
-		h.sendNumeric(c, RPL_ENDOFWHO, mask+" :End of WHO list")
-		return nil
+		h.sendRemoteWhoReplies(c, mask, ch)
 	}
 
-	h.sendNumeric(c, RPL_ENDOFWHO, mask+" :End of WHO list")
+	h.sendNumeric(c, RPL_ENDOFWHO, strings.Join(masks, ",")+" :End of WHO list")
 	return nil
 }
 
@@ -1323,7 +2145,7 @@ func (h *Handler) sendWhoReply(c *client.Client, target *client.Client, channel
 		}
 	}
 
-	// Build flags: H=here, G=away, *=ircop, @=chanop, +=voice
+	// Build flags: H=here, G=away, *=ircop, then the channel status prefix (~&@+)
 	flags := "H" // H = here (not away), G = gone (away)
 	if target.IsAway() {
 		flags = "G" // User is away
@@ -1331,10 +2153,8 @@ func (h *Handler) sendWhoReply(c *client.Client, target *client.Client, channel
 	if target.HasMode('o') {
 		flags += "*" // IRC operator
 	}
-	if ch != nil && ch.IsOperator(target) {
-		flags += "@" // Channel operator
-	} else if ch != nil && ch.IsVoiced(target) {
-		flags += "+" // Voiced
+	if ch != nil {
+		flags += ch.GetPrefix(target)
 	}
 
 	// Format: <channel> <user> <host> <server> <nick> <flags> :<hopcount> <realname>
@@ -1342,8 +2162,58 @@ func (h *Handler) sendWhoReply(c *client.Client, target *client.Client, channel
 	h.sendNumeric(c, RPL_WHOREPLY, reply)
 }
 
+// sendRemoteWhoReplies sends a WHO reply for each member of ch on a linked
+// server, with their own server name and hop count
+func (h *Handler) sendRemoteWhoReplies(c *client.Client, mask string, ch *channel.Channel) {
+	if h.router == nil {
+		return
+	}
+	remoteChan, exists := h.router.GetRemoteChannel(ch.GetName())
+	if !exists {
+		return
+	}
+
+	for _, uid := range remoteChan.GetMemberUIDs() {
+		ru, ok := h.router.GetRemoteUserByUID(uid)
+		if !ok || ch.GetMemberByNick(ru.Nick) != nil {
+			continue
+		}
+
+		flags := "H"
+		if ru.GetAway() != "" {
+			flags = "G"
+		}
+		if ru.HasMode('o') {
+			flags += "*"
+		}
+		prefixes, _ := remoteChan.GetMemberStatus(uid)
+		flags += highestPrefix(prefixes)
+
+		serverName, hopcount := "*", ru.Hopcount
+		if ru.Server != nil {
+			serverName = ru.Server.Name
+			if hopcount == 0 {
+				hopcount = ru.Server.Distance
+			}
+		}
+
+		h.sendNumeric(c, RPL_WHOREPLY, fmt.Sprintf("%s %s %s %s %s %s :%d %s",
+			mask, ru.User, ru.Host, serverName, ru.Nick, flags, hopcount, ru.RealName))
+	}
+}
+
+// highestPrefix returns the highest channel status prefix in prefixes, or ""
+func highestPrefix(prefixes string) string {
+	for _, p := range channelPrefixChars {
+		if strings.ContainsRune(prefixes, p) {
+			return string(p)
+		}
+	}
+	return ""
+}
+
 // handleWhois handles the WHOIS command
-// Syntax: WHOIS <nickname>
+// Syntax: WHOIS <nickname>[,<nickname>...]
 func (h *Handler) handleWhois(c *client.Client, msg *parser.Message) error {
 	if !c.IsRegistered() {
 		h.sendNumeric(c, ERR_NOTREGISTERED, ":You have not registered")
@@ -1355,13 +2225,27 @@ func (h *Handler) handleWhois(c *client.Client, msg *parser.Message) error {
 		return nil
 	}
 
-	targetNick := msg.Params[0]
+	for _, targetNick := range h.limitTargets(c, "WHOIS", strings.Split(msg.Params[0], ","), h.opts.MaxTargets) {
+		if targetNick != "" {
+			h.sendWhois(c, targetNick)
+		}
+	}
+
+	return nil
+}
+
+// sendWhois sends the WHOIS reply for a single nickname
+func (h *Handler) sendWhois(c *client.Client, targetNick string) {
 	target := h.clients.GetClient(targetNick)
 
 	if target == nil {
+		if ru, ok := h.remoteUser(targetNick); ok {
+			h.sendRemoteWhois(c, ru)
+			return
+		}
 		h.sendNumeric(c, ERR_NOSUCHNICK, targetNick+" :No such nick/channel")
 		h.sendNumeric(c, RPL_ENDOFWHOIS, targetNick+" :End of WHOIS list")
-		return nil
+		return
 	}
 
 	// Parse hostmask
@@ -1392,19 +2276,22 @@ func (h *Handler) handleWhois(c *client.Client, msg *parser.Message) error {
 	// RPL_WHOISCHANNELS: <nick> :<channels>
 	channels := target.GetChannels()
 	if len(channels) > 0 {
-		channelList := ""
-		for i, chName := range channels {
-			if i > 0 {
-				channelList += " "
-			}
+		var shown []string
+		for _, chName := range channels {
 			ch := h.channels.GetChannel(chName)
-			if ch != nil && ch.IsOperator(target) {
-				channelList += "@" + chName
-			} else {
-				channelList += chName
+			if ch == nil {
+				shown = append(shown, chName)
+				continue
 			}
+			// Secret channels are only shown to users who share them
+			if ch.HasMode('s') && c != target && !ch.HasMember(c) {
+				continue
+			}
+			shown = append(shown, ch.GetPrefix(target)+chName)
+		}
+		if len(shown) > 0 {
+			h.sendNumeric(c, RPL_WHOISCHANNELS, fmt.Sprintf("%s :%s", targetNick, strings.Join(shown, " ")))
 		}
-		h.sendNumeric(c, RPL_WHOISCHANNELS, fmt.Sprintf("%s :%s", targetNick, channelList))
 	}
 
 	// RPL_WHOISIDLE: <nick> <seconds> :seconds idle
@@ -1416,10 +2303,70 @@ func (h *Handler) handleWhois(c *client.Client, msg *parser.Message) error {
 		h.sendNumeric(c, RPL_WHOISOPERATOR, targetNick+" :is an IRC operator")
 	}
 
+	// Operators can see how the user is connected
+	if c.HasMode('o') {
+		h.sendNumeric(c, RPL_WHOISSPECIAL, fmt.Sprintf("%s :is connected via %s", targetNick, connectionDescription(target)))
+	}
+
 	// RPL_ENDOFWHOIS
 	h.sendNumeric(c, RPL_ENDOFWHOIS, targetNick+" :End of WHOIS list")
+}
 
-	return nil
+// sendRemoteWhois sends the WHOIS reply for a user on a linked server
+func (h *Handler) sendRemoteWhois(c *client.Client, ru *linking.RemoteUser) {
+	h.sendNumeric(c, RPL_WHOISUSER, fmt.Sprintf("%s %s %s * :%s", ru.Nick, ru.User, ru.Host, ru.RealName))
+
+	if away := ru.GetAway(); away != "" {
+		h.sendNumeric(c, RPL_AWAY, fmt.Sprintf("%s :%s", ru.Nick, away))
+	}
+
+	serverName, serverDesc := "*", "Remote server"
+	if ru.Server != nil {
+		serverName = ru.Server.Name
+		if ru.Server.Description != "" {
+			serverDesc = ru.Server.Description
+		}
+	}
+	h.sendNumeric(c, RPL_WHOISSERVER, fmt.Sprintf("%s %s :%s", ru.Nick, serverName, serverDesc))
+
+	if ru.HasMode('o') {
+		h.sendNumeric(c, RPL_WHOISOPERATOR, ru.Nick+" :is an IRC operator")
+	}
+
+	h.sendNumeric(c, RPL_ENDOFWHOIS, ru.Nick+" :End of WHOIS list")
+}
+
+// connectionDescription describes a client's transport for WHOIS
+func connectionDescription(c *client.Client) string {
+	switch {
+	case c.GetConnectionType() == client.WebSocket && c.IsSecure():
+		return "WebSocket (TLS)"
+	case c.GetConnectionType() == client.WebSocket:
+		return "WebSocket"
+	case c.IsSecure():
+		return "TLS"
+	default:
+		return "TCP"
+	}
+}
+
+// listVisibility reports whether ch appears in c's LIST. Secret channels are
+// hidden from non-members and private ones are shown as "Prv" without a
+// topic; IRC operators see them too, marked with their hiding mode. private reports that only the "Prv" placeholder may be shown.
+func (h *Handler) listVisibility(c *client.Client, ch *channel.Channel) (visible, private bool, marker string) {
+	hidden := ""
+	for _, mode := range "ps" {
+		if ch.HasMode(mode) {
+			hidden += string(mode)
+		}
+	}
+	if hidden == "" || ch.HasMember(c) {
+		return true, false, ""
+	}
+	if c.HasMode('o') {
+		return true, false, "[+" + hidden + "] "
+	}
+	return hidden == "p", hidden == "p", ""
 }
 
 // handleList handles the LIST command
@@ -1433,22 +2380,32 @@ func (h *Handler) handleList(c *client.Client, msg *parser.Message) error {
 	// RPL_LISTSTART
 	h.sendNumeric(c, RPL_LISTSTART, "Channel :Users  Name")
 
-	// If specific channel requested
+	var channels []*channel.Channel
 	if len(msg.Params) > 0 {
-		channelName := msg.Params[0]
-		ch := h.channels.GetChannel(channelName)
-		if ch != nil {
-			memberCount := len(ch.GetMembers())
-			topic := ch.GetTopic()
-			if topic == "" {
-				topic = "No topic"
+		// Specific channels requested
+		for _, channelName := range strings.Split(msg.Params[0], ",") {
+			if ch := h.channels.GetChannel(channelName); ch != nil {
+				channels = append(channels, ch)
 			}
-			h.sendNumeric(c, RPL_LIST, fmt.Sprintf("%s %d :%s", channelName, memberCount, topic))
 		}
 	} else {
-		// List all channels (simplified - in production you'd want to filter secret channels)
-		// For now, we'll just send empty list as we don't have a global channel list
-		// In a full implementation, you'd iterate through all channels
+		channels = h.channels.ListChannels()
+	}
+
+	for _, ch := range channels {
+		visible, private, marker := h.listVisibility(c, ch)
+		if !visible {
+			continue
+		}
+		if private {
+			h.sendNumeric(c, RPL_LIST, fmt.Sprintf("Prv %d :", len(ch.GetMembers())))
+			continue
+		}
+		topic := ch.GetTopic()
+		if topic == "" {
+			topic = "No topic"
+		}
+		h.sendNumeric(c, RPL_LIST, fmt.Sprintf("%s %d :%s%s", ch.GetName(), len(ch.GetMembers()), marker, topic))
 	}
 
 	// RPL_LISTEND
@@ -1465,6 +2422,12 @@ func (h *Handler) handleInvite(c *client.Client, msg *parser.Message) error {
 		return nil
 	}
 
+	// A bare INVITE lists the channels the client is invited to
+	if len(msg.Params) == 0 {
+		h.sendInviteList(c)
+		return nil
+	}
+
 	if len(msg.Params) < 2 {
 		h.sendNumeric(c, ERR_NEEDMOREPARAMS, "INVITE :Not enough parameters")
 		return nil
@@ -1487,7 +2450,7 @@ func (h *Handler) handleInvite(c *client.Client, msg *parser.Message) error {
 	}
 
 	// Check if inviter is an operator (required for invite-only channels)
-	if ch.HasMode('i') && !ch.IsOperator(c) {
+	if ch.HasMode('i') && ch.GetRank(c) < channel.RankOp {
 		h.sendNumeric(c, ERR_CHANOPRIVSNEEDED, channelName+" :You're not channel operator")
 		return nil
 	}
@@ -1505,6 +2468,8 @@ func (h *Handler) handleInvite(c *client.Client, msg *parser.Message) error {
 		return nil
 	}
 
+	h.AddInvite(ch, targetNick)
+
 	// Send confirmation to inviter
 	h.sendNumeric(c, RPL_INVITING, channelName+" "+targetNick)
 
@@ -1540,6 +2505,22 @@ func (h *Handler) handleInvite(c *client.Client, msg *parser.Message) error {
 	return nil
 }
 
+// AddInvite records an invite for nick to ch, expiring after InviteExpiry
+func (h *Handler) AddInvite(ch *channel.Channel, nick string) {
+	ch.AddInvite(nick, time.Now().Add(h.opts.InviteExpiry))
+}
+
+// sendInviteList sends RPL_INVITELIST for each channel c holds an unexpired
+// invite to, then RPL_ENDOFINVITELIST
+func (h *Handler) sendInviteList(c *client.Client) {
+	for _, ch := range h.channels.GetChannels() {
+		if ch.IsInvited(c.GetNickname()) {
+			h.sendNumeric(c, RPL_INVITELIST, ch.GetName())
+		}
+	}
+	h.sendNumeric(c, RPL_ENDOFINVITELIST, ":End of /INVITE list")
+}
+
 // handleOper handles the OPER command
 // OPER <name> <password>
 func (h *Handler) handleOper(c *client.Client, msg *parser.Message) error {
@@ -1555,12 +2536,27 @@ func (h *Handler) handleOper(c *client.Client, msg *parser.Message) error {
 
 	name := msg.Params[0]
 	password := msg.Params[1]
+	who := fmt.Sprintf("%s (%s@%s)", c.GetNickname(), c.GetUsername(), c.GetHostname())
+
+	// Refuse without checking the password while locked out
+	now := time.Now()
+	if wait := h.operLockout(c, now); wait > 0 {
+		seconds := int((wait + time.Second - 1) / time.Second)
+		description := fmt.Sprintf("Too many failed OPER attempts, try again in %d seconds", seconds)
+		if !h.sendStandardReply(c, replyFail, "OPER", codeRateLimited, description) {
+			h.sendNumeric(c, ERR_PASSWDMISMATCH, ":"+description)
+		}
+		h.logger.Warn("OPER attempt while locked out", "name", name, "client", c.GetNickname())
+		return nil
+	}
 
 	// Check if operator exists
 	hashedPassword, exists := h.operators[name]
 	if !exists {
 		h.sendNumeric(c, ERR_PASSWDMISMATCH, ":Password incorrect")
 		h.logger.Warn("OPER attempt with unknown name", "name", name, "client", c.GetNickname())
+		h.recordOperFailure(c, now)
+		h.sendSnotice('o', fmt.Sprintf("Failed OPER attempt by %s [%s]: unknown operator", who, name))
 		return nil
 	}
 
@@ -1569,16 +2565,27 @@ func (h *Handler) handleOper(c *client.Client, msg *parser.Message) error {
 	if err != nil {
 		h.sendNumeric(c, ERR_PASSWDMISMATCH, ":Password incorrect")
 		h.logger.Warn("OPER attempt with wrong password", "name", name, "client", c.GetNickname())
+		h.recordOperFailure(c, now)
+		h.sendSnotice('o', fmt.Sprintf("Failed OPER attempt by %s [%s]: wrong password", who, name))
 		return nil
 	}
 
-	// Grant operator status
+	h.clearOperFailures(c)
+	h.grantOper(c, name)
+	return nil
+}
+
+// grantOper gives a client operator status after a successful OPER (or
+// PASS on connect) as the named operator
+func (h *Handler) grantOper(c *client.Client, name string) {
+	who := fmt.Sprintf("%s (%s@%s)", c.GetNickname(), c.GetUsername(), c.GetHostname())
 	c.SetMode('o', true)
 	h.sendNumeric(c, RPL_YOUREOPER, ":You are now an IRC operator")
+	h.restoreSnomasks(c)
+	h.propagateUserMode(c, "+o")
+	h.sendSnotice('o', fmt.Sprintf("%s is now an operator [%s]", who, name))
 
 	h.logger.Info("User gained operator status", "nickname", c.GetNickname(), "oper_name", name)
-
-	return nil
 }
 
 // handleSquit handles the SQUIT command (Phase 7.4.5)
@@ -1624,6 +2631,364 @@ func (h *Handler) handleSquit(c *client.Client, msg *parser.Message) error {
 	return nil
 }
 
+// handleSajoin handles the SAJOIN command
+// SAJOIN <nick> <channel> forces a user into a channel, bypassing +i/+k/+b/+l
+func (h *Handler) handleSajoin(c *client.Client, msg *parser.Message) error {
+	if !c.IsRegistered() {
+		h.sendNumeric(c, ERR_NOTREGISTERED, ":You have not registered")
+		return nil
+	}
+
+	// Only operators can use SAJOIN
+	if !c.HasMode('o') {
+		h.sendNumeric(c, ERR_NOPRIVILEGES, ":Permission Denied- You're not an IRC operator")
+		return nil
+	}
+
+	if len(msg.Params) < 2 {
+		h.sendNumeric(c, ERR_NEEDMOREPARAMS, "SAJOIN :Not enough parameters")
+		return nil
+	}
+
+	targetNick := msg.Params[0]
+	channelName := msg.Params[1]
+
+	if !isValidChannelName(channelName) {
+		h.sendNumeric(c, ERR_NOSUCHCHANNEL, channelName+" :No such channel")
+		return nil
+	}
+
+	target := h.clients.GetClient(targetNick)
+	if target == nil {
+		// Not local - ask the user's server to do it
+		if h.router == nil || h.router.RouteSajoin(c.GetUID(), targetNick, channelName) != nil {
+			h.sendNumeric(c, ERR_NOSUCHNICK, targetNick+" :No such nick/channel")
+			return nil
+		}
+		h.logger.Info("Remote SAJOIN sent", "target", targetNick, "channel", channelName, "operator", c.GetNickname())
+		return nil
+	}
+
+	if !h.ForceJoin(target, channelName) {
+		h.sendNumeric(c, ERR_USERONCHANNEL, fmt.Sprintf("%s %s :is already on channel", targetNick, channelName))
+		return nil
+	}
+
+	h.logger.Info("SAJOIN", "target", targetNick, "channel", channelName, "operator", c.GetNickname())
+
+	return nil
+}
+
+// SendResumedState sends a resumed session the welcome burst and, for each
+// channel it is in, its JOIN, topic and names, without notifying anyone else
+func (h *Handler) SendResumedState(c *client.Client) {
+	h.sendWelcome(c)
+	
+	for _, channelName := range c.GetChannels() {
+		ch := h.channels.GetChannel(channelName)
+		if ch == nil {
+			continue
+		}
+		c.Send(fmt.Sprintf(":%s JOIN %s", c.GetHostmask(), channelName))
+		h.sendTopic(c, ch)
+		h.sendNamesList(c, ch)
+	}
+}
+
+// announceNickChange tells the client, its channels and linked servers about a nick change
+func (h *Handler) announceNickChange(c *client.Client, oldNick, newNick string) {
+	// Whoever takes the old nick must not inherit its ACCEPT entries, and
+	// WHOWAS remembers who used it
+	if !strings.EqualFold(oldNick, newNick) {
+		h.ForgetAccepted(oldNick)
+		h.rememberNick(c, oldNick)
+	}
+	
+	// Notify the client and all channels they're in
+	notification := fmt.Sprintf(":%s NICK :%s", oldNick, newNick)
+	c.Send(notification)
+	
+	// Broadcast to all channels, except where the client is still hidden by +D
+	for _, channelName := range c.GetChannels() {
+		if ch := h.channels.GetChannel(channelName); ch != nil && !ch.IsHidden(c) {
+			ch.Broadcast(notification, c)
+		}
+	}
+	
+	// Propagate NICK to remote servers (Phase 7.4.3)
+	if h.router != nil {
+		parts := strings.SplitN(c.GetHostmask(), "!", 2)
+		user := ""
+		host := ""
+		if len(parts) == 2 {
+			userhost := strings.SplitN(parts[1], "@", 2)
+			if len(userhost) == 2 {
+				user = userhost[0]
+				host = userhost[1]
+			}
+		}
+		
+		uid := c.GetUID()
+		if uid == "" {
+			uid = newNick
+		}
+		
+		if err := h.router.PropagateNick(oldNick, newNick, user, host, uid, c.GetNickTS()); err != nil {
+			h.logger.Debug("Failed to propagate NICK", "error", err)
+		}
+	}
+}
+
+// ForceNick changes a registered local client's nickname without validating
+// it, e.g. to their UID after losing a nick collision. It returns false if the
+// new nickname could not be registered.
+func (h *Handler) ForceNick(c *client.Client, newNick string) bool {
+	oldNick := c.GetNickname()
+	if oldNick == newNick {
+		return false
+	}
+	
+	if err := h.renameClient(c, oldNick, newNick); err != nil {
+		h.logger.Warn("Failed to force nick change", "error", err, "oldNick", oldNick, "newNick", newNick)
+		return false
+	}
+	
+	h.announceNickChange(c, oldNick, newNick)
+	return true
+}
+
+// renameClient changes a registered client's nickname in the registry and
+// in the member lists of its channels
+func (h *Handler) renameClient(c *client.Client, oldNick, newNick string) error {
+	if err := h.clients.RenameClient(oldNick, newNick); err != nil {
+		return err
+	}
+	c.SetNickname(newNick)
+	for _, channelName := range c.GetChannels() {
+		if ch := h.channels.GetChannel(channelName); ch != nil {
+			ch.RenameMember(oldNick, newNick)
+		}
+	}
+	return nil
+}
+
+// ForceJoin joins a local client to a channel without checking any channel
+// restrictions. It returns false if the client is already a member.
+func (h *Handler) ForceJoin(c *client.Client, channelName string) bool {
+	ch := h.channels.CreateChannel(channelName)
+	if ch.HasMember(c) {
+		return false
+	}
+
+	h.joinChannel(c, ch)
+	return true
+}
+
+// handleSapart handles the SAPART command
+// SAPART <nick> <channel> [:reason] forces a user to leave a channel
+func (h *Handler) handleSapart(c *client.Client, msg *parser.Message) error {
+	if !c.IsRegistered() {
+		h.sendNumeric(c, ERR_NOTREGISTERED, ":You have not registered")
+		return nil
+	}
+
+	// Only operators can use SAPART
+	if !c.HasMode('o') {
+		h.sendNumeric(c, ERR_NOPRIVILEGES, ":Permission Denied- You're not an IRC operator")
+		return nil
+	}
+
+	if len(msg.Params) < 2 {
+		h.sendNumeric(c, ERR_NEEDMOREPARAMS, "SAPART :Not enough parameters")
+		return nil
+	}
+
+	targetNick := msg.Params[0]
+	channelName := msg.Params[1]
+	reason := "Leaving"
+	if len(msg.Params) > 2 {
+		reason = msg.Params[2]
+	}
+
+	if !isValidChannelName(channelName) {
+		h.sendNumeric(c, ERR_NOSUCHCHANNEL, channelName+" :No such channel")
+		return nil
+	}
+
+	target := h.clients.GetClient(targetNick)
+	if target == nil {
+		// Not local - ask the user's server to do it
+		if h.router == nil || h.router.RouteSapart(c.GetUID(), targetNick, channelName, reason) != nil {
+			h.sendNumeric(c, ERR_NOSUCHNICK, targetNick+" :No such nick/channel")
+			return nil
+		}
+		h.logger.Info("Remote SAPART sent", "target", targetNick, "channel", channelName, "operator", c.GetNickname())
+		return nil
+	}
+
+	if !h.ForcePart(target, channelName, reason) {
+		h.sendNumeric(c, ERR_USERNOTINCHANNEL, fmt.Sprintf("%s %s :They aren't on that channel", targetNick, channelName))
+		return nil
+	}
+
+	h.logger.Info("SAPART", "target", targetNick, "channel", channelName, "operator", c.GetNickname())
+
+	return nil
+}
+
+// ForcePart removes a local client from a channel as if they had sent PART.
+// It returns false if the client is not a member.
+func (h *Handler) ForcePart(c *client.Client, channelName, reason string) bool {
+	ch := h.channels.GetChannel(channelName)
+	if ch == nil || !ch.HasMember(c) {
+		return false
+	}
+
+	h.partChannel(c, ch, reason)
+	return true
+}
+
+// clearableLists are the mask lists CLEARBANS empties by default
+const clearableLists = "beIq"
+
+// handleClearbans handles the CLEARBANS command
+// CLEARBANS <channel> [lists] empties the channel's ban (b), exception (e),
+// invite exception (I) and quiet (q) lists, or just the ones given
+func (h *Handler) handleClearbans(c *client.Client, msg *parser.Message) error {
+	if !c.IsRegistered() {
+		h.sendNumeric(c, ERR_NOTREGISTERED, ":You have not registered")
+		return nil
+	}
+
+	// Only operators can use CLEARBANS
+	if !c.HasMode('o') {
+		h.sendNumeric(c, ERR_NOPRIVILEGES, ":Permission Denied- You're not an IRC operator")
+		return nil
+	}
+
+	if !msg.HasParam(0) {
+		h.sendNumeric(c, ERR_NEEDMOREPARAMS, "CLEARBANS :Not enough parameters")
+		return nil
+	}
+
+	channelName := msg.GetParam(0)
+	ch := h.channels.GetChannel(channelName)
+	if ch == nil {
+		h.sendNumeric(c, ERR_NOSUCHCHANNEL, channelName+" :No such channel")
+		return nil
+	}
+
+	lists := clearableLists
+	if msg.HasParam(1) {
+		lists = msg.GetParam(1)
+	}
+	for _, m := range lists {
+		if !strings.ContainsRune(clearableLists, m) {
+			h.sendNumeric(c, ERR_UNKNOWNMODE, fmt.Sprintf("%c :is unknown mode char to me", m))
+			return nil
+		}
+	}
+
+	removed := 0
+	for _, m := range lists {
+		for _, mask := range ch.ClearList(m) {
+			removed++
+			ch.BroadcastAll(fmt.Sprintf(":%s MODE %s -%c %s", h.serverName, channelName, m, mask))
+
+			if h.router != nil {
+				if err := h.router.PropagateServerMode(channelName, fmt.Sprintf("-%c %s", m, mask), time.Now().Unix()); err != nil {
+					h.logger.Debug("Failed to propagate MODE", "error", err)
+				}
+			}
+		}
+	}
+
+	c.Send(fmt.Sprintf(":%s NOTICE %s :Removed %d mask(s) from %s", h.serverName, c.GetNickname(), removed, channelName))
+	h.logger.Info("CLEARBANS", "oper", c.GetNickname(), "channel", channelName, "lists", lists, "masks", removed)
+	return nil
+}
+
+// handleOmode handles the OMODE command
+// OMODE <channel> <modes> [args] changes modes on any channel, bypassing the
+// membership and channel operator checks
+func (h *Handler) handleOmode(c *client.Client, msg *parser.Message) error {
+	if !c.IsRegistered() {
+		h.sendNumeric(c, ERR_NOTREGISTERED, ":You have not registered")
+		return nil
+	}
+
+	// Only operators can use OMODE
+	if !c.HasMode('o') {
+		h.sendNumeric(c, ERR_NOPRIVILEGES, ":Permission Denied- You're not an IRC operator")
+		return nil
+	}
+
+	if len(msg.Params) < 2 {
+		h.sendNumeric(c, ERR_NEEDMOREPARAMS, "OMODE :Not enough parameters")
+		return nil
+	}
+
+	channelName := msg.GetParam(0)
+	ch := h.channels.GetChannel(channelName)
+	if ch == nil {
+		h.sendNumeric(c, ERR_NOSUCHCHANNEL, channelName+" :No such channel")
+		return nil
+	}
+
+	applied := h.applyChannelModes(c, ch, msg.Params[1], msg.Params[2:], true, h.serverName)
+	if applied == "" {
+		return nil
+	}
+
+	// An empty channel that just lost +P goes away like any other
+	if ch.IsEmpty() {
+		h.channels.RemoveChannel(channelName)
+	}
+
+	c.Send(fmt.Sprintf(":%s NOTICE %s :OMODE %s %s", h.serverName, c.GetNickname(), channelName, applied))
+	h.logger.Info("OMODE", "oper", c.GetNickname(), "channel", channelName, "modes", applied)
+	return nil
+}
+
+// handleLinks handles the LINKS command
+// LINKS lists every server in the network; operators also see peer versions
+// and link latency
+func (h *Handler) handleLinks(c *client.Client, msg *parser.Message) error {
+	if !c.IsRegistered() {
+		h.sendNumeric(c, ERR_NOTREGISTERED, ":You have not registered")
+		return nil
+	}
+
+	if h.router != nil {
+		for _, srv := range h.router.GetLinkedServers() {
+			uplink := h.serverName
+			via := h.router.GetServerUplink(srv)
+			if via != nil {
+				uplink = via.Name
+			}
+
+			info := srv.Description
+			if c.HasMode('o') {
+				if srv.Version != "" {
+					info += " [" + srv.Version + "]"
+				}
+				// Only our own links are pinged
+				if via == nil {
+					last, avg := srv.GetLatency()
+					info += fmt.Sprintf(" [lag %dms avg %dms]", last.Milliseconds(), avg.Milliseconds())
+				}
+			}
+
+			h.sendNumeric(c, RPL_LINKS, fmt.Sprintf("%s %s :%d %s", srv.Name, uplink, srv.Distance, info))
+		}
+	}
+
+	h.sendNumeric(c, RPL_LINKS, fmt.Sprintf("%s %s :0 IRC Server", h.serverName, h.serverName))
+	h.sendNumeric(c, RPL_ENDOFLINKS, "* :End of LINKS list")
+
+	return nil
+}
+
 // handleAway handles the AWAY command
 // AWAY [<message>]
 func (h *Handler) handleAway(c *client.Client, msg *parser.Message) error {
@@ -1636,6 +3001,7 @@ func (h *Handler) handleAway(c *client.Client, msg *parser.Message) error {
 	if !msg.HasParam(0) || msg.GetParam(0) == "" {
 		c.SetAway("")
 		h.sendNumeric(c, RPL_UNAWAY, ":You are no longer marked as being away")
+		h.propagateAway(c, "")
 		h.logger.Debug("User no longer away", "nickname", c.GetNickname())
 		return nil
 	}
@@ -1644,12 +3010,23 @@ func (h *Handler) handleAway(c *client.Client, msg *parser.Message) error {
 	awayMsg := msg.GetParam(0)
 	c.SetAway(awayMsg)
 	h.sendNumeric(c, RPL_NOWAWAY, ":You have been marked as being away")
+	h.propagateAway(c, awayMsg)
 
 	h.logger.Debug("User marked as away", "nickname", c.GetNickname(), "message", awayMsg)
 
 	return nil
 }
 
+// propagateAway tells linked servers that c went away or came back
+func (h *Handler) propagateAway(c *client.Client, message string) {
+	if h.router == nil || c.GetUID() == "" {
+		return
+	}
+	if err := h.router.PropagateAway(c.GetUID(), message); err != nil {
+		h.logger.Debug("Failed to propagate AWAY", "error", err)
+	}
+}
+
 // handleUserhost handles the USERHOST command
 // USERHOST <nickname> [<nickname> ...]
 func (h *Handler) handleUserhost(c *client.Client, msg *parser.Message) error {
@@ -1663,12 +3040,10 @@ func (h *Handler) handleUserhost(c *client.Client, msg *parser.Message) error {
 		return nil
 	}
 
-	// Build response for up to 5 nicknames (RFC limit)
+	// Build response for up to MaxTargets nicknames (RFC suggests 5)
 	var responses []string
-	maxNicks := 5
 
-	for i := 0; i < len(msg.Params) && len(responses) < maxNicks; i++ {
-		nick := msg.Params[i]
+	for _, nick := range h.limitTargets(c, "USERHOST", msg.Params, h.opts.MaxTargets) {
 		target := h.clients.GetClient(nick)
 		
 		if target != nil {
@@ -1706,6 +3081,20 @@ func (h *Handler) handleUserhost(c *client.Client, msg *parser.Message) error {
 				host)
 			
 			responses = append(responses, response)
+		} else if remote, ok := h.remoteUser(nick); ok {
+			// Users on linked servers, from their UID introduction
+			operFlag := ""
+			if remote.HasMode('o') {
+				operFlag = "*"
+			}
+			
+			awayFlag := "+"
+			if remote.GetAway() != "" {
+				awayFlag = "-"
+			}
+			
+			responses = append(responses, fmt.Sprintf("%s%s=%s%s@%s",
+				remote.Nick, operFlag, awayFlag, remote.User, remote.Host))
 		}
 	}
 
@@ -1716,6 +3105,14 @@ func (h *Handler) handleUserhost(c *client.Client, msg *parser.Message) error {
 	return nil
 }
 
+// remoteUser looks up a user on a linked server by nickname
+func (h *Handler) remoteUser(nick string) (*linking.RemoteUser, bool) {
+	if h.router == nil {
+		return nil, false
+	}
+	return h.router.GetRemoteUserByNick(nick)
+}
+
 // handleIson handles the ISON command
 // ISON <nickname> [<nickname> ...]
 func (h *Handler) handleIson(c *client.Client, msg *parser.Message) error {
@@ -1732,9 +3129,11 @@ func (h *Handler) handleIson(c *client.Client, msg *parser.Message) error {
 	// Check which nicknames are online
 	var onlineNicks []string
 
-	for _, nick := range msg.Params {
+	for _, nick := range h.limitTargets(c, "ISON", msg.Params, h.opts.MaxISON) {
 		if h.clients.GetClient(nick) != nil {
 			onlineNicks = append(onlineNicks, nick)
+		} else if _, ok := h.remoteUser(nick); ok {
+			onlineNicks = append(onlineNicks, nick)
 		}
 	}
 
@@ -1,12 +1,18 @@
 package commands
 
 import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/supamanluva/ircd/internal/channel"
 	"github.com/supamanluva/ircd/internal/client"
 	"github.com/supamanluva/ircd/internal/logger"
 	"github.com/supamanluva/ircd/internal/parser"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // Mock client registry for testing
@@ -33,11 +39,39 @@ func (m *mockClientRegistry) RemoveClient(c *client.Client) {
 	delete(m.clients, c.GetNickname())
 }
 
+func (m *mockClientRegistry) RenameClient(oldNick, newNick string) error {
+	c, ok := m.clients[oldNick]
+	if !ok {
+		return fmt.Errorf("no client with nickname %s", oldNick)
+	}
+	delete(m.clients, oldNick)
+	m.clients[newNick] = c
+	return nil
+}
+
 func (m *mockClientRegistry) IsNicknameInUse(nickname string) bool {
 	_, exists := m.clients[nickname]
 	return exists
 }
 
+func (m *mockClientRegistry) GetClientsByAccount(account string) []*client.Client {
+	var sessions []*client.Client
+	for _, c := range m.clients {
+		if c.GetAccount() == account {
+			sessions = append(sessions, c)
+		}
+	}
+	return sessions
+}
+
+func (m *mockClientRegistry) GetClients() []*client.Client {
+	clients := make([]*client.Client, 0, len(m.clients))
+	for _, c := range m.clients {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
 // Mock channel registry for testing
 type mockChannelRegistry struct {
 	channels map[string]*channel.Channel
@@ -66,6 +100,20 @@ func (m *mockChannelRegistry) RemoveChannel(name string) {
 	delete(m.channels, name)
 }
 
+func (m *mockChannelRegistry) GetChannels() []*channel.Channel {
+	channels := make([]*channel.Channel, 0, len(m.channels))
+	for _, ch := range m.channels {
+		channels = append(channels, ch)
+	}
+	return channels
+}
+
+func (m *mockChannelRegistry) ListChannels() []*channel.Channel {
+	channels := m.GetChannels()
+	sort.Slice(channels, func(i, j int) bool { return channels[i].GetName() < channels[j].GetName() })
+	return channels
+}
+
 func TestIsValidNickname(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -95,7 +143,7 @@ func TestIsValidNickname(t *testing.T) {
 func TestHandleNick(t *testing.T) {
 	log := logger.New()
 	registry := newMockClientRegistry()
-	handler := New("testserver", log, registry, &mockChannelRegistry{})
+	handler := New("testserver", log, registry, &mockChannelRegistry{}, nil)
 
 	tests := []struct {
 		name        string
@@ -149,7 +197,7 @@ func TestHandleNick(t *testing.T) {
 func TestHandlePing(t *testing.T) {
 	log := logger.New()
 	registry := newMockClientRegistry()
-	handler := New("testserver", log, registry, &mockChannelRegistry{})
+	handler := New("testserver", log, registry, &mockChannelRegistry{}, nil)
 
 	tests := []struct {
 		name        string
@@ -223,7 +271,7 @@ func TestNumericReply(t *testing.T) {
 func TestHandleUser(t *testing.T) {
 	log := logger.New()
 	registry := newMockClientRegistry()
-	handler := New("testserver", log, registry, newMockChannelRegistry())
+	handler := New("testserver", log, registry, newMockChannelRegistry(), nil)
 
 	tests := []struct {
 		name        string
@@ -279,10 +327,323 @@ func TestHandleUser(t *testing.T) {
 	}
 }
 
+func TestHandleUserModeBitmask(t *testing.T) {
+	log := logger.New()
+	handler := New("testserver", log, newMockClientRegistry(), newMockChannelRegistry(), nil)
+
+	tests := []struct {
+		name      string
+		mode      string
+		wantModes string
+	}{
+		{"Invisible", "8", "+i"},
+		{"Wallops", "4", "+w"},
+		{"Both", "12", "+iw"},
+		{"None", "0", ""},
+		{"RFC 1459 hostname", "localhost", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := client.NewMock(log)
+			nick := "u" + tt.mode
+			msg, _ := parser.Parse("NICK " + nick)
+			handler.Handle(c, msg)
+			msg, _ = parser.Parse("USER x " + tt.mode + " * :name")
+			handler.Handle(c, msg)
+
+			if !c.IsRegistered() {
+				t.Fatal("client did not register")
+			}
+			if got := c.GetModes(); got != tt.wantModes {
+				t.Errorf("modes = %q, want %q", got, tt.wantModes)
+			}
+			confirmed := strings.Contains(strings.Join(c.SentMessages(), "\n"), " MODE "+nick+" :"+tt.wantModes)
+			if confirmed != (tt.wantModes != "") {
+				t.Errorf("MODE confirmation sent = %v, want %v", confirmed, tt.wantModes != "")
+			}
+		})
+	}
+}
+
+func TestOperFailureLockout(t *testing.T) {
+	log := logger.New()
+	clientReg := newMockClientRegistry()
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := New("testserver", log, clientReg, newMockChannelRegistry(), []Operator{{Name: "admin", Password: string(hash)}})
+	handler.SetOptions(Options{OperMaxFailures: 3, OperLockout: 100 * time.Millisecond})
+
+	newUser := func(nick string) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetUsername(nick, nick)
+		c.SetRegistered(true)
+		clientReg.AddClient(c)
+		return c
+	}
+	watcher := newUser("watcher")
+	watcher.SetMode('o', true)
+	watcher.SetMode('s', true)
+	watcher.SetSnomask('o', true)
+	attacker := newUser("attacker")
+
+	oper := func(c *client.Client, password string) string {
+		msg, _ := parser.Parse("OPER admin " + password)
+		handler.Handle(c, msg)
+		return strings.Join(c.SentMessages(), "\n")
+	}
+
+	for i := 0; i < 3; i++ {
+		if out := oper(attacker, "guess"); !strings.Contains(out, ":Password incorrect") {
+			t.Fatalf("attempt %d: %q", i, out)
+		}
+	}
+	if notices := strings.Join(watcher.SentMessages(), "\n"); strings.Count(notices, "Failed OPER attempt by attacker") != 3 {
+		t.Errorf("watcher got %q, want a notice per failed attempt", notices)
+	}
+
+	// Locked out: even the right password is refused, from any client on the IP
+	if out := oper(attacker, "secret"); !strings.Contains(out, "Too many failed OPER attempts") || attacker.HasMode('o') {
+		t.Errorf("locked out client got %q", out)
+	}
+	sameIP := newUser("sameip")
+	if out := oper(sameIP, "secret"); !strings.Contains(out, "Too many failed OPER attempts") || sameIP.HasMode('o') {
+		t.Errorf("client on a locked out IP got %q", out)
+	}
+
+	// After the lockout a correct password works and is announced
+	time.Sleep(150 * time.Millisecond)
+	if out := oper(attacker, "secret"); !strings.Contains(out, " "+RPL_YOUREOPER+" ") || !attacker.HasMode('o') {
+		t.Fatalf("OPER after lockout got %q", out)
+	}
+	if notices := strings.Join(watcher.SentMessages(), "\n"); !strings.Contains(notices, "*** Notice -- attacker (attacker@test.host) is now an operator [admin]") {
+		t.Errorf("watcher got %q, want an oper-up notice", notices)
+	}
+}
+
+func TestClientTagRelay(t *testing.T) {
+	log := logger.New()
+	clientReg := newMockClientRegistry()
+	handler := New("testserver", log, clientReg, newMockChannelRegistry(), nil)
+	handler.SetOptions(Options{MaxTagLength: 64})
+
+	newUser := func(nick string) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetUsername(nick, nick)
+		c.SetRegistered(true)
+		clientReg.AddClient(c)
+		return c
+	}
+	alice := newUser("alice")
+	tagged := newUser("tagged")
+	tagged.SetCap(capMessageTags, true)
+	plain := newUser("plain")
+
+	send := func(line string) {
+		msg, err := parser.Parse(line)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", line, err)
+		}
+		handler.Handle(alice, msg)
+	}
+	for _, c := range []*client.Client{alice, tagged, plain} {
+		msg, _ := parser.Parse("JOIN #test")
+		handler.Handle(c, msg)
+	}
+	for _, c := range []*client.Client{alice, tagged, plain} {
+		c.SentMessages()
+	}
+
+	// Client-only tags reach message-tags clients; server tags are dropped
+	send(`@+draft/reply=abc;+note=a\sb;time=2024-01-01 PRIVMSG #test :hi`)
+	want := `@+draft/reply=abc;+note=a\sb :alice!alice@test.host PRIVMSG #test :hi`
+	if got := strings.Join(tagged.SentMessages(), "\n"); got != want {
+		t.Errorf("capable member got %q, want %q", got, want)
+	}
+	if got := strings.Join(plain.SentMessages(), "\n"); got != ":alice!alice@test.host PRIVMSG #test :hi" {
+		t.Errorf("member without message-tags got %q", got)
+	}
+
+	send("@+draft/reply=abc PRIVMSG tagged :psst")
+	if got := strings.Join(tagged.SentMessages(), "\n"); got != "@+draft/reply=abc :alice!alice@test.host PRIVMSG tagged :psst" {
+		t.Errorf("private message got %q", got)
+	}
+
+	// Only whitelisted client-only tags are relayed when a whitelist is set
+	handler.SetOptions(Options{MaxTagLength: 64, ClientTags: []string{"draft/reply"}})
+	send("@+draft/reply=abc;+note=x PRIVMSG tagged :again")
+	if got := strings.Join(tagged.SentMessages(), "\n"); got != "@+draft/reply=abc :alice!alice@test.host PRIVMSG tagged :again" {
+		t.Errorf("whitelisted relay got %q", got)
+	}
+
+	// Tags over the limit are refused outright
+	send("@+note=" + strings.Repeat("x", 64) + " PRIVMSG tagged :too long")
+	if got := tagged.SentMessages(); len(got) != 0 {
+		t.Errorf("message with oversized tags was delivered: %q", got)
+	}
+	if out := strings.Join(alice.SentMessages(), "\n"); !strings.Contains(out, " "+ERR_INPUTTOOLONG+" alice :Input line was too long") {
+		t.Errorf("expected ERR_INPUTTOOLONG, got %q", out)
+	}
+}
+
+func TestRegistrationLockdown(t *testing.T) {
+	log := logger.New()
+	clientReg := newMockClientRegistry()
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := New("testserver", log, clientReg, newMockChannelRegistry(), []Operator{{Name: "admin", Password: string(hash)}})
+	handler.SetOptions(Options{Lockdown: true})
+
+	// register sends the lines of a new connection, returning the last error
+	register := func(c *client.Client, lines ...string) (string, error) {
+		var lastErr error
+		for _, line := range lines {
+			msg, _ := parser.Parse(line)
+			if err := handler.Handle(c, msg); err != nil {
+				lastErr = err
+			}
+		}
+		return strings.Join(c.SentMessages(), "\n"), lastErr
+	}
+
+	user := client.NewMock(log)
+	out, err := register(user, "NICK user", "USER user 0 * :User")
+	if !errors.Is(err, ErrCloseLink) || user.IsRegistered() {
+		t.Errorf("non-oper registered during lockdown (err %v)", err)
+	}
+	if !strings.Contains(out, "NOTICE AUTH :*** This server is locked down") || !strings.HasSuffix(out, "(Server is in maintenance lockdown, try again later)") {
+		t.Errorf("expected a lockdown notice then ERROR, got %q", out)
+	}
+
+	oper := client.NewMock(log)
+	out, err = register(oper, "PASS admin:secret", "NICK boss", "USER boss 0 * :Boss")
+	if err != nil || !oper.IsRegistered() || !oper.HasMode('o') {
+		t.Fatalf("oper could not register during lockdown (err %v): %q", err, out)
+	}
+	if !strings.Contains(out, " "+RPL_WELCOME+" boss ") || !strings.Contains(out, " "+RPL_YOUREOPER+" boss ") {
+		t.Errorf("expected welcome and RPL_YOUREOPER, got %q", out)
+	}
+
+	// A wrong PASS is no way in
+	guesser := client.NewMock(log)
+	if _, err := register(guesser, "PASS admin:guess", "NICK guesser", "USER g 0 * :G"); !errors.Is(err, ErrCloseLink) {
+		t.Errorf("wrong PASS got through the lockdown (err %v)", err)
+	}
+
+	// Operators lift the lockdown at runtime
+	out, _ = register(oper, "LOCKDOWN OFF")
+	if !strings.Contains(out, "Registration lockdown is OFF") || handler.IsLockedDown() {
+		t.Errorf("LOCKDOWN OFF got %q", out)
+	}
+	late := client.NewMock(log)
+	if _, err := register(late, "NICK late", "USER late 0 * :Late"); err != nil || !late.IsRegistered() {
+		t.Errorf("registration refused after the lockdown was lifted (err %v)", err)
+	}
+	if out, _ := register(late, "LOCKDOWN ON"); !strings.Contains(out, " "+ERR_NOPRIVILEGES+" ") || handler.IsLockedDown() {
+		t.Errorf("non-oper could turn the lockdown on: %q", out)
+	}
+}
+
+func TestMaxPerUserHost(t *testing.T) {
+	log := logger.New()
+	clientReg := newMockClientRegistry()
+	handler := New("testserver", log, clientReg, newMockChannelRegistry(), nil)
+	handler.SetOptions(Options{MaxPerUserHost: 2})
+
+	register := func(nick string) (*client.Client, error) {
+		c := client.NewMock(log)
+		msg, _ := parser.Parse("NICK " + nick)
+		handler.Handle(c, msg)
+		msg, _ = parser.Parse("USER clone 0 * :Clone")
+		return c, handler.Handle(c, msg)
+	}
+
+	first, _ := register("clone1")
+	if _, err := register("clone2"); err != nil {
+		t.Fatalf("second client refused: %v", err)
+	}
+
+	third, err := register("clone3")
+	if !errors.Is(err, ErrCloseLink) || third.IsRegistered() {
+		t.Fatalf("third client: err = %v, registered = %v, want ErrCloseLink", err, third.IsRegistered())
+	}
+	sent := strings.Join(third.SentMessages(), "\n")
+	if !strings.Contains(sent, "ERROR :Closing Link: test.host (Too many connections from ~clone@test.host, limit is 2)") {
+		t.Errorf("refused client got %q", sent)
+	}
+
+	// Operators don't count against the limit
+	first.SetMode('o', true)
+	if c, err := register("clone4"); err != nil || !c.IsRegistered() {
+		t.Errorf("client refused although one clone is an operator: %v", err)
+	}
+}
+
+func TestHandleUserSanitizesFields(t *testing.T) {
+	log := logger.New()
+	handler := New("testserver", log, newMockClientRegistry(), newMockChannelRegistry(), nil)
+	handler.SetOptions(Options{UserLen: 8})
+
+	tests := []struct {
+		name       string
+		input      string
+		expectUser string
+		expectReal string
+	}{
+		{
+			name:       "Plain username gets unverified prefix",
+			input:      "USER alice 0 * :Alice",
+			expectUser: "~alice",
+			expectReal: "Alice",
+		},
+		{
+			name:       "Control characters and spaces stripped",
+			input:      "USER al\x01i\x07ce 0 * :\x02Alice\x02 W",
+			expectUser: "~alice",
+			expectReal: "Alice W",
+		},
+		{
+			name:       "Over-length username truncated",
+			input:      "USER averyveryverylongname 0 * :Long",
+			expectUser: "~averyve",
+			expectReal: "Long",
+		},
+		{
+			name:       "Invalid username rejected",
+			input:      "USER !@# 0 * :Nobody",
+			expectUser: "",
+			expectReal: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := client.NewMock(log)
+			msg, _ := parser.Parse(tt.input)
+			if err := handler.handleUser(c, msg); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got := c.GetUsername(); got != tt.expectUser {
+				t.Errorf("username = %q, want %q", got, tt.expectUser)
+			}
+			if got := c.GetRealname(); got != tt.expectReal {
+				t.Errorf("realname = %q, want %q", got, tt.expectReal)
+			}
+		})
+	}
+}
+
 func TestHandlePong(t *testing.T) {
 	log := logger.New()
 	registry := newMockClientRegistry()
-	handler := New("testserver", log, registry, newMockChannelRegistry())
+	handler := New("testserver", log, registry, newMockChannelRegistry(), nil)
 
 	tests := []struct {
 		name        string
@@ -318,7 +679,7 @@ func TestHandlePong(t *testing.T) {
 func TestHandleQuit(t *testing.T) {
 	log := logger.New()
 	registry := newMockClientRegistry()
-	handler := New("testserver", log, registry, newMockChannelRegistry())
+	handler := New("testserver", log, registry, newMockChannelRegistry(), nil)
 
 	tests := []struct {
 		name        string
@@ -360,7 +721,7 @@ func TestHandleJoin(t *testing.T) {
 	log := logger.New()
 	clientReg := newMockClientRegistry()
 	channelReg := newMockChannelRegistry()
-	handler := New("testserver", log, clientReg, channelReg)
+	handler := New("testserver", log, clientReg, channelReg, nil)
 
 	tests := []struct {
 		name        string
@@ -427,7 +788,7 @@ func TestHandlePart(t *testing.T) {
 	log := logger.New()
 	clientReg := newMockClientRegistry()
 	channelReg := newMockChannelRegistry()
-	handler := New("testserver", log, clientReg, channelReg)
+	handler := New("testserver", log, clientReg, channelReg, nil)
 
 	tests := []struct {
 		name        string
@@ -488,7 +849,7 @@ func TestHandlePrivmsg(t *testing.T) {
 	log := logger.New()
 	clientReg := newMockClientRegistry()
 	channelReg := newMockChannelRegistry()
-	handler := New("testserver", log, clientReg, channelReg)
+	handler := New("testserver", log, clientReg, channelReg, nil)
 
 	tests := []struct {
 		name        string
@@ -560,7 +921,7 @@ func TestHandleNotice(t *testing.T) {
 	log := logger.New()
 	clientReg := newMockClientRegistry()
 	channelReg := newMockChannelRegistry()
-	handler := New("testserver", log, clientReg, channelReg)
+	handler := New("testserver", log, clientReg, channelReg, nil)
 
 	tests := []struct {
 		name        string
@@ -616,7 +977,7 @@ func TestHandleNames(t *testing.T) {
 	log := logger.New()
 	clientReg := newMockClientRegistry()
 	channelReg := newMockChannelRegistry()
-	handler := New("testserver", log, clientReg, channelReg)
+	handler := New("testserver", log, clientReg, channelReg, nil)
 
 	tests := []struct {
 		name        string
@@ -665,11 +1026,188 @@ func TestHandleNames(t *testing.T) {
 	}
 }
 
+func TestProtoctlNames(t *testing.T) {
+	log := logger.New()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, newMockClientRegistry(), channelReg, nil)
+
+	newMember := func(nick string) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetUsername(nick, nick)
+		c.SetRegistered(true)
+		return c
+	}
+	ch := channelReg.CreateChannel("#test")
+	boss := newMember("boss")
+	ch.AddMember(boss)
+	ch.SetOperator(boss, true)
+	ch.SetVoice(boss, true)
+
+	tests := []struct {
+		name     string
+		protoctl string
+		want     string
+	}{
+		{"Plain", "", "@boss"},
+		{"NAMESX", "PROTOCTL NAMESX", "@+boss"},
+		{"UHNAMES", "PROTOCTL UHNAMES", "@" + boss.GetHostmask()},
+		{"Both", "PROTOCTL NAMESX UHNAMES", "@+" + boss.GetHostmask()},
+		{"Unknown token ignored", "PROTOCTL FOO", "@boss"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newMember("viewer")
+			if tt.protoctl != "" {
+				msg, _ := parser.Parse(tt.protoctl)
+				handler.Handle(c, msg)
+			}
+
+			msg, _ := parser.Parse("NAMES #test")
+			handler.Handle(c, msg)
+			out := strings.Join(c.SentMessages(), "\n")
+			if !strings.Contains(out, " "+RPL_NAMREPLY+" viewer = #test :"+tt.want+"\n") {
+				t.Errorf("NAMES reply = %q, want entry %q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestCapUserhostInNames(t *testing.T) {
+	log := logger.New()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, newMockClientRegistry(), channelReg, nil)
+
+	run := func(c *client.Client, lines ...string) string {
+		for _, line := range lines {
+			msg, _ := parser.Parse(line)
+			handler.Handle(c, msg)
+		}
+		return strings.Join(c.SentMessages(), "\n")
+	}
+
+	// A capable client negotiates before registering
+	capable := client.NewMock(log)
+	out := run(capable, "CAP LS 302", "NICK capable", "USER capable 0 * :Capable")
+	if !strings.Contains(out, "CAP * LS :draft/read-marker multi-prefix userhost-in-names") {
+		t.Errorf("CAP LS reply = %q", out)
+	}
+	if capable.IsRegistered() {
+		t.Fatal("client registered before CAP END")
+	}
+	out = run(capable, "CAP REQ :userhost-in-names bogus-cap")
+	if !strings.Contains(out, "CAP capable NAK :userhost-in-names bogus-cap") || capable.HasCap(capUserhostInNames) {
+		t.Errorf("request with an unknown cap was not refused: %q", out)
+	}
+	out = run(capable, "CAP REQ :userhost-in-names", "CAP END")
+	if !strings.Contains(out, "CAP capable ACK :userhost-in-names") {
+		t.Errorf("CAP REQ reply = %q", out)
+	}
+	if !capable.IsRegistered() {
+		t.Fatal("client did not register after CAP END")
+	}
+
+	plain := client.NewMock(log)
+	run(plain, "NICK plain", "USER plain 0 * :Plain")
+	if !plain.IsRegistered() {
+		t.Fatal("client without CAP did not register")
+	}
+
+	run(plain, "JOIN #test")
+	run(capable, "JOIN #test")
+
+	tests := []struct {
+		name   string
+		viewer *client.Client
+		want   string
+	}{
+		{"Capable", capable, "@" + plain.GetHostmask()},
+		{"Not capable", plain, "@plain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := run(tt.viewer, "NAMES #test")
+			var names string
+			for _, line := range strings.Split(out, "\n") {
+				if _, after, ok := strings.Cut(line, " "+RPL_NAMREPLY+" "); ok {
+					names = after[strings.Index(after, ":")+1:]
+				}
+			}
+			entries := strings.Fields(names)
+			if len(entries) != 2 || (entries[0] != tt.want && entries[1] != tt.want) {
+				t.Errorf("NAMES = %q, want it to list %q", names, tt.want)
+			}
+			for _, entry := range entries {
+				if strings.Contains(entry, "!") != (tt.viewer == capable) {
+					t.Errorf("entry %q in the wrong form", entry)
+				}
+			}
+		})
+	}
+}
+
+func TestMarkread(t *testing.T) {
+	log := logger.New()
+	clientReg := newMockClientRegistry()
+	handler := New("testserver", log, clientReg, newMockChannelRegistry(), nil)
+
+	newSession := func(nick, account string) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetRegistered(true)
+		c.SetAccount(account)
+		c.SetCap(capReadMarker, true)
+		clientReg.AddClient(c)
+		return c
+	}
+	phone := newSession("phone", "alice")
+	laptop := newSession("laptop", "alice")
+	other := newSession("bob", "bob")
+
+	run := func(c *client.Client, line string) string {
+		msg, _ := parser.Parse(line)
+		handler.Handle(c, msg)
+		return strings.Join(c.SentMessages(), "\n")
+	}
+
+	if out := run(phone, "MARKREAD #test"); out != ":testserver MARKREAD #test *" {
+		t.Errorf("unset marker = %q", out)
+	}
+
+	// Setting a marker answers the sender and syncs the account's other session
+	want := ":testserver MARKREAD #test timestamp=2026-01-02T03:04:05.678Z"
+	if out := run(phone, "MARKREAD #test timestamp=2026-01-02T03:04:05.678Z"); out != want {
+		t.Errorf("MARKREAD reply = %q, want %q", out, want)
+	}
+	if out := strings.Join(laptop.SentMessages(), "\n"); out != want {
+		t.Errorf("other session got %q, want %q", out, want)
+	}
+	if out := strings.Join(other.SentMessages(), "\n"); out != "" {
+		t.Errorf("another account got %q", out)
+	}
+
+	// The marker persists for the account and never moves back
+	if out := run(laptop, "MARKREAD #TEST"); out != strings.Replace(want, "#test", "#TEST", 1) {
+		t.Errorf("stored marker = %q", out)
+	}
+	if out := run(laptop, "MARKREAD #test timestamp=2025-01-01T00:00:00.000Z"); out != want {
+		t.Errorf("older timestamp moved the marker: %q", out)
+	}
+	if out := run(other, "MARKREAD #test"); out != ":testserver MARKREAD #test *" {
+		t.Errorf("marker leaked to another account: %q", out)
+	}
+
+	if out := run(phone, "MARKREAD #test yesterday"); !strings.Contains(out, "FAIL MARKREAD INVALID_PARAMS #test") {
+		t.Errorf("invalid timestamp got %q", out)
+	}
+}
+
 func TestHandleTopic(t *testing.T) {
 	log := logger.New()
 	clientReg := newMockClientRegistry()
 	channelReg := newMockChannelRegistry()
-	handler := New("testserver", log, clientReg, channelReg)
+	handler := New("testserver", log, clientReg, channelReg, nil)
 
 	tests := []struct {
 		name        string
@@ -742,7 +1280,7 @@ func TestHandleMode(t *testing.T) {
 	log := logger.New()
 	clientReg := newMockClientRegistry()
 	channelReg := newMockChannelRegistry()
-	handler := New("testserver", log, clientReg, channelReg)
+	handler := New("testserver", log, clientReg, channelReg, nil)
 
 	tests := []struct {
 		name        string
@@ -803,7 +1341,7 @@ func TestHandleKick(t *testing.T) {
 	log := logger.New()
 	clientReg := newMockClientRegistry()
 	channelReg := newMockChannelRegistry()
-	handler := New("testserver", log, clientReg, channelReg)
+	handler := New("testserver", log, clientReg, channelReg, nil)
 
 	tests := []struct {
 		name        string
@@ -873,7 +1411,7 @@ func TestHandle(t *testing.T) {
 	log := logger.New()
 	clientReg := newMockClientRegistry()
 	channelReg := newMockChannelRegistry()
-	handler := New("testserver", log, clientReg, channelReg)
+	handler := New("testserver", log, clientReg, channelReg, nil)
 
 	tests := []struct {
 		name        string
@@ -919,3 +1457,2449 @@ func TestHandle(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleSajoin(t *testing.T) {
+	log := logger.New()
+	clientReg := newMockClientRegistry()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, clientReg, channelReg, nil)
+
+	oper := client.NewMock(log)
+	oper.SetNickname("oper")
+	oper.SetRegistered(true)
+	oper.SetMode('o', true)
+
+	alice := client.NewMock(log)
+	alice.SetNickname("alice")
+	alice.SetRegistered(true)
+	clientReg.AddClient(alice)
+
+	// Keyed channel alice cannot join on her own
+	ch := channelReg.CreateChannel("#secret")
+	ch.SetKey("hunter2")
+	ch.SetMode('k', true)
+
+	msg, _ := parser.Parse("JOIN #secret")
+	handler.handleJoin(alice, msg)
+	if ch.HasMember(alice) {
+		t.Fatal("alice joined a keyed channel without the key")
+	}
+
+	// Non-operators are refused
+	bob := client.NewMock(log)
+	bob.SetNickname("bob")
+	bob.SetRegistered(true)
+	msg, _ = parser.Parse("SAJOIN alice #secret")
+	handler.handleSajoin(bob, msg)
+	if ch.HasMember(alice) {
+		t.Error("non-operator SAJOIN should not join the target")
+	}
+	if sent := strings.Join(bob.SentMessages(), "\n"); !strings.Contains(sent, " "+ERR_NOPRIVILEGES+" ") {
+		t.Errorf("expected ERR_NOPRIVILEGES, got %q", sent)
+	}
+
+	// Operators bypass the key
+	alice.SentMessages()
+	handler.handleSajoin(oper, msg)
+	if !ch.HasMember(alice) {
+		t.Fatal("SAJOIN did not join alice to #secret")
+	}
+	if sent := strings.Join(alice.SentMessages(), "\n"); !strings.Contains(sent, "JOIN #secret") {
+		t.Errorf("alice did not see her JOIN, got %q", sent)
+	}
+
+	// Unknown targets and bad channel names are rejected
+	msg, _ = parser.Parse("SAJOIN nobody #secret")
+	handler.handleSajoin(oper, msg)
+	msg, _ = parser.Parse("SAJOIN alice secret")
+	handler.handleSajoin(oper, msg)
+	sent := strings.Join(oper.SentMessages(), "\n")
+	if !strings.Contains(sent, " "+ERR_NOSUCHNICK+" ") {
+		t.Errorf("expected ERR_NOSUCHNICK, got %q", sent)
+	}
+	if !strings.Contains(sent, " "+ERR_NOSUCHCHANNEL+" ") {
+		t.Errorf("expected ERR_NOSUCHCHANNEL, got %q", sent)
+	}
+}
+
+func TestHandleSapart(t *testing.T) {
+	log := logger.New()
+	clientReg := newMockClientRegistry()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, clientReg, channelReg, nil)
+
+	oper := client.NewMock(log)
+	oper.SetNickname("oper")
+	oper.SetRegistered(true)
+	oper.SetMode('o', true)
+
+	alice := client.NewMock(log)
+	alice.SetNickname("alice")
+	alice.SetRegistered(true)
+	clientReg.AddClient(alice)
+
+	bob := client.NewMock(log)
+	bob.SetNickname("bob")
+	bob.SetRegistered(true)
+
+	ch := channelReg.CreateChannel("#test")
+	ch.AddMember(alice)
+	alice.JoinChannel("#test")
+	ch.AddMember(bob)
+	bob.JoinChannel("#test")
+
+	// Non-operators are refused
+	msg, _ := parser.Parse("SAPART alice #test :Go away")
+	handler.handleSapart(bob, msg)
+	if !ch.HasMember(alice) {
+		t.Fatal("non-operator SAPART should not remove the target")
+	}
+	if sent := strings.Join(bob.SentMessages(), "\n"); !strings.Contains(sent, " "+ERR_NOPRIVILEGES+" ") {
+		t.Errorf("expected ERR_NOPRIVILEGES, got %q", sent)
+	}
+
+	handler.handleSapart(oper, msg)
+	if ch.HasMember(alice) {
+		t.Fatal("SAPART did not remove alice from #test")
+	}
+	if len(alice.GetChannels()) != 0 {
+		t.Errorf("alice still tracks channels after SAPART: %v", alice.GetChannels())
+	}
+	for _, c := range []*client.Client{alice, bob} {
+		if sent := strings.Join(c.SentMessages(), "\n"); !strings.Contains(sent, "PART #test :Go away") {
+			t.Errorf("%s did not see the PART, got %q", c.GetNickname(), sent)
+		}
+	}
+
+	// Target is no longer a member
+	handler.handleSapart(oper, msg)
+	if sent := strings.Join(oper.SentMessages(), "\n"); !strings.Contains(sent, " "+ERR_USERNOTINCHANNEL+" ") {
+		t.Errorf("expected ERR_USERNOTINCHANNEL, got %q", sent)
+	}
+}
+
+func TestHandleWhoisConnectionType(t *testing.T) {
+	log := logger.New()
+	clientReg := newMockClientRegistry()
+	handler := New("testserver", log, clientReg, newMockChannelRegistry(), nil)
+
+	oper := client.NewMock(log)
+	oper.SetNickname("oper")
+	oper.SetRegistered(true)
+	oper.SetMode('o', true)
+
+	tests := []struct {
+		name     string
+		connType client.ConnectionType
+		secure   bool
+		expected string
+	}{
+		{"Plain TCP", client.TCP, false, "is connected via TCP"},
+		{"TLS", client.TCP, true, "is connected via TLS"},
+		{"WebSocket", client.WebSocket, false, "is connected via WebSocket"},
+		{"Secure WebSocket", client.WebSocket, true, "is connected via WebSocket (TLS)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := client.NewMock(log)
+			target.SetNickname("alice")
+			target.SetRegistered(true)
+			target.SetConnectionType(tt.connType, tt.secure)
+			clientReg.AddClient(target)
+
+			msg, _ := parser.Parse("WHOIS alice")
+			handler.handleWhois(oper, msg)
+
+			sent := strings.Join(oper.SentMessages(), "\n")
+			if !strings.Contains(sent, " "+RPL_WHOISSPECIAL+" oper alice :"+tt.expected+"\n") {
+				t.Errorf("expected %q in WHOIS, got %q", tt.expected, sent)
+			}
+		})
+	}
+
+	// Regular users don't see the transport
+	user := client.NewMock(log)
+	user.SetNickname("bob")
+	user.SetRegistered(true)
+
+	msg, _ := parser.Parse("WHOIS alice")
+	handler.handleWhois(user, msg)
+	if sent := strings.Join(user.SentMessages(), "\n"); strings.Contains(sent, " "+RPL_WHOISSPECIAL+" ") {
+		t.Errorf("non-operator saw connection type: %q", sent)
+	}
+}
+
+func TestChannelOwnerAdminModes(t *testing.T) {
+	log := logger.New()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, newMockClientRegistry(), channelReg, nil)
+
+	newMember := func(nick string) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetRegistered(true)
+		return c
+	}
+	owner := newMember("owner")
+	op := newMember("op")
+	user := newMember("user")
+
+	ch := channelReg.CreateChannel("#test")
+	ch.AddMember(owner)
+	ch.AddMember(op)
+	ch.AddMember(user)
+	ch.SetOwner(owner, true)
+	ch.SetOperator(op, true)
+
+	// Operators cannot grant owner or admin
+	msg, _ := parser.Parse("MODE #test +a user")
+	handler.handleChannelMode(op, msg)
+	if ch.IsAdmin(user) {
+		t.Error("channel operator should not be able to set +a")
+	}
+	if sent := strings.Join(op.SentMessages(), "\n"); !strings.Contains(sent, " "+ERR_CHANOPRIVSNEEDED+" ") {
+		t.Errorf("expected ERR_CHANOPRIVSNEEDED, got %q", sent)
+	}
+
+	// Owners can, and admins may then set +o
+	handler.handleChannelMode(owner, msg)
+	if !ch.IsAdmin(user) {
+		t.Fatal("owner failed to set +a")
+	}
+	msg, _ = parser.Parse("MODE #test +q op")
+	handler.handleChannelMode(owner, msg)
+	if !ch.IsOwner(op) {
+		t.Error("owner failed to set +q")
+	}
+
+	msg, _ = parser.Parse("MODE #test +v owner")
+	handler.handleChannelMode(user, msg)
+	if !ch.IsVoiced(owner) {
+		t.Error("admin should be able to change channel modes")
+	}
+
+	// Prefixes show in NAMES
+	owner.SentMessages()
+	handler.sendNamesList(owner, ch)
+	sent := strings.Join(owner.SentMessages(), "\n")
+	for _, want := range []string{"~owner", "~op", "&user"} {
+		if !strings.Contains(sent, want) {
+			t.Errorf("NAMES missing %q: %q", want, sent)
+		}
+	}
+}
+
+func TestISupportPrefix(t *testing.T) {
+	log := logger.New()
+	handler := New("testserver", log, newMockClientRegistry(), newMockChannelRegistry(), nil)
+
+	c := client.NewMock(log)
+	c.SetNickname("alice")
+	handler.sendISupport(c)
+
+	sent := strings.Join(c.SentMessages(), "\n")
+	if !strings.Contains(sent, " "+RPL_ISUPPORT+" alice ") || !strings.Contains(sent, "PREFIX=(qaohv)~&@%+") {
+		t.Errorf("expected %q in ISUPPORT, got %q", "PREFIX=(qaohv)~&@%+", sent)
+	}
+}
+
+func TestISupportChanModes(t *testing.T) {
+	log := logger.New()
+	handler := New("testserver", log, newMockClientRegistry(), newMockChannelRegistry(), nil)
+
+	var token string
+	for _, tok := range handler.isupportTokens() {
+		if value, ok := strings.CutPrefix(tok, "CHANMODES="); ok {
+			token = value
+		}
+	}
+	groups := strings.Split(token, ",")
+	if len(groups) != 4 {
+		t.Fatalf("CHANMODES=%s, want four groups", token)
+	}
+
+	want := map[rune]int{'b': 0, 'e': 0, 'I': 0, 'k': 1, 'l': 2, 'f': 2, 'j': 2, 'T': 2, 'i': 3, 'm': 3, 'n': 3, 's': 3, 't': 3}
+	for mode, group := range want {
+		if !strings.ContainsRune(groups[group], mode) {
+			t.Errorf("CHANMODES=%s: %c not in group %c", token, mode, 'A'+group)
+		}
+	}
+
+	// Every other supported mode appears exactly once, status modes never
+	for _, mode := range channelModeChars {
+		count := strings.Count(token, string(mode))
+		if strings.ContainsRune(channelPrefixModes, mode) {
+			if count != 0 {
+				t.Errorf("CHANMODES=%s lists status mode %c", token, mode)
+			}
+		} else if count != 1 {
+			t.Errorf("CHANMODES=%s lists %c %d times, want once", token, mode, count)
+		}
+	}
+}
+
+func TestKickAndDeopRankProtection(t *testing.T) {
+	log := logger.New()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, newMockClientRegistry(), channelReg, nil)
+
+	newMember := func(nick string) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetRegistered(true)
+		return c
+	}
+	owner := newMember("owner")
+	op := newMember("op")
+	halfop := newMember("halfop")
+	voiced := newMember("voiced")
+
+	ch := channelReg.CreateChannel("#test")
+	for _, c := range []*client.Client{owner, op, halfop, voiced} {
+		ch.AddMember(c)
+	}
+	ch.SetOperator(owner, false)
+	ch.SetOwner(owner, true)
+	ch.SetOperator(op, true)
+	ch.SetHalfop(halfop, true)
+	ch.SetVoice(voiced, true)
+
+	// A halfop cannot kick an op
+	msg, _ := parser.Parse("KICK #test op :bye")
+	handler.handleKick(halfop, msg)
+	if !ch.HasMember(op) {
+		t.Error("halfop was able to kick an op")
+	}
+	if sent := strings.Join(halfop.SentMessages(), "\n"); !strings.Contains(sent, " "+ERR_CHANOPRIVSNEEDED+" ") {
+		t.Errorf("expected ERR_CHANOPRIVSNEEDED, got %q", sent)
+	}
+
+	// An op cannot deop the owner, or kick them
+	msg, _ = parser.Parse("MODE #test -q owner")
+	handler.handleChannelMode(op, msg)
+	msg, _ = parser.Parse("KICK #test owner")
+	handler.handleKick(op, msg)
+	if !ch.IsOwner(owner) || !ch.HasMember(owner) {
+		t.Error("op was able to act against the owner")
+	}
+
+	// A halfop cannot grant op, but can voice
+	msg, _ = parser.Parse("MODE #test +ov voiced halfop")
+	handler.handleChannelMode(halfop, msg)
+	if ch.IsOperator(voiced) {
+		t.Error("halfop was able to grant +o")
+	}
+	if !ch.IsVoiced(halfop) {
+		t.Error("halfop should be able to grant +v")
+	}
+
+	// Users can always drop their own status
+	msg, _ = parser.Parse("MODE #test -o op")
+	handler.handleChannelMode(op, msg)
+	if ch.IsOperator(op) {
+		t.Error("op could not remove their own +o")
+	}
+	ch.SetOperator(op, true)
+
+	// An op can kick a voiced user
+	msg, _ = parser.Parse("KICK #test voiced :bye")
+	handler.handleKick(op, msg)
+	if ch.HasMember(voiced) {
+		t.Error("op failed to kick a voiced user")
+	}
+}
+
+func TestChannelFloodKickban(t *testing.T) {
+	log := logger.New()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, newMockClientRegistry(), channelReg, nil)
+
+	newMember := func(nick string) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetUsername("~"+nick, "Test")
+		c.SetRegistered(true)
+		return c
+	}
+	op := newMember("op")
+	flooder := newMember("flooder")
+
+	msg, _ := parser.Parse("JOIN #test")
+	handler.handleJoin(op, msg)
+	handler.handleJoin(flooder, msg)
+	ch := channelReg.GetChannel("#test")
+
+	msg, _ = parser.Parse("MODE #test +f 3:60")
+	handler.handleChannelMode(op, msg)
+	if lines, seconds := ch.GetFloodLimit(); lines != 3 || seconds != 60 {
+		t.Fatalf("flood limit = %d:%d, want 3:60", lines, seconds)
+	}
+	op.SentMessages()
+
+	msg, _ = parser.Parse("PRIVMSG #test :spam")
+	for i := 0; i < 3; i++ {
+		handler.handleMessage(flooder, msg, "PRIVMSG")
+	}
+	if !ch.HasMember(flooder) {
+		t.Fatal("flooder removed before exceeding the limit")
+	}
+
+	// The fourth line trips the limit
+	handler.handleMessage(flooder, msg, "PRIVMSG")
+	if ch.HasMember(flooder) {
+		t.Fatal("flooder was not kicked")
+	}
+	if !ch.IsBanned(flooder.GetHostmask()) {
+		t.Error("flooder was not banned")
+	}
+
+	sent := strings.Join(op.SentMessages(), "\n")
+	if !strings.Contains(sent, "MODE #test +b "+flooder.GetHostmask()) {
+		t.Errorf("members did not see the ban: %q", sent)
+	}
+	if !strings.Contains(sent, "KICK #test flooder :Channel flood") {
+		t.Errorf("members did not see the kick: %q", sent)
+	}
+
+	// The ban keeps them out
+	flooder.SentMessages()
+	msg, _ = parser.Parse("JOIN #test")
+	handler.handleJoin(flooder, msg)
+	if ch.HasMember(flooder) {
+		t.Error("banned flooder was able to rejoin")
+	}
+	if sent := strings.Join(flooder.SentMessages(), "\n"); !strings.Contains(sent, " "+ERR_BANNEDFROMCHAN+" ") {
+		t.Errorf("expected ERR_BANNEDFROMCHAN, got %q", sent)
+	}
+
+	// Operators are exempt
+	msg, _ = parser.Parse("PRIVMSG #test :op talk")
+	for i := 0; i < 10; i++ {
+		handler.handleMessage(op, msg, "PRIVMSG")
+	}
+	if !ch.HasMember(op) {
+		t.Error("operator was flood-kicked")
+	}
+}
+
+func TestParseFloodParam(t *testing.T) {
+	tests := []struct {
+		param           string
+		lines, seconds int
+		ok              bool
+	}{
+		{"5:10", 5, 10, true},
+		{"0:10", 0, 0, false},
+		{"5", 0, 0, false},
+		{"a:b", 0, 0, false},
+		{"5:-1", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		lines, seconds, ok := ParseFloodParam(tt.param)
+		if lines != tt.lines || seconds != tt.seconds || ok != tt.ok {
+			t.Errorf("ParseFloodParam(%q) = (%d, %d, %v), want (%d, %d, %v)",
+				tt.param, lines, seconds, ok, tt.lines, tt.seconds, tt.ok)
+		}
+	}
+}
+
+func TestHandleWhoisTargetLimit(t *testing.T) {
+	log := logger.New()
+	clientReg := newMockClientRegistry()
+	handler := New("testserver", log, clientReg, newMockChannelRegistry(), nil)
+	handler.SetOptions(Options{MaxTargets: 2})
+
+	for _, nick := range []string{"alice", "bob", "carol", "dave"} {
+		target := client.NewMock(log)
+		target.SetNickname(nick)
+		target.SetRegistered(true)
+		clientReg.AddClient(target)
+	}
+
+	user := client.NewMock(log)
+	user.SetNickname("user")
+	user.SetRegistered(true)
+
+	tests := []struct {
+		name        string
+		command     string
+		wantEnds    int
+		wantTooMany bool
+	}{
+		{"Within limit", "WHOIS alice,bob", 2, false},
+		{"Over limit", "WHOIS alice,bob,carol,dave", 2, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, _ := parser.Parse(tt.command)
+			handler.handleWhois(user, msg)
+
+			sent := strings.Join(user.SentMessages(), "\n")
+			if got := strings.Count(sent, " "+RPL_ENDOFWHOIS+" "); got != tt.wantEnds {
+				t.Errorf("expected %d WHOIS replies, got %d: %q", tt.wantEnds, got, sent)
+			}
+			if strings.Contains(sent, "carol") && !tt.wantTooMany {
+				t.Errorf("unexpected reply for carol: %q", sent)
+			}
+			if got := strings.Contains(sent, " "+ERR_TOOMANYTARGETS+" user carol :"); got != tt.wantTooMany {
+				t.Errorf("ERR_TOOMANYTARGETS sent = %v, want %v: %q", got, tt.wantTooMany, sent)
+			}
+			if strings.Contains(sent, RPL_WHOISUSER+" user dave ") {
+				t.Errorf("dave should not have been looked up: %q", sent)
+			}
+		})
+	}
+}
+
+func TestRegisterCommand(t *testing.T) {
+	log := logger.New()
+	handler := New("testserver", log, newMockClientRegistry(), newMockChannelRegistry(), nil)
+
+	called := 0
+	pongbot := func(c *client.Client, msg *parser.Message) error {
+		called++
+		c.Send("PONGBOT " + msg.GetParam(0))
+		return nil
+	}
+
+	if err := handler.RegisterCommand("pongbot", pongbot, true); err != nil {
+		t.Fatalf("RegisterCommand failed: %v", err)
+	}
+
+	// Unregistered clients are refused before the command runs
+	guest := client.NewMock(log)
+	msg, _ := parser.Parse("PONGBOT hello")
+	handler.Handle(guest, msg)
+	if called != 0 {
+		t.Error("custom command ran for an unregistered client")
+	}
+	if sent := strings.Join(guest.SentMessages(), "\n"); !strings.Contains(sent, " "+ERR_NOTREGISTERED+" ") {
+		t.Errorf("expected ERR_NOTREGISTERED, got %q", sent)
+	}
+
+	user := client.NewMock(log)
+	user.SetNickname("alice")
+	user.SetRegistered(true)
+	handler.Handle(user, msg)
+	if called != 1 {
+		t.Fatalf("custom command called %d times, want 1", called)
+	}
+	if sent := user.SentMessages(); len(sent) != 1 || sent[0] != "PONGBOT hello" {
+		t.Errorf("unexpected reply %q", sent)
+	}
+
+	// Built-in commands are protected unless overriding is allowed
+	if err := handler.RegisterCommand("PING", pongbot, false); err == nil {
+		t.Error("expected error overriding built-in PING")
+	}
+	handler.AllowCommandOverride(true)
+	if err := handler.RegisterCommand("PING", pongbot, false); err != nil {
+		t.Errorf("override with AllowCommandOverride failed: %v", err)
+	}
+}
+
+func TestHandleUserMode(t *testing.T) {
+	log := logger.New()
+	handler := New("testserver", log, newMockClientRegistry(), newMockChannelRegistry(), nil)
+
+	tests := []struct {
+		name        string
+		oper        bool
+		commands    []string
+		wantMode    []string // Expected MODE confirmation lines for the last command
+		wantUnknown int
+		wantUmodeIs string
+	}{
+		{"Set +iw", false, []string{"MODE alice +iw"}, []string{":alice MODE alice :+iw"}, 0, "+iw"},
+		{"Already set", false, []string{"MODE alice +iw", "MODE alice +i"}, nil, 0, "+iw"},
+		{"Unknown flags", false, []string{"MODE alice +ixyz"}, []string{":alice MODE alice :+i"}, 1, "+i"},
+		{"Mixed", false, []string{"MODE alice +iw", "MODE alice -i+x"}, []string{":alice MODE alice :-i"}, 1, "+w"},
+		{"Snomask", true, []string{"MODE alice +iws +cfk"}, []string{":alice MODE alice :+iws"}, 0, "+iosw +cfk"},
+		{"Snomask needs oper", false, []string{"MODE alice +s +c"}, nil, 0, "+"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := client.NewMock(log)
+			c.SetNickname("alice")
+			c.SetRegistered(true)
+			c.SetMode('o', tt.oper)
+
+			var sent []string
+			for _, cmd := range tt.commands {
+				c.SentMessages()
+				msg, _ := parser.Parse(cmd)
+				handler.handleUserMode(c, msg)
+				sent = c.SentMessages()
+			}
+
+			var modeLines []string
+			unknown := 0
+			for _, line := range sent {
+				if strings.HasPrefix(line, ":"+c.GetHostmask()+" MODE ") {
+					modeLines = append(modeLines, strings.Replace(line, ":"+c.GetHostmask(), ":alice", 1))
+				}
+				if strings.Contains(line, " "+ERR_UMODEUNKNOWNFLAG+" ") {
+					unknown++
+				}
+			}
+			if strings.Join(modeLines, "|") != strings.Join(tt.wantMode, "|") {
+				t.Errorf("MODE lines = %q, want %q", modeLines, tt.wantMode)
+			}
+			if unknown != tt.wantUnknown {
+				t.Errorf("got %d ERR_UMODEUNKNOWNFLAG, want %d", unknown, tt.wantUnknown)
+			}
+			if got := userModeString(c); got != tt.wantUmodeIs {
+				t.Errorf("RPL_UMODEIS = %q, want %q", got, tt.wantUmodeIs)
+			}
+		})
+	}
+}
+
+func TestChannelModeBroadcastIncludesArgs(t *testing.T) {
+	log := logger.New()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, newMockClientRegistry(), channelReg, nil)
+
+	newMember := func(nick string) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetUsername(nick, nick)
+		c.SetRegistered(true)
+		return c
+	}
+	op := newMember("op")
+	alice := newMember("alice")
+	bob := newMember("bob")
+
+	msg, _ := parser.Parse("JOIN #test")
+	handler.handleJoin(op, msg)
+	handler.handleJoin(alice, msg)
+	handler.handleJoin(bob, msg)
+	msg, _ = parser.Parse("MODE #test +v bob")
+	handler.handleChannelMode(op, msg)
+
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"Op a user", "MODE #test +o alice", "MODE #test +o alice"},
+		{"Mixed signs", "MODE #test +h-v alice bob", "MODE #test +h-v alice bob"},
+		{"Flags and args", "MODE #test -t+kzv secret bob", "MODE #test -t+kv secret bob"},
+		{"Unchanged sign only", "MODE #test +", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alice.SentMessages()
+			msg, _ := parser.Parse(tt.line)
+			handler.handleChannelMode(op, msg)
+
+			var got string
+			for _, line := range alice.SentMessages() {
+				if strings.Contains(line, " MODE #test ") {
+					got = strings.TrimPrefix(line, ":"+op.GetHostmask()+" ")
+				}
+			}
+			if got != tt.want {
+				t.Errorf("broadcast %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChannelNoCTCPMode(t *testing.T) {
+	log := logger.New()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, newMockClientRegistry(), channelReg, nil)
+
+	newMember := func(nick string) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetRegistered(true)
+		return c
+	}
+	op := newMember("op")
+	user := newMember("user")
+
+	msg, _ := parser.Parse("JOIN #test")
+	handler.handleJoin(op, msg)
+	handler.handleJoin(user, msg)
+
+	msg, _ = parser.Parse("MODE #test +C")
+	handler.handleChannelMode(op, msg)
+	if !channelReg.GetChannel("#test").HasMode('C') {
+		t.Fatal("+C was not set")
+	}
+
+	tests := []struct {
+		name        string
+		message     string
+		wantBlocked bool
+	}{
+		{"CTCP VERSION", "\x01VERSION\x01", true},
+		{"CTCP PING", "\x01PING 12345\x01", true},
+		{"ACTION", "\x01ACTION waves\x01", false},
+		{"Plain text", "hello", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op.SentMessages()
+			user.SentMessages()
+
+			msg := &parser.Message{Command: "PRIVMSG", Params: []string{"#test", tt.message}}
+			handler.handleMessage(user, msg, "PRIVMSG")
+
+			delivered := strings.Contains(strings.Join(op.SentMessages(), "\n"), tt.message)
+			blocked := strings.Contains(strings.Join(user.SentMessages(), "\n"), " "+ERR_CANNOTSENDTOCHAN+" user #test :Cannot send CTCP to channel (+C)")
+			if blocked != tt.wantBlocked || delivered == tt.wantBlocked {
+				t.Errorf("blocked = %v, delivered = %v, want blocked = %v", blocked, delivered, tt.wantBlocked)
+			}
+		})
+	}
+}
+
+func TestChannelRegisteredSpeechMode(t *testing.T) {
+	log := logger.New()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, newMockClientRegistry(), channelReg, nil)
+
+	newMember := func(nick string) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetRegistered(true)
+		return c
+	}
+	op := newMember("op")
+	guest := newMember("guest")
+	member := newMember("member")
+	member.SetAccount("member")
+
+	msg, _ := parser.Parse("JOIN #test")
+	handler.handleJoin(op, msg)
+
+	msg, _ = parser.Parse("MODE #test +M")
+	handler.handleChannelMode(op, msg)
+	if !channelReg.GetChannel("#test").HasMode('M') {
+		t.Fatal("+M was not set")
+	}
+
+	// Unauthenticated users may still join
+	msg, _ = parser.Parse("JOIN #test")
+	handler.handleJoin(guest, msg)
+	handler.handleJoin(member, msg)
+	if !channelReg.GetChannel("#test").HasMember(guest) {
+		t.Fatal("guest could not join a +M channel")
+	}
+
+	tests := []struct {
+		name        string
+		sender      *client.Client
+		wantBlocked bool
+	}{
+		{"Unauthenticated", guest, true},
+		{"Authenticated", member, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op.SentMessages()
+			tt.sender.SentMessages()
+
+			text := "hello from " + tt.sender.GetNickname()
+			msg := &parser.Message{Command: "PRIVMSG", Params: []string{"#test", text}}
+			handler.handleMessage(tt.sender, msg, "PRIVMSG")
+
+			delivered := strings.Contains(strings.Join(op.SentMessages(), "\n"), text)
+			blocked := strings.Contains(strings.Join(tt.sender.SentMessages(), "\n"), " "+ERR_NEEDREGGEDNICK+" "+tt.sender.GetNickname()+" #test ")
+			if blocked != tt.wantBlocked || delivered == tt.wantBlocked {
+				t.Errorf("blocked = %v, delivered = %v, want blocked = %v", blocked, delivered, tt.wantBlocked)
+			}
+		})
+	}
+}
+
+func TestChannelExtbans(t *testing.T) {
+	log := logger.New()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, newMockClientRegistry(), channelReg, nil)
+
+	newMember := func(nick, account string) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetUsername(nick, "Real "+nick)
+		c.SetAccount(account)
+		c.SetRegistered(true)
+		return c
+	}
+	op := newMember("op", "")
+	bad := newMember("bad", "BadUser")
+	quiet := newMember("quiet", "")
+
+	msg, _ := parser.Parse("JOIN #test")
+	handler.handleJoin(op, msg)
+
+	msg, _ = parser.Parse("MODE #test +bb ~a:baduser ~q:" + quiet.GetHostmask())
+	handler.handleChannelMode(op, msg)
+	ch := channelReg.GetChannel("#test")
+	if bans := ch.GetBanList(); len(bans) != 2 || bans[0] != "~a:baduser" {
+		t.Fatalf("ban list = %v, want the extbans unchanged", bans)
+	}
+
+	// The account extban blocks the join regardless of hostmask
+	msg, _ = parser.Parse("JOIN #test")
+	handler.handleJoin(bad, msg)
+	if ch.HasMember(bad) {
+		t.Error("~a:baduser did not stop the matching account from joining")
+	}
+	if out := strings.Join(bad.SentMessages(), "\n"); !strings.Contains(out, " "+ERR_BANNEDFROMCHAN+" ") {
+		t.Errorf("expected ERR_BANNEDFROMCHAN, got %q", out)
+	}
+
+	// A quiet does not stop the join, but does stop speech
+	handler.handleJoin(quiet, msg)
+	if !ch.HasMember(quiet) {
+		t.Fatal("~q: quiet stopped the user from joining")
+	}
+	op.SentMessages()
+	quiet.SentMessages()
+	msg = &parser.Message{Command: "PRIVMSG", Params: []string{"#test", "can you hear me"}}
+	handler.handleMessage(quiet, msg, "PRIVMSG")
+	if strings.Contains(strings.Join(op.SentMessages(), "\n"), "can you hear me") {
+		t.Error("quieted user's message was delivered")
+	}
+	if out := strings.Join(quiet.SentMessages(), "\n"); !strings.Contains(out, " "+ERR_CANNOTSENDTOCHAN+" quiet #test ") {
+		t.Errorf("expected ERR_CANNOTSENDTOCHAN, got %q", out)
+	}
+
+	// Voice overrides the quiet
+	ch.SetVoice(quiet, true)
+	handler.handleMessage(quiet, msg, "PRIVMSG")
+	if !strings.Contains(strings.Join(op.SentMessages(), "\n"), "can you hear me") {
+		t.Error("voiced user was still quieted")
+	}
+
+	// Removing the extban lets the account back in
+	msg, _ = parser.Parse("MODE #test -b ~a:baduser")
+	handler.handleChannelMode(op, msg)
+	msg, _ = parser.Parse("JOIN #test")
+	handler.handleJoin(bad, msg)
+	if !ch.HasMember(bad) {
+		t.Error("account could not join after -b ~a:baduser")
+	}
+}
+
+func TestChannelQuietList(t *testing.T) {
+	log := logger.New()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, newMockClientRegistry(), channelReg, nil)
+
+	newMember := func(nick string) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetUsername(nick, nick)
+		c.SetRegistered(true)
+		return c
+	}
+	op := newMember("op")
+	muted := newMember("muted")
+	friend := newMember("friend")
+
+	msg, _ := parser.Parse("JOIN #test")
+	handler.handleJoin(op, msg)
+	handler.handleJoin(friend, msg)
+	channelReg.GetChannel("#test").SetOwner(op, true) // Only owners may grant owner status
+
+	// A mask argument adds a quiet; a nickname still means owner
+	msg, _ = parser.Parse("MODE #test +qq " + muted.GetHostmask() + " friend")
+	handler.handleChannelMode(op, msg)
+	ch := channelReg.GetChannel("#test")
+	if quiets := ch.GetQuietList(); len(quiets) != 1 || quiets[0] != muted.GetHostmask() {
+		t.Fatalf("quiet list = %v, want [%s]", quiets, muted.GetHostmask())
+	}
+	if ch.GetRank(friend) != channel.RankOwner {
+		t.Error("+q friend did not grant owner status")
+	}
+	if len(ch.GetBanList()) != 0 {
+		t.Errorf("quiet was added to the ban list: %v", ch.GetBanList())
+	}
+
+	// Quieted users can still join and read
+	msg, _ = parser.Parse("JOIN #test")
+	handler.handleJoin(muted, msg)
+	if !ch.HasMember(muted) {
+		t.Fatal("quieted user could not join")
+	}
+	msg = &parser.Message{Command: "PRIVMSG", Params: []string{"#test", "hello muted"}}
+	handler.handleMessage(op, msg, "PRIVMSG")
+	if !strings.Contains(strings.Join(muted.SentMessages(), "\n"), "hello muted") {
+		t.Error("quieted user did not receive channel messages")
+	}
+
+	// ...but not speak
+	op.SentMessages()
+	msg = &parser.Message{Command: "PRIVMSG", Params: []string{"#test", "let me talk"}}
+	handler.handleMessage(muted, msg, "PRIVMSG")
+	if strings.Contains(strings.Join(op.SentMessages(), "\n"), "let me talk") {
+		t.Error("quieted user's message was delivered")
+	}
+	if out := strings.Join(muted.SentMessages(), "\n"); !strings.Contains(out, " "+ERR_CANNOTSENDTOCHAN+" muted #test ") {
+		t.Errorf("expected ERR_CANNOTSENDTOCHAN, got %q", out)
+	}
+
+	// Any member may list the quiets
+	msg, _ = parser.Parse("MODE #test q")
+	handler.handleChannelMode(muted, msg)
+	out := strings.Join(muted.SentMessages(), "\n")
+	if !strings.Contains(out, " "+RPL_QUIETLIST+" muted #test q "+muted.GetHostmask()) ||
+		!strings.Contains(out, " "+RPL_ENDOFQUIETLIST+" muted #test q :End of channel quiet list") {
+		t.Errorf("unexpected quiet list reply: %q", out)
+	}
+
+	// Removing the quiet restores speech
+	msg, _ = parser.Parse("MODE #test -q " + muted.GetHostmask())
+	handler.handleChannelMode(op, msg)
+	msg = &parser.Message{Command: "PRIVMSG", Params: []string{"#test", "thanks"}}
+	handler.handleMessage(muted, msg, "PRIVMSG")
+	if !strings.Contains(strings.Join(op.SentMessages(), "\n"), "thanks") {
+		t.Error("message not delivered after -q")
+	}
+}
+
+func TestChannelListLimits(t *testing.T) {
+	log := logger.New()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, newMockClientRegistry(), channelReg, nil)
+	handler.SetOptions(Options{MaxListEntries: 2, MaxListTotal: 3})
+
+	op := client.NewMock(log)
+	op.SetNickname("op")
+	op.SetRegistered(true)
+	msg, _ := parser.Parse("JOIN #test")
+	handler.handleJoin(op, msg)
+	ch := channelReg.GetChannel("#test")
+
+	mode := func(line string) string {
+		op.SentMessages()
+		msg, _ := parser.Parse(line)
+		handler.handleChannelMode(op, msg)
+		return strings.Join(op.SentMessages(), "\n")
+	}
+
+	mode("MODE #test +bb one!*@* two!*@*")
+	out := mode("MODE #test +b three!*@*")
+	if !strings.Contains(out, " "+ERR_BANLISTFULL+" op #test b :Channel list is full") {
+		t.Errorf("expected ERR_BANLISTFULL, got %q", out)
+	}
+	if bans := ch.GetBanList(); len(bans) != 2 {
+		t.Errorf("ban list grew past the limit: %v", bans)
+	}
+
+	// Re-adding a listed mask doesn't grow the list
+	if out := mode("MODE #test +b one!*@*"); strings.Contains(out, " "+ERR_BANLISTFULL+" ") {
+		t.Errorf("re-adding a listed ban was refused: %q", out)
+	}
+
+	// The combined limit covers the quiet list too
+	mode("MODE #test +q quiet1!*@*")
+	if out := mode("MODE #test +q quiet2!*@*"); !strings.Contains(out, " "+ERR_BANLISTFULL+" op #test q ") {
+		t.Errorf("expected the combined limit to refuse a quiet, got %q", out)
+	}
+	if quiets := ch.GetQuietList(); len(quiets) != 1 {
+		t.Errorf("quiet list = %v, want one entry", quiets)
+	}
+
+	if tokens := strings.Join(handler.isupportTokens(), " "); !strings.Contains(tokens, "MAXLIST=beIq:3") {
+		t.Errorf("ISUPPORT = %q, want MAXLIST=beIq:3", tokens)
+	}
+	handler.SetOptions(Options{MaxListEntries: 50})
+	if tokens := strings.Join(handler.isupportTokens(), " "); !strings.Contains(tokens, "MAXLIST=b:50,e:50,I:50,q:50") {
+		t.Errorf("ISUPPORT = %q, want MAXLIST=b:50,e:50,I:50,q:50", tokens)
+	}
+}
+
+func TestChannelJoinThrottleMode(t *testing.T) {
+	log := logger.New()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, newMockClientRegistry(), channelReg, nil)
+
+	newMember := func(nick string) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetRegistered(true)
+		return c
+	}
+	op := newMember("op")
+
+	msg, _ := parser.Parse("JOIN #test")
+	handler.handleJoin(op, msg)
+
+	msg, _ = parser.Parse("MODE #test +j 2:60")
+	handler.handleChannelMode(op, msg)
+	ch := channelReg.GetChannel("#test")
+	if joins, seconds := ch.GetJoinThrottle(); !ch.HasMode('j') || joins != 2 || seconds != 60 {
+		t.Fatalf("+j 2:60 gave mode=%v %d:%d", ch.HasMode('j'), joins, seconds)
+	}
+
+	joined := 0
+	var refused *client.Client
+	for _, nick := range []string{"u1", "u2", "u3"} {
+		c := newMember(nick)
+		msg, _ := parser.Parse("JOIN #test")
+		handler.handleJoin(c, msg)
+		if ch.HasMember(c) {
+			joined++
+		} else {
+			refused = c
+		}
+	}
+	if joined != 2 || refused == nil {
+		t.Fatalf("%d joins allowed, want 2", joined)
+	}
+	if sent := strings.Join(refused.SentMessages(), "\n"); !strings.Contains(sent, " "+ERR_CHANNELISFULL+" u3 #test :Cannot join channel (+j)") {
+		t.Errorf("refused join got %q, want ERR_CHANNELISFULL", sent)
+	}
+
+	// Removing +j lets joins through again
+	msg, _ = parser.Parse("MODE #test -j")
+	handler.handleChannelMode(op, msg)
+	msg, _ = parser.Parse("JOIN #test")
+	handler.handleJoin(refused, msg)
+	if !ch.HasMember(refused) {
+		t.Error("join refused after -j")
+	}
+
+	// Malformed arguments are rejected
+	msg, _ = parser.Parse("MODE #test +j nonsense")
+	handler.handleChannelMode(op, msg)
+	if ch.HasMode('j') {
+		t.Error("+j accepted an invalid argument")
+	}
+}
+
+func TestHandleWallchops(t *testing.T) {
+	log := logger.New()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, newMockClientRegistry(), channelReg, nil)
+
+	newMember := func(nick string) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetRegistered(true)
+		return c
+	}
+	op := newMember("op")
+	op2 := newMember("op2")
+	voiced := newMember("voiced")
+	user := newMember("user")
+	outsider := newMember("outsider")
+
+	msg, _ := parser.Parse("JOIN #test")
+	for _, c := range []*client.Client{op, op2, voiced, user} {
+		handler.handleJoin(c, msg)
+	}
+	ch := channelReg.GetChannel("#test")
+	ch.SetOperator(op2, true)
+	ch.SetVoice(voiced, true)
+
+	drain := func() {
+		for _, c := range []*client.Client{op, op2, voiced, user, outsider} {
+			c.SentMessages()
+		}
+	}
+	received := func(c *client.Client) bool {
+		return strings.Contains(strings.Join(c.SentMessages(), "\n"), "NOTICE @#test :ops only")
+	}
+
+	// Any member may send; only operators receive
+	drain()
+	msg, _ = parser.Parse("WALLCHOPS #test :ops only")
+	handler.handleWallchops(user, msg)
+	if !received(op) || !received(op2) {
+		t.Error("channel operators should receive WALLCHOPS")
+	}
+	if received(voiced) || received(user) {
+		t.Error("non-operators should not receive WALLCHOPS")
+	}
+
+	// Non-members are refused
+	drain()
+	handler.handleWallchops(outsider, msg)
+	if received(op) {
+		t.Error("WALLCHOPS from a non-member was delivered")
+	}
+	if sent := strings.Join(outsider.SentMessages(), "\n"); !strings.Contains(sent, " "+ERR_NOTONCHANNEL+" ") {
+		t.Errorf("expected ERR_NOTONCHANNEL, got %q", sent)
+	}
+}
+
+func TestVersionOverride(t *testing.T) {
+	log := logger.New()
+	handler := New("testserver", log, newMockClientRegistry(), newMockChannelRegistry(), nil)
+	handler.SetOptions(Options{Version: "hidden-1.0", HideBuildInfo: true})
+
+	user := client.NewMock(log)
+	user.SetNickname("user")
+	user.SetRegistered(true)
+
+	oper := client.NewMock(log)
+	oper.SetNickname("oper")
+	oper.SetRegistered(true)
+	oper.SetMode('o', true)
+
+	// Normal users see the configured version in RPL_YOURHOST
+	handler.sendWelcome(user)
+	sent := strings.Join(user.SentMessages(), "\n")
+	if !strings.Contains(sent, " "+RPL_YOURHOST+" user :Your host is testserver, running version hidden-1.0") {
+		t.Errorf("RPL_YOURHOST did not show the configured version: %q", sent)
+	}
+	if strings.Contains(sent, serverVersion) {
+		t.Errorf("real version leaked to a normal user: %q", sent)
+	}
+
+	tests := []struct {
+		name string
+		c    *client.Client
+		want string
+	}{
+		{"Normal user", user, " " + RPL_VERSION + " user hidden-1.0 testserver :"},
+		{"Operator", oper, " " + RPL_VERSION + " oper " + serverVersion + " testserver :" + buildInfo()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, _ := parser.Parse("VERSION")
+			handler.handleVersion(tt.c, msg)
+			sent := tt.c.SentMessages()
+			if len(sent) == 0 || !strings.HasSuffix(sent[0], tt.want) {
+				t.Errorf("got %q, want suffix %q", sent, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleClearbans(t *testing.T) {
+	log := logger.New()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, newMockClientRegistry(), channelReg, nil)
+
+	oper := client.NewMock(log)
+	oper.SetNickname("oper")
+	oper.SetRegistered(true)
+	oper.SetMode('o', true)
+
+	member := client.NewMock(log)
+	member.SetNickname("member")
+	member.SetRegistered(true)
+
+	msg, _ := parser.Parse("JOIN #test")
+	handler.handleJoin(member, msg)
+	ch := channelReg.GetChannel("#test")
+	ch.AddBan("*!*@raid1.example")
+	ch.AddBan("*!*@raid2.example")
+
+	// Regular users are refused
+	msg, _ = parser.Parse("CLEARBANS #test")
+	handler.handleClearbans(member, msg)
+	if len(ch.GetBanList()) != 2 {
+		t.Fatal("CLEARBANS by a non-operator removed bans")
+	}
+	member.SentMessages()
+
+	handler.handleClearbans(oper, msg)
+	if bans := ch.GetBanList(); len(bans) != 0 {
+		t.Errorf("ban list not empty after CLEARBANS: %v", bans)
+	}
+
+	sent := strings.Join(member.SentMessages(), "\n")
+	for _, mask := range []string{"*!*@raid1.example", "*!*@raid2.example"} {
+		if !strings.Contains(sent, ":testserver MODE #test -b "+mask) {
+			t.Errorf("missing MODE -b %s broadcast in %q", mask, sent)
+		}
+	}
+
+	// A selector limits which lists are emptied; the default is all of them
+	ch.AddBan("*!*@raid3.example")
+	ch.AddException("*!*@friend.example")
+	ch.AddInviteException("*!*@guest.example")
+	ch.AddQuiet("*!*@loud.example")
+	msg, _ = parser.Parse("CLEARBANS #test bq")
+	handler.handleClearbans(oper, msg)
+	if len(ch.GetBanList()) != 0 || len(ch.GetQuietList()) != 0 {
+		t.Error("CLEARBANS bq left bans or quiets")
+	}
+	if len(ch.GetExceptionList()) != 1 || len(ch.GetInviteExceptionList()) != 1 {
+		t.Error("CLEARBANS bq removed exceptions it wasn't asked to")
+	}
+	if sent := strings.Join(member.SentMessages(), "\n"); !strings.Contains(sent, "MODE #test -q *!*@loud.example") {
+		t.Errorf("missing MODE -q broadcast in %q", sent)
+	}
+
+	msg, _ = parser.Parse("CLEARBANS #test")
+	handler.handleClearbans(oper, msg)
+	if len(ch.GetExceptionList()) != 0 || len(ch.GetInviteExceptionList()) != 0 {
+		t.Error("CLEARBANS without a selector left exceptions")
+	}
+
+	oper.SentMessages()
+	msg, _ = parser.Parse("CLEARBANS #test bx")
+	handler.handleClearbans(oper, msg)
+	if sent := strings.Join(oper.SentMessages(), "\n"); !strings.Contains(sent, " 472 oper x ") {
+		t.Errorf("expected ERR_UNKNOWNMODE for x, got %q", sent)
+	}
+}
+
+func TestHandleOmode(t *testing.T) {
+	log := logger.New()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, newMockClientRegistry(), channelReg, nil)
+
+	oper := client.NewMock(log)
+	oper.SetNickname("oper")
+	oper.SetRegistered(true)
+	oper.SetMode('o', true)
+
+	member := client.NewMock(log)
+	member.SetNickname("member")
+	member.SetRegistered(true)
+
+	msg, _ := parser.Parse("JOIN #spam")
+	handler.handleJoin(member, msg)
+	ch := channelReg.GetChannel("#spam")
+	member.SentMessages()
+
+	// Even the channel's own operator can't use OMODE
+	msg, _ = parser.Parse("OMODE #spam +im")
+	handler.Handle(member, msg)
+	if ch.HasMode('i') || ch.HasMode('m') {
+		t.Fatal("OMODE by a non-operator changed modes")
+	}
+	if sent := strings.Join(member.SentMessages(), "\n"); !strings.Contains(sent, " "+ERR_NOPRIVILEGES+" ") {
+		t.Errorf("non-operator got %q, want ERR_NOPRIVILEGES", sent)
+	}
+
+	// The oper isn't on the channel
+	handler.Handle(oper, msg)
+	if !ch.HasMode('i') || !ch.HasMode('m') {
+		t.Error("OMODE did not set +im")
+	}
+	if ch.HasMember(oper) {
+		t.Error("OMODE joined the operator to the channel")
+	}
+	if sent := strings.Join(member.SentMessages(), "\n"); !strings.Contains(sent, ":testserver MODE #spam +im") {
+		t.Errorf("members got %q, want the MODE broadcast", sent)
+	}
+
+	// Plain MODE gives an oper without channel status no say
+	ch.AddMember(oper)
+	oper.SentMessages()
+	msg, _ = parser.Parse("MODE #spam -im")
+	handler.Handle(oper, msg)
+	if !ch.HasMode('i') || !ch.HasMode('m') {
+		t.Error("MODE by an oper without channel status changed modes")
+	}
+	if sent := strings.Join(oper.SentMessages(), "\n"); !strings.Contains(sent, " "+ERR_CHANOPRIVSNEEDED+" oper #spam ") {
+		t.Errorf("oper without channel status got %q, want ERR_CHANOPRIVSNEEDED", sent)
+	}
+
+	msg, _ = parser.Parse("OMODE #nowhere +m")
+	handler.Handle(oper, msg)
+	if sent := strings.Join(oper.SentMessages(), "\n"); !strings.Contains(sent, " "+ERR_NOSUCHCHANNEL+" oper #nowhere ") {
+		t.Errorf("OMODE on a missing channel got %q", sent)
+	}
+}
+
+func TestChannelBanListQuery(t *testing.T) {
+	log := logger.New()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, newMockClientRegistry(), channelReg, nil)
+
+	op := client.NewMock(log)
+	op.SetNickname("op")
+	op.SetRegistered(true)
+	member := client.NewMock(log)
+	member.SetNickname("member")
+	member.SetRegistered(true)
+
+	msg, _ := parser.Parse("JOIN #test")
+	handler.handleJoin(op, msg)
+	handler.handleJoin(member, msg)
+	ch := channelReg.GetChannel("#test")
+	ch.AddBan("*!*@one.example")
+	ch.AddBan("bad!*@*")
+
+	tests := []struct {
+		name    string
+		c       *client.Client
+		command string
+	}{
+		{"Bare b", member, "MODE #test b"},
+		{"Plus b", member, "MODE #test +b"},
+		{"Op query", op, "MODE #test b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.c.SentMessages()
+			msg, _ := parser.Parse(tt.command)
+			handler.handleChannelMode(tt.c, msg)
+
+			nick := tt.c.GetNickname()
+			want := []string{
+				":testserver " + RPL_BANLIST + " " + nick + " #test *!*@one.example",
+				":testserver " + RPL_BANLIST + " " + nick + " #test bad!*@*",
+				":testserver " + RPL_ENDOFBANLIST + " " + nick + " #test :End of channel ban list",
+			}
+			if got := tt.c.SentMessages(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Errorf("got %q, want %q", got, want)
+			}
+			if len(ch.GetBanList()) != 2 {
+				t.Error("ban list changed by a query")
+			}
+		})
+	}
+}
+
+func TestAccountTargetedMessage(t *testing.T) {
+	log := logger.New()
+	clientReg := newMockClientRegistry()
+	handler := New("testserver", log, clientReg, newMockChannelRegistry(), nil)
+
+	newClient := func(nick, account string) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetRegistered(true)
+		c.SetAccount(account)
+		clientReg.AddClient(c)
+		return c
+	}
+	sender := newClient("sender", "")
+	laptop := newClient("alice", "alice")
+	phone := newClient("alice_phone", "alice")
+	other := newClient("bob", "bob")
+
+	msg := &parser.Message{Command: "NOTICE", Params: []string{"$a:alice", "hello all sessions"}}
+	handler.handleMessage(sender, msg, "NOTICE")
+
+	for _, session := range []*client.Client{laptop, phone} {
+		want := " NOTICE " + session.GetNickname() + " :hello all sessions"
+		if sent := strings.Join(session.SentMessages(), "\n"); !strings.Contains(sent, want) {
+			t.Errorf("%s did not receive the account message: %q", session.GetNickname(), sent)
+		}
+	}
+	if sent := other.SentMessages(); len(sent) != 0 {
+		t.Errorf("other account received %q", sent)
+	}
+
+	// Unknown accounts are reported like unknown nicks
+	msg.Params[0] = "$a:nobody"
+	handler.handleMessage(sender, msg, "NOTICE")
+	if sent := strings.Join(sender.SentMessages(), "\n"); !strings.Contains(sent, " "+ERR_NOSUCHNICK+" sender $a:nobody ") {
+		t.Errorf("expected ERR_NOSUCHNICK, got %q", sent)
+	}
+}
+
+func TestDispatchMinParams(t *testing.T) {
+	log := logger.New()
+	handler := New("testserver", log, newMockClientRegistry(), newMockChannelRegistry(), nil)
+
+	for name, entry := range handler.commands {
+		if entry.minParams == 0 {
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			c := client.NewMock(log)
+			c.SetNickname("alice")
+			c.SetRegistered(entry.requiresReg)
+
+			// One parameter short of the minimum
+			params := make([]string, entry.minParams-1)
+			for i := range params {
+				params[i] = "x"
+			}
+			handler.Handle(c, &parser.Message{Command: name, Params: params})
+
+			want := ":testserver " + ERR_NEEDMOREPARAMS + " alice " + name + " :Not enough parameters"
+			if sent := c.SentMessages(); len(sent) != 1 || sent[0] != want {
+				t.Errorf("got %q, want [%q]", sent, want)
+			}
+		})
+	}
+}
+
+func TestListSecretChannels(t *testing.T) {
+	log := logger.New()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, newMockClientRegistry(), channelReg, nil)
+
+	owner := client.NewMock(log)
+	owner.SetNickname("owner")
+	owner.SetRegistered(true)
+
+	oper := client.NewMock(log)
+	oper.SetNickname("oper")
+	oper.SetRegistered(true)
+	oper.SetMode('o', true)
+
+	user := client.NewMock(log)
+	user.SetNickname("user")
+	user.SetRegistered(true)
+
+	for _, name := range []string{"#public", "#hidden", "#private"} {
+		msg, _ := parser.Parse("JOIN " + name)
+		handler.handleJoin(owner, msg)
+	}
+	channelReg.GetChannel("#hidden").SetMode('s', true)
+	channelReg.GetChannel("#private").SetMode('p', true)
+	if modes := channelReg.GetChannel("#hidden").GetModes(); !strings.Contains(modes, "s") {
+		t.Errorf("GetModes() = %q, want it to include s", modes)
+	}
+
+	list := func(c *client.Client) string {
+		c.SentMessages()
+		msg, _ := parser.Parse("LIST")
+		handler.handleList(c, msg)
+		return strings.Join(c.SentMessages(), "\n")
+	}
+
+	tests := []struct {
+		name       string
+		client     *client.Client
+		wantHidden string // expected RPL_LIST line fragment for #hidden ("" = absent)
+	}{
+		{"normal user", user, ""},
+		{"member", owner, " #hidden 1 :No topic"},
+		{"operator", oper, " #hidden 1 :[+s] No topic"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent := list(tt.client)
+			if !strings.Contains(sent, " #public 1 :") {
+				t.Errorf("#public missing from LIST: %q", sent)
+			}
+			if tt.wantHidden == "" {
+				if strings.Contains(sent, "#hidden") {
+					t.Errorf("+s channel shown to a non-member: %q", sent)
+				}
+			} else if !strings.Contains(sent, tt.wantHidden) {
+				t.Errorf("LIST missing %q: %q", tt.wantHidden, sent)
+			}
+		})
+	}
+
+	// Non-members see +p channels only as "Prv"
+	sent := list(user)
+	if strings.Contains(sent, "#private") || !strings.Contains(sent, " Prv 1 :") {
+		t.Errorf("+p channel not listed as Prv to a non-member: %q", sent)
+	}
+	if sent := list(owner); !strings.Contains(sent, " #private 1 :No topic") {
+		t.Errorf("+p channel hidden from its member: %q", sent)
+	}
+
+	// Dropping +o drops the operator view
+	oper.SetMode('o', false)
+	if sent := list(oper); strings.Contains(sent, "#hidden") {
+		t.Errorf("+s channel shown to a former operator: %q", sent)
+	}
+}
+
+func TestWhoisSecretChannels(t *testing.T) {
+	log := logger.New()
+	clientReg := newMockClientRegistry()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, clientReg, channelReg, nil)
+
+	newUser := func(nick string) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetUsername(nick, nick)
+		c.SetRegistered(true)
+		clientReg.AddClient(c)
+		return c
+	}
+	target := newUser("target")
+	friend := newUser("friend")
+	stranger := newUser("stranger")
+
+	for _, join := range []struct {
+		c    *client.Client
+		name string
+	}{{target, "#public"}, {target, "#secret"}, {friend, "#secret"}} {
+		msg, _ := parser.Parse("JOIN " + join.name)
+		handler.handleJoin(join.c, msg)
+	}
+	channelReg.GetChannel("#secret").SetMode('s', true)
+
+	whois := func(c *client.Client) string {
+		c.SentMessages()
+		msg, _ := parser.Parse("WHOIS target")
+		handler.Handle(c, msg)
+		for _, line := range c.SentMessages() {
+			if strings.Contains(line, " "+RPL_WHOISCHANNELS+" ") {
+				return line
+			}
+		}
+		return ""
+	}
+
+	if line := whois(stranger); strings.Contains(line, "#secret") || !strings.Contains(line, "#public") {
+		t.Errorf("stranger's WHOIS channels = %q, want #public without #secret", line)
+	}
+	if line := whois(friend); !strings.Contains(line, "#secret") {
+		t.Errorf("fellow member's WHOIS channels = %q, want #secret", line)
+	}
+	if line := whois(target); !strings.Contains(line, "#secret") {
+		t.Errorf("own WHOIS channels = %q, want #secret", line)
+	}
+}
+
+func TestStatusGraceOnReconnect(t *testing.T) {
+	log := logger.New()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, newMockClientRegistry(), channelReg, nil)
+	handler.SetOptions(Options{StatusGrace: 50 * time.Millisecond})
+
+	newMember := func(nick, account string) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetRegistered(true)
+		c.SetAccount(account)
+		return c
+	}
+	join := func(c *client.Client) {
+		msg, _ := parser.Parse("JOIN #test")
+		handler.handleJoin(c, msg)
+	}
+	quit := func(c *client.Client) {
+		msg, _ := parser.Parse("QUIT :reconnecting")
+		handler.handleQuit(c, msg)
+	}
+
+	founder := newMember("founder", "founder")
+	join(founder)
+	ch := channelReg.GetChannel("#test")
+
+	alice := newMember("alice", "alice")
+	join(alice)
+	msg, _ := parser.Parse("MODE #test +o alice")
+	handler.handleChannelMode(founder, msg)
+
+	// Reconnecting within the grace window restores op
+	quit(alice)
+	alice = newMember("alice", "alice")
+	join(alice)
+	if ch.GetRank(alice) != channel.RankOp {
+		t.Fatalf("returning op has rank %d, want op", ch.GetRank(alice))
+	}
+	if sent := strings.Join(founder.SentMessages(), "\n"); !strings.Contains(sent, ":testserver MODE #test +o alice") {
+		t.Errorf("restored op was not announced: %q", sent)
+	}
+
+	// Outside the window the status is gone
+	quit(alice)
+	time.Sleep(80 * time.Millisecond)
+	alice = newMember("alice", "alice")
+	join(alice)
+	if ch.GetRank(alice) != channel.RankNone {
+		t.Errorf("op restored after the grace window: rank %d", ch.GetRank(alice))
+	}
+
+	// Another user with the same nick but no account gets nothing
+	bob := newMember("bob", "bob")
+	join(bob)
+	msg, _ = parser.Parse("MODE #test +v bob")
+	handler.handleChannelMode(founder, msg)
+	quit(bob)
+	join(newMember("bob", ""))
+	if impostor := ch.GetMemberByNick("bob"); ch.GetRank(impostor) != channel.RankNone {
+		t.Error("status restored to a client without the account")
+	}
+
+	// Expired statuses are dropped when the next one is held
+	time.Sleep(80 * time.Millisecond)
+	quit(founder)
+	handler.graceMu.Lock()
+	held := len(handler.heldStatus)
+	handler.graceMu.Unlock()
+	if held != 1 {
+		t.Errorf("%d statuses held, want only the founder's", held)
+	}
+}
+
+func TestAccountStickyModes(t *testing.T) {
+	log := logger.New()
+	handler := New("testserver", log, newMockClientRegistry(), newMockChannelRegistry(), nil)
+
+	first := client.NewMock(log)
+	first.SetNickname("alice")
+	first.SetRegistered(true)
+	handler.LoginAccount(first, "alice")
+
+	msg, _ := parser.Parse("MODE alice +i")
+	handler.handleUserMode(first, msg)
+
+	// A new session logging in to the same account gets +i back
+	second := client.NewMock(log)
+	second.SetNickname("alice_")
+	second.SetRegistered(true)
+	handler.LoginAccount(second, "Alice")
+
+	if !second.HasMode('i') {
+		t.Fatal("saved +i was not reapplied on login")
+	}
+	sent := strings.Join(second.SentMessages(), "\n")
+	if !strings.Contains(sent, ":alice_!@test.host MODE alice_ :+i") {
+		t.Errorf("client not told about the restored mode: %q", sent)
+	}
+
+	// Sessions without an account are unaffected
+	guest := client.NewMock(log)
+	guest.SetNickname("guest")
+	guest.SetRegistered(true)
+	handler.LoginAccount(guest, "guest")
+	if guest.HasMode('i') {
+		t.Error("modes leaked to an unrelated account")
+	}
+}
+
+func TestKickCooldown(t *testing.T) {
+	log := logger.New()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, newMockClientRegistry(), channelReg, nil)
+	handler.SetOptions(Options{KickCooldown: 100 * time.Millisecond})
+
+	op := client.NewMock(log)
+	op.SetNickname("op")
+	op.SetUsername("op", "Op")
+	op.SetRegistered(true)
+	victim := client.NewMock(log)
+	victim.SetNickname("victim")
+	victim.SetUsername("victim", "Victim")
+	victim.SetRegistered(true)
+
+	join := func(c *client.Client) string {
+		c.SentMessages()
+		msg, _ := parser.Parse("JOIN #test")
+		handler.handleJoin(c, msg)
+		return strings.Join(c.SentMessages(), "\n")
+	}
+	join(op)
+	join(victim)
+
+	msg, _ := parser.Parse("KICK #test victim :out")
+	handler.handleKick(op, msg)
+
+	out := join(victim)
+	if !strings.Contains(out, " "+ERR_BANNEDFROMCHAN+" victim #test :Cannot join channel (kicked, try again in 1 seconds)") {
+		t.Errorf("expected the rejoin to be refused, got %q", out)
+	}
+	if channelReg.GetChannel("#test").GetMemberByNick("victim") != nil {
+		t.Error("kicked user rejoined during the cooldown")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	join(victim)
+	if channelReg.GetChannel("#test").GetMemberByNick("victim") == nil {
+		t.Error("kicked user could not rejoin after the cooldown")
+	}
+}
+
+func TestTopicThrottle(t *testing.T) {
+	log := logger.New()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, newMockClientRegistry(), channelReg, nil)
+	handler.SetOptions(Options{TopicChanges: 2, TopicWindow: 100 * time.Millisecond})
+
+	alice := client.NewMock(log)
+	alice.SetNickname("alice")
+	alice.SetRegistered(true)
+	msg, _ := parser.Parse("JOIN #test")
+	handler.handleJoin(alice, msg)
+	ch := channelReg.GetChannel("#test")
+
+	topic := func(text string) string {
+		alice.SentMessages()
+		msg, _ := parser.Parse("TOPIC #test :" + text)
+		handler.handleTopic(alice, msg)
+		return strings.Join(alice.SentMessages(), "\n")
+	}
+
+	topic("one")
+	topic("two")
+	out := topic("three")
+	if !strings.Contains(out, "NOTICE alice :#test Topic changed too often") {
+		t.Errorf("expected a throttle notice, got %q", out)
+	}
+	if got := ch.GetTopic(); got != "two" {
+		t.Errorf("topic = %q, want the throttled change refused", got)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	topic("four")
+	if got := ch.GetTopic(); got != "four" {
+		t.Errorf("topic = %q after the window cleared, want four", got)
+	}
+
+	// +T sets a per-channel limit
+	alice.SentMessages()
+	msg, _ = parser.Parse("MODE #test +T 1:60")
+	handler.handleChannelMode(alice, msg)
+	if changes, seconds := ch.GetTopicThrottle(); changes != 1 || seconds != 60 {
+		t.Fatalf("+T 1:60 gave a throttle of %d:%d", changes, seconds)
+	}
+	topic("five")
+	if out := topic("six"); !strings.Contains(out, "try again in 60 seconds") {
+		t.Errorf("expected the +T limit to apply, got %q", out)
+	}
+}
+
+func TestInviteOnlyAndExpiry(t *testing.T) {
+	log := logger.New()
+	clientReg := newMockClientRegistry()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, clientReg, channelReg, nil)
+	handler.SetOptions(Options{InviteExpiry: 100 * time.Millisecond})
+
+	op := client.NewMock(log)
+	op.SetNickname("op")
+	op.SetRegistered(true)
+	guest := client.NewMock(log)
+	guest.SetNickname("guest")
+	guest.SetRegistered(true)
+	clientReg.AddClient(guest)
+
+	run := func(c *client.Client, line string) string {
+		c.SentMessages()
+		msg, _ := parser.Parse(line)
+		if err := handler.Handle(c, msg); err != nil {
+			t.Fatalf("%s failed: %v", line, err)
+		}
+		return strings.Join(c.SentMessages(), "\n")
+	}
+	run(op, "JOIN #test")
+	run(op, "MODE #test +i")
+	ch := channelReg.GetChannel("#test")
+
+	if out := run(guest, "JOIN #test"); !strings.Contains(out, " "+ERR_INVITEONLYCHAN+" guest #test :Cannot join channel (+i)") {
+		t.Errorf("expected ERR_INVITEONLYCHAN, got %q", out)
+	}
+
+	// An invite that isn't used lapses
+	run(op, "INVITE guest #test")
+	if out := run(guest, "INVITE"); !strings.Contains(out, " "+RPL_INVITELIST+" guest #test") {
+		t.Errorf("invite list missing #test: %q", out)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if out := run(guest, "INVITE"); strings.Contains(out, " "+RPL_INVITELIST+" ") {
+		t.Errorf("expired invite still listed: %q", out)
+	}
+	run(guest, "JOIN #test")
+	if ch.HasMember(guest) {
+		t.Fatal("joined with an expired invite")
+	}
+
+	// A fresh invite is used up by joining
+	run(op, "INVITE guest #test")
+	run(guest, "JOIN #test")
+	if !ch.HasMember(guest) {
+		t.Fatal("invited user could not join")
+	}
+	if ch.IsInvited("guest") {
+		t.Error("invite not consumed by the join")
+	}
+}
+
+func TestBanExceptions(t *testing.T) {
+	log := logger.New()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, newMockClientRegistry(), channelReg, nil)
+
+	newUser := func(nick string) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetUsername(nick, nick)
+		c.SetRegistered(true)
+		return c
+	}
+	op := newUser("op")
+	trusted := newUser("trusted")
+	stranger := newUser("stranger")
+
+	run := func(c *client.Client, line string) string {
+		c.SentMessages()
+		msg, _ := parser.Parse(line)
+		if err := handler.Handle(c, msg); err != nil {
+			t.Fatalf("%s failed: %v", line, err)
+		}
+		return strings.Join(c.SentMessages(), "\n")
+	}
+	run(op, "JOIN #test")
+	run(op, "MODE #test +be *!*@test.host trusted!*@*")
+	ch := channelReg.GetChannel("#test")
+
+	// The exception overrides the broad ban
+	run(trusted, "JOIN #test")
+	if !ch.HasMember(trusted) {
+		t.Error("excepted user was refused by the ban")
+	}
+	if out := run(stranger, "JOIN #test"); !strings.Contains(out, " "+ERR_BANNEDFROMCHAN+" ") || ch.HasMember(stranger) {
+		t.Errorf("banned user without an exception got in: %q", out)
+	}
+
+	// +e without a mask lists the exceptions
+	out := run(op, "MODE #test e")
+	if !strings.Contains(out, " "+RPL_EXCEPTLIST+" op #test trusted!*@*") ||
+		!strings.Contains(out, " "+RPL_ENDOFEXCEPTLIST+" op #test :End of channel exception list") {
+		t.Errorf("unexpected exception list:\n%s", out)
+	}
+
+	run(op, "MODE #test -e trusted")
+	if excepts := ch.GetExceptionList(); len(excepts) != 0 {
+		t.Errorf("exception list = %v after -e, want empty", excepts)
+	}
+}
+
+func TestNickProtection(t *testing.T) {
+	log := logger.New()
+	clientReg := newMockClientRegistry()
+	handler := New("testserver", log, clientReg, newMockChannelRegistry(), nil)
+	handler.SetOptions(Options{NickProtectGrace: 50 * time.Millisecond, GuestNickPattern: "Guest*"})
+	store := NewMemoryAccountStore()
+	store.ReserveNick("alice", "Alice")
+	handler.SetAccountStore(store)
+
+	newUser := func(nick string) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetUsername(nick, nick)
+		c.SetRegistered(true)
+		clientReg.AddClient(c)
+		return c
+	}
+	nick := func(c *client.Client, newNick string) string {
+		c.SentMessages()
+		msg, _ := parser.Parse("NICK " + newNick)
+		handler.Handle(c, msg)
+		return strings.Join(c.SentMessages(), "\n")
+	}
+
+	// Taking a reserved nick without logging in ends in a guest rename
+	mallory := newUser("mallory")
+	if out := nick(mallory, "alice"); !strings.Contains(out, "NOTICE alice :*** This nickname is registered") {
+		t.Errorf("expected a warning about the reserved nick, got %q", out)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got := mallory.GetNickname(); got != "Guest1" {
+		t.Errorf("nick after the grace period = %q, want Guest1", got)
+	}
+	if clientReg.GetClient("Guest1") != mallory || clientReg.GetClient("alice") != nil {
+		t.Error("registry was not updated for the forced rename")
+	}
+	if out := strings.Join(mallory.SentMessages(), "\n"); !strings.Contains(out, ":alice NICK :Guest1") {
+		t.Errorf("expected the forced NICK, got %q", out)
+	}
+
+	// Logging in to the owning account within the grace period cancels it
+	alice := newUser("a1")
+	nick(alice, "alice")
+	handler.LoginAccount(alice, "Alice")
+	time.Sleep(100 * time.Millisecond)
+	if got := alice.GetNickname(); got != "alice" {
+		t.Errorf("logged-in owner was renamed to %q", got)
+	}
+
+	// Unreserved nicks are left alone
+	bob := newUser("b1")
+	if out := nick(bob, "bob"); strings.Contains(out, "registered") {
+		t.Errorf("unreserved nick got a warning: %q", out)
+	}
+}
+
+func TestUserLimit(t *testing.T) {
+	log := logger.New()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, newMockClientRegistry(), channelReg, nil)
+
+	newUser := func(nick string) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetUsername(nick, nick)
+		c.SetRegistered(true)
+		return c
+	}
+	op := newUser("op")
+	alice := newUser("alice")
+	bob := newUser("bob")
+
+	run := func(c *client.Client, line string) string {
+		c.SentMessages()
+		msg, _ := parser.Parse(line)
+		if err := handler.Handle(c, msg); err != nil {
+			t.Fatalf("%s failed: %v", line, err)
+		}
+		return strings.Join(c.SentMessages(), "\n")
+	}
+	run(op, "JOIN #test")
+	if out := run(op, "MODE #test +l 2"); !strings.Contains(out, "MODE #test +l 2") {
+		t.Fatalf("expected +l 2 to be applied, got %q", out)
+	}
+	ch := channelReg.GetChannel("#test")
+
+	run(alice, "JOIN #test")
+	if !ch.HasMember(alice) {
+		t.Fatal("join below the limit was refused")
+	}
+	if out := run(bob, "JOIN #test"); !strings.Contains(out, " "+ERR_CHANNELISFULL+" bob #test :Cannot join channel (+l)") || ch.HasMember(bob) {
+		t.Errorf("join to a full channel was not refused: %q", out)
+	}
+
+	// The limit is shown with its argument
+	if out := run(op, "MODE #test"); !strings.Contains(out, " "+RPL_CHANNELMODEIS+" op #test +") || !strings.HasSuffix(out, " 2") || !strings.Contains(out, "l") {
+		t.Errorf("unexpected RPL_CHANNELMODEIS: %q", out)
+	}
+
+	// -l takes no argument and lifts the limit
+	if out := run(op, "MODE #test -l"); !strings.Contains(out, "MODE #test -l") {
+		t.Fatalf("expected -l to be applied, got %q", out)
+	}
+	run(bob, "JOIN #test")
+	if !ch.HasMember(bob) || ch.GetLimit() != 0 || ch.HasMode('l') {
+		t.Error("join was refused after the limit was removed")
+	}
+
+	if out := run(op, "MODE #test +l many"); !strings.Contains(out, " "+ERR_INVALIDMODEPARAM+" ") || ch.HasMode('l') {
+		t.Errorf("non-numeric limit was accepted: %q", out)
+	}
+}
+
+func TestJoinPartThrottle(t *testing.T) {
+	log := logger.New()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, newMockClientRegistry(), channelReg, nil)
+	handler.SetOptions(Options{JoinPartRate: 0.01, JoinPartBurst: 4})
+
+	newUser := func(nick string) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetUsername(nick, nick)
+		c.SetRegistered(true)
+		return c
+	}
+	hopper := newUser("hopper")
+	regular := newUser("regular")
+
+	run := func(c *client.Client, line string) string {
+		c.SentMessages()
+		msg, _ := parser.Parse(line)
+		if err := handler.Handle(c, msg); err != nil {
+			t.Fatalf("%s failed: %v", line, err)
+		}
+		return strings.Join(c.SentMessages(), "\n")
+	}
+	run(regular, "JOIN #hop")
+
+	// Two join/part cycles use up the burst
+	for i := 0; i < 2; i++ {
+		run(hopper, "JOIN #hop")
+		run(hopper, "PART #hop")
+	}
+	out := run(hopper, "JOIN #hop")
+	if !strings.Contains(out, "NOTICE hopper :*** Cannot join #hop: you are joining and parting channels too fast") {
+		t.Errorf("expected the join to be throttled, got %q", out)
+	}
+	if channelReg.GetChannel("#hop").HasMember(hopper) {
+		t.Error("throttled client joined the channel")
+	}
+
+	// JOIN for a channel the client is already in costs nothing, and other
+	// clients have their own budget
+	run(regular, "JOIN #hop")
+	if out := run(regular, "JOIN #other,#third"); strings.Contains(out, "too fast") {
+		t.Errorf("normal joins were throttled: %q", out)
+	}
+	if out := run(regular, "PART #other"); strings.Contains(out, "too fast") || channelReg.GetChannel("#other") != nil {
+		t.Errorf("normal part was throttled: %q", out)
+	}
+	if out := run(regular, "PART #third"); !strings.Contains(out, "Cannot part #third") || !channelReg.GetChannel("#third").HasMember(regular) {
+		t.Errorf("expected the fifth join/part to be throttled, got %q", out)
+	}
+}
+
+func TestInviteExceptions(t *testing.T) {
+	log := logger.New()
+	channelReg := newMockChannelRegistry()
+	handler := New("testserver", log, newMockClientRegistry(), channelReg, nil)
+
+	newUser := func(nick string) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetUsername(nick, nick)
+		c.SetRegistered(true)
+		return c
+	}
+	op := newUser("op")
+	friend := newUser("friend")
+	stranger := newUser("stranger")
+
+	run := func(c *client.Client, line string) string {
+		c.SentMessages()
+		msg, _ := parser.Parse(line)
+		if err := handler.Handle(c, msg); err != nil {
+			t.Fatalf("%s failed: %v", line, err)
+		}
+		return strings.Join(c.SentMessages(), "\n")
+	}
+	run(op, "JOIN #test")
+	run(op, "MODE #test +iI friend!*@*")
+	ch := channelReg.GetChannel("#test")
+
+	// A matching invite exception lets the user in without an INVITE
+	run(friend, "JOIN #test")
+	if !ch.HasMember(friend) {
+		t.Error("invite-excepted user was refused by +i")
+	}
+	if out := run(stranger, "JOIN #test"); !strings.Contains(out, " "+ERR_INVITEONLYCHAN+" ") || ch.HasMember(stranger) {
+		t.Errorf("uninvited user got into +i channel: %q", out)
+	}
+
+	// +I without a mask lists the invite exceptions
+	out := run(op, "MODE #test I")
+	if !strings.Contains(out, " "+RPL_INVEXLIST+" op #test friend!*@*") ||
+		!strings.Contains(out, " "+RPL_ENDOFINVEXLIST+" op #test :End of channel invite exception list") {
+		t.Errorf("unexpected invite exception list:\n%s", out)
+	}
+
+	run(op, "MODE #test -I friend")
+	if invexes := ch.GetInviteExceptionList(); len(invexes) != 0 {
+		t.Errorf("invite exception list = %v after -I, want empty", invexes)
+	}
+}
+
+func TestDuplicateJoin(t *testing.T) {
+	tests := []struct {
+		name   string
+		resync bool
+	}{
+		{"ignored", false},
+		{"resync", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := logger.New()
+			channelReg := newMockChannelRegistry()
+			handler := New("testserver", log, newMockClientRegistry(), channelReg, nil)
+			handler.SetOptions(Options{ResyncDuplicateJoin: tt.resync})
+
+			alice := client.NewMock(log)
+			alice.SetNickname("alice")
+			alice.SetRegistered(true)
+			msg, _ := parser.Parse("JOIN #test")
+			handler.handleJoin(alice, msg)
+			channelReg.GetChannel("#test").SetTopic("hello")
+			alice.SentMessages()
+
+			handler.handleJoin(alice, msg)
+			out := strings.Join(alice.SentMessages(), "\n")
+			if strings.Contains(out, " JOIN ") {
+				t.Errorf("duplicate JOIN was announced again: %q", out)
+			}
+			resent := strings.Contains(out, " "+RPL_TOPIC+" alice #test :hello") &&
+				strings.Contains(out, " "+RPL_ENDOFNAMES+" alice #test ")
+			if resent != tt.resync {
+				t.Errorf("topic and NAMES resent = %v, want %v; got %q", resent, tt.resync, out)
+			}
+		})
+	}
+}
+
+func TestWallops(t *testing.T) {
+	log := logger.New()
+	clientReg := newMockClientRegistry()
+	handler := New("testserver", log, clientReg, newMockChannelRegistry(), nil)
+
+	newUser := func(nick string) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetUsername(nick, nick)
+		c.SetRegistered(true)
+		clientReg.AddClient(c)
+		return c
+	}
+	oper := newUser("oper")
+	oper.SetMode('o', true)
+	user := newUser("user")
+	watcher := newUser("watcher")
+	watcher.SetMode('w', true)
+	other := newUser("other")
+
+	// Non-operators are refused and nothing is sent
+	msg, _ := parser.Parse("WALLOPS :hello")
+	handler.Handle(user, msg)
+	if sent := strings.Join(user.SentMessages(), "\n"); !strings.Contains(sent, " "+ERR_NOPRIVILEGES+" ") {
+		t.Errorf("non-operator WALLOPS not refused: %q", sent)
+	}
+	if sent := watcher.SentMessages(); len(sent) != 0 {
+		t.Errorf("+w user got a refused WALLOPS: %q", sent)
+	}
+
+	msg, _ = parser.Parse("WALLOPS :Server restarting soon")
+	handler.Handle(oper, msg)
+	want := ":oper!oper@test.host WALLOPS :Server restarting soon"
+	if sent := strings.Join(watcher.SentMessages(), "\n"); !strings.Contains(sent, want) {
+		t.Errorf("+w user got %q, want %q", sent, want)
+	}
+	if sent := other.SentMessages(); len(sent) != 0 {
+		t.Errorf("user without +w got WALLOPS: %q", sent)
+	}
+}
+
+func TestMotdCommand(t *testing.T) {
+	log := logger.New()
+	handler := New("testserver", log, newMockClientRegistry(), newMockChannelRegistry(), nil)
+
+	c := client.NewMock(log)
+	c.SetNickname("alice")
+	c.SetRegistered(true)
+
+	motd := func() []string {
+		c.SentMessages()
+		msg, _ := parser.Parse("MOTD")
+		handler.Handle(c, msg)
+		return c.SentMessages()
+	}
+
+	// Without a MOTD the command answers ERR_NOMOTD
+	if sent := motd(); len(sent) != 1 || !strings.Contains(sent[0], " "+ERR_NOMOTD+" alice :MOTD File is missing") {
+		t.Errorf("MOTD without a file = %q, want a single 422", sent)
+	}
+
+	handler.SetOptions(Options{MOTD: []string{"Welcome!", "", "Be nice."}})
+	want := []string{
+		":testserver 375 alice :- testserver Message of the day - ",
+		":testserver 372 alice :- Welcome!",
+		":testserver 372 alice :- ",
+		":testserver 372 alice :- Be nice.",
+		":testserver 376 alice :End of /MOTD command.",
+	}
+	sent := motd()
+	if len(sent) != len(want) {
+		t.Fatalf("MOTD sent %q, want %q", sent, want)
+	}
+	for i := range want {
+		if sent[i] != want[i] {
+			t.Errorf("line %d = %q, want %q", i, sent[i], want[i])
+		}
+	}
+}
+
+func TestWhowas(t *testing.T) {
+	log := logger.New()
+	clientReg := newMockClientRegistry()
+	handler := New("testserver", log, clientReg, newMockChannelRegistry(), nil)
+
+	newUser := func(nick, realname string) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetUsername(nick, realname)
+		c.SetRegistered(true)
+		clientReg.AddClient(c)
+		return c
+	}
+	send := func(c *client.Client, line string) []string {
+		c.SentMessages()
+		msg, _ := parser.Parse(line)
+		handler.Handle(c, msg)
+		return c.SentMessages()
+	}
+
+	alice := newUser("alice", "Alice")
+	send(newUser("bob", "Bob One"), "QUIT :bye")
+
+	sent := send(alice, "WHOWAS bob")
+	if len(sent) != 3 ||
+		sent[0] != ":testserver 314 alice bob bob test.host * :Bob One" ||
+		!strings.HasPrefix(sent[1], ":testserver 312 alice bob testserver :") ||
+		sent[2] != ":testserver 369 alice bob :End of WHOWAS" {
+		t.Errorf("WHOWAS bob = %q", sent)
+	}
+
+	// A nick used twice lists the newest first, limited by count
+	send(newUser("bob", "Bob Two"), "QUIT")
+	if sent := send(alice, "WHOWAS BOB"); len(sent) != 5 || !strings.HasSuffix(sent[0], ":Bob Two") || !strings.HasSuffix(sent[2], ":Bob One") {
+		t.Errorf("WHOWAS for a reused nick = %q, want both entries newest first", sent)
+	}
+	if sent := send(alice, "WHOWAS bob 1"); len(sent) != 3 || !strings.HasSuffix(sent[0], ":Bob Two") {
+		t.Errorf("WHOWAS bob 1 = %q, want only the newest entry", sent)
+	}
+
+	if sent := send(alice, "WHOWAS nobody"); len(sent) != 2 ||
+		sent[0] != ":testserver 406 alice nobody :There was no such nickname" ||
+		sent[1] != ":testserver 369 alice nobody :End of WHOWAS" {
+		t.Errorf("WHOWAS for an unknown nick = %q, want 406 and 369", sent)
+	}
+
+	// Once full, the oldest entries are dropped first
+	handler.SetOptions(Options{WhowasSize: 2})
+	send(newUser("carol", "Carol"), "QUIT")
+	if sent := send(alice, "WHOWAS bob"); len(sent) != 3 || !strings.HasSuffix(sent[0], ":Bob Two") {
+		t.Errorf("WHOWAS bob after eviction = %q, want only the newest entry", sent)
+	}
+	if sent := send(alice, "WHOWAS carol"); len(sent) != 3 || !strings.Contains(sent[0], " 314 ") {
+		t.Errorf("WHOWAS carol = %q, want the entry just added", sent)
+	}
+
+	// A nick change remembers the old nick
+	send(newUser("dave", "Dave"), "NICK david")
+	if sent := send(alice, "WHOWAS dave"); len(sent) != 3 || sent[0] != ":testserver 314 alice dave dave test.host * :Dave" {
+		t.Errorf("WHOWAS after a nick change = %q", sent)
+	}
+}
+
+func TestCallerID(t *testing.T) {
+	log := logger.New()
+	clientReg := newMockClientRegistry()
+	handler := New("testserver", log, clientReg, newMockChannelRegistry(), nil)
+
+	newUser := func(nick string) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetUsername(nick, nick)
+		c.SetRegistered(true)
+		clientReg.AddClient(c)
+		return c
+	}
+	send := func(c *client.Client, line string) {
+		msg, _ := parser.Parse(line)
+		handler.Handle(c, msg)
+	}
+	received := func(c *client.Client, text string) bool {
+		for _, line := range c.SentMessages() {
+			if strings.Contains(line, text) {
+				return true
+			}
+		}
+		return false
+	}
+
+	alice, bob, carol := newUser("alice"), newUser("bob"), newUser("carol")
+	send(alice, "MODE alice +g")
+	alice.SentMessages()
+
+	// A sender who isn't accepted is bounced, and alice hears about it once
+	send(bob, "PRIVMSG alice :hello")
+	sent := bob.SentMessages()
+	if len(sent) != 2 ||
+		sent[0] != ":testserver 716 bob alice :is in +g mode (server-side ignore.)" ||
+		sent[1] != ":testserver 717 bob alice :has been informed that you messaged them." {
+		t.Errorf("blocked sender got %q, want 716 and 717", sent)
+	}
+	if sent := alice.SentMessages(); len(sent) != 1 || sent[0] != ":testserver 718 alice bob bob@test.host :is messaging you, and you have umode +g." {
+		t.Errorf("+g user got %q, want a single 718", sent)
+	}
+	send(carol, "PRIVMSG alice :hi")
+	if received(alice, "hi") || received(alice, " 718 ") {
+		t.Error("+g user should not get the message or another 718 within a minute")
+	}
+	if sent := carol.SentMessages(); len(sent) != 1 || !strings.Contains(sent[0], " 716 ") {
+		t.Errorf("second blocked sender got %q, want only 716", sent)
+	}
+	send(carol, "NOTICE alice :psst")
+	if received(alice, "psst") || len(carol.SentMessages()) != 0 {
+		t.Error("a blocked NOTICE should be dropped without a reply")
+	}
+
+	// Accepted senders get through
+	send(alice, "ACCEPT bob")
+	send(bob, "PRIVMSG alice :hello again")
+	if !received(alice, ":bob!bob@test.host PRIVMSG alice :hello again") {
+		t.Error("message from an accepted sender was not delivered")
+	}
+
+	send(alice, "ACCEPT bob,nobody,-carol")
+	if sent := alice.SentMessages(); len(sent) != 3 ||
+		sent[0] != ":testserver 457 alice bob :is already on your accept list" ||
+		sent[1] != ":testserver 401 alice nobody :No such nick/channel" ||
+		sent[2] != ":testserver 458 alice carol :is not on your accept list" {
+		t.Errorf("ACCEPT errors = %q", sent)
+	}
+
+	// Messaging someone accepts them, so their reply gets through
+	send(alice, "PRIVMSG carol :what did you want?")
+	carol.SentMessages()
+	send(carol, "PRIVMSG alice :just saying hi")
+	if !received(alice, "just saying hi") {
+		t.Error("reply from a user alice messaged was not delivered")
+	}
+
+	send(alice, "ACCEPT *")
+	if sent := alice.SentMessages(); len(sent) != 3 ||
+		sent[0] != ":testserver 281 alice bob" || sent[1] != ":testserver 281 alice carol" ||
+		sent[2] != ":testserver 282 alice :End of /ACCEPT list." {
+		t.Errorf("ACCEPT * = %q", sent)
+	}
+
+	send(alice, "ACCEPT -bob")
+	send(bob, "PRIVMSG alice :still there?")
+	if received(alice, "still there?") {
+		t.Error("message from a removed sender was delivered")
+	}
+
+	// Entries go away with the nick, so nobody can take it to get through
+	send(alice, "ACCEPT bob,carol")
+	send(bob, "NICK bobby")
+	send(carol, "QUIT")
+	for _, nick := range []string{"bob", "carol"} {
+		impostor := newUser(nick)
+		send(impostor, "PRIVMSG alice :it's me")
+		if received(alice, "it's me") {
+			t.Errorf("new user of %s's old nick got through +g", nick)
+		}
+	}
+	if accepted := alice.GetAcceptList(); len(accepted) != 0 {
+		t.Errorf("ACCEPT list = %v after NICK and QUIT, want it empty", accepted)
+	}
+}
+
+func TestDelayedJoin(t *testing.T) {
+	log := logger.New()
+	clientReg := newMockClientRegistry()
+	handler := New("testserver", log, clientReg, newMockChannelRegistry(), nil)
+
+	newUser := func(nick string) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetUsername(nick, nick)
+		c.SetRegistered(true)
+		clientReg.AddClient(c)
+		return c
+	}
+	send := func(c *client.Client, line string) {
+		msg, _ := parser.Parse(line)
+		handler.Handle(c, msg)
+	}
+	owner := newUser("owner")
+	bob := newUser("bob")
+	carol := newUser("carol")
+	dave := newUser("dave")
+
+	send(owner, "JOIN #big")
+	send(owner, "MODE #big +D")
+	owner.SentMessages()
+
+	// The join is confirmed to bob but not shown to the channel
+	send(bob, "JOIN #big")
+	if sent := strings.Join(bob.SentMessages(), "\n"); !strings.Contains(sent, ":bob!bob@test.host JOIN #big") {
+		t.Errorf("joining member not shown their own JOIN: %q", sent)
+	}
+	if sent := owner.SentMessages(); len(sent) != 0 {
+		t.Fatalf("+D join broadcast before bob spoke: %q", sent)
+	}
+
+	// Hidden members are left out of others' NAMES and WHO
+	send(owner, "NAMES #big")
+	send(owner, "WHO #big")
+	if sent := strings.Join(owner.SentMessages(), "\n"); strings.Contains(sent, "bob") {
+		t.Errorf("hidden member listed to others: %q", sent)
+	}
+
+	// Speaking announces the join first
+	send(bob, "PRIVMSG #big :hello")
+	sent := owner.SentMessages()
+	want := []string{":bob!bob@test.host JOIN #big", ":bob!bob@test.host PRIVMSG #big :hello"}
+	if len(sent) != 2 || sent[0] != want[0] || sent[1] != want[1] {
+		t.Errorf("after bob spoke owner got %q, want %q", sent, want)
+	}
+	send(bob, "PRIVMSG #big :again")
+	if sent := owner.SentMessages(); len(sent) != 1 {
+		t.Errorf("JOIN repeated for a revealed member: %q", sent)
+	}
+
+	// Gaining status announces the join before the MODE
+	send(carol, "JOIN #big")
+	bob.SentMessages()
+	send(owner, "MODE #big +v carol")
+	sent = bob.SentMessages()
+	if len(sent) != 2 || !strings.Contains(sent[0], "carol!carol@test.host JOIN #big") || !strings.Contains(sent[1], "MODE #big +v carol") {
+		t.Errorf("voicing a hidden member sent %q, want JOIN then MODE", sent)
+	}
+
+	// A member who leaves without speaking was never seen
+	send(dave, "JOIN #big")
+	send(dave, "PART #big")
+	if sent := bob.SentMessages(); len(sent) != 0 {
+		t.Errorf("hidden member's JOIN/PART shown to others: %q", sent)
+	}
+	if sent := strings.Join(dave.SentMessages(), "\n"); !strings.Contains(sent, "dave!dave@test.host PART #big") {
+		t.Errorf("hidden member not shown their own PART: %q", sent)
+	}
+}
+
+func TestStandardReplies(t *testing.T) {
+	log := logger.New()
+	handler := New("testserver", log, newMockClientRegistry(), newMockChannelRegistry(), nil)
+	handler.SetOptions(Options{JoinPartRate: 0.01, JoinPartBurst: 1})
+
+	run := func(c *client.Client, line string) string {
+		c.SentMessages()
+		msg, _ := parser.Parse(line)
+		handler.Handle(c, msg)
+		return strings.Join(c.SentMessages(), "\n")
+	}
+	newUser := func(nick string, standardReplies bool) *client.Client {
+		c := client.NewMock(log)
+		c.SetNickname(nick)
+		c.SetUsername(nick, nick)
+		c.SetRegistered(true)
+		if standardReplies {
+			if out := run(c, "CAP REQ :standard-replies"); !strings.Contains(out, "ACK :standard-replies") {
+				t.Fatalf("standard-replies not acknowledged: %q", out)
+			}
+		}
+		return c
+	}
+	modern := newUser("modern", true)
+	legacy := newUser("legacy", false)
+
+	// Both use up their single join, then get throttled
+	for _, c := range []*client.Client{modern, legacy} {
+		run(c, "JOIN #a")
+	}
+
+	out := run(modern, "JOIN #b")
+	if want := ":testserver FAIL JOIN RATE_LIMITED #b :Cannot join #b: you are joining and parting channels too fast, slow down"; out != want {
+		t.Errorf("capable client got %q, want %q", out, want)
+	}
+
+	out = run(legacy, "JOIN #b")
+	if !strings.Contains(out, "NOTICE legacy :*** Cannot join #b") || strings.Contains(out, "FAIL") {
+		t.Errorf("legacy client got %q, want the NOTICE", out)
+	}
+
+	// Numerics stay for legacy clients: the OPER lockout
+	handler.SetOptions(Options{OperMaxFailures: 1, OperLockout: time.Minute})
+	for _, c := range []*client.Client{modern, legacy} {
+		run(c, "OPER nobody wrong")
+	}
+	if out := run(modern, "OPER nobody wrong"); !strings.HasPrefix(out, ":testserver FAIL OPER RATE_LIMITED :Too many failed OPER attempts") {
+		t.Errorf("capable client got %q, want FAIL OPER", out)
+	}
+	if out := run(legacy, "OPER nobody wrong"); !strings.Contains(out, " "+ERR_PASSWDMISMATCH+" legacy :Too many failed OPER attempts") {
+		t.Errorf("legacy client got %q, want ERR_PASSWDMISMATCH", out)
+	}
+
+	// Disabled in the options, the capability is neither offered nor used
+	handler.SetOptions(Options{NoStandardReplies: true})
+	if out := run(legacy, "CAP LS"); strings.Contains(out, "standard-replies") {
+		t.Errorf("standard-replies offered while disabled: %q", out)
+	}
+	if handler.usesStandardReplies(modern) {
+		t.Error("standard replies used while disabled")
+	}
+}
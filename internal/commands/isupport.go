@@ -0,0 +1,95 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/supamanluva/ircd/internal/channel"
+	"github.com/supamanluva/ircd/internal/client"
+)
+
+// channelPrefixChars are the channel status prefixes, highest first
+const channelPrefixChars = "~&@%+"
+
+// channelPrefixModes are the status modes granting channelPrefixChars
+const channelPrefixModes = "qaohv"
+
+// channelModeChars lists every channel mode we understand (for RPL_MYINFO)
+const channelModeChars = "CDIMPTabefhijklmnopqstv"
+
+// Parameter-taking channel modes by CHANMODES group. The status modes of
+// PREFIX are left out of CHANMODES; every other mode in channelModeChars
+// takes no parameter.
+const (
+	chanModesList  = "beI"  // A: lists, a mask is always given
+	chanModesKey   = "k"    // B: parameter when set and unset
+	chanModesOnSet = "fjlT" // C: parameter only when set
+)
+
+// chanModesToken builds the CHANMODES token from the modes we understand
+func chanModesToken() string {
+	var flags strings.Builder
+	for _, m := range channelModeChars {
+		if strings.ContainsRune(channelPrefixModes+chanModesList+chanModesKey+chanModesOnSet, m) {
+			continue
+		}
+		flags.WriteRune(m)
+	}
+	return "CHANMODES=" + strings.Join([]string{chanModesList, chanModesKey, chanModesOnSet, flags.String()}, ",")
+}
+
+// maxISupportTokens is how many tokens fit in one RPL_ISUPPORT line
+const maxISupportTokens = 13
+
+// isupportTokens returns the RPL_ISUPPORT tokens advertised to clients
+func (h *Handler) isupportTokens() []string {
+	return []string{
+		"PREFIX=(" + channelPrefixModes + ")" + channelPrefixChars,
+		"CHANTYPES=#&",
+		chanModesToken(),
+		"EXCEPTS=e",
+		"INVEX=I",
+		"EXTBAN=~," + channel.ExtbanTypes,
+		h.maxListToken(),
+		"NAMESX",
+		"UHNAMES",
+		"CALLERID=g",
+		"NICKLEN=16",
+		fmt.Sprintf("USERLEN=%d", h.opts.UserLen),
+		fmt.Sprintf("TARGMAX=WHO:%d,WHOIS:%d,USERHOST:%d,ISON:%d",
+			h.opts.MaxTargets, h.opts.MaxTargets, h.opts.MaxTargets, h.opts.MaxISON),
+	}
+}
+
+// maxListToken returns the MAXLIST token for the +b, +e, +I and +q lists:
+// the combined limit if one is set, otherwise the per-list limit
+func (h *Handler) maxListToken() string {
+	if h.opts.MaxListTotal > 0 {
+		return fmt.Sprintf("MAXLIST=beIq:%d", h.opts.MaxListTotal)
+	}
+	n := h.opts.MaxListEntries
+	return fmt.Sprintf("MAXLIST=b:%d,e:%d,I:%d,q:%d", n, n, n, n)
+}
+
+// limitTargets truncates a target list to max entries, telling the client
+// about the first target that was dropped
+func (h *Handler) limitTargets(c *client.Client, command string, targets []string, max int) []string {
+	if len(targets) <= max {
+		return targets
+	}
+	h.sendNumeric(c, ERR_TOOMANYTARGETS, fmt.Sprintf("%s :Too many targets. The maximum is %d for %s.", targets[max], max, command))
+	return targets[:max]
+}
+
+// sendISupport sends the RPL_ISUPPORT (005) lines
+func (h *Handler) sendISupport(c *client.Client) {
+	tokens := h.isupportTokens()
+	for len(tokens) > 0 {
+		n := len(tokens)
+		if n > maxISupportTokens {
+			n = maxISupportTokens
+		}
+		h.sendNumeric(c, RPL_ISUPPORT, strings.Join(tokens[:n], " ")+" :are supported by this server")
+		tokens = tokens[n:]
+	}
+}
@@ -0,0 +1,114 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/supamanluva/ircd/internal/client"
+	"github.com/supamanluva/ircd/internal/parser"
+)
+
+// luserCounts is a snapshot of the user and server totals reported by LUSERS
+type luserCounts struct {
+	local     int // Registered local clients
+	global    int // Local clients plus users on linked servers
+	invisible int // Local clients with +i
+	opers     int // Local clients with +o, plus operators on linked servers
+	channels  int
+	servers   int // Servers on the network, including this one
+	links     int // Servers linked directly to this one
+}
+
+// countLusers gathers the current totals and updates the recorded peaks
+func (h *Handler) countLusers() luserCounts {
+	var n luserCounts
+	for _, c := range h.clients.GetClients() {
+		if !c.IsRegistered() {
+			continue
+		}
+		n.local++
+		if c.HasMode('i') {
+			n.invisible++
+		}
+		if c.HasMode('o') {
+			n.opers++
+		}
+	}
+	n.channels = len(h.channels.GetChannels())
+	n.global = n.local
+	n.servers = 1
+
+	if h.router != nil {
+		n.global += h.router.GetRemoteUserCount()
+		n.opers += h.router.GetRemoteOperCount()
+		for _, srv := range h.router.GetLinkedServers() {
+			n.servers++
+			if srv.Distance <= 1 {
+				n.links++
+			}
+		}
+	}
+
+	h.luserMu.Lock()
+	if n.local > h.maxLocalUsers {
+		h.maxLocalUsers = n.local
+	}
+	if n.global > h.maxGlobalUsers {
+		h.maxGlobalUsers = n.global
+	}
+	h.luserMu.Unlock()
+
+	return n
+}
+
+// sendLusers sends the LUSERS reply (251-255, 265, 266)
+func (h *Handler) sendLusers(c *client.Client) {
+	n := h.countLusers()
+
+	h.luserMu.Lock()
+	maxLocal, maxGlobal := h.maxLocalUsers, h.maxGlobalUsers
+	h.luserMu.Unlock()
+
+	h.sendNumeric(c, RPL_LUSERCLIENT, fmt.Sprintf(":There are %d users and %d invisible on %d servers",
+		n.global-n.invisible, n.invisible, n.servers))
+	if n.opers > 0 {
+		h.sendNumeric(c, RPL_LUSEROP, fmt.Sprintf("%d :operator(s) online", n.opers))
+	}
+	if n.channels > 0 {
+		h.sendNumeric(c, RPL_LUSERCHANNELS, fmt.Sprintf("%d :channels formed", n.channels))
+	}
+	h.sendNumeric(c, RPL_LUSERME, fmt.Sprintf(":I have %d clients and %d servers", n.local, n.links))
+	h.sendNumeric(c, RPL_LOCALUSERS, fmt.Sprintf("%d %d :Current local users %d, max %d", n.local, maxLocal, n.local, maxLocal))
+	h.sendNumeric(c, RPL_GLOBALUSERS, fmt.Sprintf("%d %d :Current global users %d, max %d", n.global, maxGlobal, n.global, maxGlobal))
+}
+
+// handleStats handles STATS. The only query is z (operators only), which
+// reports server counters such as lines dropped for full send queues.
+func (h *Handler) handleStats(c *client.Client, msg *parser.Message) error {
+	query := msg.GetParam(0)
+	if query == "" {
+		query = "*"
+	} else {
+		query = query[:1]
+	}
+
+	if query == "z" {
+		if !c.HasMode('o') {
+			h.sendNumeric(c, ERR_NOPRIVILEGES, ":Permission Denied- You're not an IRC operator")
+			return nil
+		}
+		h.sendNumeric(c, RPL_STATSDEBUG, fmt.Sprintf("z :Dropped messages (full send queues): %d", client.DroppedMessages()))
+	}
+	h.sendNumeric(c, RPL_ENDOFSTATS, query+" :End of /STATS report")
+	return nil
+}
+
+// handleLusers handles the LUSERS command
+func (h *Handler) handleLusers(c *client.Client, msg *parser.Message) error {
+	if !c.IsRegistered() {
+		h.sendNumeric(c, ERR_NOTREGISTERED, ":You have not registered")
+		return nil
+	}
+
+	h.sendLusers(c)
+	return nil
+}
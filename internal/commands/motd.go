@@ -0,0 +1,30 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/supamanluva/ircd/internal/client"
+	"github.com/supamanluva/ircd/internal/parser"
+)
+
+// handleMotd handles the MOTD command
+// Syntax: MOTD [<target>]
+func (h *Handler) handleMotd(c *client.Client, msg *parser.Message) error {
+	h.sendMotd(c)
+	return nil
+}
+
+// sendMotd sends the message of the day, or ERR_NOMOTD if none is
+// configured. It ends the welcome burst too.
+func (h *Handler) sendMotd(c *client.Client) {
+	if h.opts.MOTD == nil {
+		h.sendNumeric(c, ERR_NOMOTD, ":MOTD File is missing")
+		return
+	}
+
+	h.sendNumeric(c, RPL_MOTDSTART, fmt.Sprintf(":- %s Message of the day - ", h.serverName))
+	for _, line := range h.opts.MOTD {
+		h.sendNumeric(c, RPL_MOTD, ":- "+line)
+	}
+	h.sendNumeric(c, RPL_ENDOFMOTD, ":End of /MOTD command.")
+}
@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/supamanluva/ircd/internal/client"
+)
+
+// maxGuestNickTries bounds the search for an unused guest nick
+const maxGuestNickTries = 100
+
+// protectNick starts the NickProtectGrace timer when a registered client is
+// using a nick reserved to an account they are not logged in to, and cancels
+// any earlier timer otherwise. It is called whenever the client's nick or
+// account changes.
+func (h *Handler) protectNick(c *client.Client) {
+	h.cancelNickEnforcement(c)
+	if h.opts.NickProtectGrace <= 0 || !c.IsRegistered() {
+		return
+	}
+
+	nick := c.GetNickname()
+	owner := h.accounts.NickOwner(nick)
+	if owner == "" || strings.EqualFold(c.GetAccount(), owner) {
+		return
+	}
+
+	seconds := int((h.opts.NickProtectGrace + time.Second - 1) / time.Second)
+	c.Send(fmt.Sprintf(":%s NOTICE %s :*** This nickname is registered. Log in to its account within %d seconds or your nick will be changed.", h.serverName, nick, seconds))
+
+	var timer *time.Timer
+	timer = time.AfterFunc(h.opts.NickProtectGrace, func() {
+		h.nickMu.Lock()
+		current := h.nickTimers[c] == timer
+		if current {
+			delete(h.nickTimers, c)
+		}
+		h.nickMu.Unlock()
+
+		if current {
+			h.enforceNick(c, nick)
+		}
+	})
+
+	h.nickMu.Lock()
+	if h.nickTimers == nil {
+		h.nickTimers = make(map[*client.Client]*time.Timer)
+	}
+	h.nickTimers[c] = timer
+	h.nickMu.Unlock()
+}
+
+// cancelNickEnforcement stops a pending guest rename for the client
+func (h *Handler) cancelNickEnforcement(c *client.Client) {
+	h.nickMu.Lock()
+	defer h.nickMu.Unlock()
+	if timer, ok := h.nickTimers[c]; ok {
+		timer.Stop()
+		delete(h.nickTimers, c)
+	}
+}
+
+// enforceNick renames a client still holding a reserved nick without being
+// logged in to its account once the grace period is over
+func (h *Handler) enforceNick(c *client.Client, nick string) {
+	if c.IsDisconnected() || !strings.EqualFold(c.GetNickname(), nick) {
+		return
+	}
+	owner := h.accounts.NickOwner(nick)
+	if owner == "" || strings.EqualFold(c.GetAccount(), owner) {
+		return
+	}
+
+	guest := h.guestNick()
+	if guest == "" || !h.ForceNick(c, guest) {
+		h.logger.Warn("Could not rename user of a reserved nick", "nick", nick, "account", owner)
+		return
+	}
+
+	h.logger.Info("Renamed unauthenticated user of a reserved nick", "nick", nick, "account", owner, "guest", guest)
+	c.Send(fmt.Sprintf(":%s NOTICE %s :*** Your nick was changed because %s is registered to another account.", h.serverName, guest, nick))
+}
+
+// guestNick returns an unused nick made from GuestNickPattern, or "" if
+// none could be found
+func (h *Handler) guestNick() string {
+	for i := 0; i < maxGuestNickTries; i++ {
+		number := strconv.FormatUint(h.guestSeq.Add(1), 10)
+		nick := strings.Replace(h.opts.GuestNickPattern, "*", number, 1)
+		if !strings.Contains(h.opts.GuestNickPattern, "*") {
+			nick += number
+		}
+		if !h.clients.IsNicknameInUse(nick) {
+			return nick
+		}
+	}
+	return ""
+}
@@ -0,0 +1,111 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/supamanluva/ircd/internal/client"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Account is an account clients can log in to through NickServ
+type Account struct {
+	Name     string
+	Password string   // bcrypt hashed
+	Nicks    []string // Nicknames reserved to the account besides its name
+}
+
+// SetAccounts installs the configured accounts and reserves their nicks
+func (h *Handler) SetAccounts(accounts []Account) {
+	h.logins = make(map[string]Account)
+	for _, a := range accounts {
+		h.logins[strings.ToLower(a.Name)] = a
+		h.accounts.ReserveNick(a.Name, a.Name)
+		for _, nick := range a.Nicks {
+			h.accounts.ReserveNick(a.Name, nick)
+		}
+	}
+}
+
+// NickServ handles messages to the NickServ service
+// IDENTIFY [account] <password> logs in (the account defaults to the
+// current nick); LOGOUT logs out
+func (h *Handler) NickServ(svc, from *client.Client, message string) {
+	reply := func(text string) {
+		from.Send(fmt.Sprintf(":%s NOTICE %s :%s", svc.GetHostmask(), from.GetNickname(), text))
+	}
+
+	fields := strings.Fields(message)
+	if len(fields) == 0 {
+		reply("Commands: IDENTIFY [account] <password>, LOGOUT")
+		return
+	}
+
+	switch strings.ToUpper(fields[0]) {
+	case "IDENTIFY":
+		var name, password string
+		switch len(fields) {
+		case 2:
+			name, password = from.GetNickname(), fields[1]
+		case 3:
+			name, password = fields[1], fields[2]
+		default:
+			reply("Syntax: IDENTIFY [account] <password>")
+			return
+		}
+		h.identify(from, name, password, reply)
+	case "LOGOUT":
+		if from.GetAccount() == "" {
+			reply("You are not logged in.")
+			return
+		}
+		h.LogoutAccount(from)
+		reply("You are now logged out.")
+	default:
+		reply(fmt.Sprintf("Unknown command %s. Commands: IDENTIFY [account] <password>, LOGOUT", fields[0]))
+	}
+}
+
+// identify checks an account password and logs the client in. Failures
+// count towards the OPER lockout, so passwords can't be guessed faster
+// through NickServ than through OPER.
+func (h *Handler) identify(c *client.Client, name, password string, reply func(string)) {
+	now := time.Now()
+	if wait := h.operLockout(c, now); wait > 0 {
+		seconds := int((wait + time.Second - 1) / time.Second)
+		reply(fmt.Sprintf("Too many failed attempts, try again in %d seconds.", seconds))
+		h.logger.Warn("IDENTIFY attempt while locked out", "account", name, "client", c.GetNickname())
+		return
+	}
+
+	account, exists := h.logins[strings.ToLower(name)]
+	if !exists || bcrypt.CompareHashAndPassword([]byte(account.Password), []byte(password)) != nil {
+		reply("Invalid account or password.")
+		h.logger.Warn("Failed IDENTIFY attempt", "account", name, "client", c.GetNickname())
+		h.recordOperFailure(c, now)
+		return
+	}
+	if strings.EqualFold(c.GetAccount(), account.Name) {
+		reply(fmt.Sprintf("You are already logged in as %s.", account.Name))
+		return
+	}
+
+	h.clearOperFailures(c)
+	if c.GetAccount() != "" {
+		h.saveStickyModes(c)
+	}
+	h.LoginAccount(c, account.Name)
+	h.sendNumeric(c, RPL_LOGGEDIN, fmt.Sprintf("%s %s :You are now logged in as %s", c.GetHostmask(), account.Name, account.Name))
+	reply(fmt.Sprintf("You are now identified for %s.", account.Name))
+	h.logger.Info("Client logged in", "nickname", c.GetNickname(), "account", account.Name)
+}
+
+// LogoutAccount logs a client out of its account, saving its sticky modes
+// first. Nick protection applies again to the nick it is using.
+func (h *Handler) LogoutAccount(c *client.Client) {
+	h.saveStickyModes(c)
+	c.SetAccount("")
+	h.sendNumeric(c, RPL_LOGGEDOUT, c.GetHostmask()+" :You are now logged out")
+	h.protectNick(c)
+}
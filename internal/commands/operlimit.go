@@ -0,0 +1,95 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/supamanluva/ircd/internal/client"
+)
+
+// operFailures counts failed OPER attempts from one client or IP
+type operFailures struct {
+	count       int
+	last        time.Time // Most recent failure; the count resets OperLockout after it
+	lockedUntil time.Time
+}
+
+// operLockout returns how much longer c is locked out of OPER, either by its
+// own failures or by those of its IP
+func (h *Handler) operLockout(c *client.Client, now time.Time) time.Duration {
+	h.operMu.Lock()
+	defer h.operMu.Unlock()
+
+	var remaining time.Duration
+	for _, f := range []*operFailures{h.operFailsByClient[c], h.operFailsByIP[c.GetIP()]} {
+		if f != nil && f.lockedUntil.After(now) && f.lockedUntil.Sub(now) > remaining {
+			remaining = f.lockedUntil.Sub(now)
+		}
+	}
+	return remaining
+}
+
+// recordOperFailure counts a failed OPER attempt against c and its IP,
+// locking both out for OperLockout once OperMaxFailures is reached
+func (h *Handler) recordOperFailure(c *client.Client, now time.Time) {
+	h.operMu.Lock()
+	defer h.operMu.Unlock()
+
+	if h.operFailsByClient == nil {
+		h.operFailsByClient = make(map[*client.Client]*operFailures)
+		h.operFailsByIP = make(map[string]*operFailures)
+	}
+	h.pruneOperFailures(now)
+
+	count := func(f *operFailures) *operFailures {
+		if f == nil {
+			f = &operFailures{}
+		}
+		f.count++
+		f.last = now
+		if f.count >= h.opts.OperMaxFailures {
+			f.lockedUntil = now.Add(h.opts.OperLockout)
+			f.count = 0
+		}
+		return f
+	}
+	h.operFailsByClient[c] = count(h.operFailsByClient[c])
+	ip := c.GetIP()
+	h.operFailsByIP[ip] = count(h.operFailsByIP[ip])
+}
+
+// clearOperFailures forgets c's failures after a successful OPER. Failures
+// of other clients on the same IP still count.
+func (h *Handler) clearOperFailures(c *client.Client) {
+	h.operMu.Lock()
+	defer h.operMu.Unlock()
+	delete(h.operFailsByClient, c)
+}
+
+// pruneOperFailures drops entries that are neither locked out nor recent;
+// callers must hold operMu
+func (h *Handler) pruneOperFailures(now time.Time) {
+	stale := func(f *operFailures) bool {
+		return !f.lockedUntil.After(now) && now.Sub(f.last) > h.opts.OperLockout
+	}
+	for c, f := range h.operFailsByClient {
+		if stale(f) {
+			delete(h.operFailsByClient, c)
+		}
+	}
+	for ip, f := range h.operFailsByIP {
+		if stale(f) {
+			delete(h.operFailsByIP, ip)
+		}
+	}
+}
+
+// sendSnotice sends a server notice to local users with +s and the given
+// snomask
+func (h *Handler) sendSnotice(mask rune, text string) {
+	for _, c := range h.clients.GetClients() {
+		if c.HasMode('s') && c.HasSnomask(mask) {
+			c.Send(fmt.Sprintf(":%s NOTICE %s :*** Notice -- %s", h.serverName, c.GetNickname(), text))
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package commands
+
+import "time"
+
+// Options holds tunable command handler behaviour
+type Options struct {
+	UserLen       int     // Maximum username length (USERLEN), including the ~ prefix
+	CTCPRate      float64 // CTCP queries per second per client (0 = unlimited)
+	CTCPBurst     float64 // CTCP queries allowed in a burst
+	CTCPReplies   bool    // Answer VERSION/PING/TIME/CLIENTINFO sent to the server name
+	JoinPartRate  float64 // JOINs and PARTs per second per client, combined (0 = unlimited)
+	JoinPartBurst float64 // JOINs and PARTs allowed in a burst
+	MaxTargets    int     // Targets processed per WHO/WHOIS/USERHOST query
+	MaxISON       int     // Nicknames checked per ISON query
+	Version       string  // Version shown to non-operators instead of the real one ("" = real)
+	HideBuildInfo bool    // Omit Go/platform details from VERSION for non-operators
+	MaxPerUserHost int    // Registered non-oper clients allowed per user@host (0 = unlimited)
+	StatusGrace   time.Duration // Logged-in users rejoining within this get their channel status back (0 = off)
+	OperMaxFailures int         // Failed OPER attempts (per client and per IP) before a lockout
+	OperLockout   time.Duration // How long OPER is refused after too many failures
+	NoticeLoopLimit  int           // CTCP reply NOTICEs allowed between two users per NoticeLoopWindow (0 = unlimited)
+	NoticeLoopWindow time.Duration
+	MaxListEntries int          // Masks allowed on each channel list (+b, +e, +I, +q)
+	MaxListTotal   int          // Masks allowed on all of a channel's lists together (0 = no combined limit)
+	KickCooldown   time.Duration // Kicked users may not rejoin the channel for this long (0 = off)
+	TopicChanges   int           // Topic changes allowed per channel per TopicWindow unless +T is set (0 = unlimited)
+	TopicWindow    time.Duration
+	InviteExpiry   time.Duration // Unused invites lapse after this long
+	ResyncDuplicateJoin bool     // JOIN for a channel the client is already in resends topic and NAMES
+	NickProtectGrace time.Duration // Users of a nick reserved to another account are renamed after this long (0 = off)
+	GuestNickPattern string        // Nick given on enforcement; * is replaced with a number
+	Lockdown         bool          // Start with registration limited to operators (PASS <name>:<password>)
+	ClientTags       []string      // Client-only tags (without the +) relayed to message-tags clients; empty relays any
+	MaxTagLength     int           // Longest tag section a client may send, in bytes
+	MOTD             []string      // Message of the day, one entry per line (nil = none, ERR_NOMOTD)
+	NoStandardReplies bool         // Don't offer standard-replies; every client gets the legacy numerics
+	WhowasSize       int           // Departed users kept for WHOWAS, oldest dropped first
+	MaxAccept        int           // Nicks a +g (caller ID) user may have on their ACCEPT list
+}
+
+// DefaultOptions returns the options used when none are configured
+func DefaultOptions() Options {
+	return Options{
+		UserLen:    10,
+		MaxTargets: 5,
+		MaxISON:    32,
+		OperMaxFailures: 3,
+		OperLockout:     time.Minute,
+		NoticeLoopWindow: 10 * time.Second,
+		MaxListEntries:   100,
+		TopicWindow:      time.Minute,
+		InviteExpiry:     time.Hour,
+		GuestNickPattern: "Guest*",
+		MaxTagLength:     4094,
+		WhowasSize:       1000,
+		MaxAccept:        20,
+	}
+}
+
+// SetOptions replaces the handler options, filling in defaults for unset values
+func (h *Handler) SetOptions(opts Options) {
+	defaults := DefaultOptions()
+	if opts.UserLen <= 0 {
+		opts.UserLen = defaults.UserLen
+	}
+	if opts.MaxTargets <= 0 {
+		opts.MaxTargets = defaults.MaxTargets
+	}
+	if opts.MaxISON <= 0 {
+		opts.MaxISON = defaults.MaxISON
+	}
+	if opts.OperMaxFailures <= 0 {
+		opts.OperMaxFailures = defaults.OperMaxFailures
+	}
+	if opts.OperLockout <= 0 {
+		opts.OperLockout = defaults.OperLockout
+	}
+	if opts.NoticeLoopWindow <= 0 {
+		opts.NoticeLoopWindow = defaults.NoticeLoopWindow
+	}
+	if opts.MaxListEntries <= 0 {
+		opts.MaxListEntries = defaults.MaxListEntries
+	}
+	if opts.TopicWindow <= 0 {
+		opts.TopicWindow = defaults.TopicWindow
+	}
+	if opts.InviteExpiry <= 0 {
+		opts.InviteExpiry = defaults.InviteExpiry
+	}
+	if opts.MaxTagLength <= 0 {
+		opts.MaxTagLength = defaults.MaxTagLength
+	}
+	if opts.WhowasSize <= 0 {
+		opts.WhowasSize = defaults.WhowasSize
+	}
+	if opts.MaxAccept <= 0 {
+		opts.MaxAccept = defaults.MaxAccept
+	}
+	if opts.GuestNickPattern == "" {
+		opts.GuestNickPattern = defaults.GuestNickPattern
+	}
+	if opts.CTCPRate > 0 && opts.CTCPBurst < 1 {
+		opts.CTCPBurst = 1
+	}
+	if opts.JoinPartRate > 0 && opts.JoinPartBurst < 1 {
+		opts.JoinPartBurst = 1
+	}
+	h.opts = opts
+	h.lockdown.Store(opts.Lockdown)
+}
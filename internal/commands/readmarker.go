@@ -0,0 +1,117 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/supamanluva/ircd/internal/client"
+	"github.com/supamanluva/ircd/internal/parser"
+)
+
+// capReadMarker lets clients sync the last-read position of each target
+const capReadMarker = "draft/read-marker"
+
+// readMarkerLayout is the timestamp format of MARKREAD (UTC, milliseconds)
+const readMarkerLayout = "2006-01-02T15:04:05.000Z"
+
+// readMarkers holds the last-read timestamp per target, shared by every
+// session of an account; sessions without an account keep their own
+type readMarkers struct {
+	mu        sync.Mutex
+	byAccount map[string]map[string]time.Time         // account -> target -> last read
+	bySession map[*client.Client]map[string]time.Time // client -> target -> last read
+}
+
+// targets returns the marker map for c, creating it if create is set
+func (m *readMarkers) targets(c *client.Client, create bool) map[string]time.Time {
+	if account := c.GetAccount(); account != "" {
+		if m.byAccount[account] == nil && create {
+			if m.byAccount == nil {
+				m.byAccount = make(map[string]map[string]time.Time)
+			}
+			m.byAccount[account] = make(map[string]time.Time)
+		}
+		return m.byAccount[account]
+	}
+	if m.bySession[c] == nil && create {
+		if m.bySession == nil {
+			m.bySession = make(map[*client.Client]map[string]time.Time)
+		}
+		m.bySession[c] = make(map[string]time.Time)
+	}
+	return m.bySession[c]
+}
+
+// get returns the marker for target, or the zero time if none is set
+func (m *readMarkers) get(c *client.Client, target string) time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.targets(c, false)[strings.ToLower(target)]
+}
+
+// advance moves the marker for target forward to ts; markers never move
+// back. It returns the marker now in effect.
+func (m *readMarkers) advance(c *client.Client, target string, ts time.Time) time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	targets := m.targets(c, true)
+	key := strings.ToLower(target)
+	if ts.After(targets[key]) {
+		targets[key] = ts
+	}
+	return targets[key]
+}
+
+// forget drops the markers of a session without an account
+func (m *readMarkers) forget(c *client.Client) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.bySession, c)
+}
+
+// formatReadMarker returns the MARKREAD timestamp parameter ("*" if unset)
+func formatReadMarker(ts time.Time) string {
+	if ts.IsZero() {
+		return "*"
+	}
+	return "timestamp=" + ts.UTC().Format(readMarkerLayout)
+}
+
+// handleMarkread handles MARKREAD <target> [timestamp=<ts>]. Without a
+// timestamp it reports the current marker; with one it moves the marker
+// forward and tells every session of the account.
+func (h *Handler) handleMarkread(c *client.Client, msg *parser.Message) error {
+	if !msg.HasParam(0) {
+		c.Send(fmt.Sprintf(":%s FAIL MARKREAD NEED_MORE_PARAMS :Missing parameters", h.serverName))
+		return nil
+	}
+	target := msg.GetParam(0)
+
+	if !msg.HasParam(1) {
+		marker := h.markers.get(c, target)
+		c.Send(fmt.Sprintf(":%s MARKREAD %s %s", h.serverName, target, formatReadMarker(marker)))
+		return nil
+	}
+
+	value, ok := strings.CutPrefix(msg.GetParam(1), "timestamp=")
+	ts, err := time.Parse(time.RFC3339Nano, value)
+	if !ok || err != nil {
+		c.Send(fmt.Sprintf(":%s FAIL MARKREAD INVALID_PARAMS %s :Invalid timestamp", h.serverName, target))
+		return nil
+	}
+
+	reply := fmt.Sprintf(":%s MARKREAD %s %s", h.serverName, target, formatReadMarker(h.markers.advance(c, target, ts)))
+	c.Send(reply)
+
+	// Keep the account's other sessions in sync
+	if account := c.GetAccount(); account != "" {
+		for _, session := range h.clients.GetClientsByAccount(account) {
+			if session != c && session.HasCap(capReadMarker) {
+				session.Send(reply)
+			}
+		}
+	}
+	return nil
+}
@@ -10,17 +10,29 @@ const (
 	RPL_ISUPPORT         = "005"
 
 	// Command responses
+	RPL_ENDOFSTATS       = "219"
 	RPL_UMODEIS          = "221"
+	RPL_STATSDEBUG       = "249"
+	RPL_LUSERCLIENT      = "251"
+	RPL_LUSEROP          = "252"
+	RPL_LUSERCHANNELS    = "254"
+	RPL_LUSERME          = "255"
+	RPL_LOCALUSERS       = "265"
+	RPL_GLOBALUSERS      = "266"
 	RPL_AWAY             = "301"
 	RPL_USERHOST         = "302"
 	RPL_ISON             = "303"
 	RPL_UNAWAY           = "305"
 	RPL_NOWAWAY          = "306"
+	RPL_ACCEPTLIST       = "281"
+	RPL_ENDOFACCEPT      = "282"
 	RPL_WHOISUSER        = "311"
 	RPL_WHOISSERVER      = "312"
 	RPL_WHOISOPERATOR    = "313"
 	RPL_ENDOFWHO         = "315"
 	RPL_WHOISIDLE        = "317"
+	RPL_WHOISSPECIAL     = "320"
+	RPL_WHOWASUSER       = "314"
 	RPL_ENDOFWHOIS       = "318"
 	RPL_WHOISCHANNELS    = "319"
 	RPL_LISTSTART        = "321"
@@ -29,24 +41,51 @@ const (
 	RPL_CHANNELMODEIS    = "324"
 	RPL_NOTOPIC          = "331"
 	RPL_TOPIC            = "332"
+	RPL_TOPICWHOTIME     = "333"
+	RPL_INVITELIST       = "336"
+	RPL_ENDOFINVITELIST  = "337"
 	RPL_INVITING         = "341"
+	RPL_VERSION          = "351"
 	RPL_WHOREPLY         = "352"
 	RPL_NAMREPLY         = "353"
+	RPL_LINKS            = "364"
+	RPL_ENDOFLINKS       = "365"
 	RPL_ENDOFNAMES       = "366"
+	RPL_INVEXLIST        = "346"
+	RPL_ENDOFINVEXLIST   = "347"
+	RPL_EXCEPTLIST       = "348"
+	RPL_ENDOFEXCEPTLIST  = "349"
+	RPL_BANLIST          = "367"
+	RPL_ENDOFBANLIST     = "368"
+	RPL_ENDOFWHOWAS      = "369"
 	RPL_MOTD             = "372"
 	RPL_MOTDSTART        = "375"
 	RPL_ENDOFMOTD        = "376"
 	RPL_YOUREOPER        = "381"
+	RPL_REHASHING        = "382"
+	RPL_TARGUMODEG       = "716"
+	RPL_TARGNOTIFY       = "717"
+	RPL_UMODEGMSG        = "718"
+	RPL_QUIETLIST        = "728"
+	RPL_LOGGEDIN         = "900"
+	RPL_LOGGEDOUT        = "901"
+	RPL_ENDOFQUIETLIST   = "729"
 
 	// Error messages
+	ERR_UNKNOWNERROR     = "400"
 	ERR_NOSUCHNICK       = "401"
 	ERR_NOSUCHSERVER     = "402"
 	ERR_NOSUCHCHANNEL    = "403"
 	ERR_CANNOTSENDTOCHAN = "404"
 	ERR_TOOMANYCHANNELS  = "405"
+	ERR_WASNOSUCHNICK    = "406"
+	ERR_TOOMANYTARGETS   = "407"
+	ERR_INVALIDCAPCMD    = "410"
 	ERR_NORECIPIENT      = "411"
 	ERR_NOTEXTTOSEND     = "412"
+	ERR_INPUTTOOLONG     = "417"
 	ERR_UNKNOWNCOMMAND   = "421"
+	ERR_NOMOTD           = "422"
 	ERR_NONICKNAMEGIVEN  = "431"
 	ERR_ERRONEUSNICKNAME = "432"
 	ERR_NICKNAMEINUSE    = "433"
@@ -54,16 +93,25 @@ const (
 	ERR_NOTONCHANNEL     = "442"
 	ERR_USERONCHANNEL    = "443"
 	ERR_NOTREGISTERED    = "451"
+	ERR_ACCEPTFULL       = "456"
+	ERR_ACCEPTEXIST      = "457"
+	ERR_ACCEPTNOT        = "458"
 	ERR_NEEDMOREPARAMS   = "461"
 	ERR_ALREADYREGISTERED = "462"
 	ERR_PASSWDMISMATCH   = "464"
+	ERR_INVALIDUSERNAME  = "468"
 	ERR_CHANNELISFULL    = "471"
 	ERR_UNKNOWNMODE      = "472"
+	ERR_INVITEONLYCHAN   = "473"
+	ERR_BANNEDFROMCHAN   = "474"
 	ERR_BADCHANNELKEY    = "475"
+	ERR_NEEDREGGEDNICK   = "477"
+	ERR_BANLISTFULL      = "478"
 	ERR_NOPRIVILEGES     = "481"
 	ERR_CHANOPRIVSNEEDED = "482"
 	ERR_UMODEUNKNOWNFLAG = "501"
 	ERR_USERSDONTMATCH   = "502"
+	ERR_INVALIDMODEPARAM = "696"
 )
 
 // NumericReply formats a numeric reply message
@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/supamanluva/ircd/internal/client"
+)
+
+// Standard reply types and codes (IRCv3 standard-replies) used by this server
+const (
+	replyFail       = "FAIL"         // The command failed
+	codeRateLimited = "RATE_LIMITED" // Refused until the client slows down
+)
+
+// usesStandardReplies reports whether c gets FAIL/WARN/NOTE in place of
+// legacy numerics and notices
+func (h *Handler) usesStandardReplies(c *client.Client) bool {
+	return !h.opts.NoStandardReplies && c.HasCap(capStandardReplies)
+}
+
+// sendStandardReply sends <kind> <command> <code> [<context>...] :<description>,
+// where kind is FAIL, WARN or NOTE, if c negotiated standard-replies, and
+// reports whether it did. Callers send their legacy reply when it didn't.
+func (h *Handler) sendStandardReply(c *client.Client, kind, command, code, description string, context ...string) bool {
+	if !h.usesStandardReplies(c) {
+		return false
+	}
+
+	fields := append([]string{kind, command, code}, context...)
+	c.Send(fmt.Sprintf(":%s %s :%s", h.serverName, strings.Join(fields, " "), description))
+	return true
+}
+
+// SendFail reports a failed command to c as FAIL if it negotiated
+// standard-replies, and as ERR_UNKNOWNERROR otherwise
+func (h *Handler) SendFail(c *client.Client, command, code, description string) {
+	if !h.sendStandardReply(c, replyFail, command, code, description) {
+		h.sendNumeric(c, ERR_UNKNOWNERROR, fmt.Sprintf("%s :%s", command, description))
+	}
+}
@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"strings"
+
+	"github.com/supamanluva/ircd/internal/client"
+	"github.com/supamanluva/ircd/internal/parser"
+)
+
+// clientTagPrefix marks tags that clients may set and that are passed on to
+// other clients untouched
+const clientTagPrefix = "+"
+
+// relayedTags returns the tag section to pass on with a client's message:
+// its client-only tags allowed by ClientTags. Tags without the + prefix are
+// the server's to set and are dropped. ok is false, after ERR_INPUTTOOLONG,
+// if the tags are over MaxTagLength.
+func (h *Handler) relayedTags(c *client.Client, msg *parser.Message) (tags string, ok bool) {
+	if msg.TagsLength() > h.opts.MaxTagLength {
+		h.sendNumeric(c, ERR_INPUTTOOLONG, ":Input line was too long")
+		return "", false
+	}
+
+	relayed := make(map[string]string)
+	for key, value := range msg.Tags {
+		name, clientOnly := strings.CutPrefix(key, clientTagPrefix)
+		if !clientOnly || name == "" || !h.clientTagAllowed(name) {
+			continue
+		}
+		relayed[key] = value
+	}
+	return parser.FormatTags(relayed), true
+}
+
+// clientTagAllowed reports whether a client-only tag (without the +) may be
+// relayed
+func (h *Handler) clientTagAllowed(name string) bool {
+	if len(h.opts.ClientTags) == 0 {
+		return true
+	}
+	for _, allowed := range h.opts.ClientTags {
+		if strings.EqualFold(name, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// sendTagged sends a line to a client, with the tag section in front if
+// there is one and the client has enabled message-tags
+func (h *Handler) sendTagged(c *client.Client, tags, line string) {
+	if tags != "" && c.HasCap(capMessageTags) {
+		line = tags + " " + line
+	}
+	c.Send(line)
+}
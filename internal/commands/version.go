@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/supamanluva/ircd/internal/client"
+	"github.com/supamanluva/ircd/internal/parser"
+)
+
+// advertisedVersion returns the version string shown to a client. Operators
+// always see the real version; others see the configured override, if any.
+func (h *Handler) advertisedVersion(c *client.Client) string {
+	if h.opts.Version == "" || c.HasMode('o') {
+		return serverVersion
+	}
+	return h.opts.Version
+}
+
+// ServerVersion returns the real server version, as exchanged with linked servers
+func ServerVersion() string {
+	return serverVersion
+}
+
+// buildInfo describes the runtime the server was built with
+func buildInfo() string {
+	return fmt.Sprintf("%s %s/%s", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// handleVersion handles the VERSION command
+// VERSION replies with RPL_VERSION: <version> <server> :<comments>
+func (h *Handler) handleVersion(c *client.Client, msg *parser.Message) error {
+	if !c.IsRegistered() {
+		h.sendNumeric(c, ERR_NOTREGISTERED, ":You have not registered")
+		return nil
+	}
+
+	comments := buildInfo()
+	if h.opts.HideBuildInfo && !c.HasMode('o') {
+		comments = ""
+	}
+
+	h.sendNumeric(c, RPL_VERSION, fmt.Sprintf("%s %s :%s", h.advertisedVersion(c), h.serverName, comments))
+	h.sendISupport(c)
+	return nil
+}
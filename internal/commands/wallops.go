@@ -0,0 +1,40 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/supamanluva/ircd/internal/client"
+	"github.com/supamanluva/ircd/internal/parser"
+)
+
+// handleWallops handles the WALLOPS command
+// Syntax: WALLOPS :<text>
+func (h *Handler) handleWallops(c *client.Client, msg *parser.Message) error {
+	if !c.HasMode('o') {
+		h.sendNumeric(c, ERR_NOPRIVILEGES, ":Permission Denied- You're not an IRC operator")
+		return nil
+	}
+
+	text := msg.GetParam(0)
+	h.SendWallops(c.GetHostmask(), text)
+
+	if h.router != nil && c.GetUID() != "" {
+		if err := h.router.PropagateWallops(c.GetNickname(), c.GetUsername(), c.GetHostname(), c.GetUID(), text); err != nil {
+			h.logger.Debug("Failed to propagate WALLOPS", "error", err)
+		}
+	}
+
+	h.logger.Info("WALLOPS sent", "oper", c.GetNickname())
+	return nil
+}
+
+// SendWallops delivers a WALLOPS from source to every local client with
+// user mode +w
+func (h *Handler) SendWallops(source, text string) {
+	line := fmt.Sprintf(":%s WALLOPS :%s", source, text)
+	for _, c := range h.clients.GetClients() {
+		if c.HasMode('w') {
+			c.Send(line)
+		}
+	}
+}
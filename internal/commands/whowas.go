@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/supamanluva/ircd/internal/client"
+	"github.com/supamanluva/ircd/internal/parser"
+)
+
+// whowasEntry is a nick remembered after its user left the server or
+// changed nick
+type whowasEntry struct {
+	nick     string
+	user     string
+	host     string
+	realname string
+	leftAt   time.Time
+}
+
+// whowasHistory holds recently departed nicks, oldest first. Once it is
+// full the oldest entry is dropped for each new one.
+type whowasHistory struct {
+	mu      sync.Mutex
+	entries []whowasEntry
+}
+
+// add records an entry, evicting the oldest ones beyond max
+func (w *whowasHistory) add(e whowasEntry, max int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.entries = append(w.entries, e)
+	if over := len(w.entries) - max; over > 0 {
+		copy(w.entries, w.entries[over:])
+		w.entries = w.entries[:max]
+	}
+}
+
+// lookup returns up to count entries for nick, newest first (count <= 0
+// returns all of them)
+func (w *whowasHistory) lookup(nick string, count int) []whowasEntry {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var found []whowasEntry
+	for i := len(w.entries) - 1; i >= 0; i-- {
+		if !strings.EqualFold(w.entries[i].nick, nick) {
+			continue
+		}
+		found = append(found, w.entries[i])
+		if count > 0 && len(found) == count {
+			break
+		}
+	}
+	return found
+}
+
+// rememberQuit adds a registered client that is leaving to the WHOWAS
+// history
+func (h *Handler) rememberQuit(c *client.Client) {
+	if !c.IsRegistered() {
+		return
+	}
+	h.rememberNick(c, c.GetNickname())
+}
+
+// rememberNick adds a nick c used to the WHOWAS history
+func (h *Handler) rememberNick(c *client.Client, nick string) {
+	h.whowas.add(whowasEntry{
+		nick:     nick,
+		user:     c.GetUsername(),
+		host:     c.GetHostname(),
+		realname: c.GetRealname(),
+		leftAt:   time.Now(),
+	}, h.opts.WhowasSize)
+}
+
+// handleWhowas handles the WHOWAS command
+// WHOWAS <nick>[,<nick>...] [count]
+func (h *Handler) handleWhowas(c *client.Client, msg *parser.Message) error {
+	count := 0
+	if msg.HasParam(1) {
+		count, _ = strconv.Atoi(msg.GetParam(1))
+	}
+
+	for _, nick := range h.limitTargets(c, "WHOWAS", strings.Split(msg.GetParam(0), ","), h.opts.MaxTargets) {
+		if nick == "" {
+			continue
+		}
+		entries := h.whowas.lookup(nick, count)
+		if len(entries) == 0 {
+			h.sendNumeric(c, ERR_WASNOSUCHNICK, fmt.Sprintf("%s :There was no such nickname", nick))
+		}
+		for _, e := range entries {
+			h.sendNumeric(c, RPL_WHOWASUSER, fmt.Sprintf("%s %s %s * :%s", e.nick, e.user, e.host, e.realname))
+			h.sendNumeric(c, RPL_WHOISSERVER, fmt.Sprintf("%s %s :%s", e.nick, h.serverName, e.leftAt.UTC().Format(time.RFC1123)))
+		}
+		h.sendNumeric(c, RPL_ENDOFWHOWAS, fmt.Sprintf("%s :End of WHOWAS", nick))
+	}
+	return nil
+}
@@ -1,14 +1,28 @@
 package linking
 
 import (
+	"errors"
 	"fmt"
 )
 
+// ErrMalformedBurstEntry is returned by HandleBurstMessage for a single UID or
+// SJOIN that can't be applied. ReceiveBurst skips such entries rather than
+// dropping the link.
+var ErrMalformedBurstEntry = errors.New("malformed burst entry")
+
 // BurstState tracks the state of a burst operation
 type BurstState struct {
 	InProgress bool
 	UsersRecv  int
 	ChansRecv  int
+	UsersSkipped int                        // Malformed or rejected UIDs skipped
+	ChansSkipped int                        // Malformed SJOINs skipped
+	MasksSkipped int                        // Malformed BMASKs skipped
+	Skipped    []error                      // Why each skipped entry was dropped, for the caller to log
+	ChanTS     map[string]int64             // Channel -> TS received in SJOIN
+	Cleared    map[string]map[string]string // Channel -> UID -> prefixes cleared by a TS loss
+	Users      []*RemoteUser                // Users introduced by UID, for local nick collision checks
+	Masks      map[string]map[byte][]string // Channel -> list type -> masks accepted from BMASK
 }
 
 // SendBurst sends all local users and channels to a remote server
@@ -34,6 +48,7 @@ func (l *Link) SendBurst(network *Network, localClients map[string]interface{},
 		msg := BuildUID(
 			network.LocalSID,
 			nick,
+			1,
 			"+i",
 			"user",
 			"localhost",
@@ -72,8 +87,8 @@ func (l *Link) SendBurst(network *Network, localClients map[string]interface{},
 		_ = chanData // Avoid unused variable error
 	}
 	
-	// Send burst completion marker (using PING as end-of-burst marker)
-	eobMsg := BuildPING(network.LocalSID, server.SID)
+	// Send burst completion marker
+	eobMsg := BuildEOB(network.LocalSID)
 	if err := l.WriteMessage(eobMsg); err != nil {
 		return fmt.Errorf("failed to send end-of-burst: %v", err)
 	}
@@ -88,7 +103,12 @@ func (l *Link) HandleBurstMessage(network *Network, msg *Message, burstState *Bu
 		// Parse and add remote user
 		user, err := ParseUID(msg)
 		if err != nil {
-			return fmt.Errorf("invalid UID during burst: %v", err)
+			burstState.UsersSkipped++
+			return fmt.Errorf("%w: invalid UID: %v", ErrMalformedBurstEntry, err)
+		}
+		
+		if l.maxUsers > 0 && burstState.UsersRecv >= l.maxUsers {
+			return fmt.Errorf("%w (%d)", ErrTooManyUsers, l.maxUsers)
 		}
 		
 		// Get source server
@@ -102,17 +122,20 @@ func (l *Link) HandleBurstMessage(network *Network, msg *Message, burstState *Bu
 		
 		// Add to network
 		if err := network.AddUser(user); err != nil {
-			return fmt.Errorf("failed to add user %s: %v", user.Nick, err)
+			burstState.UsersSkipped++
+			return fmt.Errorf("%w: failed to add user %s: %v", ErrMalformedBurstEntry, user.Nick, err)
 		}
 		
 		burstState.UsersRecv++
+		burstState.Users = append(burstState.Users, user)
 		return nil
 		
 	case "SJOIN":
 		// Parse channel
 		channel, ts, modes, members, err := ParseSJOIN(msg)
 		if err != nil {
-			return fmt.Errorf("invalid SJOIN during burst: %v", err)
+			burstState.ChansSkipped++
+			return fmt.Errorf("%w: invalid SJOIN: %v", ErrMalformedBurstEntry, err)
 		}
 		
 		// Create RemoteChannel
@@ -123,8 +146,18 @@ func (l *Link) HandleBurstMessage(network *Network, msg *Message, burstState *Bu
 			Members: members,
 		}
 		
-		// Add/merge channel
-		network.AddChannel(remoteChan)
+		// Add/merge channel, remembering any status cleared by a lower TS
+		cleared := network.AddChannel(remoteChan)
+		if burstState.ChanTS == nil {
+			burstState.ChanTS = make(map[string]int64)
+		}
+		burstState.ChanTS[channel] = ts
+		if len(cleared) > 0 {
+			if burstState.Cleared == nil {
+				burstState.Cleared = make(map[string]map[string]string)
+			}
+			burstState.Cleared[channel] = cleared
+		}
 		
 		// Update user channel membership
 		for uid := range members {
@@ -138,9 +171,35 @@ func (l *Link) HandleBurstMessage(network *Network, msg *Message, burstState *Bu
 		burstState.ChansRecv++
 		return nil
 		
+	case "BMASK":
+		channel, ts, listType, masks, err := ParseBMASK(msg)
+		if err != nil {
+			burstState.MasksSkipped++
+			return fmt.Errorf("%w: invalid BMASK: %v", ErrMalformedBurstEntry, err)
+		}
+		
+		// Only lists from the older (or same) channel survive the merge
+		if _, ok := network.AddChannelMasks(channel, ts, listType, masks); ok {
+			if burstState.Masks == nil {
+				burstState.Masks = make(map[string]map[byte][]string)
+			}
+			if burstState.Masks[channel] == nil {
+				burstState.Masks[channel] = make(map[byte][]string)
+			}
+			burstState.Masks[channel][listType] = append(burstState.Masks[channel][listType], masks...)
+		}
+		return nil
+		
+	case "EOB":
+		if _, err := ParseEOB(msg); err != nil {
+			return fmt.Errorf("invalid EOB: %v", err)
+		}
+		l.finishBurst(burstState)
+		return nil
+		
 	case "PING":
-		// End of burst marker
-		burstState.InProgress = false
+		// Older peers end their burst with a PING instead of EOB
+		l.finishBurst(burstState)
 		
 		// Send PONG response
 		pong := BuildPONG(network.LocalSID, msg.Source)
@@ -155,6 +214,14 @@ func (l *Link) HandleBurstMessage(network *Network, msg *Message, burstState *Bu
 	}
 }
 
+// finishBurst ends the burst and marks the remote server as synced
+func (l *Link) finishBurst(burstState *BurstState) {
+	burstState.InProgress = false
+	if server := l.GetServer(); server != nil {
+		server.SetSynced(true)
+	}
+}
+
 // ReceiveBurst receives burst from remote server
 func (l *Link) ReceiveBurst(network *Network) (*BurstState, error) {
 	burstState := &BurstState{
@@ -170,6 +237,11 @@ func (l *Link) ReceiveBurst(network *Network) (*BurstState, error) {
 		}
 		
 		if err := l.HandleBurstMessage(network, msg, burstState); err != nil {
+			// One bad user or channel shouldn't cost the whole link
+			if errors.Is(err, ErrMalformedBurstEntry) {
+				burstState.Skipped = append(burstState.Skipped, err)
+				continue
+			}
 			return burstState, err
 		}
 	}
@@ -207,6 +279,7 @@ func (l *Link) SendBurstFromClients(network *Network, getClients func() []BurstC
 		msg := BuildUID(
 			network.LocalSID,
 			client.Nick,
+			1,
 			modes,
 			client.User,
 			client.Host,
@@ -235,10 +308,25 @@ func (l *Link) SendBurstFromClients(network *Network, getClients func() []BurstC
 		if err := l.WriteMessage(msg); err != nil {
 			return fmt.Errorf("failed to send SJOIN for %s: %v", channel.Name, err)
 		}
+		
+		// Ban, exception, invite exception and quiet lists follow the channel
+		// they belong to
+		for _, list := range []struct {
+			listType byte
+			masks    []string
+		}{{'b', channel.Bans}, {'e', channel.Excepts}, {'I', channel.Invexes}, {'q', channel.Quiets}} {
+			if len(list.masks) == 0 {
+				continue
+			}
+			bmask := BuildBMASK(network.LocalSID, channel.Name, channel.TS, list.listType, list.masks)
+			if err := l.WriteMessage(bmask); err != nil {
+				return fmt.Errorf("failed to send BMASK for %s: %v", channel.Name, err)
+			}
+		}
 	}
 	
 	// Send end-of-burst marker
-	eobMsg := BuildPING(network.LocalSID, server.SID)
+	eobMsg := BuildEOB(network.LocalSID)
 	if err := l.WriteMessage(eobMsg); err != nil {
 		return fmt.Errorf("failed to send end-of-burst: %v", err)
 	}
@@ -264,4 +352,8 @@ type BurstChannel struct {
 	TS      int64
 	Modes   string
 	Members map[string]string // UID -> modes (@, +, etc)
+	Bans    []string          // Ban masks (+b)
+	Excepts []string          // Ban exception masks (+e)
+	Invexes []string          // Invite exception masks (+I)
+	Quiets  []string          // Quiet masks (+q)
 }
@@ -0,0 +1,195 @@
+package linking
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBurstRejectsTooManyUsers(t *testing.T) {
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	network := NewNetwork("0AA", "hub.test")
+	network.AddServer(&Server{SID: "1BB", Name: "leaf.test"})
+
+	link := NewLink(local)
+	link.SetMaxUsers(2)
+	state := &BurstState{InProgress: true}
+
+	ts := time.Now().Unix()
+	uids := []string{"1BBAAAAAA", "1BBAAAAAB", "1BBAAAAAC"}
+	for i, uid := range uids {
+		msg := BuildUID("1BB", "user"+uid[6:], 1, "+i", "u", "leaf", "0", uid, "User", ts)
+		err := link.HandleBurstMessage(network, msg, state)
+		if i < 2 && err != nil {
+			t.Fatalf("UID %d rejected under the cap: %v", i+1, err)
+		}
+		if i == 2 && !errors.Is(err, ErrTooManyUsers) {
+			t.Fatalf("UID over the cap: error = %v, want ErrTooManyUsers", err)
+		}
+	}
+
+	if _, ok := network.GetUserByUID("1BBAAAAAC"); ok {
+		t.Error("user beyond the cap was added to the network")
+	}
+}
+
+func TestReceiveBurstCompletesOnEOB(t *testing.T) {
+	tests := []struct {
+		name   string
+		marker string
+	}{
+		{"EOB", ":1BB EOB\r\n"},
+		{"legacy PING", ":1BB PING 0AA\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local, remote := net.Pipe()
+			defer local.Close()
+			defer remote.Close()
+
+			network := NewNetwork("0AA", "hub.test")
+			leaf := &Server{SID: "1BB", Name: "leaf.test"}
+			network.AddServer(leaf)
+
+			link := NewLink(local)
+			link.server = leaf
+
+			go func() {
+				uid := BuildUID("1BB", "alice", 1, "+i", "a", "leaf", "0", "1BBAAAAAA", "Alice", 1000)
+				remote.Write([]byte(uid.String() + "\r\n" + tt.marker))
+				// Drain the PONG a legacy marker triggers
+				buf := make([]byte, 512)
+				remote.Read(buf)
+			}()
+
+			state, err := link.ReceiveBurst(network)
+			if err != nil {
+				t.Fatalf("ReceiveBurst failed: %v", err)
+			}
+			if state.InProgress || state.UsersRecv != 1 {
+				t.Errorf("burst state = %+v, want finished with 1 user", state)
+			}
+			if !leaf.IsSynced() {
+				t.Error("server not marked synced after end of burst")
+			}
+		})
+	}
+}
+
+func TestReceiveBurstSkipsMalformedEntries(t *testing.T) {
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	network := NewNetwork("0AA", "hub.test")
+	leaf := &Server{SID: "1BB", Name: "leaf.test"}
+	network.AddServer(leaf)
+
+	link := NewLink(local)
+	link.server = leaf
+
+	go func() {
+		alice := BuildUID("1BB", "alice", 1, "+i", "a", "leaf", "0", "1BBAAAAAA", "Alice", 1000)
+		bob := BuildUID("1BB", "bob", 1, "+i", "b", "leaf", "0", "1BBAAAAAB", "Bob", 1000)
+		remote.Write([]byte(alice.String() + "\r\n" +
+			":1BB UID broken 1 1000\r\n" +
+			bob.String() + "\r\n" +
+			":1BB SJOIN notanumber #test +nt :@1BBAAAAAA\r\n" +
+			":1BB BMASK notanumber #test b :*!*@spam\r\n" +
+			":1BB EOB\r\n"))
+	}()
+
+	state, err := link.ReceiveBurst(network)
+	if err != nil {
+		t.Fatalf("ReceiveBurst failed: %v", err)
+	}
+	if state.UsersRecv != 2 || state.UsersSkipped != 1 || state.ChansSkipped != 1 || state.MasksSkipped != 1 {
+		t.Errorf("burst state = %+v, want 2 users received, 1 user, 1 channel and 1 mask list skipped", state)
+	}
+	if len(state.Skipped) != 3 {
+		t.Errorf("got %d skip reasons, want 3: %v", len(state.Skipped), state.Skipped)
+	}
+	for _, uid := range []string{"1BBAAAAAA", "1BBAAAAAB"} {
+		if _, ok := network.GetUserByUID(uid); !ok {
+			t.Errorf("valid user %s was not added", uid)
+		}
+	}
+	if !leaf.IsSynced() {
+		t.Error("server not marked synced after end of burst")
+	}
+}
+
+func TestBurstRelaysChannelLists(t *testing.T) {
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	// Sending side: hub.test bursts #test with a ban and a quiet
+	sender := NewLink(local)
+	sender.state = LinkStateRegistered
+	sender.server = &Server{SID: "1BB", Name: "leaf.test"}
+	hubNet := NewNetwork("0AA", "hub.test")
+
+	// Receiving side: leaf.test already knows hub.test
+	leafNet := NewNetwork("1BB", "leaf.test")
+	hub := &Server{SID: "0AA", Name: "hub.test"}
+	leafNet.AddServer(hub)
+	receiver := NewLink(remote)
+	receiver.server = hub
+
+	sendErr := make(chan error, 1)
+	go func() {
+		sendErr <- sender.SendBurstFromClients(hubNet,
+			func() []BurstClient { return nil },
+			func() []BurstChannel {
+				return []BurstChannel{{
+					Name:    "#test",
+					TS:      1000,
+					Modes:   "+nt",
+					Members: map[string]string{"0AAAAAAAA": "@"},
+					Bans:    []string{"*!*@evil.example", "spammer!*@*"},
+					Quiets:  []string{"loud!*@*"},
+				}}
+			})
+	}()
+
+	state, err := receiver.ReceiveBurst(leafNet)
+	if err != nil {
+		t.Fatalf("ReceiveBurst failed: %v", err)
+	}
+	if err := <-sendErr; err != nil {
+		t.Fatalf("SendBurstFromClients failed: %v", err)
+	}
+
+	ch, ok := leafNet.GetChannel("#test")
+	if !ok {
+		t.Fatal("channel not created by the burst")
+	}
+	if len(ch.Bans) != 2 || ch.Bans[0] != "*!*@evil.example" || ch.Bans[1] != "spammer!*@*" {
+		t.Errorf("bans = %v, want both masks", ch.Bans)
+	}
+	if len(ch.Quiets) != 1 || ch.Quiets[0] != "loud!*@*" {
+		t.Errorf("quiets = %v, want [loud!*@*]", ch.Quiets)
+	}
+	if got := state.Masks["#test"]['b']; len(got) != 2 {
+		t.Errorf("burst state bans = %v, want 2 masks", got)
+	}
+}
+
+func TestBMASKFromNewerChannelIgnored(t *testing.T) {
+	network := NewNetwork("0AA", "hub.test")
+	network.AddChannel(&RemoteChannel{Name: "#test", TS: 1000, Members: map[string]string{}})
+
+	if _, ok := network.AddChannelMasks("#test", 2000, 'b', []string{"*!*@late.example"}); ok {
+		t.Error("masks from a newer channel were accepted")
+	}
+	added, ok := network.AddChannelMasks("#test", 1000, 'b', []string{"*!*@evil.example", "*!*@evil.example"})
+	if !ok || len(added) != 1 {
+		t.Errorf("AddChannelMasks = %v, %v; want one new mask", added, ok)
+	}
+}
@@ -2,6 +2,7 @@ package linking
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"net"
 	"sync"
@@ -19,6 +20,15 @@ const (
 	LinkStateRegistered                   // Fully registered and ready
 )
 
+// DefaultMaxLineLength is the default upper bound on a single server protocol line
+const DefaultMaxLineLength = 16 * 1024
+
+// ErrLineTooLong is returned by ReadMessage when a peer sends a line exceeding the limit
+var ErrLineTooLong = errors.New("protocol line exceeds maximum length")
+
+// ErrTooManyUsers is returned during burst when a peer introduces more users than allowed
+var ErrTooManyUsers = errors.New("burst exceeds maximum users per link")
+
 // Link represents an active server-to-server connection
 type Link struct {
 	conn           net.Conn
@@ -35,6 +45,10 @@ type Link struct {
 	remoteName     string
 	remotePass     string
 	capabilities   []string
+	maxLineLen     int
+	maxUsers       int                  // Maximum users accepted in burst (0 = unlimited)
+	pingSeq        uint64               // Counter for keepalive PING tokens
+	pingsSent      map[string]time.Time // Outstanding PING token -> send time
 	closeOnce      sync.Once
 	closed         chan struct{}
 }
@@ -45,14 +59,32 @@ func NewLink(conn net.Conn) *Link {
 		conn:   conn,
 		reader: bufio.NewReader(conn),
 		writer: bufio.NewWriter(conn),
-		state:  LinkStateConnected,
-		closed: make(chan struct{}),
+		state:      LinkStateConnected,
+		maxLineLen: DefaultMaxLineLength,
+		closed:     make(chan struct{}),
+	}
+}
+
+// SetMaxLineLength sets the maximum accepted protocol line length (0 keeps the default)
+func (l *Link) SetMaxLineLength(n int) {
+	if n <= 0 {
+		n = DefaultMaxLineLength
 	}
+	l.maxLineLen = n
+}
+
+// SetMaxUsers sets the maximum number of users the peer may introduce
+// during burst (0 = unlimited)
+func (l *Link) SetMaxUsers(n int) {
+	if n < 0 {
+		n = 0
+	}
+	l.maxUsers = n
 }
 
 // ReadMessage reads a protocol message from the link
 func (l *Link) ReadMessage() (*Message, error) {
-	line, err := l.reader.ReadString('\n')
+	line, err := l.readLine()
 	if err != nil {
 		return nil, err
 	}
@@ -68,6 +100,26 @@ func (l *Link) ReadMessage() (*Message, error) {
 	return ParseMessage(line)
 }
 
+// readLine reads a single newline-terminated line, reassembling it across
+// buffer boundaries but refusing to grow beyond maxLineLen bytes
+func (l *Link) readLine() (string, error) {
+	var buf []byte
+	for {
+		chunk, err := l.reader.ReadSlice('\n')
+		if len(buf)+len(chunk) > l.maxLineLen {
+			return "", ErrLineTooLong
+		}
+		buf = append(buf, chunk...)
+		
+		if err == nil {
+			return string(buf), nil
+		}
+		if err != bufio.ErrBufferFull {
+			return "", err
+		}
+	}
+}
+
 // WriteMessage sends a protocol message to the link
 func (l *Link) WriteMessage(msg *Message) error {
 	l.mu.Lock()
@@ -102,6 +154,11 @@ func (l *Link) IsClosed() bool {
 	}
 }
 
+// Done returns a channel that is closed once the link has been closed
+func (l *Link) Done() <-chan struct{} {
+	return l.closed
+}
+
 // RemoteAddr returns the remote address
 func (l *Link) RemoteAddr() string {
 	return l.conn.RemoteAddr().String()
@@ -234,6 +291,7 @@ func (l *Link) HandshakeServer(network *Network, password string) error {
 				fmt.Printf("WARNING: Server %s time delta: %d seconds\n", l.remoteName, timeDelta)
 			}
 			
+			l.server.Version = SVINFOVersion(msg)
 			l.receivedSVINFO = true
 			l.state = LinkStateRegistered
 			
@@ -277,7 +335,7 @@ func (l *Link) HandshakeClient(network *Network, password, remoteSID, remoteName
 	}
 	
 	// Send SVINFO
-	svinfoMsg := BuildSVINFO()
+	svinfoMsg := BuildSVINFO(network.LocalVersion)
 	if err := l.WriteMessage(svinfoMsg); err != nil {
 		return fmt.Errorf("failed to send SVINFO: %v", err)
 	}
@@ -368,6 +426,7 @@ func (l *Link) HandshakeClient(network *Network, password, remoteSID, remoteName
 				return fmt.Errorf("incompatible TS versions: %d/%d", tsVersion, minVersion)
 			}
 			
+			l.server.Version = SVINFOVersion(msg)
 			l.receivedSVINFO = true
 			l.state = LinkStateRegistered
 			
@@ -408,7 +467,7 @@ func (l *Link) SendHandshake(network *Network, password string) error {
 	}
 	
 	// Send SVINFO
-	svinfoMsg := BuildSVINFO()
+	svinfoMsg := BuildSVINFO(network.LocalVersion)
 	if err := l.WriteMessage(svinfoMsg); err != nil {
 		return err
 	}
@@ -0,0 +1,65 @@
+package linking
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestReadMessageRejectsOversizedLine(t *testing.T) {
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	link := NewLink(local)
+	link.SetMaxLineLength(1024)
+
+	go func() {
+		// Far larger than the limit; the reader must bail out without buffering it all
+		remote.Write([]byte(":0AA PRIVMSG #test :" + strings.Repeat("A", 64*1024) + "\r\n"))
+	}()
+
+	_, err := link.ReadMessage()
+	if !errors.Is(err, ErrLineTooLong) {
+		t.Fatalf("ReadMessage error = %v, want ErrLineTooLong", err)
+	}
+}
+
+func TestReadMessageReassemblesPartialReads(t *testing.T) {
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	link := NewLink(local)
+
+	// Longer than the bufio buffer so the line spans several reads
+	text := strings.Repeat("B", 6000)
+	line := ":0AA PRIVMSG #test :" + text + "\r\n:0AA PING 1BB\r\n"
+
+	go func() {
+		for i := 0; i < len(line); i += 700 {
+			end := i + 700
+			if end > len(line) {
+				end = len(line)
+			}
+			remote.Write([]byte(line[i:end]))
+		}
+	}()
+
+	msg, err := link.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage failed: %v", err)
+	}
+	if msg.Command != "PRIVMSG" || len(msg.Params) != 2 || msg.Params[1] != text {
+		t.Errorf("reassembled message mismatch: command=%s params=%d", msg.Command, len(msg.Params))
+	}
+
+	msg, err = link.ReadMessage()
+	if err != nil {
+		t.Fatalf("second ReadMessage failed: %v", err)
+	}
+	if msg.Command != "PING" {
+		t.Errorf("second command = %s, want PING", msg.Command)
+	}
+}
@@ -0,0 +1,87 @@
+package linking
+
+import (
+	"strconv"
+	"time"
+)
+
+// latencySmoothing is the weight given to the newest sample in the average RTT
+const latencySmoothing = 0.25
+
+// pingTokenExpiry is how long an unanswered PING token is remembered
+const pingTokenExpiry = 5 * time.Minute
+
+// SendPing sends a keepalive PING carrying a unique token and records when it was sent
+func (l *Link) SendPing(source string) error {
+	l.mu.Lock()
+	l.pingSeq++
+	token := source + "." + strconv.FormatUint(l.pingSeq, 36)
+	if l.pingsSent == nil {
+		l.pingsSent = make(map[string]time.Time)
+	}
+	sentAt := time.Now()
+	for t, at := range l.pingsSent {
+		if sentAt.Sub(at) > pingTokenExpiry {
+			delete(l.pingsSent, t)
+		}
+	}
+	l.pingsSent[token] = sentAt
+	server := l.server
+	l.mu.Unlock()
+	
+	if server != nil {
+		server.mu.Lock()
+		server.LastPing = sentAt
+		server.mu.Unlock()
+	}
+	
+	return l.WriteMessage(BuildPING(source, token))
+}
+
+// HandlePong matches a PONG against an outstanding PING token and records the
+// round-trip time. It returns false if the PONG does not answer one of our PINGs.
+func (l *Link) HandlePong(msg *Message) (time.Duration, bool) {
+	if len(msg.Params) == 0 {
+		return 0, false
+	}
+	token := msg.Params[len(msg.Params)-1]
+	
+	l.mu.Lock()
+	sentAt, ok := l.pingsSent[token]
+	if ok {
+		delete(l.pingsSent, token)
+	}
+	server := l.server
+	l.mu.Unlock()
+	
+	if !ok {
+		return 0, false
+	}
+	
+	rtt := time.Since(sentAt)
+	if server != nil {
+		server.RecordLatency(rtt)
+	}
+	return rtt, true
+}
+
+// RecordLatency stores a round-trip sample and updates the smoothed average
+func (s *Server) RecordLatency(rtt time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	
+	s.LastPong = time.Now()
+	s.Latency = rtt
+	if s.AvgLatency == 0 {
+		s.AvgLatency = rtt
+	} else {
+		s.AvgLatency = time.Duration(float64(s.AvgLatency)*(1-latencySmoothing) + float64(rtt)*latencySmoothing)
+	}
+}
+
+// GetLatency returns the last measured and average round-trip times
+func (s *Server) GetLatency() (last, avg time.Duration) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Latency, s.AvgLatency
+}
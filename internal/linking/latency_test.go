@@ -0,0 +1,49 @@
+package linking
+
+import (
+	"net"
+	"testing"
+)
+
+func TestPingPongRecordsLatency(t *testing.T) {
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	link := NewLink(local)
+	link.server = &Server{SID: "1BB", Name: "hub.example.com"}
+	peer := NewLink(remote)
+
+	go link.SendPing("0AA")
+
+	ping, err := peer.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage failed: %v", err)
+	}
+	if ping.Command != "PING" || len(ping.Params) == 0 {
+		t.Fatalf("expected PING with token, got %s %v", ping.Command, ping.Params)
+	}
+
+	// A PONG for an unknown token must be ignored
+	if _, ok := link.HandlePong(BuildPONG("1BB", "bogus")); ok {
+		t.Error("HandlePong accepted an unknown token")
+	}
+
+	rtt, ok := link.HandlePong(BuildPONG("1BB", ping.Params[0]))
+	if !ok {
+		t.Fatal("HandlePong did not match the outstanding PING")
+	}
+	if rtt < 0 {
+		t.Errorf("rtt = %v, want >= 0", rtt)
+	}
+
+	last, avg := link.server.GetLatency()
+	if last != rtt || avg != rtt {
+		t.Errorf("GetLatency = (%v, %v), want (%v, %v)", last, avg, rtt, rtt)
+	}
+
+	// The token is single use
+	if _, ok := link.HandlePong(BuildPONG("1BB", ping.Params[0])); ok {
+		t.Error("HandlePong accepted a token twice")
+	}
+}
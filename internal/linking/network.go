@@ -3,6 +3,7 @@ package linking
 import (
 	"fmt"
 	"net"
+	"strings"
 	"sync"
 	"time"
 )
@@ -21,8 +22,11 @@ type Server struct {
 	Channels    map[string]*RemoteChannel // Channel name -> Channel
 	LastPing    time.Time
 	LastPong    time.Time
-	Version     string
+	Latency     time.Duration  // Last measured PING/PONG round-trip time
+	AvgLatency  time.Duration  // Smoothed average round-trip time
+	Version     string          // Software version from SVINFO ("" if not sent)
 	Capabilities []string       // Server capabilities (ENCAP, KLN, etc)
+	synced      bool            // Burst received in full
 	mu          sync.RWMutex
 }
 
@@ -39,6 +43,7 @@ type RemoteUser struct {
 	Away       string    // Away message (empty if not away)
 	Channels   map[string]bool // Channels user is in
 	Timestamp  int64     // Nick timestamp
+	Hopcount   int       // Hops from the local server
 	mu         sync.RWMutex
 }
 
@@ -54,6 +59,9 @@ type RemoteChannel struct {
 	TopicBy    string             // Who set the topic (nick!user@host)
 	Members    map[string]string  // UID -> modes (@, +, etc)
 	Bans       []string           // Ban masks
+	Excepts    []string           // Ban exception masks (+e)
+	Invexes    []string           // Invite exception masks (+I)
+	Quiets     []string           // Quiet masks (+q)
 	mu         sync.RWMutex
 }
 
@@ -61,6 +69,7 @@ type RemoteChannel struct {
 type Network struct {
 	LocalSID   string                    // Our server's SID
 	LocalName  string                    // Our server's name
+	LocalVersion string                  // Our software version, sent in SVINFO
 	Servers    map[string]*Server        // SID -> Server
 	Users      map[string]*RemoteUser    // UID -> User
 	Channels   map[string]*RemoteChannel // Name -> Channel
@@ -119,14 +128,160 @@ func (n *Network) AddServer(srv *Server) error {
 	}
 	
 	n.Servers[srv.SID] = srv
+	
+	// Servers introduced behind another link hang off their uplink
+	if srv.Uplink != nil {
+		srv.Uplink.mu.Lock()
+		srv.Uplink.Downlinks = append(srv.Uplink.Downlinks, srv)
+		srv.Uplink.mu.Unlock()
+	}
 	return nil
 }
 
+// SetSynced records that the server has finished its burst
+func (s *Server) SetSynced(synced bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.synced = synced
+}
+
+// IsSynced reports whether the server has finished its burst
+func (s *Server) IsSynced() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.synced
+}
+
+// HasCapability reports whether the server sent capab in its CAPAB
+func (s *Server) HasCapability(capab string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, c := range s.Capabilities {
+		if c == capab {
+			return true
+		}
+	}
+	return false
+}
+
+// GetDownlinks returns the servers linked behind this one
+func (s *Server) GetDownlinks() []*Server {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	downlinks := make([]*Server, len(s.Downlinks))
+	copy(downlinks, s.Downlinks)
+	return downlinks
+}
+
+// HasMode reports whether the remote user has a user mode set
+func (u *RemoteUser) HasMode(mode rune) bool {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return strings.ContainsRune(strings.TrimPrefix(u.Modes, "+"), mode)
+}
+
+// SetAway sets the remote user's away message ("" when back)
+func (u *RemoteUser) SetAway(message string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.Away = message
+}
+
+// GetAway returns the remote user's away message, "" if not away
+func (u *RemoteUser) GetAway() string {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.Away
+}
+
+// SetMode sets or clears a user mode on the remote user
+func (u *RemoteUser) SetMode(mode rune, enabled bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	
+	modes := strings.ReplaceAll(strings.TrimPrefix(u.Modes, "+"), string(mode), "")
+	if enabled {
+		modes += string(mode)
+	}
+	if modes == "" {
+		u.Modes = ""
+		return
+	}
+	u.Modes = "+" + modes
+}
+
+// statusPrefixes maps channel status modes to their member prefixes
+var statusPrefixes = map[rune]string{'q': "~", 'a': "&", 'o': "@", 'h': "%", 'v': "+"}
+
+// GetMemberStatus returns the status prefixes of a channel member
+func (c *RemoteChannel) GetMemberStatus(uid string) (prefixes string, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	prefixes, ok = c.Members[uid]
+	return prefixes, ok
+}
+
+// GetMemberUIDs returns the UIDs of the channel's members
+func (c *RemoteChannel) GetMemberUIDs() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	
+	uids := make([]string, 0, len(c.Members))
+	for uid := range c.Members {
+		uids = append(uids, uid)
+	}
+	return uids
+}
+
+// IsMemberOp reports whether a member holds halfop or higher status
+func (c *RemoteChannel) IsMemberOp(uid string) bool {
+	prefixes, ok := c.GetMemberStatus(uid)
+	return ok && strings.ContainsAny(prefixes, "~&@%")
+}
+
+// SetMemberStatus grants or removes a status mode (q, a, o, h, v) for an
+// existing member
+func (c *RemoteChannel) SetMemberStatus(uid string, mode rune, adding bool) {
+	prefix, ok := statusPrefixes[mode]
+	if !ok {
+		return
+	}
+	
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
+	prefixes, member := c.Members[uid]
+	if !member {
+		return
+	}
+	prefixes = strings.ReplaceAll(prefixes, prefix, "")
+	if adding {
+		prefixes += prefix
+	}
+	c.Members[uid] = prefixes
+}
+
 // RemoveServer removes a server and all its users from the network
 func (n *Network) RemoveServer(sid string) {
 	n.mu.Lock()
 	defer n.mu.Unlock()
 	
+	srv, exists := n.Servers[sid]
+	if exists && srv.Uplink != nil {
+		srv.Uplink.mu.Lock()
+		for i, downlink := range srv.Uplink.Downlinks {
+			if downlink == srv {
+				srv.Uplink.Downlinks = append(srv.Uplink.Downlinks[:i], srv.Uplink.Downlinks[i+1:]...)
+				break
+			}
+		}
+		srv.Uplink.mu.Unlock()
+	}
+	n.removeServerLocked(sid)
+}
+
+// removeServerLocked removes a server, its users and its downlinks; n.mu must be held
+func (n *Network) removeServerLocked(sid string) {
 	srv, exists := n.Servers[sid]
 	if !exists {
 		return
@@ -152,8 +307,8 @@ func (n *Network) RemoveServer(sid string) {
 	}
 	
 	// Remove all downlink servers recursively
-	for _, downlink := range srv.Downlinks {
-		n.RemoveServer(downlink.SID)
+	for _, downlink := range srv.GetDownlinks() {
+		n.removeServerLocked(downlink.SID)
 	}
 	
 	delete(n.Servers, sid)
@@ -312,10 +467,13 @@ func (n *Network) GetUsersBySID(sid string) []*RemoteUser {
 }
 
 // AddChannel adds or updates a channel in the network
-func (n *Network) AddChannel(ch *RemoteChannel) {
+// It returns the members whose status prefixes were cleared because the
+// incoming channel had a lower TS (UID -> prefixes removed).
+func (n *Network) AddChannel(ch *RemoteChannel) map[string]string {
 	n.mu.Lock()
 	defer n.mu.Unlock()
 	
+	var cleared map[string]string
 	existing, exists := n.Channels[ch.Name]
 	if exists {
 		// Channel already exists - need to merge based on TS
@@ -329,7 +487,13 @@ func (n *Network) AddChannel(ch *RemoteChannel) {
 			existing.Key = ch.Key
 			existing.Limit = ch.Limit
 			// Clear ops/voices - new state is authoritative
-			for uid := range existing.Members {
+			for uid, modes := range existing.Members {
+				if modes != "" {
+					if cleared == nil {
+						cleared = make(map[string]string)
+					}
+					cleared[uid] = modes
+				}
 				existing.Members[uid] = ""
 			}
 		} else if ch.TS == existing.TS {
@@ -343,6 +507,81 @@ func (n *Network) AddChannel(ch *RemoteChannel) {
 		// New channel
 		n.Channels[ch.Name] = ch
 	}
+	
+	return cleared
+}
+
+// AddChannelMasks merges list masks (type 'b', 'e', 'I' or 'q') into a channel. Masks
+// from a newer channel (higher TS) are refused, as that side lost the merge;
+// it returns the masks that were new.
+func (n *Network) AddChannelMasks(name string, ts int64, listType byte, masks []string) ([]string, bool) {
+	n.mu.RLock()
+	ch, exists := n.Channels[name]
+	n.mu.RUnlock()
+	
+	if !exists {
+		return nil, false
+	}
+	
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	
+	if ts > ch.TS {
+		return nil, false
+	}
+	
+	var list *[]string
+	switch listType {
+	case 'b':
+		list = &ch.Bans
+	case 'e':
+		list = &ch.Excepts
+	case 'I':
+		list = &ch.Invexes
+	case 'q':
+		list = &ch.Quiets
+	default:
+		return nil, false
+	}
+	
+	var added []string
+	for _, mask := range masks {
+		known := false
+		for _, existing := range *list {
+			if strings.EqualFold(existing, mask) {
+				known = true
+				break
+			}
+		}
+		if !known {
+			*list = append(*list, mask)
+			added = append(added, mask)
+		}
+	}
+	return added, true
+}
+
+// SetChannelTopic updates a channel's topic unless the stored topic is newer.
+// It returns false if the update was rejected as older.
+func (n *Network) SetChannelTopic(name, topic, setter string, ts int64) bool {
+	n.mu.RLock()
+	ch, exists := n.Channels[name]
+	n.mu.RUnlock()
+	
+	if !exists {
+		return true
+	}
+	
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	
+	if ts < ch.TopicTime {
+		return false
+	}
+	ch.Topic = topic
+	ch.TopicBy = setter
+	ch.TopicTime = ts
+	return true
 }
 
 // GetChannel finds a channel by name
@@ -368,6 +607,20 @@ func (n *Network) GetUserCount() int {
 	return len(n.Users)
 }
 
+// GetOperCount returns the number of remote users with +o
+func (n *Network) GetOperCount() int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	
+	count := 0
+	for _, user := range n.Users {
+		if user.HasMode('o') {
+			count++
+		}
+	}
+	return count
+}
+
 // GetChannelCount returns the number of channels
 func (n *Network) GetChannelCount() int {
 	n.mu.RLock()
@@ -429,3 +682,22 @@ func (n *Network) GetServerSIDs() []string {
 	}
 	return sids
 }
+
+// GetUplink returns the server srv is linked behind, or nil if it is linked
+// to us directly
+func (n *Network) GetUplink(srv *Server) *Server {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return srv.Uplink
+}
+
+// GetServers returns a snapshot of all known servers
+func (n *Network) GetServers() []*Server {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	servers := make([]*Server, 0, len(n.Servers))
+	for _, srv := range n.Servers {
+		servers = append(servers, srv)
+	}
+	return servers
+}
@@ -399,7 +399,10 @@ func TestNetworkChannelTSConflict(t *testing.T) {
 		Modes:   "s",
 		Members: map[string]string{"user2": "+"},
 	}
-	net.AddChannel(ch2)
+	cleared := net.AddChannel(ch2)
+	if cleared["user1"] != "@" {
+		t.Errorf("cleared = %v, want user1 -> @", cleared)
+	}
 	
 	// Check that older TS won
 	retrieved, _ := net.GetChannel("#test")
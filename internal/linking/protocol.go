@@ -27,6 +27,7 @@ var DefaultCapabilities = []string{
 	"EUID",    // Extended UID
 	"EOPMOD",  // Op moderation
 	"MLOCK",   // Mode lock
+	"TOPICTS", // TOPIC carries the setter and topic timestamp
 }
 
 // Message represents a server-to-server protocol message
@@ -94,8 +95,8 @@ func (m *Message) String() string {
 	
 	for i, param := range m.Params {
 		sb.WriteString(" ")
-		// Last param with space needs : prefix, or always for UID command
-		if i == len(m.Params)-1 && (strings.Contains(param, " ") || m.Command == "UID") {
+		// Last param with space needs : prefix, or always for UID/TOPIC (text may be empty)
+		if i == len(m.Params)-1 && (strings.Contains(param, " ") || m.Command == "UID" || m.Command == "TOPIC") {
 			sb.WriteString(":")
 		}
 		sb.WriteString(param)
@@ -187,16 +188,55 @@ func ParseSERVER(msg *Message) (name string, hopcount int, description string, e
 	return name, hopcount, description, nil
 }
 
+// BuildServerIntro creates a SERVER message introducing a server that sits
+// behind an existing link
+// Format: :<uplink SID> SERVER <name> <hopcount> <SID> :<description>
+func BuildServerIntro(source, name string, hopcount int, sid, description string) *Message {
+	return &Message{
+		Source:  source,
+		Command: "SERVER",
+		Params:  []string{name, strconv.Itoa(hopcount), sid, description},
+	}
+}
+
+// ParseServerIntro parses a SERVER introduction received over an established link
+func ParseServerIntro(msg *Message) (name string, hopcount int, sid, description string, err error) {
+	if len(msg.Params) < 4 {
+		return "", 0, "", "", fmt.Errorf("SERVER introduction requires 4 parameters")
+	}
+	
+	name = msg.Params[0]
+	
+	hopcount, err = strconv.Atoi(msg.Params[1])
+	if err != nil || hopcount < 1 {
+		return "", 0, "", "", fmt.Errorf("invalid hopcount: %s", msg.Params[1])
+	}
+	
+	sid = msg.Params[2]
+	if !ValidateSID(sid) {
+		return "", 0, "", "", fmt.Errorf("invalid SID: %s", sid)
+	}
+	
+	description = msg.Params[3]
+	
+	return name, hopcount, sid, description, nil
+}
+
 // BuildSVINFO creates a SVINFO message
-// Format: SVINFO <TS_version> <min_TS_version> <current_time>
-func BuildSVINFO() *Message {
+// Format: SVINFO <TS_version> <min_TS_version> <current_time> [:<software_version>]
+// The software version is omitted when empty.
+func BuildSVINFO(version string) *Message {
+	params := []string{
+		strconv.Itoa(TS6Version),
+		strconv.Itoa(MinTSVersion),
+		strconv.FormatInt(time.Now().Unix(), 10),
+	}
+	if version != "" {
+		params = append(params, version)
+	}
 	return &Message{
 		Command: "SVINFO",
-		Params: []string{
-			strconv.Itoa(TS6Version),
-			strconv.Itoa(MinTSVersion),
-			strconv.FormatInt(time.Now().Unix(), 10),
-		},
+		Params:  params,
 	}
 }
 
@@ -224,15 +264,24 @@ func ParseSVINFO(msg *Message) (tsVersion, minVersion int, serverTime int64, err
 	return tsVersion, minVersion, serverTime, nil
 }
 
+// SVINFOVersion returns the peer's software version from a SVINFO message,
+// or "" if the peer didn't send one
+func SVINFOVersion(msg *Message) string {
+	if len(msg.Params) < 4 {
+		return ""
+	}
+	return msg.Params[3]
+}
+
 // BuildUID creates a UID message to introduce a user
 // Format: :<SID> UID <nick> <hopcount> <ts> <modes> <user> <host> <ip> <uid> :<realname>
-func BuildUID(sid, nick, modes, user, host, ip, uid, realname string, timestamp int64) *Message {
+func BuildUID(sid, nick string, hopcount int, modes, user, host, ip, uid, realname string, timestamp int64) *Message {
 	return &Message{
 		Source:  sid,
 		Command: "UID",
 		Params: []string{
 			nick,
-			"1",                                  // hopcount
+			strconv.Itoa(hopcount),               // hopcount
 			strconv.FormatInt(timestamp, 10),     // timestamp
 			modes,
 			user,
@@ -250,6 +299,11 @@ func ParseUID(msg *Message) (*RemoteUser, error) {
 		return nil, fmt.Errorf("UID requires 9 parameters")
 	}
 	
+	hopcount, err := strconv.Atoi(msg.Params[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid hopcount: %s", msg.Params[1])
+	}
+	
 	timestamp, err := strconv.ParseInt(msg.Params[2], 10, 64)
 	if err != nil {
 		return nil, fmt.Errorf("invalid timestamp: %s", msg.Params[2])
@@ -268,6 +322,7 @@ func ParseUID(msg *Message) (*RemoteUser, error) {
 		IP:        msg.Params[6],
 		Modes:     msg.Params[3],
 		RealName:  msg.Params[8],
+		Hopcount:  hopcount,
 		Timestamp: timestamp,
 		Channels:  make(map[string]bool),
 	}
@@ -333,6 +388,103 @@ func ParseSJOIN(msg *Message) (channel string, ts int64, modes string, members m
 	return channel, ts, modes, members, nil
 }
 
+// BuildBMASK creates a BMASK message carrying a channel list (bans, ban
+// exceptions, invite exceptions, quiets)
+// Format: :<SID> BMASK <ts> <channel> <type> :<mask1> <mask2> ...
+func BuildBMASK(sid, channel string, ts int64, listType byte, masks []string) *Message {
+	return &Message{
+		Source:  sid,
+		Command: "BMASK",
+		Params: []string{
+			strconv.FormatInt(ts, 10),
+			channel,
+			string(listType),
+			strings.Join(masks, " "),
+		},
+	}
+}
+
+// ParseBMASK parses a BMASK message
+func ParseBMASK(msg *Message) (channel string, ts int64, listType byte, masks []string, err error) {
+	if len(msg.Params) < 4 {
+		return "", 0, 0, nil, fmt.Errorf("BMASK requires 4 parameters")
+	}
+	
+	ts, err = strconv.ParseInt(msg.Params[0], 10, 64)
+	if err != nil {
+		return "", 0, 0, nil, fmt.Errorf("invalid timestamp: %s", msg.Params[0])
+	}
+	
+	if len(msg.Params[2]) != 1 {
+		return "", 0, 0, nil, fmt.Errorf("invalid list type: %s", msg.Params[2])
+	}
+	
+	return msg.Params[1], ts, msg.Params[2][0], strings.Fields(msg.Params[3]), nil
+}
+
+// BuildTOPIC creates a TOPIC message carrying the setter and topic timestamp
+// Format: :<UID> TOPIC <channel> <setter> <topicTS> :<topic>
+func BuildTOPIC(source, channel, setter string, ts int64, topic string) *Message {
+	return &Message{
+		Source:  source,
+		Command: "TOPIC",
+		Params:  []string{channel, setter, strconv.FormatInt(ts, 10), topic},
+	}
+}
+
+// BuildLegacyTOPIC creates a TOPIC message for servers without TOPICTS
+// Format: :<UID> TOPIC <channel> :<topic>
+func BuildLegacyTOPIC(source, channel, topic string) *Message {
+	return &Message{
+		Source:  source,
+		Command: "TOPIC",
+		Params:  []string{channel, topic},
+	}
+}
+
+// ParseTOPIC parses a TOPIC message in either format. The setter is empty
+// and ts zero for a TOPIC from a server without TOPICTS.
+func ParseTOPIC(msg *Message) (channel, setter string, ts int64, topic string, err error) {
+	if len(msg.Params) < 1 {
+		return "", "", 0, "", fmt.Errorf("TOPIC requires a channel")
+	}
+	if len(msg.Params) < 3 {
+		if len(msg.Params) > 1 {
+			topic = msg.Params[1]
+		}
+		return msg.Params[0], "", 0, topic, nil
+	}
+	
+	ts, err = strconv.ParseInt(msg.Params[2], 10, 64)
+	if err != nil {
+		return "", "", 0, "", fmt.Errorf("invalid topic timestamp: %s", msg.Params[2])
+	}
+	
+	// An empty trailing parameter (topic cleared) may be dropped by the parser
+	if len(msg.Params) > 3 {
+		topic = msg.Params[3]
+	}
+	
+	return msg.Params[0], msg.Params[1], ts, topic, nil
+}
+
+// BuildEOB creates an EOB message marking the end of a burst
+// Format: :<SID> EOB
+func BuildEOB(source string) *Message {
+	return &Message{
+		Source:  source,
+		Command: "EOB",
+	}
+}
+
+// ParseEOB parses an EOB message, returning the SID that finished its burst
+func ParseEOB(msg *Message) (string, error) {
+	if msg.Source == "" {
+		return "", fmt.Errorf("EOB requires a source")
+	}
+	return msg.Source, nil
+}
+
 // BuildPING creates a PING message
 func BuildPING(source, target string) *Message {
 	return &Message{
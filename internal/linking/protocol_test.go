@@ -186,8 +186,26 @@ func TestBuildParseSERVER(t *testing.T) {
 	}
 }
 
+func TestBuildParseServerIntro(t *testing.T) {
+	msg := BuildServerIntro("1BB", "leaf.example.net", 2, "2CC", "Leaf Server")
+	
+	parsed, err := ParseMessage(msg.String())
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+	
+	name, hopcount, sid, desc, err := ParseServerIntro(parsed)
+	if err != nil {
+		t.Fatalf("ParseServerIntro failed: %v", err)
+	}
+	if parsed.Source != "1BB" || name != "leaf.example.net" || hopcount != 2 || sid != "2CC" || desc != "Leaf Server" {
+		t.Errorf("got (%q, %q, %d, %q, %q), want (1BB, leaf.example.net, 2, 2CC, Leaf Server)",
+			parsed.Source, name, hopcount, sid, desc)
+	}
+}
+
 func TestBuildParseSVINFO(t *testing.T) {
-	msg := BuildSVINFO()
+	msg := BuildSVINFO("")
 	
 	gotTSVersion, gotMinVersion, gotTime, err := ParseSVINFO(msg)
 	if err != nil {
@@ -220,7 +238,7 @@ func TestBuildParseUID(t *testing.T) {
 	realname := "Test User"
 	timestamp := time.Now().Unix()
 	
-	msg := BuildUID(sid, nick, user, host, ip, uid, modes, realname, timestamp)
+	msg := BuildUID(sid, nick, 1, modes, user, host, ip, uid, realname, timestamp)
 	
 	gotUser, err := ParseUID(msg)
 	if err != nil {
@@ -258,6 +276,10 @@ func TestBuildParseUID(t *testing.T) {
 	if gotUser.Timestamp != timestamp {
 		t.Errorf("timestamp = %d, want %d", gotUser.Timestamp, timestamp)
 	}
+	
+	if gotUser.Hopcount != 1 {
+		t.Errorf("hopcount = %d, want 1", gotUser.Hopcount)
+	}
 }
 
 func TestBuildParseSJOIN(t *testing.T) {
@@ -327,6 +349,72 @@ func TestBuildParseSQUIT(t *testing.T) {
 	}
 }
 
+func TestBuildParseTOPIC(t *testing.T) {
+	tests := []struct {
+		name  string
+		topic string
+	}{
+		{"with spaces", "Welcome to the channel"},
+		{"single word", "hello"},
+		{"cleared", ""},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := BuildTOPIC("0AAAAAAAA", "#test", "alice!a@host", 1234567890, tt.topic)
+			
+			// Round-trip through the wire format
+			parsed, err := ParseMessage(msg.String())
+			if err != nil {
+				t.Fatalf("ParseMessage failed: %v", err)
+			}
+			
+			channel, setter, ts, topic, err := ParseTOPIC(parsed)
+			if err != nil {
+				t.Fatalf("ParseTOPIC failed: %v", err)
+			}
+			if channel != "#test" || setter != "alice!a@host" || ts != 1234567890 {
+				t.Errorf("got (%q, %q, %d), want (#test, alice!a@host, 1234567890)", channel, setter, ts)
+			}
+			if topic != tt.topic {
+				t.Errorf("topic = %q, want %q", topic, tt.topic)
+			}
+		})
+	}
+}
+
+func TestBuildParseEOB(t *testing.T) {
+	parsed, err := ParseMessage(BuildEOB("1BB").String())
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+	sid, err := ParseEOB(parsed)
+	if err != nil || sid != "1BB" {
+		t.Errorf("ParseEOB = (%q, %v), want (1BB, nil)", sid, err)
+	}
+	if _, err := ParseEOB(&Message{Command: "EOB"}); err == nil {
+		t.Error("ParseEOB accepted an EOB without a source")
+	}
+}
+
+func TestParseLegacyTOPIC(t *testing.T) {
+	parsed, err := ParseMessage(BuildLegacyTOPIC("0AAAAAAAA", "#test", "Welcome to the channel").String())
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+	
+	channel, setter, ts, topic, err := ParseTOPIC(parsed)
+	if err != nil {
+		t.Fatalf("ParseTOPIC failed: %v", err)
+	}
+	if channel != "#test" || topic != "Welcome to the channel" {
+		t.Errorf("got (%q, %q), want (#test, Welcome to the channel)", channel, topic)
+	}
+	if setter != "" || ts != 0 {
+		t.Errorf("legacy TOPIC gave setter %q and ts %d, want none", setter, ts)
+	}
+}
+
 func TestParsePASSInvalid(t *testing.T) {
 	tests := []struct {
 		name string
@@ -371,3 +459,26 @@ func TestParsePASSInvalid(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildParseBMASK(t *testing.T) {
+	msg := BuildBMASK("0AA", "#test", 1000, 'b', []string{"*!*@evil.example", "spam!*@*"})
+	if got := msg.String(); got != ":0AA BMASK 1000 #test b :*!*@evil.example spam!*@*" {
+		t.Errorf("String() = %q", got)
+	}
+
+	parsed, err := ParseMessage(msg.String())
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+	channel, ts, listType, masks, err := ParseBMASK(parsed)
+	if err != nil {
+		t.Fatalf("ParseBMASK failed: %v", err)
+	}
+	if channel != "#test" || ts != 1000 || listType != 'b' || len(masks) != 2 || masks[1] != "spam!*@*" {
+		t.Errorf("got (%q, %d, %c, %v)", channel, ts, listType, masks)
+	}
+
+	if _, _, _, _, err := ParseBMASK(&Message{Command: "BMASK", Params: []string{"x", "#test", "b", "m"}}); err == nil {
+		t.Error("expected an error for a bad timestamp")
+	}
+}
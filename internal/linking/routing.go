@@ -7,8 +7,9 @@ import (
 
 // LinkRegistry manages active server-to-server connections
 type LinkRegistry struct {
-	links map[string]*Link // SID -> Link
-	mu    sync.RWMutex
+	links   map[string]*Link // SID -> Link
+	pending int              // Slots held by ReserveLink for links being set up
+	mu      sync.RWMutex
 }
 
 // NewLinkRegistry creates a new link registry
@@ -31,6 +32,41 @@ func (lr *LinkRegistry) AddLink(sid string, link *Link) error {
 	return nil
 }
 
+// ReserveLink holds a slot for a link that is still being set up, failing
+// if max links (0 = unlimited) are already linked or being set up. The slot
+// is filled by AddReservedLink or handed back with ReleaseReservation.
+func (lr *LinkRegistry) ReserveLink(max int) bool {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	
+	if max > 0 && len(lr.links)+lr.pending >= max {
+		return false
+	}
+	lr.pending++
+	return true
+}
+
+// AddReservedLink registers a link in a slot held by ReserveLink
+func (lr *LinkRegistry) AddReservedLink(sid string, link *Link) error {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	
+	if _, exists := lr.links[sid]; exists {
+		return fmt.Errorf("link for server %s already exists", sid)
+	}
+	
+	lr.links[sid] = link
+	lr.pending--
+	return nil
+}
+
+// ReleaseReservation hands back a slot that no link was added to
+func (lr *LinkRegistry) ReleaseReservation() {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	lr.pending--
+}
+
 // RemoveLink removes a link from the registry
 func (lr *LinkRegistry) RemoveLink(sid string) {
 	lr.mu.Lock()
@@ -90,8 +126,8 @@ func (mr *MessageRouter) RouteToUser(sourceUID, targetUID string, msg *Message)
 			return fmt.Errorf("target user %s has no server", targetUID)
 		}
 		
-		// Get link to target server
-		link, ok := mr.registry.GetLink(targetServer.SID)
+		// Get link towards the target server
+		link, ok := mr.registry.GetLink(nextHop(targetServer))
 		if !ok {
 			return fmt.Errorf("no link to server %s for user %s", targetServer.SID, targetUID)
 		}
@@ -138,6 +174,35 @@ func (mr *MessageRouter) BroadcastToServers(msg *Message, exceptSID string) erro
 	return nil
 }
 
+// BroadcastByCapability sends msg to the linked servers that advertised
+// capab and fallback to the rest, except the one specified by exceptSID
+func (mr *MessageRouter) BroadcastByCapability(capab string, msg, fallback *Message, exceptSID string) error {
+	links := mr.registry.GetAllLinks()
+	
+	var errs []error
+	for _, link := range links {
+		server := link.GetServer()
+		if server != nil && server.SID == exceptSID {
+			continue
+		}
+		
+		out := fallback
+		if server != nil && server.HasCapability(capab) {
+			out = msg
+		}
+		if err := link.WriteMessage(out); err != nil {
+			errs = append(errs, fmt.Errorf("failed to send to %s: %v", 
+				link.RemoteAddr(), err))
+		}
+	}
+	
+	if len(errs) > 0 {
+		return fmt.Errorf("broadcast errors: %v", errs)
+	}
+	
+	return nil
+}
+
 // RouteToChannelServers sends a message to all servers that have users in a channel
 // except the server specified by exceptSID
 func (mr *MessageRouter) RouteToChannelServers(channelName string, msg *Message, exceptSID string) error {
@@ -147,17 +212,18 @@ func (mr *MessageRouter) RouteToChannelServers(channelName string, msg *Message,
 		return fmt.Errorf("channel %s not found", channelName)
 	}
 	
-	// Get unique server IDs from channel members
+	// Collect the links leading to member servers; servers behind the same
+	// link share one copy, which that server relays onward
 	serverSIDs := make(map[string]bool)
 	for uid := range channel.Members {
 		if user, ok := mr.network.GetUserByUID(uid); ok {
 			if user.Server != nil {
-				serverSIDs[user.Server.SID] = true
+				serverSIDs[nextHop(user.Server)] = true
 			}
 		}
 	}
 	
-	// Send to each server (except source)
+	// Send once per link (except towards the source)
 	var errs []error
 	for sid := range serverSIDs {
 		if sid == exceptSID {
@@ -181,6 +247,33 @@ func (mr *MessageRouter) RouteToChannelServers(channelName string, msg *Message,
 	return nil
 }
 
+// IsEcho reports whether a message from sourceUID arriving over the link to
+// fromSID has looped back: it came from one of our own users, or from a
+// remote user who is not reached through that link. Sources that aren't
+// UIDs (servers, nick!user@host) are never treated as echoes.
+func (mr *MessageRouter) IsEcho(sourceUID, fromSID string) bool {
+	if !ValidateUID(sourceUID) {
+		return false
+	}
+	if sourceUID[:3] == mr.network.LocalSID {
+		return true
+	}
+	
+	user, ok := mr.network.GetUserByUID(sourceUID)
+	if !ok || user.Server == nil {
+		return false
+	}
+	return nextHop(user.Server) != fromSID
+}
+
+// nextHop returns the SID of the directly linked server through which srv is reached
+func nextHop(srv *Server) string {
+	for srv.Uplink != nil {
+		srv = srv.Uplink
+	}
+	return srv.SID
+}
+
 // GetServerForUID returns the server ID that hosts a given UID
 func (mr *MessageRouter) GetServerForUID(uid string) (string, error) {
 	user, ok := mr.network.GetUserByUID(uid)
@@ -0,0 +1,145 @@
+package linking
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"testing"
+)
+
+func TestRouteToChannelServersOncePerLink(t *testing.T) {
+	tests := []struct {
+		name    string
+		members []string
+	}{
+		{"members on the hub and behind it", []string{"1BBAAAAAA", "2CCAAAAAA", "2CCAAAAAB", "3DDAAAAAA"}},
+		{"members only behind the hub", []string{"2CCAAAAAA", "3DDAAAAAA"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			network := NewNetwork("0AA", "hub.test")
+			registry := NewLinkRegistry()
+			router := NewMessageRouter(network, registry)
+
+			// 1BB is linked directly; 2CC and 3DD sit behind it
+			hub := &Server{SID: "1BB", Name: "hub2.test", Distance: 1}
+			network.AddServer(hub)
+			for _, sid := range []string{"2CC", "3DD"} {
+				network.AddServer(&Server{SID: sid, Name: sid + ".test", Uplink: hub, Distance: 2})
+			}
+
+			members := make(map[string]string)
+			for _, uid := range tt.members {
+				srv, _ := network.GetServer(uid[:3])
+				network.AddUser(&RemoteUser{UID: uid, Nick: "n" + uid, Server: srv, Channels: map[string]bool{"#test": true}})
+				members[uid] = ""
+			}
+			network.AddChannel(&RemoteChannel{Name: "#test", TS: 1000, Members: members})
+
+			local, remote := net.Pipe()
+			defer remote.Close()
+			link := NewLink(local)
+			link.server = hub
+			registry.AddLink("1BB", link)
+
+			go func() {
+				msg := &Message{Source: "0AAAAAAAA", Command: "PRIVMSG", Params: []string{"#test", "hello"}}
+				if err := router.RouteToChannelServers("#test", msg, "0AA"); err != nil {
+					t.Errorf("RouteToChannelServers failed: %v", err)
+				}
+				local.Close()
+			}()
+
+			received := 0
+			scanner := bufio.NewScanner(remote)
+			for scanner.Scan() {
+				received++
+			}
+			if received != 1 {
+				t.Errorf("hub link received %d copies, want 1", received)
+			}
+		})
+	}
+}
+
+func TestBroadcastByCapability(t *testing.T) {
+	network := NewNetwork("0AA", "hub.test")
+	registry := NewLinkRegistry()
+	router := NewMessageRouter(network, registry)
+
+	// 1BB understands TOPICTS, 2CC is an older server
+	received := map[string]chan string{}
+	for _, srv := range []*Server{
+		{SID: "1BB", Name: "b.test", Distance: 1, Capabilities: []string{"ENCAP", "TOPICTS"}},
+		{SID: "2CC", Name: "c.test", Distance: 1, Capabilities: []string{"ENCAP"}},
+	} {
+		network.AddServer(srv)
+		local, remote := net.Pipe()
+		defer remote.Close()
+		link := NewLink(local)
+		link.server = srv
+		registry.AddLink(srv.SID, link)
+
+		lines := make(chan string, 1)
+		received[srv.SID] = lines
+		go func() {
+			scanner := bufio.NewScanner(remote)
+			if scanner.Scan() {
+				lines <- scanner.Text()
+			}
+		}()
+	}
+
+	msg := BuildTOPIC("0AAAAAAAA", "#test", "alice!a@host", 1234567890, "hello")
+	fallback := BuildLegacyTOPIC("0AAAAAAAA", "#test", "hello")
+	if err := router.BroadcastByCapability("TOPICTS", msg, fallback, "0AA"); err != nil {
+		t.Fatalf("BroadcastByCapability failed: %v", err)
+	}
+
+	if got := <-received["1BB"]; got != ":0AAAAAAAA TOPIC #test alice!a@host 1234567890 :hello" {
+		t.Errorf("capable server got %q", got)
+	}
+	if got := <-received["2CC"]; got != ":0AAAAAAAA TOPIC #test :hello" {
+		t.Errorf("older server got %q", got)
+	}
+}
+
+func TestReserveLinkLimit(t *testing.T) {
+	registry := NewLinkRegistry()
+
+	// Concurrent links never get more slots than the limit
+	var granted int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if registry.ReserveLink(3) {
+				mu.Lock()
+				granted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if granted != 3 {
+		t.Fatalf("%d links reserved, want 3", granted)
+	}
+
+	// A registered link keeps its slot; a released one frees it
+	if err := registry.AddReservedLink("1BB", &Link{}); err != nil {
+		t.Fatalf("AddReservedLink failed: %v", err)
+	}
+	if registry.ReserveLink(3) {
+		t.Error("reserved a link beyond the limit")
+	}
+	registry.ReleaseReservation()
+	if !registry.ReserveLink(3) {
+		t.Error("released slot was not given back")
+	}
+	if registry.GetLinkCount() != 1 {
+		t.Errorf("GetLinkCount = %d, want 1", registry.GetLinkCount())
+	}
+}
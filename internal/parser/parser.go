@@ -1,11 +1,23 @@
 package parser
 
 import (
+	"errors"
+	"sort"
 	"strings"
 )
 
+var (
+	// ErrEmptyMessage is returned for blank lines, which servers silently ignore
+	ErrEmptyMessage = errors.New("empty message")
+	// ErrNoCommand is returned for a line that has a prefix but no command
+	ErrNoCommand = errors.New("message has no command")
+	// ErrInvalidCommand is returned when the command is neither letters nor a three-digit numeric
+	ErrInvalidCommand = errors.New("invalid command")
+)
+
 // Message represents a parsed IRC message
 type Message struct {
+	Tags    map[string]string // IRCv3 message tags (@key=value;...), unescaped; nil if none
 	Prefix  string   // Optional prefix (sender)
 	Command string   // IRC command (e.g., PRIVMSG, JOIN)
 	Params  []string // Command parameters
@@ -13,7 +25,7 @@ type Message struct {
 }
 
 // Parse parses a raw IRC protocol message
-// Format: [:prefix] <command> [params] [:trailing]
+// Format: [@tags] [:prefix] <command> [params] [:trailing]
 func Parse(raw string) (*Message, error) {
 	msg := &Message{
 		Raw:    raw,
@@ -21,21 +33,37 @@ func Parse(raw string) (*Message, error) {
 	}
 
 	// Handle empty message
-	if raw == "" {
-		return msg, nil
+	if strings.TrimSpace(raw) == "" {
+		return msg, ErrEmptyMessage
 	}
 
 	pos := 0
+
+	// Parse tags (optional, start with @)
+	if raw[0] == '@' {
+		end := strings.Index(raw, " ")
+		if end == -1 {
+			return msg, ErrNoCommand
+		}
+		msg.Tags = parseTags(raw[1:end])
+		pos = end + 1
+		for pos < len(raw) && raw[pos] == ' ' {
+			pos++
+		}
+		if pos >= len(raw) {
+			return msg, ErrNoCommand
+		}
+	}
 	
 	// Parse prefix (optional, starts with :)
-	if raw[0] == ':' {
-		end := strings.Index(raw, " ")
+	if raw[pos] == ':' {
+		end := strings.Index(raw[pos:], " ")
 		if end == -1 {
 			// Malformed message
-			return msg, nil
+			return msg, ErrNoCommand
 		}
-		msg.Prefix = raw[1:end]
-		pos = end + 1
+		msg.Prefix = raw[pos+1 : pos+end]
+		pos += end + 1
 	}
 
 	// Skip spaces
@@ -43,15 +71,22 @@ func Parse(raw string) (*Message, error) {
 		pos++
 	}
 
+	if pos >= len(raw) {
+		return msg, ErrNoCommand
+	}
+
 	// Parse command
 	end := strings.Index(raw[pos:], " ")
 	if end == -1 {
 		// Command with no parameters
 		msg.Command = strings.ToUpper(raw[pos:])
-		return msg, nil
+		return msg, validateCommand(msg.Command)
 	}
 	
 	msg.Command = strings.ToUpper(raw[pos : pos+end])
+	if err := validateCommand(msg.Command); err != nil {
+		return msg, err
+	}
 	pos += end + 1
 
 	// Parse parameters
@@ -85,6 +120,90 @@ func Parse(raw string) (*Message, error) {
 	return msg, nil
 }
 
+// parseTags splits a tag section ("a=1;+b;c=x\sy") into unescaped values.
+// Tags without a value map to "".
+func parseTags(section string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(section, ";") {
+		if tag == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(tag, "=")
+		tags[key] = unescapeTagValue(value)
+	}
+	return tags
+}
+
+// tagEscapes maps the character after a backslash in a tag value to what it
+// stands for
+var tagEscapes = map[byte]byte{':': ';', 's': ' ', '\\': '\\', 'r': '\r', 'n': '\n'}
+
+// unescapeTagValue undoes tag value escaping. A backslash before any other
+// character, or at the end, is dropped.
+func unescapeTagValue(value string) string {
+	if !strings.Contains(value, "\\") {
+		return value
+	}
+	var out strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			out.WriteByte(value[i])
+			continue
+		}
+		i++
+		if i >= len(value) {
+			break
+		}
+		if unescaped, ok := tagEscapes[value[i]]; ok {
+			out.WriteByte(unescaped)
+		} else {
+			out.WriteByte(value[i])
+		}
+	}
+	return out.String()
+}
+
+// FormatTags builds a tag section, with the leading @, from tags sorted by
+// key. It returns "" when there are no tags.
+func FormatTags(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var out strings.Builder
+	out.WriteByte('@')
+	for i, key := range keys {
+		if i > 0 {
+			out.WriteByte(';')
+		}
+		out.WriteString(key)
+		if value := tags[key]; value != "" {
+			out.WriteByte('=')
+			out.WriteString(tagValueEscaper.Replace(value))
+		}
+	}
+	return out.String()
+}
+
+// tagValueEscaper escapes a tag value for sending
+var tagValueEscaper = strings.NewReplacer("\\", "\\\\", ";", "\\:", " ", "\\s", "\r", "\\r", "\n", "\\n")
+
+// validateCommand checks that a command is made of letters or is a three-digit numeric
+func validateCommand(cmd string) error {
+	if len(cmd) == 3 && strings.Trim(cmd, "0123456789") == "" {
+		return nil
+	}
+	if strings.Trim(cmd, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return ErrInvalidCommand
+	}
+	return nil
+}
+
 // IsValid checks if the message has a valid command
 func (m *Message) IsValid() bool {
 	return m.Command != ""
@@ -98,6 +217,18 @@ func (m *Message) GetParam(index int) string {
 	return m.Params[index]
 }
 
+// TagsLength returns the length of the raw tag section, including the
+// leading @, or 0 if the message has no tags
+func (m *Message) TagsLength() int {
+	if !strings.HasPrefix(m.Raw, "@") {
+		return 0
+	}
+	if end := strings.Index(m.Raw, " "); end != -1 {
+		return end
+	}
+	return len(m.Raw)
+}
+
 // HasParam checks if a parameter exists at the given index
 func (m *Message) HasParam(index int) bool {
 	return index >= 0 && index < len(m.Params)
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -85,6 +86,39 @@ func TestParseWithPrefix(t *testing.T) {
 	}
 }
 
+func TestParseWithTags(t *testing.T) {
+	input := `@+draft/reply=abc;+note=a\sb\:c\;time=2024 :nick!user@host PRIVMSG #channel :Hello`
+	msg, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	want := map[string]string{"+draft/reply": "abc", "+note": "a b;c", "time": "2024"}
+	if len(msg.Tags) != len(want) {
+		t.Errorf("Tags = %v, want %v", msg.Tags, want)
+	}
+	for key, value := range want {
+		if msg.Tags[key] != value {
+			t.Errorf("Tags[%q] = %q, want %q", key, msg.Tags[key], value)
+		}
+	}
+	if msg.Prefix != "nick!user@host" || msg.Command != "PRIVMSG" || msg.GetParam(1) != "Hello" {
+		t.Errorf("tags upset the rest of the parse: %+v", msg)
+	}
+	if msg.TagsLength() != strings.Index(input, " ") {
+		t.Errorf("TagsLength() = %d, want %d", msg.TagsLength(), strings.Index(input, " "))
+	}
+
+	// Formatting escapes values again and sorts the keys
+	if got := FormatTags(map[string]string{"+b": "", "+a": "x y;z"}); got != `@+a=x\sy\:z;+b` {
+		t.Errorf("FormatTags() = %q", got)
+	}
+
+	if _, err := Parse("@+only-tags"); err != ErrNoCommand {
+		t.Errorf("Parse(tags only) error = %v, want ErrNoCommand", err)
+	}
+}
+
 func TestIsValid(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -105,3 +139,33 @@ func TestIsValid(t *testing.T) {
 		})
 	}
 }
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{"Empty line", "", ErrEmptyMessage},
+		{"Only spaces", "   ", ErrEmptyMessage},
+		{"Prefix only", ":nick!user@host", ErrNoCommand},
+		{"Prefix and spaces", ":nick   ", ErrNoCommand},
+		{"Garbage command", "#$%! foo", ErrInvalidCommand},
+		{"Garbage without params", "\x01\x02", ErrInvalidCommand},
+		{"Two-digit numeric", "12 alice", ErrInvalidCommand},
+		{"Valid numeric", "001 alice :Welcome", nil},
+		{"Valid command", "privmsg #chan :hi", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := Parse(tt.input)
+			if err != tt.wantErr {
+				t.Errorf("Parse(%q) error = %v, want %v", tt.input, err, tt.wantErr)
+			}
+			if msg == nil {
+				t.Fatal("Parse returned a nil message")
+			}
+		})
+	}
+}
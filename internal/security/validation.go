@@ -33,6 +33,33 @@ func SanitizeNickname(nick string) string {
 	return result.String()
 }
 
+// SanitizeUsername strips characters that would break nick!user@host formatting
+// Allowed: ASCII letters, digits, and - _ .
+func SanitizeUsername(user string) string {
+	var result strings.Builder
+	for _, ch := range user {
+		if (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') ||
+		   (ch >= '0' && ch <= '9') ||
+		   strings.ContainsRune("-_.", ch) {
+			result.WriteRune(ch)
+		}
+	}
+	return result.String()
+}
+
+// SanitizeRealname removes IRC formatting codes and any remaining control characters
+func SanitizeRealname(name string) string {
+	name = StripControlCodes(name)
+	
+	var result strings.Builder
+	for _, ch := range name {
+		if ch >= 32 && ch != 127 {
+			result.WriteRune(ch)
+		}
+	}
+	return strings.TrimSpace(result.String())
+}
+
 // SanitizeChannelName ensures channel name only contains valid characters
 func SanitizeChannelName(name string) string {
 	if len(name) == 0 {
@@ -53,6 +53,50 @@ func TestSanitizeNickname(t *testing.T) {
 	}
 }
 
+func TestSanitizeUsername(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"alice", "alice"},
+		{"alice smith", "alicesmith"},
+		{"al\x01ice\x07", "alice"},
+		{"a.b-c_d", "a.b-c_d"},
+		{"bad@user!", "baduser"},
+		{"!@#", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := SanitizeUsername(tt.input)
+			if got != tt.want {
+				t.Errorf("SanitizeUsername(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeRealname(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"Alice Wonderland", "Alice Wonderland"},
+		{"\x02Bold\x02 Name", "Bold Name"},
+		{"\x0304,05Colored", "Colored"},
+		{"Bell\x07 Name\r\n", "Bell Name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := SanitizeRealname(tt.input)
+			if got != tt.want {
+				t.Errorf("SanitizeRealname(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestSanitizeChannelName(t *testing.T) {
 	tests := []struct {
 		input string
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sync"
+
+	"github.com/supamanluva/ircd/internal/client"
+	"github.com/supamanluva/ircd/internal/commands"
+	"github.com/supamanluva/ircd/internal/parser"
+)
+
+// certReloader serves a certificate loaded from disk and can swap it for a
+// renewed one while listeners keep running
+type certReloader struct {
+	certFile string
+	keyFile  string
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+}
+
+// newCertReloader loads the certificate and key
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload re-reads the certificate and key files. On error the current
+// certificate stays in use.
+func (r *certReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificates: %w", err)
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+	return nil
+}
+
+// GetCertificate returns the current certificate (tls.Config.GetCertificate)
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Rehash reloads the TLS certificates of the client, WebSocket and link
+// listeners. New handshakes use the renewed certificates; open connections
+// are kept.
+func (s *Server) Rehash() error {
+	s.mu.RLock()
+	reloaders := map[string]*certReloader{"TLS": s.tlsCerts, "WebSocket": s.wsCerts, "Link TLS": s.linkCerts}
+	s.mu.RUnlock()
+
+	var errs []error
+	for name, r := range reloaders {
+		if r == nil {
+			continue
+		}
+		if err := r.Reload(); err != nil {
+			s.logger.Error("Failed to reload certificate", "listener", name, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		s.logger.Info("Reloaded certificate", "listener", name, "cert", r.certFile)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("rehash failed: %v", errs)
+	}
+	return nil
+}
+
+// handleRehash handles REHASH from an IRC operator
+func (s *Server) handleRehash(c *client.Client, msg *parser.Message) error {
+	nick := c.GetNickname()
+	if !c.HasMode('o') {
+		c.Send(commands.NumericReply(s.config.ServerName, commands.ERR_NOPRIVILEGES, nick, ":Permission Denied- You're not an IRC operator"))
+		return nil
+	}
+
+	s.logger.Info("REHASH requested", "oper", nick)
+	c.Send(commands.NumericReply(s.config.ServerName, commands.RPL_REHASHING, nick, "certificates :Rehashing"))
+	if err := s.Rehash(); err != nil {
+		c.Send(fmt.Sprintf(":%s NOTICE %s :*** %v", s.config.ServerName, nick, err))
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/supamanluva/ircd/internal/client"
+	"github.com/supamanluva/ircd/internal/commands"
+	"github.com/supamanluva/ircd/internal/parser"
+)
+
+// configSecret reports whether a Config field holds a password or private
+// key that CONFIG must not show
+func configSecret(field string) bool {
+	return strings.Contains(field, "Password") || strings.Contains(field, "Key")
+}
+
+// configLines renders the effective configuration as "Field: value" lines.
+// Secrets only show whether they are set; operators are listed by name and
+// links without their passwords.
+func (s *Server) configLines() []string {
+	v := reflect.ValueOf(*s.config)
+	t := v.Type()
+
+	var lines []string
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Name
+		value := v.Field(i)
+
+		switch {
+		case name == "Operators":
+			var names []string
+			for _, op := range s.config.Operators {
+				names = append(names, op.Name)
+			}
+			lines = append(lines, fmt.Sprintf("Operators: %s", strings.Join(names, " ")))
+		case name == "Links":
+			for _, link := range s.config.Links {
+				lines = append(lines, fmt.Sprintf("Link: %s sid=%s address=%s:%d auto_connect=%t hub=%t tls=%t",
+					link.Name, link.SID, link.Host, link.Port, link.AutoConnect, link.IsHub, link.TLS))
+			}
+		case configSecret(name):
+			state := "(not set)"
+			if !value.IsZero() {
+				state = "(set, hidden)"
+			}
+			lines = append(lines, fmt.Sprintf("%s: %s", name, state))
+		default:
+			lines = append(lines, fmt.Sprintf("%s: %v", name, value.Interface()))
+		}
+	}
+
+	// Runtime state that can differ from the config file
+	lines = append(lines, fmt.Sprintf("Lockdown (now): %t", s.handler.IsLockedDown()))
+	return lines
+}
+
+// handleConfig handles CONFIG from an IRC operator: it lists the effective
+// configuration so it can be checked against the config file
+func (s *Server) handleConfig(c *client.Client, msg *parser.Message) error {
+	nick := c.GetNickname()
+	if !c.HasMode('o') {
+		c.Send(commands.NumericReply(s.config.ServerName, commands.ERR_NOPRIVILEGES, nick, ":Permission Denied- You're not an IRC operator"))
+		return nil
+	}
+
+	s.logger.Info("CONFIG requested", "oper", nick)
+	for _, line := range s.configLines() {
+		c.Send(fmt.Sprintf(":%s NOTICE %s :*** %s", s.config.ServerName, nick, line))
+	}
+	c.Send(fmt.Sprintf(":%s NOTICE %s :*** End of CONFIG", s.config.ServerName, nick))
+	return nil
+}
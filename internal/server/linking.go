@@ -1,11 +1,17 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 	
+	"github.com/supamanluva/ircd/internal/channel"
+	"github.com/supamanluva/ircd/internal/commands"
 	"github.com/supamanluva/ircd/internal/linking"
 )
 
@@ -14,6 +20,15 @@ func (s *Server) StartLinkListener() error {
 	if !s.config.LinkingEnabled {
 		return nil // Linking not enabled
 	}
+	
+	if s.config.LinkTLSEnabled {
+		if err := s.startLinkTLSListener(); err != nil {
+			return err
+		}
+		if s.config.LinkPlaintextDisabled {
+			return nil
+		}
+	}
 
 	addr := fmt.Sprintf("%s:%d", s.config.LinkingHost, s.config.LinkingPort)
 	
@@ -26,15 +41,15 @@ func (s *Server) StartLinkListener() error {
 	s.logger.Info("Server link listener started on", "address", addr)
 	
 	// Accept connections in a goroutine
-	go s.acceptLinks()
+	go s.acceptLinks(listener)
 	
 	return nil
 }
 
 // acceptLinks accepts incoming server link connections
-func (s *Server) acceptLinks() {
+func (s *Server) acceptLinks(listener net.Listener) {
 	for {
-		conn, err := s.linkListener.Accept()
+		conn, err := listener.Accept()
 		if err != nil {
 			select {
 			case <-s.shutdown:
@@ -54,12 +69,33 @@ func (s *Server) acceptLinks() {
 
 // handleLinkConnection handles an incoming server link connection
 func (s *Server) handleLinkConnection(conn net.Conn) {
-	defer conn.Close()
-	
 	s.logger.Info("Link connection handler started for", "address", conn.RemoteAddr().String())
 	
+	// On the TLS link port, plaintext never reaches the link handshake
+	if err := s.completeLinkTLS(conn); err != nil {
+		s.logger.Warn("Refusing link without TLS", "address", conn.RemoteAddr().String(), "error", err)
+		conn.Close()
+		return
+	}
+	
 	// Create link
 	link := linking.NewLink(conn)
+	link.SetMaxLineLength(s.config.LinkMaxLineLength)
+	link.SetMaxUsers(s.config.LinkMaxUsers)
+	defer link.Close()
+	s.closeLinkOnShutdown(link)
+	
+	if !s.linkRegistry.ReserveLink(s.config.MaxLinks) {
+		s.logger.Warn("Refusing link, too many linked servers", "address", conn.RemoteAddr().String(), "max_links", s.config.MaxLinks)
+		link.WriteMessage(linking.BuildERROR("Closing Link: too many linked servers"))
+		return
+	}
+	registered := false
+	defer func() {
+		if !registered {
+			s.linkRegistry.ReleaseReservation()
+		}
+	}()
 	
 	// Perform handshake (server side - receiving connection)
 	err := link.HandshakeServer(s.network, s.config.LinkPassword)
@@ -75,7 +111,7 @@ func (s *Server) handleLinkConnection(conn net.Conn) {
 		return
 	}
 	
-	s.logger.Info("Server link established", "name", server.Name, "sid", server.SID, "address", conn.RemoteAddr().String())
+	s.logger.Info("Server link established", "name", server.Name, "sid", server.SID, "version", server.Version, "address", conn.RemoteAddr().String())
 	
 	// Add server to network
 	if err := s.network.AddServer(server); err != nil {
@@ -91,10 +127,17 @@ func (s *Server) handleLinkConnection(conn net.Conn) {
 	burstState, err := link.ReceiveBurst(s.network)
 	if err != nil {
 		s.logger.Error("Failed to receive burst", "name", server.Name, "error", err)
+		s.refuseOversizedBurst(link, server, err)
 		return
 	}
 	
-	s.logger.Info("Burst received", "name", server.Name, "users", burstState.UsersRecv, "channels", burstState.ChansRecv)
+	s.logger.Info("Burst received", "name", server.Name, "users", burstState.UsersRecv, "channels", burstState.ChansRecv,
+		"skipped_users", burstState.UsersSkipped, "skipped_channels", burstState.ChansSkipped, "skipped_masks", burstState.MasksSkipped)
+	for _, skipped := range burstState.Skipped {
+		s.logger.Warn("Skipped burst entry", "name", server.Name, "error", skipped)
+	}
+	s.syncBurstChannelModes(burstState)
+	s.resolveBurstNickCollisions(burstState)
 	
 	// Send our burst
 	s.logger.Info("Sending burst to", "name", server.Name)
@@ -118,11 +161,13 @@ func (s *Server) handleLinkConnection(conn net.Conn) {
 		"total_users", s.network.GetUserCount(), "total_channels", s.network.GetChannelCount())
 	
 	// Register link in link registry (Phase 7.4)
-	if err := s.linkRegistry.AddLink(server.SID, link); err != nil {
+	if err := s.linkRegistry.AddReservedLink(server.SID, link); err != nil {
 		s.logger.Error("Failed to register link", "name", server.Name, "error", err)
 		return
 	}
+	registered = true
 	defer s.linkRegistry.RemoveLink(server.SID)
+	s.introduceNewLink(link, server)
 	
 	s.logger.Info("Link established, keeping connection alive", "name", server.Name)
 	
@@ -130,7 +175,12 @@ func (s *Server) handleLinkConnection(conn net.Conn) {
 	for {
 		msg, err := link.ReadMessage()
 		if err != nil {
+			if s.shuttingDown() {
+				s.logger.Info("Link closed for shutdown", "name", server.Name)
+				break
+			}
 			s.logger.Info("Link connection closed", "name", server.Name, "error", err)
+			s.squitOnProtocolError(link, server, err)
 			// Clean up disconnected server (Phase 7.4.5)
 			s.cleanupDisconnectedServer(server, fmt.Sprintf("Connection lost: %v", err))
 			s.network.RemoveServer(server.SID)
@@ -142,7 +192,7 @@ func (s *Server) handleLinkConnection(conn net.Conn) {
 		
 		// Handle PING to keep connection alive
 		if msg.Command == "PING" {
-			pong := linking.BuildPONG(s.network.LocalSID, msg.Source)
+			pong := linking.BuildPONG(s.network.LocalSID, pingToken(msg))
 			if err := link.WriteMessage(pong); err != nil {
 				s.logger.Error("Failed to send PONG", "name", server.Name, "error", err)
 				// Clean up on send error (Phase 7.4.5)
@@ -161,16 +211,48 @@ func (s *Server) handleLinkConnection(conn net.Conn) {
 	s.logger.Info("Link connection closed for", "address", conn.RemoteAddr().String())
 }
 
+// closeLinkOnShutdown closes link when the server shuts down, which unblocks
+// any goroutine waiting in ReadMessage on it
+func (s *Server) closeLinkOnShutdown(link *linking.Link) {
+	go func() {
+		select {
+		case <-s.shutdown:
+			link.Close()
+		case <-link.Done():
+		}
+	}()
+}
+
+// shuttingDown reports whether Shutdown has been called
+func (s *Server) shuttingDown() bool {
+	select {
+	case <-s.shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
 // ConnectToServer initiates an outbound connection to another server
 func (s *Server) ConnectToServer(linkCfg LinkConfig) error {
 	if !s.config.LinkingEnabled {
 		return fmt.Errorf("server linking is not enabled")
 	}
 	
-	addr := fmt.Sprintf("%s:%d", linkCfg.Host, linkCfg.Port)
+	if !s.linkRegistry.ReserveLink(s.config.MaxLinks) {
+		return fmt.Errorf("cannot link %s: maximum of %d linked servers reached", linkCfg.Name, s.config.MaxLinks)
+	}
+	registered := false
+	defer func() {
+		if !registered {
+			s.linkRegistry.ReleaseReservation()
+		}
+	}()
+	
+	addr := net.JoinHostPort(linkCfg.Host, strconv.Itoa(linkCfg.Port))
 	s.logger.Info("Attempting to connect to server", "name", linkCfg.Name, "sid", linkCfg.SID, "address", addr)
 	
-	conn, err := net.Dial("tcp", addr)
+	conn, err := dialLink(linkCfg)
 	if err != nil {
 		return fmt.Errorf("failed to connect to %s: %v", addr, err)
 	}
@@ -179,29 +261,32 @@ func (s *Server) ConnectToServer(linkCfg LinkConfig) error {
 	
 	// Create link
 	link := linking.NewLink(conn)
+	link.SetMaxLineLength(s.config.LinkMaxLineLength)
+	link.SetMaxUsers(s.config.LinkMaxUsers)
+	s.closeLinkOnShutdown(link)
 	
 	// Perform handshake (client side - initiating connection)
 	err = link.HandshakeClient(s.network, linkCfg.Password, linkCfg.SID, linkCfg.Name)
 	if err != nil {
-		conn.Close()
+		link.Close()
 		return fmt.Errorf("handshake failed with %s: %v", linkCfg.Name, err)
 	}
 	
 	// Get the registered server
 	server := link.GetServer()
 	if server == nil {
-		conn.Close()
+		link.Close()
 		return fmt.Errorf("no server object after handshake with %s", linkCfg.Name)
 	}
 	
 	// Mark as hub if configured
 	server.IsHub = linkCfg.IsHub
 	
-	s.logger.Info("Server link established", "name", server.Name, "sid", server.SID)
+	s.logger.Info("Server link established", "name", server.Name, "sid", server.SID, "version", server.Version)
 	
 	// Add server to network
 	if err := s.network.AddServer(server); err != nil {
-		conn.Close()
+		link.Close()
 		return fmt.Errorf("failed to add server %s to network: %v", server.Name, err)
 	}
 	
@@ -216,7 +301,7 @@ func (s *Server) ConnectToServer(linkCfg LinkConfig) error {
 		func() []linking.BurstChannel { return s.GetBurstChannels() },
 	)
 	if err != nil {
-		conn.Close()
+		link.Close()
 		return fmt.Errorf("failed to send burst: %v", err)
 	}
 	
@@ -229,21 +314,30 @@ func (s *Server) ConnectToServer(linkCfg LinkConfig) error {
 	
 	burstState, err := link.ReceiveBurst(s.network)
 	if err != nil {
-		conn.Close()
+		s.refuseOversizedBurst(link, server, err)
+		link.Close()
 		return fmt.Errorf("failed to receive burst: %v", err)
 	}
 	
-	s.logger.Info("Burst received", "name", server.Name, "users", burstState.UsersRecv, "channels", burstState.ChansRecv)
+	s.logger.Info("Burst received", "name", server.Name, "users", burstState.UsersRecv, "channels", burstState.ChansRecv,
+		"skipped_users", burstState.UsersSkipped, "skipped_channels", burstState.ChansSkipped, "skipped_masks", burstState.MasksSkipped)
+	for _, skipped := range burstState.Skipped {
+		s.logger.Warn("Skipped burst entry", "name", server.Name, "error", skipped)
+	}
+	s.syncBurstChannelModes(burstState)
+	s.resolveBurstNickCollisions(burstState)
 	
 	// Log network statistics
 	s.logger.Info("Network state", "total_servers", s.network.GetServerCount(), 
 		"total_users", s.network.GetUserCount(), "total_channels", s.network.GetChannelCount())
 	
 	// Register link in link registry (Phase 7.4)
-	if err := s.linkRegistry.AddLink(server.SID, link); err != nil {
-		conn.Close()
+	if err := s.linkRegistry.AddReservedLink(server.SID, link); err != nil {
+		link.Close()
 		return fmt.Errorf("failed to register link: %v", err)
 	}
+	registered = true
+	s.introduceNewLink(link, server)
 	
 	s.logger.Info("Link established, starting message handler", "name", server.Name)
 	
@@ -251,7 +345,10 @@ func (s *Server) ConnectToServer(linkCfg LinkConfig) error {
 	go func() {
 		defer func() {
 			s.linkRegistry.RemoveLink(server.SID)
-			conn.Close()
+			link.Close()
+			if s.shuttingDown() {
+				return
+			}
 			// Clean up disconnected server (Phase 7.4.5)
 			s.cleanupDisconnectedServer(server, "Connection lost")
 			s.network.RemoveServer(server.SID)
@@ -260,7 +357,12 @@ func (s *Server) ConnectToServer(linkCfg LinkConfig) error {
 		for {
 			msg, err := link.ReadMessage()
 			if err != nil {
+				if s.shuttingDown() {
+					s.logger.Info("Link closed for shutdown", "name", server.Name)
+					return
+				}
 				s.logger.Info("Link connection closed", "name", server.Name, "error", err)
+				s.squitOnProtocolError(link, server, err)
 				return
 			}
 			
@@ -269,7 +371,7 @@ func (s *Server) ConnectToServer(linkCfg LinkConfig) error {
 			
 			// Handle PING to keep connection alive
 			if msg.Command == "PING" {
-				pong := linking.BuildPONG(s.network.LocalSID, msg.Source)
+				pong := linking.BuildPONG(s.network.LocalSID, pingToken(msg))
 				if err := link.WriteMessage(pong); err != nil {
 					s.logger.Error("Failed to send PONG", "name", server.Name, "error", err)
 					return
@@ -287,6 +389,258 @@ func (s *Server) ConnectToServer(linkCfg LinkConfig) error {
 	return nil
 }
 
+// squitOnProtocolError tells the peer and the rest of the network why a link is
+// being dropped when the failure was a protocol violation rather than a lost connection
+func (s *Server) squitOnProtocolError(link *linking.Link, server *linking.Server, err error) {
+	if !errors.Is(err, linking.ErrLineTooLong) {
+		return
+	}
+	
+	s.logger.Warn("Dropping link after protocol error", "name", server.Name, "error", err)
+	link.WriteMessage(linking.BuildERROR("Closing Link: line too long"))
+	
+	squitMsg := linking.BuildSQUIT(s.config.ServerID, server.Name, "Protocol error: line too long")
+	s.router.BroadcastToServers(squitMsg, server.SID)
+}
+
+// refuseOversizedBurst drops a link whose burst introduced more users than
+// LinkMaxUsers allows, forgetting the server and the users it already added
+func (s *Server) refuseOversizedBurst(link *linking.Link, server *linking.Server, err error) {
+	if !errors.Is(err, linking.ErrTooManyUsers) {
+		return
+	}
+	
+	s.logger.Warn("Dropping link after oversized burst", "name", server.Name, "max_users", s.config.LinkMaxUsers)
+	link.WriteMessage(linking.BuildERROR("Closing Link: too many users in burst"))
+	
+	s.cleanupDisconnectedServer(server, "Too many users in burst")
+	s.network.RemoveServer(server.SID)
+}
+
+// resolveBurstNickCollisions renames local users who lost their nick to a burst user
+func (s *Server) resolveBurstNickCollisions(burstState *linking.BurstState) {
+	for _, user := range burstState.Users {
+		s.resolveNickCollision(user)
+	}
+}
+
+// resolveNickCollision forces a local user whose nick was taken by an older
+// remote user (lower nick TS wins), or one with the same TS, to change nick
+// to their UID
+func (s *Server) resolveNickCollision(remote *linking.RemoteUser) {
+	local := s.GetClient(remote.Nick)
+	if local == nil || !local.IsRegistered() {
+		return
+	}
+	
+	// The older nick wins and a newer remote user is renamed by its own
+	// server. On a tie both lose: the remote server sees the same tie and
+	// renames its user as we rename ours.
+	if remote.Timestamp > local.GetNickTS() {
+		return
+	}
+	
+	uid := local.GetUID()
+	if uid == "" {
+		return
+	}
+	
+	serverName := ""
+	if remote.Server != nil {
+		serverName = remote.Server.Name
+	}
+	s.logger.Info("Nick collision, forcing local user to UID",
+		"nick", remote.Nick, "uid", uid, "remote_uid", remote.UID, "from_server", serverName)
+	
+	local.Send(fmt.Sprintf(":%s NOTICE %s :Nick collision with a user on %s, your nickname has been changed to %s",
+		s.config.ServerName, remote.Nick, serverName, uid))
+	s.handler.ForceNick(local, uid)
+}
+
+// syncBurstChannelModes tells local members about status lost to lower-TS SJOINs
+func (s *Server) syncBurstChannelModes(burstState *linking.BurstState) {
+	for name, ts := range burstState.ChanTS {
+		s.applyChannelTS(name, ts, burstState.Cleared[name])
+	}
+	for name, lists := range burstState.Masks {
+		for listType, masks := range lists {
+			s.applyChannelMasks(name, burstState.ChanTS[name], listType, masks)
+		}
+	}
+}
+
+// applyChannelMasks adds ban, exception, invite exception or quiet masks received from a peer to the
+// local channel, announcing the new ones to local members. Lists from a
+// channel newer than ours (higher TS) lost the merge and are ignored, in
+// which case it returns false.
+func (s *Server) applyChannelMasks(name string, ts int64, listType byte, masks []string) bool {
+	s.mu.RLock()
+	ch, exists := s.channels[name]
+	s.mu.RUnlock()
+	
+	if !exists {
+		return true
+	}
+	if ts > ch.GetCreatedAt().Unix() {
+		return false
+	}
+	
+	for _, mask := range masks {
+		var added bool
+		switch listType {
+		case 'b':
+			added = ch.AddBan(mask)
+		case 'e':
+			added = ch.AddException(mask)
+		case 'I':
+			added = ch.AddInviteException(mask)
+		case 'q':
+			added = ch.AddQuiet(mask)
+		}
+		if added {
+			ch.BroadcastAll(fmt.Sprintf(":%s MODE %s +%c %s", s.config.ServerName, name, listType, mask))
+		}
+	}
+	return true
+}
+
+// handleLinkBMASK handles BMASK from remote servers: a batch of ban,
+// exception, invite exception or quiet masks for one channel, applied only if the sender's channel TS isn't newer
+func (s *Server) handleLinkBMASK(msg *linking.Message, fromServer *linking.Server) error {
+	channel, ts, listType, masks, err := linking.ParseBMASK(msg)
+	if err != nil {
+		return fmt.Errorf("invalid BMASK: %v", err)
+	}
+	if !strings.ContainsRune("beIq", rune(listType)) {
+		s.logger.Debug("Ignoring BMASK for unknown list", "type", string(listType), "channel", channel)
+		return nil
+	}
+	
+	if remoteChan, ok := s.network.GetChannel(channel); ok && ts > remoteChan.TS {
+		s.logger.Debug("Ignoring BMASK from newer channel", "channel", channel, "ts", ts)
+		return nil
+	}
+	if !s.applyChannelMasks(channel, ts, listType, masks) {
+		s.logger.Debug("Ignoring BMASK from newer channel", "channel", channel, "ts", ts)
+		return nil
+	}
+	s.network.AddChannelMasks(channel, ts, listType, masks)
+	
+	s.router.BroadcastToServers(msg, fromServer.SID)
+	return nil
+}
+
+// applyChannelTS merges an incoming channel TS into the local channel.
+// If the incoming TS is lower, local ops and voices are removed; those, plus
+// any remote members whose status was cleared, are announced to local members.
+func (s *Server) applyChannelTS(name string, ts int64, cleared map[string]string) {
+	s.mu.RLock()
+	ch, exists := s.channels[name]
+	s.mu.RUnlock()
+	
+	if !exists {
+		return
+	}
+	
+	var changes []string
+	
+	if ts < ch.GetCreatedAt().Unix() {
+		ch.SetCreatedAt(time.Unix(ts, 0))
+		for _, member := range ch.GetMembers() {
+			if ch.IsOwner(member) {
+				ch.SetOwner(member, false)
+				changes = append(changes, "-q "+member.GetNickname())
+			}
+			if ch.IsAdmin(member) {
+				ch.SetAdmin(member, false)
+				changes = append(changes, "-a "+member.GetNickname())
+			}
+			if ch.IsOperator(member) {
+				ch.SetOperator(member, false)
+				changes = append(changes, "-o "+member.GetNickname())
+			}
+			if ch.IsHalfop(member) {
+				ch.SetHalfop(member, false)
+				changes = append(changes, "-h "+member.GetNickname())
+			}
+			if ch.IsVoiced(member) {
+				ch.SetVoice(member, false)
+				changes = append(changes, "-v "+member.GetNickname())
+			}
+		}
+	}
+	
+	for uid, prefixes := range cleared {
+		user, ok := s.network.GetUserByUID(uid)
+		if !ok {
+			continue
+		}
+		if strings.Contains(prefixes, "~") {
+			changes = append(changes, "-q "+user.Nick)
+		}
+		if strings.Contains(prefixes, "&") {
+			changes = append(changes, "-a "+user.Nick)
+		}
+		if strings.Contains(prefixes, "@") {
+			changes = append(changes, "-o "+user.Nick)
+		}
+		if strings.Contains(prefixes, "%") {
+			changes = append(changes, "-h "+user.Nick)
+		}
+		if strings.Contains(prefixes, "+") {
+			changes = append(changes, "-v "+user.Nick)
+		}
+	}
+	
+	for _, change := range changes {
+		ch.BroadcastAll(fmt.Sprintf(":%s MODE %s %s", s.config.ServerName, name, change))
+	}
+	
+	if len(changes) > 0 {
+		s.logger.Info("Channel status reset after TS merge", "channel", name, "ts", ts, "changes", len(changes))
+	}
+}
+
+// pingToken returns the token a PONG should echo for an incoming PING
+func pingToken(msg *linking.Message) string {
+	if len(msg.Params) > 0 {
+		return msg.Params[0]
+	}
+	return msg.Source
+}
+
+// pingLinks periodically PINGs every linked server to measure latency
+func (s *Server) pingLinks(ctx context.Context) {
+	ticker := time.NewTicker(s.config.PingInterval)
+	defer ticker.Stop()
+	
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, link := range s.linkRegistry.GetAllLinks() {
+				if err := link.SendPing(s.network.LocalSID); err != nil {
+					s.logger.Debug("Failed to PING link", "address", link.RemoteAddr(), "error", err)
+				}
+			}
+		}
+	}
+}
+
+// handleLinkPong records link latency from a PONG answering one of our PINGs
+func (s *Server) handleLinkPong(msg *linking.Message, fromServer *linking.Server) error {
+	link, ok := s.linkRegistry.GetLink(fromServer.SID)
+	if !ok {
+		return nil
+	}
+	
+	if rtt, ok := link.HandlePong(msg); ok {
+		s.logger.Debug("Link latency", "name", fromServer.Name, "rtt", rtt)
+	}
+	return nil
+}
+
 // AutoConnect attempts to connect to all auto-connect servers
 func (s *Server) AutoConnect() {
 	if !s.config.LinkingEnabled {
@@ -338,10 +692,21 @@ func (s *Server) AutoConnect() {
 
 // handleLinkMessage processes incoming messages from linked servers (Phase 7.4)
 func (s *Server) handleLinkMessage(msg *linking.Message, fromServer *linking.Server) error {
+	// In a mesh a user's message can come back to us through a third
+	// server; only the copy arriving from the user's direction is used
+	if s.router.IsEcho(msg.Source, fromServer.SID) {
+		s.logger.Debug("Dropping looped link message",
+			"command", msg.Command, "source", msg.Source, "from", fromServer.Name)
+		return nil
+	}
+	
 	switch msg.Command {
 	case "UID":
 		return s.handleLinkUID(msg, fromServer)
 	
+	case "SERVER":
+		return s.handleLinkServer(msg, fromServer)
+	
 	case "PRIVMSG", "NOTICE":
 		return s.handleLinkPrivmsg(msg, fromServer)
 	
@@ -369,9 +734,30 @@ func (s *Server) handleLinkMessage(msg *linking.Message, fromServer *linking.Ser
 	case "INVITE":
 		return s.handleLinkInvite(msg, fromServer)
 	
+	case "WALLOPS":
+		return s.handleLinkWallops(msg, fromServer)
+	
+	case "WALLCHOPS":
+		return s.handleLinkWallchops(msg, fromServer)
+	
+	case "AWAY":
+		return s.handleLinkAway(msg, fromServer)
+	
+	case "BMASK":
+		return s.handleLinkBMASK(msg, fromServer)
+	
 	case "SQUIT":
 		return s.handleLinkSquit(msg, fromServer)
 	
+	case "PONG":
+		return s.handleLinkPong(msg, fromServer)
+	
+	case "SAJOIN":
+		return s.handleLinkSajoin(msg, fromServer)
+	
+	case "SAPART":
+		return s.handleLinkSapart(msg, fromServer)
+	
 	default:
 		s.logger.Debug("Unhandled link message", "command", msg.Command, "from", fromServer.Name)
 	}
@@ -382,17 +768,45 @@ func (s *Server) handleLinkMessage(msg *linking.Message, fromServer *linking.Ser
 // handleLinkUID handles UID messages from remote servers (new user registration)
 func (s *Server) handleLinkUID(msg *linking.Message, fromServer *linking.Server) error {
 	// UID format: UID nick hopcount timestamp user host uid realname
+	// The TS6 form also carries modes and IP:
+	// UID nick hopcount timestamp modes user host ip uid realname
 	if len(msg.Params) < 7 {
 		return fmt.Errorf("invalid UID: need 7 params")
 	}
 	
 	nick := msg.Params[0]
-	// hopcount := msg.Params[1]  // not used
-	// ts := msg.Params[2]        // not used  
+	hopcount, err := strconv.Atoi(msg.Params[1])
+	if err != nil || hopcount < 1 {
+		hopcount = 1
+	}
+	ts, _ := strconv.ParseInt(msg.Params[2], 10, 64)
 	user := msg.Params[3]
 	host := msg.Params[4]
 	uid := msg.Params[5]
 	realname := msg.Params[6]
+	modes, ip := "", ""
+	if len(msg.Params) >= 9 {
+		modes, user, host, ip, uid, realname = msg.Params[3], msg.Params[4], msg.Params[5], msg.Params[6], msg.Params[7], msg.Params[8]
+	}
+	
+	// Our own users coming back around a loop, and users we already know
+	// through another path, are neither added nor passed on again
+	if len(uid) >= 3 && uid[:3] == s.network.LocalSID {
+		return fmt.Errorf("UID introduction for our own user %s", uid)
+	}
+	if _, known := s.network.GetUserByUID(uid); known {
+		s.logger.Debug("Ignoring UID for known user", "uid", uid, "from_server", fromServer.Name)
+		return nil
+	}
+	
+	// The user lives on the server its UID belongs to, which may sit
+	// behind the link the introduction arrived on
+	homeServer := fromServer
+	if len(uid) >= 3 {
+		if srv, ok := s.network.GetServer(uid[:3]); ok {
+			homeServer = srv
+		}
+	}
 	
 	// Add remote user to network
 	remoteUser := &linking.RemoteUser{
@@ -400,20 +814,101 @@ func (s *Server) handleLinkUID(msg *linking.Message, fromServer *linking.Server)
 		Nick:     nick,
 		User:     user,
 		Host:     host,
+		IP:       ip,
+		Modes:    modes,
 		RealName: realname,
-		Server:   fromServer,
+		Server:   homeServer,
 		Channels: make(map[string]bool),  // Initialize channels map
+		Timestamp: ts,
+		Hopcount: hopcount,
 	}
 	
-	s.network.AddUser(remoteUser)
+	if err := s.network.AddUser(remoteUser); err != nil {
+		s.logger.Warn("Rejected remote user", "nick", nick, "uid", uid, "from_server", fromServer.Name, "error", err)
+		return nil
+	}
+	s.resolveNickCollision(remoteUser)
 	s.logger.Info("Remote user registered", 
 		"nick", nick, 
 		"uid", uid, 
 		"from_server", fromServer.Name)
 	
+	// Pass the introduction on, one hop further away
+	forward := &linking.Message{Source: msg.Source, Command: msg.Command, Params: append([]string(nil), msg.Params...)}
+	forward.Params[1] = strconv.Itoa(hopcount + 1)
+	s.router.BroadcastToServers(forward, fromServer.SID)
+	
+	return nil
+}
+
+// handleLinkServer handles a SERVER introduction for a server linked behind fromServer
+func (s *Server) handleLinkServer(msg *linking.Message, fromServer *linking.Server) error {
+	name, hopcount, sid, description, err := linking.ParseServerIntro(msg)
+	if err != nil {
+		return fmt.Errorf("invalid SERVER: %v", err)
+	}
+	
+	if sid == s.network.LocalSID {
+		return fmt.Errorf("SERVER introduction for our own SID %s", sid)
+	}
+	if _, exists := s.network.GetServer(sid); exists {
+		return fmt.Errorf("SERVER introduction for known SID %s", sid)
+	}
+	
+	// The source names the server it is linked to; default to the link itself
+	uplink := fromServer
+	if msg.Source != "" {
+		if srv, ok := s.network.GetServer(msg.Source); ok {
+			uplink = srv
+		}
+	}
+	
+	server := &linking.Server{
+		SID:         sid,
+		Name:        name,
+		Description: description,
+		Uplink:      uplink,
+		Distance:    hopcount,
+		Users:       make(map[string]*linking.RemoteUser),
+		Channels:    make(map[string]*linking.RemoteChannel),
+	}
+	if err := s.network.AddServer(server); err != nil {
+		return err
+	}
+	
+	s.logger.Info("Remote server introduced", "name", name, "sid", sid, "uplink", uplink.Name, "distance", hopcount)
+	
+	// Pass the introduction on, one hop further away
+	forward := linking.BuildServerIntro(uplink.SID, name, hopcount+1, sid, description)
+	s.router.BroadcastToServers(forward, fromServer.SID)
 	return nil
 }
 
+// introduceNewLink tells existing links about a newly linked server and
+// tells the new server about every other server we know of
+func (s *Server) introduceNewLink(link *linking.Link, server *linking.Server) {
+	intro := linking.BuildServerIntro(s.network.LocalSID, server.Name, server.Distance+1, server.SID, server.Description)
+	s.router.BroadcastToServers(intro, server.SID)
+	
+	// Uplinks must be introduced before the servers behind them
+	known := s.network.GetServers()
+	sort.Slice(known, func(i, j int) bool { return known[i].Distance < known[j].Distance })
+	for _, srv := range known {
+		if srv == server {
+			continue
+		}
+		source := s.network.LocalSID
+		if srv.Uplink != nil {
+			source = srv.Uplink.SID
+		}
+		msg := linking.BuildServerIntro(source, srv.Name, srv.Distance+1, srv.SID, srv.Description)
+		if err := link.WriteMessage(msg); err != nil {
+			s.logger.Error("Failed to introduce server", "name", srv.Name, "to", server.Name, "error", err)
+			return
+		}
+	}
+}
+
 // handleLinkPrivmsg handles PRIVMSG/NOTICE from remote servers
 func (s *Server) handleLinkPrivmsg(msg *linking.Message, fromServer *linking.Server) error {
 	if len(msg.Params) < 2 {
@@ -462,6 +957,9 @@ func (s *Server) handleLinkPrivmsg(msg *linking.Message, fromServer *linking.Ser
 	
 	// Check if target is a channel
 	if len(target) > 0 && (target[0] == '#' || target[0] == '&') {
+		// Relay to members behind our other links, one copy per link
+		s.router.RouteToChannelServers(target, msg, fromServer.SID)
+		
 		// Channel message - deliver to local members
 		s.mu.RLock()
 		ch := s.channels[target]
@@ -506,6 +1004,13 @@ func (s *Server) handleLinkPrivmsg(msg *linking.Message, fromServer *linking.Ser
 		return fmt.Errorf("target %s not found locally", target)
 	}
 	
+	// Caller ID (+g) applies to remote senders too
+	if !s.handler.CallerIDAllows(targetClient, sourceUserObj.Nick, sourceUserObj.User+"@"+sourceUserObj.Host) {
+		s.logger.Debug("Remote message blocked by caller ID",
+			"from", sourceUserObj.Nick, "to", targetClient.GetNickname())
+		return nil
+	}
+	
 	// Format and deliver message
 	msgText := fmt.Sprintf(":%s!%s@%s %s %s :%s",
 		sourceUserObj.Nick, sourceUserObj.User, sourceUserObj.Host,
@@ -535,6 +1040,9 @@ func (s *Server) handleLinkJoin(msg *linking.Message, fromServer *linking.Server
 		return fmt.Errorf("unknown user %s", sourceUID)
 	}
 	
+	// Pass it on so servers further away know who is in the channel
+	s.router.BroadcastToServers(msg, fromServer.SID)
+	
 	// Update network state: add user to channel
 	// Note: user.Channels is protected by Network.mu in other operations
 	sourceUser.Channels[channel] = true
@@ -599,6 +1107,9 @@ func (s *Server) handleLinkPart(msg *linking.Message, fromServer *linking.Server
 		return fmt.Errorf("unknown user %s", sourceUID)
 	}
 	
+	// Pass it on to servers further away
+	s.router.BroadcastToServers(msg, fromServer.SID)
+	
 	// Update network state: remove user from channel
 	delete(sourceUser.Channels, channel)
 	if remoteChan, exists := s.network.GetChannel(channel); exists {
@@ -649,6 +1160,9 @@ func (s *Server) handleLinkQuit(msg *linking.Message, fromServer *linking.Server
 		return fmt.Errorf("unknown user %s", sourceUID)
 	}
 	
+	// Pass it on so servers further away forget the user too
+	s.router.BroadcastToServers(msg, fromServer.SID)
+	
 	// Broadcast QUIT to all local channels that have this remote user
 	quitNotice := fmt.Sprintf(":%s!%s@%s QUIT :%s",
 		sourceUser.Nick, sourceUser.User, sourceUser.Host, quitMsg)
@@ -664,6 +1178,7 @@ func (s *Server) handleLinkQuit(msg *linking.Message, fromServer *linking.Server
 	s.mu.RUnlock()
 	
 	// Remove user from network state
+	s.handler.ForgetAccepted(sourceUser.Nick)
 	s.network.RemoveUser(sourceUID)
 	
 	s.logger.Debug("Delivered remote QUIT and removed user",
@@ -688,7 +1203,27 @@ func (s *Server) handleLinkNick(msg *linking.Message, fromServer *linking.Server
 		return fmt.Errorf("unknown user %s", sourceUID)
 	}
 	
+	// Pass it on to servers further away
+	s.router.BroadcastToServers(msg, fromServer.SID)
+	
+	// The nick TS travels with the change; older peers don't send one
+	ts := time.Now().Unix()
+	if len(msg.Params) > 1 {
+		if parsed, err := strconv.ParseInt(msg.Params[1], 10, 64); err == nil {
+			ts = parsed
+		}
+	}
+	
 	oldNick := sourceUser.Nick
+	if err := s.network.UpdateNick(sourceUID, newNick, ts); err != nil {
+		s.logger.Warn("Rejected remote NICK", "uid", sourceUID, "nick", newNick, "error", err)
+		return nil
+	}
+	// ACCEPT entries are by nick and don't follow the user to a new one
+	if !strings.EqualFold(oldNick, newNick) {
+		s.handler.ForgetAccepted(oldNick)
+	}
+	s.resolveNickCollision(sourceUser)
 	
 	// Broadcast NICK change to all local channels that have this remote user
 	nickNotice := fmt.Sprintf(":%s!%s@%s NICK :%s",
@@ -720,13 +1255,31 @@ func (s *Server) handleLinkMode(msg *linking.Message, fromServer *linking.Server
 	modeString := msg.Params[1]
 	sourceUID := msg.Source
 	
-	// Get source user info
-	sourceUser, ok := s.network.GetUserByUID(sourceUID)
-	if !ok {
-		s.logger.Debug("Unknown user setting MODE", "uid", sourceUID, "channel", channel)
-		return fmt.Errorf("unknown user %s", sourceUID)
+	// Pass the change on, arguments and all, to servers further away
+	s.router.BroadcastToServers(msg, fromServer.SID)
+	
+	// A UID target is a user mode change (e.g. a remote OPER)
+	if !strings.HasPrefix(channel, "#") && !strings.HasPrefix(channel, "&") {
+		return s.handleLinkUserMode(channel, modeString)
 	}
 	
+	// Get source user info; servers set modes too (flood bans)
+	source, err := s.linkSource(sourceUID)
+	if err != nil {
+		s.logger.Debug("Unknown source setting MODE", "source", sourceUID, "channel", channel)
+		return err
+	}
+	
+	// Mode arguments sit between the mode string and the trailing TS
+	var modeArgs []string
+	if len(msg.Params) > 3 {
+		modeArgs = msg.Params[2 : len(msg.Params)-1]
+	}
+	
+	// Status is tracked in the network state whether or not anyone here
+	// is in the channel; later remote KICKs are checked against it
+	s.applyRemoteStatusModes(channel, modeString, modeArgs)
+	
 	// Check if we have local members in this channel
 	s.mu.RLock()
 	ch, exists := s.channels[channel]
@@ -735,29 +1288,166 @@ func (s *Server) handleLinkMode(msg *linking.Message, fromServer *linking.Server
 	if !exists {
 		// No local users in this channel, nothing to do
 		s.logger.Debug("Remote MODE on channel with no local users",
-			"user", sourceUser.Nick, "channel", channel)
+			"source", source, "channel", channel)
 		return nil
 	}
 	
+	// Apply simple flag modes so local checks match the network
+	applyRemoteFlagModes(ch, modeString)
+	applyRemoteParamModes(ch, modeString, modeArgs)
+	
 	// Broadcast MODE to all local members
-	modeMsg := fmt.Sprintf(":%s!%s@%s MODE %s %s",
-		sourceUser.Nick, sourceUser.User, sourceUser.Host, channel, modeString)
+	modeMsg := fmt.Sprintf(":%s MODE %s %s", source, channel,
+		strings.Join(append([]string{modeString}, modeArgs...), " "))
 	ch.BroadcastAll(modeMsg)
 	
+	// A permanent channel kept while empty goes away once it loses +P
+	if ch.IsEmpty() {
+		s.RemoveChannel(channel)
+	}
+	
 	s.logger.Debug("Delivered remote MODE",
-		"user", sourceUser.Nick, "channel", channel, "mode", modeString)
+		"source", source, "channel", channel, "mode", modeString)
+	
+	return nil
+}
+
+// handleLinkUserMode applies a remote user's mode change. Only +o is tracked,
+// so WHOIS and LUSERS can report remote operators.
+func (s *Server) handleLinkUserMode(target, modeString string) error {
+	user, ok := s.network.GetUserByUID(target)
+	if !ok {
+		return fmt.Errorf("unknown user %s", target)
+	}
+	
+	adding := true
+	for _, m := range modeString {
+		switch m {
+		case '+':
+			adding = true
+		case '-':
+			adding = false
+		case 'o':
+			user.SetMode('o', adding)
+		}
+	}
 	
+	s.logger.Debug("Remote user MODE", "nick", user.Nick, "mode", modeString)
 	return nil
 }
 
+// remoteFlagModes are the parameterless channel modes applied from remote MODE
+const remoteFlagModes = "CDMPimnpst"
+
+// applyRemoteFlagModes applies the parameterless modes of a remote mode string
+// to a local channel. Modes with parameters are only relayed.
+func applyRemoteFlagModes(ch *channel.Channel, modeString string) {
+	adding := true
+	for _, m := range modeString {
+		switch {
+		case m == '+':
+			adding = true
+		case m == '-':
+			adding = false
+		case strings.ContainsRune(remoteFlagModes, m):
+			ch.SetMode(m, adding)
+		}
+	}
+}
+
+// applyRemoteParamModes applies a remote +j/-j, +T/-T and +l/-l to a local
+// channel, walking the mode arguments the same way the local MODE handler
+// consumes them.
+func applyRemoteParamModes(ch *channel.Channel, modeString string, args []string) {
+	adding := true
+	argIndex := 0
+	for _, m := range modeString {
+		switch {
+		case m == '+':
+			adding = true
+		case m == '-':
+			adding = false
+		case m == 'j' && !adding:
+			ch.SetJoinThrottle(0, 0)
+			ch.SetMode('j', false)
+		case m == 'j':
+			if argIndex >= len(args) {
+				return
+			}
+			joins, seconds, ok := commands.ParseFloodParam(args[argIndex])
+			argIndex++
+			if ok {
+				ch.SetJoinThrottle(joins, seconds)
+				ch.SetMode('j', true)
+			}
+		case m == 'T' && !adding:
+			ch.SetTopicThrottle(0, 0)
+			ch.SetMode('T', false)
+		case m == 'T':
+			if argIndex >= len(args) {
+				return
+			}
+			changes, seconds, ok := commands.ParseFloodParam(args[argIndex])
+			argIndex++
+			if ok {
+				ch.SetTopicThrottle(changes, seconds)
+				ch.SetMode('T', true)
+			}
+		case m == 'l' && !adding:
+			ch.SetLimit(0)
+			ch.SetMode('l', false)
+		case m == 'l':
+			if argIndex >= len(args) {
+				return
+			}
+			limit, err := strconv.Atoi(args[argIndex])
+			argIndex++
+			if err == nil && limit > 0 {
+				ch.SetLimit(limit)
+				ch.SetMode('l', true)
+			}
+		case strings.ContainsRune("qaohvbeI", m), adding && strings.ContainsRune("kf", m):
+			argIndex++
+		}
+	}
+}
+
+// applyRemoteStatusModes records status changes (q, a, o, h, v) of remote
+// users in the network channel state, so later remote KICKs can be checked
+func (s *Server) applyRemoteStatusModes(channel, modeString string, args []string) {
+	remoteChan, ok := s.network.GetChannel(channel)
+	if !ok {
+		return
+	}
+	
+	adding := true
+	argIndex := 0
+	for _, m := range modeString {
+		switch {
+		case m == '+':
+			adding = true
+		case m == '-':
+			adding = false
+		case strings.ContainsRune("qaohv", m):
+			if argIndex >= len(args) {
+				return
+			}
+			if user, ok := s.network.GetUserByNick(args[argIndex]); ok {
+				remoteChan.SetMemberStatus(user.UID, m, adding)
+			}
+			argIndex++
+		case strings.ContainsRune("beI", m), adding && strings.ContainsRune("kfjlT", m):
+			argIndex++
+		}
+	}
+}
+
 // handleLinkTopic handles TOPIC from remote servers (Phase 7.4.4)
 func (s *Server) handleLinkTopic(msg *linking.Message, fromServer *linking.Server) error {
-	if len(msg.Params) < 2 {
-		return fmt.Errorf("invalid TOPIC: need at least 2 params")
+	channel, setter, ts, topic, err := linking.ParseTOPIC(msg)
+	if err != nil {
+		return fmt.Errorf("invalid TOPIC: %v", err)
 	}
-	
-	channel := msg.Params[0]
-	topic := msg.Params[1]
 	sourceUID := msg.Source
 	
 	// Get source user info
@@ -767,6 +1457,22 @@ func (s *Server) handleLinkTopic(msg *linking.Message, fromServer *linking.Serve
 		return fmt.Errorf("unknown user %s", sourceUID)
 	}
 	
+	// Servers without TOPICTS only send the topic; it was set just now
+	if setter == "" {
+		setter = fmt.Sprintf("%s!%s@%s", sourceUser.Nick, sourceUser.User, sourceUser.Host)
+		ts = time.Now().Unix()
+	}
+	
+	// Older topics never overwrite newer ones
+	if !s.network.SetChannelTopic(channel, topic, setter, ts) {
+		s.logger.Debug("Ignoring older remote TOPIC", "channel", channel, "ts", ts)
+		return nil
+	}
+	
+	// Pass it on to servers further away, in the format each understands
+	s.router.BroadcastByCapability("TOPICTS", linking.BuildTOPIC(sourceUID, channel, setter, ts, topic),
+		linking.BuildLegacyTOPIC(sourceUID, channel, topic), fromServer.SID)
+	
 	// Check if we have local members in this channel
 	s.mu.RLock()
 	ch, exists := s.channels[channel]
@@ -779,8 +1485,13 @@ func (s *Server) handleLinkTopic(msg *linking.Message, fromServer *linking.Serve
 		return nil
 	}
 	
-	// Update local channel topic
-	ch.SetTopic(topic)
+	if _, setAt := ch.GetTopicInfo(); ts < setAt.Unix() {
+		s.logger.Debug("Ignoring older remote TOPIC", "channel", channel, "ts", ts)
+		return nil
+	}
+	
+	// Update local channel topic, keeping the original setter and time
+	ch.SetTopicInfo(topic, setter, time.Unix(ts, 0))
 	
 	// Broadcast TOPIC to all local members
 	topicMsg := fmt.Sprintf(":%s!%s@%s TOPIC %s :%s",
@@ -788,7 +1499,7 @@ func (s *Server) handleLinkTopic(msg *linking.Message, fromServer *linking.Serve
 	ch.BroadcastAll(topicMsg)
 	
 	s.logger.Debug("Delivered remote TOPIC",
-		"user", sourceUser.Nick, "channel", channel)
+		"user", sourceUser.Nick, "channel", channel, "setter", setter)
 	
 	return nil
 }
@@ -804,11 +1515,31 @@ func (s *Server) handleLinkKick(msg *linking.Message, fromServer *linking.Server
 	reason := msg.Params[2]
 	sourceUID := msg.Source
 	
-	// Get source user info
-	sourceUser, ok := s.network.GetUserByUID(sourceUID)
-	if !ok {
-		s.logger.Debug("Unknown user KICKing", "uid", sourceUID, "channel", channel)
-		return fmt.Errorf("unknown user %s", sourceUID)
+	// Get source user info; servers kick too (flood kick-bans)
+	source, err := s.linkSource(sourceUID)
+	if err != nil {
+		s.logger.Debug("Unknown source KICKing", "source", sourceUID, "channel", channel)
+		return err
+	}
+	
+	// Only honour kicks from servers and from users the network state shows
+	// as channel operators (halfop or higher)
+	remoteChan, known := s.network.GetChannel(channel)
+	_, fromSrv := s.network.GetServer(sourceUID)
+	if !fromSrv && (!known || !remoteChan.IsMemberOp(sourceUID)) {
+		s.logger.Warn("Ignoring remote KICK from non-operator",
+			"kicker", source, "channel", channel, "target", targetNick, "from_server", fromServer.Name)
+		return nil
+	}
+	
+	// Pass the kick on to servers further away, and drop a remote target
+	// from the network channel state
+	s.router.BroadcastToServers(msg, fromServer.SID)
+	if target, ok := s.network.GetUserByNick(targetNick); ok {
+		delete(target.Channels, channel)
+		if known {
+			delete(remoteChan.Members, target.UID)
+		}
 	}
 	
 	// Check if we have local members in this channel
@@ -819,13 +1550,12 @@ func (s *Server) handleLinkKick(msg *linking.Message, fromServer *linking.Server
 	if !exists {
 		// No local users in this channel, nothing to do
 		s.logger.Debug("Remote KICK on channel with no local users",
-			"user", sourceUser.Nick, "channel", channel)
+			"kicker", source, "channel", channel)
 		return nil
 	}
 	
 	// Broadcast KICK to all local members
-	kickMsg := fmt.Sprintf(":%s!%s@%s KICK %s %s :%s",
-		sourceUser.Nick, sourceUser.User, sourceUser.Host, channel, targetNick, reason)
+	kickMsg := fmt.Sprintf(":%s KICK %s %s :%s", source, channel, targetNick, reason)
 	ch.BroadcastAll(kickMsg)
 	
 	// If the kicked user is local, remove them from the channel
@@ -841,11 +1571,23 @@ func (s *Server) handleLinkKick(msg *linking.Message, fromServer *linking.Server
 	}
 	
 	s.logger.Debug("Delivered remote KICK",
-		"kicker", sourceUser.Nick, "channel", channel, "target", targetNick)
+		"kicker", source, "channel", channel, "target", targetNick)
 	
 	return nil
 }
 
+// linkSource returns the prefix to show local clients for the source of a
+// remote message: nick!user@host for a user, the name for a server
+func (s *Server) linkSource(source string) (string, error) {
+	if user, ok := s.network.GetUserByUID(source); ok {
+		return fmt.Sprintf("%s!%s@%s", user.Nick, user.User, user.Host), nil
+	}
+	if srv, ok := s.network.GetServer(source); ok {
+		return srv.Name, nil
+	}
+	return "", fmt.Errorf("unknown source %s", source)
+}
+
 // handleLinkInvite handles INVITE from remote servers (Phase 7.4.4)
 func (s *Server) handleLinkInvite(msg *linking.Message, fromServer *linking.Server) error {
 	if len(msg.Params) < 2 {
@@ -875,6 +1617,13 @@ func (s *Server) handleLinkInvite(msg *linking.Message, fromServer *linking.Serv
 		return nil
 	}
 	
+	s.mu.RLock()
+	ch, exists := s.channels[channel]
+	s.mu.RUnlock()
+	if exists {
+		s.handler.AddInvite(ch, targetNick)
+	}
+	
 	// Send INVITE notification to target
 	inviteMsg := fmt.Sprintf(":%s!%s@%s INVITE %s %s",
 		sourceUser.Nick, sourceUser.User, sourceUser.Host, targetNick, channel)
@@ -886,6 +1635,140 @@ func (s *Server) handleLinkInvite(msg *linking.Message, fromServer *linking.Serv
 	return nil
 }
 
+// handleLinkWallops delivers a remote WALLOPS to local +w users and passes
+// it on to the rest of the network
+func (s *Server) handleLinkWallops(msg *linking.Message, fromServer *linking.Server) error {
+	if len(msg.Params) < 1 {
+		return fmt.Errorf("invalid WALLOPS: need 1 param")
+	}
+	
+	// Servers may send WALLOPS too; fall back to the raw source
+	source := msg.Source
+	if sourceUser, ok := s.network.GetUserByUID(msg.Source); ok {
+		source = fmt.Sprintf("%s!%s@%s", sourceUser.Nick, sourceUser.User, sourceUser.Host)
+	}
+	
+	s.handler.SendWallops(source, msg.Params[0])
+	s.router.BroadcastToServers(msg, fromServer.SID)
+	return nil
+}
+
+// handleLinkAway records a remote user going away or coming back and passes
+// it on to the rest of the network
+func (s *Server) handleLinkAway(msg *linking.Message, fromServer *linking.Server) error {
+	user, ok := s.network.GetUserByUID(msg.Source)
+	if !ok {
+		return fmt.Errorf("unknown user %s", msg.Source)
+	}
+	
+	message := ""
+	if len(msg.Params) > 0 {
+		message = msg.Params[0]
+	}
+	user.SetAway(message)
+	
+	s.router.BroadcastToServers(msg, fromServer.SID)
+	return nil
+}
+
+// handleLinkWallchops delivers a remote WALLCHOPS to the channel's local
+// operators and relays it to members behind our other links
+func (s *Server) handleLinkWallchops(msg *linking.Message, fromServer *linking.Server) error {
+	if len(msg.Params) < 2 {
+		return fmt.Errorf("invalid WALLCHOPS: need 2 params")
+	}
+	
+	source, err := s.linkSource(msg.Source)
+	if err != nil {
+		return fmt.Errorf("WALLCHOPS: %w", err)
+	}
+	
+	channel := msg.Params[0]
+	s.router.RouteToChannelServers(channel, msg, fromServer.SID)
+	
+	s.mu.RLock()
+	ch := s.channels[channel]
+	s.mu.RUnlock()
+	if ch != nil {
+		s.handler.SendWallchops(ch, source, msg.Params[1], nil)
+	}
+	return nil
+}
+
+// handleLinkSajoin handles an operator-forced JOIN for one of our users
+func (s *Server) handleLinkSajoin(msg *linking.Message, fromServer *linking.Server) error {
+	if len(msg.Params) < 2 {
+		return fmt.Errorf("invalid SAJOIN: need 2 params")
+	}
+	
+	// Only network operators may force users around
+	if !s.isRemoteOper(msg.Source) {
+		s.logger.Warn("Ignoring remote SAJOIN from non-operator",
+			"source", msg.Source, "from_server", fromServer.Name)
+		return nil
+	}
+	
+	targetUID := msg.Params[0]
+	channel := msg.Params[1]
+	
+	// Not ours - pass it along towards the user's server
+	if !s.router.IsUserLocal(targetUID) {
+		return s.router.RouteToUser(msg.Source, targetUID, msg)
+	}
+	
+	target := s.getClientByUID(targetUID)
+	if target == nil {
+		return fmt.Errorf("SAJOIN target %s not found locally", targetUID)
+	}
+	
+	s.handler.ForceJoin(target, channel)
+	s.logger.Info("Remote SAJOIN", "target", target.GetNickname(), "channel", channel, "from", fromServer.Name)
+	
+	return nil
+}
+
+// handleLinkSapart handles an operator-forced PART for one of our users
+func (s *Server) handleLinkSapart(msg *linking.Message, fromServer *linking.Server) error {
+	if len(msg.Params) < 2 {
+		return fmt.Errorf("invalid SAPART: need at least 2 params")
+	}
+	
+	// Only network operators may force users around
+	if !s.isRemoteOper(msg.Source) {
+		s.logger.Warn("Ignoring remote SAPART from non-operator",
+			"source", msg.Source, "from_server", fromServer.Name)
+		return nil
+	}
+	
+	targetUID := msg.Params[0]
+	channel := msg.Params[1]
+	reason := "Leaving"
+	if len(msg.Params) > 2 {
+		reason = msg.Params[2]
+	}
+	
+	// Not ours - pass it along towards the user's server
+	if !s.router.IsUserLocal(targetUID) {
+		return s.router.RouteToUser(msg.Source, targetUID, msg)
+	}
+	
+	target := s.getClientByUID(targetUID)
+	if target == nil {
+		return fmt.Errorf("SAPART target %s not found locally", targetUID)
+	}
+	
+	s.handler.ForcePart(target, channel, reason)
+	s.logger.Info("Remote SAPART", "target", target.GetNickname(), "channel", channel, "from", fromServer.Name)
+	
+	return nil
+}
+
+// isRemoteOper reports whether uid is a known remote user with operator status
+func (s *Server) isRemoteOper(uid string) bool {
+	user, ok := s.network.GetUserByUID(uid)
+	return ok && user.HasMode('o')
+}
+
 // handleLinkSquit handles SQUIT from remote servers (Phase 7.4.5)
 func (s *Server) handleLinkSquit(msg *linking.Message, fromServer *linking.Server) error {
 	if len(msg.Params) < 1 {
@@ -907,6 +1790,9 @@ func (s *Server) handleLinkSquit(msg *linking.Message, fromServer *linking.Serve
 		return nil
 	}
 	
+	// Servers further away lose the split server as well
+	s.router.BroadcastToServers(msg, fromServer.SID)
+	
 	// Clean up state from the disconnected server
 	s.cleanupDisconnectedServer(server, reason)
 	
@@ -927,6 +1813,11 @@ func (s *Server) handleLinkSquit(msg *linking.Message, fromServer *linking.Serve
 func (s *Server) cleanupDisconnectedServer(server *linking.Server, reason string) {
 	s.logger.Info("Cleaning up disconnected server", "server", server.Name, "sid", server.SID)
 	
+	// Servers behind this one are lost with it
+	for _, downlink := range server.GetDownlinks() {
+		s.cleanupDisconnectedServer(downlink, reason)
+	}
+	
 	// Get all users from the disconnected server
 	remoteUsers := s.network.GetUsersBySID(server.SID)
 	
@@ -956,6 +1847,7 @@ func (s *Server) cleanupDisconnectedServer(server *linking.Server, reason string
 		s.mu.RUnlock()
 		
 		// Remove the user from network state
+		s.handler.ForgetAccepted(remoteUser.Nick)
 		s.network.RemoveUser(remoteUser.UID)
 	}
 	
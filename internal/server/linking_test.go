@@ -0,0 +1,1740 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/supamanluva/ircd/internal/client"
+	"github.com/supamanluva/ircd/internal/commands"
+	"github.com/supamanluva/ircd/internal/linking"
+	"github.com/supamanluva/ircd/internal/logger"
+	"github.com/supamanluva/ircd/internal/parser"
+)
+
+func newLinkingTestServer(t *testing.T) *Server {
+	t.Helper()
+	srv, err := New(&Config{
+		ServerName:     "hub.test",
+		LinkingEnabled: true,
+		ServerID:       "0AA",
+	}, logger.New())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return srv
+}
+
+func TestSJOINLowerTSDeopsLocalMembers(t *testing.T) {
+	srv := newLinkingTestServer(t)
+	log := logger.New()
+
+	alice := client.NewMock(log)
+	alice.SetNickname("alice")
+	bob := client.NewMock(log)
+	bob.SetNickname("bob")
+
+	ch := srv.CreateChannel("#test")
+	ch.SetCreatedAt(time.Unix(1000, 0))
+	ch.AddMember(alice)
+	ch.AddMember(bob)
+	ch.SetOperator(alice, true)
+
+	// Remote op known from an earlier SJOIN at the same (higher) TS
+	remote := &linking.Server{SID: "1BB", Name: "leaf.test"}
+	srv.network.AddServer(remote)
+	srv.network.AddUser(&linking.RemoteUser{UID: "1BBAAAAAA", Nick: "carol", Server: remote, Channels: map[string]bool{}})
+	srv.network.AddChannel(&linking.RemoteChannel{Name: "#test", TS: 1000, Members: map[string]string{"1BBAAAAAA": "@"}})
+	alice.SentMessages()
+	bob.SentMessages()
+
+	state := &linking.BurstState{InProgress: true}
+	link := linking.NewLink(nil)
+	sjoin := linking.BuildSJOIN("1BB", "#test", 500, "+nt", map[string]string{"1BBAAAAAB": ""})
+	if err := link.HandleBurstMessage(srv.network, sjoin, state); err != nil {
+		t.Fatalf("HandleBurstMessage failed: %v", err)
+	}
+	srv.syncBurstChannelModes(state)
+
+	if ch.IsOperator(alice) {
+		t.Error("alice should have lost ops to the lower TS")
+	}
+	if got := ch.GetCreatedAt().Unix(); got != 500 {
+		t.Errorf("channel TS = %d, want 500", got)
+	}
+
+	for _, c := range []*client.Client{alice, bob} {
+		msgs := strings.Join(c.SentMessages(), "\n")
+		if !strings.Contains(msgs, ":hub.test MODE #test -o alice") {
+			t.Errorf("%s missing local deop, got %q", c.GetNickname(), msgs)
+		}
+		if !strings.Contains(msgs, ":hub.test MODE #test -o carol") {
+			t.Errorf("%s missing remote deop, got %q", c.GetNickname(), msgs)
+		}
+	}
+}
+
+func TestSJOINHigherTSKeepsLocalOps(t *testing.T) {
+	srv := newLinkingTestServer(t)
+	log := logger.New()
+
+	alice := client.NewMock(log)
+	alice.SetNickname("alice")
+
+	ch := srv.CreateChannel("#test")
+	ch.SetCreatedAt(time.Unix(1000, 0))
+	ch.AddMember(alice)
+	ch.SetOperator(alice, true)
+	alice.SentMessages()
+
+	srv.applyChannelTS("#test", 2000, nil)
+
+	if !ch.IsOperator(alice) {
+		t.Error("alice should keep ops when our TS is older")
+	}
+	if msgs := alice.SentMessages(); len(msgs) != 0 {
+		t.Errorf("unexpected messages: %v", msgs)
+	}
+}
+
+func TestRemoteTOPICKeepsNewerTopic(t *testing.T) {
+	srv := newLinkingTestServer(t)
+	log := logger.New()
+
+	alice := client.NewMock(log)
+	alice.SetNickname("alice")
+	ch := srv.CreateChannel("#test")
+	ch.AddMember(alice)
+
+	remote := &linking.Server{SID: "1BB", Name: "leaf.test"}
+	srv.network.AddServer(remote)
+	srv.network.AddUser(&linking.RemoteUser{UID: "1BBAAAAAA", Nick: "carol", User: "c", Host: "leaf", Server: remote, Channels: map[string]bool{}})
+
+	newer := linking.BuildTOPIC("1BBAAAAAA", "#test", "carol!c@leaf", 2000, "newer topic")
+	if err := srv.handleLinkTopic(newer, remote); err != nil {
+		t.Fatalf("handleLinkTopic failed: %v", err)
+	}
+	if got := ch.GetTopic(); got != "newer topic" {
+		t.Fatalf("topic = %q, want %q", got, "newer topic")
+	}
+	setBy, setAt := ch.GetTopicInfo()
+	if setBy != "carol!c@leaf" || setAt.Unix() != 2000 {
+		t.Errorf("topic info = (%q, %d), want (carol!c@leaf, 2000)", setBy, setAt.Unix())
+	}
+
+	older := linking.BuildTOPIC("1BBAAAAAA", "#test", "dave!d@leaf", 1000, "older topic")
+	if err := srv.handleLinkTopic(older, remote); err != nil {
+		t.Fatalf("handleLinkTopic failed: %v", err)
+	}
+	if got := ch.GetTopic(); got != "newer topic" {
+		t.Errorf("older TOPIC overwrote topic: got %q", got)
+	}
+	if setBy, _ := ch.GetTopicInfo(); setBy != "carol!c@leaf" {
+		t.Errorf("setter = %q, want carol!c@leaf", setBy)
+	}
+
+	// A server without TOPICTS sends only the topic, set by the source now
+	legacy := linking.BuildLegacyTOPIC("1BBAAAAAA", "#test", "legacy topic")
+	if err := srv.handleLinkTopic(legacy, remote); err != nil {
+		t.Fatalf("handleLinkTopic failed: %v", err)
+	}
+	if got := ch.GetTopic(); got != "legacy topic" {
+		t.Errorf("legacy TOPIC not applied: got %q", got)
+	}
+	if setBy, setAt := ch.GetTopicInfo(); setBy != "carol!c@leaf" || time.Since(setAt) > time.Minute {
+		t.Errorf("legacy topic info = (%q, %v), want carol!c@leaf just now", setBy, setAt)
+	}
+}
+
+func TestRemoteMODEAppliesFlagModes(t *testing.T) {
+	srv := newLinkingTestServer(t)
+
+	alice := client.NewMock(logger.New())
+	alice.SetNickname("alice")
+	ch := srv.CreateChannel("#test")
+	ch.AddMember(alice)
+
+	remote := &linking.Server{SID: "1BB", Name: "leaf.test"}
+	srv.network.AddServer(remote)
+	srv.network.AddUser(&linking.RemoteUser{UID: "1BBAAAAAA", Nick: "carol", User: "c", Host: "leaf", Server: remote, Channels: map[string]bool{}})
+
+	mode := &linking.Message{Source: "1BBAAAAAA", Command: "MODE", Params: []string{"#test", "+Cb", "*!*@spam"}}
+	if err := srv.handleLinkMode(mode, remote); err != nil {
+		t.Fatalf("handleLinkMode failed: %v", err)
+	}
+	if !ch.HasMode('C') {
+		t.Error("remote +C was not applied to the local channel")
+	}
+
+	mode.Params = []string{"#test", "-C"}
+	if err := srv.handleLinkMode(mode, remote); err != nil {
+		t.Fatalf("handleLinkMode failed: %v", err)
+	}
+	if ch.HasMode('C') {
+		t.Error("remote -C was not applied to the local channel")
+	}
+}
+
+func TestRemoteMODEAppliesJoinThrottle(t *testing.T) {
+	srv := newLinkingTestServer(t)
+
+	alice := client.NewMock(logger.New())
+	alice.SetNickname("alice")
+	ch := srv.CreateChannel("#test")
+	ch.AddMember(alice)
+
+	remote := &linking.Server{SID: "1BB", Name: "leaf.test"}
+	srv.network.AddServer(remote)
+	srv.network.AddUser(&linking.RemoteUser{UID: "1BBAAAAAA", Nick: "carol", User: "c", Host: "leaf", Server: remote, Channels: map[string]bool{}})
+
+	// The +j argument follows the +b mask and precedes the TS
+	mode := &linking.Message{Source: "1BBAAAAAA", Command: "MODE", Params: []string{"#test", "+bj", "*!*@spam", "5:30", "1700000000"}}
+	if err := srv.handleLinkMode(mode, remote); err != nil {
+		t.Fatalf("handleLinkMode failed: %v", err)
+	}
+	if joins, seconds := ch.GetJoinThrottle(); !ch.HasMode('j') || joins != 5 || seconds != 30 {
+		t.Errorf("remote +j gave mode=%v %d:%d, want 5:30", ch.HasMode('j'), joins, seconds)
+	}
+
+	mode.Params = []string{"#test", "-j", "1700000001"}
+	if err := srv.handleLinkMode(mode, remote); err != nil {
+		t.Fatalf("handleLinkMode failed: %v", err)
+	}
+	if joins, _ := ch.GetJoinThrottle(); ch.HasMode('j') || joins != 0 {
+		t.Error("remote -j was not applied to the local channel")
+	}
+}
+
+func TestRemoteOperInWhoisAndLusers(t *testing.T) {
+	srv := newLinkingTestServer(t)
+
+	remote := &linking.Server{SID: "1BB", Name: "leaf.test", Description: "Leaf server", Distance: 1}
+	srv.network.AddServer(remote)
+
+	uid := linking.BuildUID("1BB", "carol", 1, "+io", "c", "leaf", "10.0.0.2", "1BBAAAAAA", "Carol", 1700000000)
+	if err := srv.handleLinkUID(uid, remote); err != nil {
+		t.Fatalf("handleLinkUID failed: %v", err)
+	}
+
+	alice := client.NewMock(logger.New())
+	alice.SetNickname("alice")
+	alice.SetRegistered(true)
+
+	run := func(line string) string {
+		msg, _ := parser.Parse(line)
+		if err := srv.handler.Handle(alice, msg); err != nil {
+			t.Fatalf("%s failed: %v", line, err)
+		}
+		return strings.Join(alice.SentMessages(), "\n")
+	}
+
+	whois := run("WHOIS carol")
+	for _, want := range []string{
+		" 311 alice carol c leaf * :Carol",
+		" 312 alice carol leaf.test :Leaf server",
+		" 313 alice carol :is an IRC operator",
+		" 318 alice carol :End of WHOIS list",
+	} {
+		if !strings.Contains(whois, want) {
+			t.Errorf("WHOIS missing %q in:\n%s", want, whois)
+		}
+	}
+	if lusers := run("LUSERS"); !strings.Contains(lusers, " 252 alice 1 :operator(s) online") {
+		t.Errorf("LUSERS did not count the remote oper:\n%s", lusers)
+	}
+
+	// A remote -o is reflected locally
+	mode := &linking.Message{Source: "1BBAAAAAA", Command: "MODE", Params: []string{"1BBAAAAAA", "-o", "1700000001"}}
+	if err := srv.handleLinkMode(mode, remote); err != nil {
+		t.Fatalf("handleLinkMode failed: %v", err)
+	}
+	if whois := run("WHOIS carol"); strings.Contains(whois, " 313 ") {
+		t.Errorf("WHOIS still reports carol as an operator:\n%s", whois)
+	}
+}
+
+func TestRemoteKICKRequiresOperator(t *testing.T) {
+	srv := newLinkingTestServer(t)
+
+	alice := client.NewMock(logger.New())
+	alice.SetNickname("alice")
+	srv.clients["alice"] = alice
+	ch := srv.CreateChannel("#test")
+	ch.AddMember(alice)
+	alice.JoinChannel("#test")
+
+	remote := &linking.Server{SID: "1BB", Name: "leaf.test"}
+	srv.network.AddServer(remote)
+	srv.network.AddUser(&linking.RemoteUser{UID: "1BBAAAAAA", Nick: "carol", User: "c", Host: "leaf", Server: remote, Channels: map[string]bool{}})
+	srv.network.AddUser(&linking.RemoteUser{UID: "1BBAAAAAB", Nick: "dave", User: "d", Host: "leaf", Server: remote, Channels: map[string]bool{}})
+	srv.network.AddChannel(&linking.RemoteChannel{Name: "#test", TS: 1700000000, Members: map[string]string{"1BBAAAAAA": "@", "1BBAAAAAB": ""}})
+
+	kick := func(sourceUID string) {
+		msg := &linking.Message{Source: sourceUID, Command: "KICK", Params: []string{"#test", "alice", "bye"}}
+		if err := srv.handleLinkKick(msg, remote); err != nil {
+			t.Fatalf("handleLinkKick failed: %v", err)
+		}
+	}
+
+	kick("1BBAAAAAB")
+	if !ch.HasMember(alice) {
+		t.Fatal("KICK from a non-operator was applied")
+	}
+	if sent := alice.SentMessages(); len(sent) != 0 {
+		t.Errorf("KICK from a non-operator was broadcast: %q", sent)
+	}
+
+	// A remote +o recorded in the network state authorizes the kick
+	mode := &linking.Message{Source: "1BBAAAAAA", Command: "MODE", Params: []string{"#test", "+o", "dave", "1700000001"}}
+	if err := srv.handleLinkMode(mode, remote); err != nil {
+		t.Fatalf("handleLinkMode failed: %v", err)
+	}
+	kick("1BBAAAAAB")
+	if ch.HasMember(alice) {
+		t.Error("KICK from an operator was not applied")
+	}
+}
+
+func TestRemoteChannelStatusComesFromMode(t *testing.T) {
+	srv := newLinkingTestServer(t)
+
+	remote := &linking.Server{SID: "1BB", Name: "leaf.test"}
+	srv.network.AddServer(remote)
+	srv.network.AddUser(&linking.RemoteUser{UID: "1BBAAAAAA", Nick: "carol", User: "c", Host: "leaf", Server: remote, Channels: map[string]bool{}})
+	toB := pipeLink(t, srv, "1BB")
+
+	// Being first to JOIN a channel gives no status of its own
+	join := &linking.Message{Source: "1BBAAAAAA", Command: "JOIN", Params: []string{"#new", "1700000000"}}
+	if err := srv.handleLinkJoin(join, remote); err != nil {
+		t.Fatalf("handleLinkJoin failed: %v", err)
+	}
+	remoteChan, ok := srv.network.GetChannel("#new")
+	if !ok {
+		t.Fatal("remote JOIN did not create the network channel")
+	}
+	if remoteChan.IsMemberOp("1BBAAAAAA") {
+		t.Error("first remote JOIN was given operator status")
+	}
+
+	// A MODE records it even with nobody here in the channel
+	mode := &linking.Message{Source: "1BB", Command: "MODE", Params: []string{"#new", "+o", "carol", "1700000000"}}
+	if err := srv.handleLinkMode(mode, remote); err != nil {
+		t.Fatalf("handleLinkMode failed: %v", err)
+	}
+	if !remoteChan.IsMemberOp("1BBAAAAAA") {
+		t.Error("remote +o was not recorded in the network state")
+	}
+
+	// A local user creating a channel sends their status the same way
+	alice := client.NewMock(logger.New())
+	alice.SetNickname("alice")
+	alice.SetUsername("alice", "Alice")
+	alice.SetRegistered(true)
+	srv.AddClient(alice)
+	msg, _ := parser.Parse("JOIN #mine")
+	if err := srv.handler.Handle(alice, msg); err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+	for {
+		select {
+		case line := <-toB:
+			if strings.Contains(line, ":0AA MODE #mine +o alice") {
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatal("creator status was not sent over the link")
+		}
+	}
+}
+
+// pipeLink registers a link to sid whose outgoing lines are collected on
+// the returned channel
+func pipeLink(t *testing.T, srv *Server, sid string) chan string {
+	t.Helper()
+	local, remote := net.Pipe()
+	t.Cleanup(func() { remote.Close() })
+	link := linking.NewLink(local)
+	t.Cleanup(func() { link.Close() })
+	srv.linkRegistry.AddLink(sid, link)
+	lines := make(chan string, 10)
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, err := remote.Read(buf)
+			if err != nil {
+				return
+			}
+			lines <- string(buf[:n])
+		}
+	}()
+	return lines
+}
+
+// serverChain is leaf.test (1BB) - hub.test (0AA) - far.test (2CC). The
+// hub and far servers are real; lines between them are handed over by
+// relay, and what the hub sends the leaf is collected on toLeaf.
+type serverChain struct {
+	hub, far      *Server
+	leaf          *linking.Server // The leaf as the hub knows it
+	hubOnFar      *linking.Server // The hub as far knows it
+	farOnHub      *linking.Server // Far as the hub knows it
+	toLeaf, toFar chan string
+	toHub         chan string // Far's lines towards the hub
+}
+
+func newServerChain(t *testing.T) *serverChain {
+	t.Helper()
+	sc := &serverChain{hub: newLinkingTestServer(t)}
+	far, err := New(&Config{
+		ServerName:     "far.test",
+		LinkingEnabled: true,
+		ServerID:       "2CC",
+	}, logger.New())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	sc.far = far
+
+	sc.leaf = &linking.Server{SID: "1BB", Name: "leaf.test", Distance: 1}
+	sc.farOnHub = &linking.Server{SID: "2CC", Name: "far.test", Distance: 1}
+	sc.hub.network.AddServer(sc.leaf)
+	sc.hub.network.AddServer(sc.farOnHub)
+	sc.toLeaf = pipeLink(t, sc.hub, "1BB")
+	sc.toFar = pipeLink(t, sc.hub, "2CC")
+
+	sc.hubOnFar = &linking.Server{SID: "0AA", Name: "hub.test", Distance: 1}
+	far.network.AddServer(sc.hubOnFar)
+	far.network.AddServer(&linking.Server{SID: "1BB", Name: "leaf.test", Uplink: sc.hubOnFar, Distance: 2})
+	sc.toHub = pipeLink(t, far, "0AA")
+	return sc
+}
+
+// relay reads lines from one server's link and has to handle them as
+// arriving from from, until a line with command has been handled. It
+// returns everything that was read.
+func relay(t *testing.T, lines chan string, to *Server, from *linking.Server, command string) string {
+	t.Helper()
+	var read strings.Builder
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case chunk := <-lines:
+			read.WriteString(chunk)
+			for _, line := range strings.Split(strings.TrimSpace(chunk), "\r\n") {
+				msg, err := linking.ParseMessage(line)
+				if err != nil {
+					t.Fatalf("bad line %q: %v", line, err)
+				}
+				if to != nil {
+					to.handleLinkMessage(msg, from)
+				}
+				if msg.Command == command {
+					return read.String()
+				}
+			}
+		case <-deadline:
+			t.Fatalf("no %s was relayed, got %q", command, read.String())
+		}
+	}
+}
+
+// introduceLeafUser has the leaf introduce a user, which the hub passes on
+// to far
+func (sc *serverChain) introduceLeafUser(t *testing.T, uid, nick string, ts int64) {
+	t.Helper()
+	uidMsg := &linking.Message{Source: "1BB", Command: "UID", Params: []string{nick, "1", strconv.FormatInt(ts, 10), nick, "leaf", uid, nick}}
+	if err := sc.hub.handleLinkMessage(uidMsg, sc.leaf); err != nil {
+		t.Fatalf("handleLinkMessage failed: %v", err)
+	}
+	relay(t, sc.toFar, sc.far, sc.hubOnFar, "UID")
+	if _, ok := sc.far.network.GetUserByUID(uid); !ok {
+		t.Fatalf("far server did not learn of %s", nick)
+	}
+}
+
+func TestRemoteQUITAndNICKReachFarServer(t *testing.T) {
+	sc := newServerChain(t)
+	sc.introduceLeafUser(t, "1BBAAAAAA", "carol", 1700000000)
+
+	nick := &linking.Message{Source: "1BBAAAAAA", Command: "NICK", Params: []string{"carol2", "1700000100"}}
+	if err := sc.hub.handleLinkMessage(nick, sc.leaf); err != nil {
+		t.Fatalf("handleLinkMessage failed: %v", err)
+	}
+	relay(t, sc.toFar, sc.far, sc.hubOnFar, "NICK")
+	if _, ok := sc.far.network.GetUserByNick("carol2"); !ok {
+		t.Error("far server did not follow the NICK")
+	}
+
+	quit := &linking.Message{Source: "1BBAAAAAA", Command: "QUIT", Params: []string{"bye"}}
+	if err := sc.hub.handleLinkMessage(quit, sc.leaf); err != nil {
+		t.Fatalf("handleLinkMessage failed: %v", err)
+	}
+	relay(t, sc.toFar, sc.far, sc.hubOnFar, "QUIT")
+	if _, ok := sc.far.network.GetUserByUID("1BBAAAAAA"); ok {
+		t.Error("user two hops away is still known after QUIT")
+	}
+}
+
+func TestRemoteSQUITReachesFarServer(t *testing.T) {
+	sc := newServerChain(t)
+
+	// deep.test sits behind the leaf, three hops from far
+	intro := linking.BuildServerIntro("1BB", "deep.test", 2, "3DD", "Deep")
+	if err := sc.hub.handleLinkMessage(intro, sc.leaf); err != nil {
+		t.Fatalf("handleLinkMessage failed: %v", err)
+	}
+	relay(t, sc.toFar, sc.far, sc.hubOnFar, "SERVER")
+	uid := &linking.Message{Source: "3DD", Command: "UID", Params: []string{"erin", "2", "1700000000", "erin", "deep", "3DDAAAAAA", "Erin"}}
+	if err := sc.hub.handleLinkMessage(uid, sc.leaf); err != nil {
+		t.Fatalf("handleLinkMessage failed: %v", err)
+	}
+	relay(t, sc.toFar, sc.far, sc.hubOnFar, "UID")
+	if _, ok := sc.far.network.GetUserByUID("3DDAAAAAA"); !ok {
+		t.Fatal("far server did not learn of erin")
+	}
+
+	squit := linking.BuildSQUIT("1BB", "deep.test", "Connection lost")
+	if err := sc.hub.handleLinkMessage(squit, sc.leaf); err != nil {
+		t.Fatalf("handleLinkMessage failed: %v", err)
+	}
+	relay(t, sc.toFar, sc.far, sc.hubOnFar, "SQUIT")
+	if _, ok := sc.far.network.GetServer("3DD"); ok {
+		t.Error("far server still knows the split server")
+	}
+	if _, ok := sc.far.network.GetUserByUID("3DDAAAAAA"); ok {
+		t.Error("far server still knows a user of the split server")
+	}
+}
+
+func TestChannelMessageReachesMemberTwoHopsAway(t *testing.T) {
+	sc := newServerChain(t)
+	sc.introduceLeafUser(t, "1BBAAAAAA", "carol", 1700000000)
+
+	dave := client.NewMock(logger.New())
+	dave.SetNickname("dave")
+	dave.SetUsername("dave", "Dave")
+	dave.SetRegistered(true)
+	sc.far.AddClient(dave)
+	send := func(line string) {
+		msg, _ := parser.Parse(line)
+		if err := sc.far.handler.Handle(dave, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	send("JOIN #test")
+
+	// carol's JOIN reaches far through the hub
+	join := &linking.Message{Source: "1BBAAAAAA", Command: "JOIN", Params: []string{"#test", "1700000000"}}
+	if err := sc.hub.handleLinkMessage(join, sc.leaf); err != nil {
+		t.Fatalf("handleLinkMessage failed: %v", err)
+	}
+	relay(t, sc.toFar, sc.far, sc.hubOnFar, "JOIN")
+	if got := strings.Join(dave.SentMessages(), "\n"); !strings.Contains(got, ":carol!carol@leaf JOIN #test") {
+		t.Errorf("far member not shown the JOIN: %q", got)
+	}
+
+	// So dave's message is routed through the hub to the leaf
+	send("PRIVMSG #test :hi carol")
+	relay(t, sc.toHub, sc.hub, sc.farOnHub, "PRIVMSG")
+	if got := relay(t, sc.toLeaf, nil, nil, "PRIVMSG"); !strings.Contains(got, " PRIVMSG #test :hi carol") {
+		t.Errorf("leaf was sent %q, want the PRIVMSG", got)
+	}
+}
+
+func TestChannelMessageNotEchoedInMesh(t *testing.T) {
+	srv := newLinkingTestServer(t)
+
+	// Triangle: we link directly to both 1BB and 2CC, which also link to each other
+	b := &linking.Server{SID: "1BB", Name: "b.test", Distance: 1}
+	c := &linking.Server{SID: "2CC", Name: "c.test", Distance: 1}
+	srv.network.AddServer(b)
+	srv.network.AddServer(c)
+	srv.network.AddUser(&linking.RemoteUser{UID: "1BBAAAAAA", Nick: "bob", User: "b", Host: "b", Server: b, Channels: map[string]bool{"#test": true}})
+	srv.network.AddUser(&linking.RemoteUser{UID: "2CCAAAAAA", Nick: "carol", User: "c", Host: "c", Server: c, Channels: map[string]bool{"#test": true}})
+	srv.network.AddChannel(&linking.RemoteChannel{Name: "#test", TS: 1700000000, Members: map[string]string{"1BBAAAAAA": "", "2CCAAAAAA": ""}})
+
+	// Count what each link is sent
+	received := map[string]chan string{}
+	for _, sid := range []string{"1BB", "2CC"} {
+		received[sid] = pipeLink(t, srv, sid)
+	}
+
+	alice := client.NewMock(logger.New())
+	alice.SetNickname("alice")
+	ch := srv.CreateChannel("#test")
+	ch.AddMember(alice)
+
+	privmsg := &linking.Message{Source: "2CCAAAAAA", Command: "PRIVMSG", Params: []string{"#test", "hello"}}
+
+	// The original arrives from carol's server and is relayed to 1BB only
+	if err := srv.handleLinkMessage(privmsg, c); err != nil {
+		t.Fatalf("handleLinkMessage failed: %v", err)
+	}
+	// 1BB relays it back to us: it must be neither delivered nor forwarded
+	if err := srv.handleLinkMessage(privmsg, b); err != nil {
+		t.Fatalf("handleLinkMessage failed: %v", err)
+	}
+	// Our own user's message coming back is dropped as well
+	own := &linking.Message{Source: "0AAAAAAAA", Command: "PRIVMSG", Params: []string{"#test", "mine"}}
+	if err := srv.handleLinkMessage(own, b); err != nil {
+		t.Fatalf("handleLinkMessage failed: %v", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if sent := alice.SentMessages(); len(sent) != 1 || !strings.HasSuffix(sent[0], "PRIVMSG #test :hello") {
+		t.Errorf("local member got %q, want the message once", sent)
+	}
+	if n := len(received["1BB"]); n != 1 {
+		t.Errorf("1BB was sent %d copies, want 1", n)
+	}
+	if n := len(received["2CC"]); n != 0 {
+		t.Errorf("message was echoed back to its origin %d times", n)
+	}
+}
+
+func TestMODEPropagatesAcceptedArguments(t *testing.T) {
+	srv := newLinkingTestServer(t)
+	b := &linking.Server{SID: "1BB", Name: "b.test", Distance: 1}
+	c := &linking.Server{SID: "2CC", Name: "c.test", Distance: 1}
+	srv.network.AddServer(b)
+	srv.network.AddServer(c)
+	srv.network.AddUser(&linking.RemoteUser{UID: "2CCAAAAAA", Nick: "carol", User: "c", Host: "c", Server: c, Channels: map[string]bool{"#test": true}})
+	toB := pipeLink(t, srv, "1BB")
+
+	alice := client.NewMock(logger.New())
+	alice.SetNickname("alice")
+	alice.SetRegistered(true)
+	ch := srv.CreateChannel("#test")
+	ch.AddMember(alice)
+	ch.SetOperator(alice, true)
+
+	// The +o for a non-member is refused; its argument must not shift onto +l
+	msg, _ := parser.Parse("MODE #test +ol nobody 10")
+	srv.handler.Handle(alice, msg)
+	select {
+	case line := <-toB:
+		if !strings.Contains(line, " MODE #test +l 10 ") {
+			t.Errorf("propagated %q, want +l 10", line)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("MODE was not propagated")
+	}
+
+	// A remote change keeps its arguments for local members and further links
+	alice.SentMessages()
+	mode := &linking.Message{Source: "2CCAAAAAA", Command: "MODE", Params: []string{"#test", "+k", "secret", "1700000000"}}
+	if err := srv.handleLinkMessage(mode, c); err != nil {
+		t.Fatalf("handleLinkMessage failed: %v", err)
+	}
+	if sent := alice.SentMessages(); len(sent) != 1 || sent[0] != ":carol!c@c MODE #test +k secret" {
+		t.Errorf("local member got %q, want the MODE with its key", sent)
+	}
+	select {
+	case line := <-toB:
+		if !strings.Contains(line, "MODE #test +k secret 1700000000") {
+			t.Errorf("forwarded %q, want the key and TS", line)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("remote MODE was not forwarded")
+	}
+}
+
+func TestFloodKickbanPropagates(t *testing.T) {
+	srv := newLinkingTestServer(t)
+	b := &linking.Server{SID: "1BB", Name: "b.test", Distance: 1}
+	srv.network.AddServer(b)
+	toB := pipeLink(t, srv, "1BB")
+
+	mallory := client.NewMock(logger.New())
+	mallory.SetNickname("mallory")
+	mallory.SetUsername("m", "Mallory")
+	mallory.SetRegistered(true)
+	srv.AddClient(mallory)
+	ch := srv.CreateChannel("#test")
+	ch.AddMember(mallory)
+	ch.SetOperator(mallory, false)
+	mallory.JoinChannel("#test")
+	ch.SetFloodLimit(2, 60)
+
+	for i := 0; i < 3; i++ {
+		msg, _ := parser.Parse("PRIVMSG #test :spam")
+		if err := srv.handler.Handle(mallory, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Links get a real ban and kick from this server, not a PART
+	var sent strings.Builder
+	deadline := time.After(time.Second)
+	for !strings.Contains(sent.String(), "KICK") {
+		select {
+		case line := <-toB:
+			sent.WriteString(line)
+		case <-deadline:
+			t.Fatalf("flood kick was not propagated, got %q", sent.String())
+		}
+	}
+	if !strings.Contains(sent.String(), ":0AA MODE #test +b mallory!m@test.host ") {
+		t.Errorf("expected the ban from our SID, got %q", sent.String())
+	}
+	if !strings.Contains(sent.String(), ":0AA KICK #test mallory :Channel flood") || strings.Contains(sent.String(), "PART") {
+		t.Errorf("expected a KICK from our SID, got %q", sent.String())
+	}
+
+	// A remote server's own kick reaches local members under its name
+	alice := client.NewMock(logger.New())
+	alice.SetNickname("alice")
+	alice.SetRegistered(true)
+	srv.AddClient(alice)
+	ch = srv.CreateChannel("#test")
+	ch.AddMember(alice)
+	alice.JoinChannel("#test")
+	kick := &linking.Message{Source: "1BB", Command: "KICK", Params: []string{"#test", "alice", "Channel flood (2 lines in 60s)"}}
+	if err := srv.handleLinkMessage(kick, b); err != nil {
+		t.Fatalf("handleLinkMessage failed: %v", err)
+	}
+	if got := alice.SentMessages(); len(got) != 1 || got[0] != ":b.test KICK #test alice :Channel flood (2 lines in 60s)" {
+		t.Errorf("local member got %q, want the server's KICK", got)
+	}
+	if ch.HasMember(alice) {
+		t.Error("kicked local member is still in the channel")
+	}
+}
+
+func TestISONAndUSERHOSTSeeRemoteUsers(t *testing.T) {
+	srv := newLinkingTestServer(t)
+
+	remote := &linking.Server{SID: "1BB", Name: "leaf.test"}
+	srv.network.AddServer(remote)
+	srv.network.AddUser(&linking.RemoteUser{UID: "1BBAAAAAA", Nick: "carol", User: "c", Host: "leaf", Modes: "+o", Server: remote, Channels: map[string]bool{}})
+
+	alice := client.NewMock(logger.New())
+	alice.SetNickname("alice")
+	alice.SetRegistered(true)
+
+	tests := []struct {
+		name    string
+		command string
+		want    string
+	}{
+		{"ISON remote nick", "ISON carol nobody", " 303 alice :carol"},
+		{"USERHOST remote nick", "USERHOST carol", " 302 alice :carol*=+c@leaf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, _ := parser.Parse(tt.command)
+			if err := srv.handler.Handle(alice, msg); err != nil {
+				t.Fatalf("Handle failed: %v", err)
+			}
+			sent := alice.SentMessages()
+			if len(sent) != 1 || !strings.HasSuffix(sent[0], tt.want) {
+				t.Errorf("got %q, want suffix %q", sent, tt.want)
+			}
+		})
+	}
+}
+
+func TestISONFollowsRemoteNick(t *testing.T) {
+	srv := newLinkingTestServer(t)
+
+	remote := &linking.Server{SID: "1BB", Name: "leaf.test"}
+	srv.network.AddServer(remote)
+	srv.network.AddUser(&linking.RemoteUser{UID: "1BBAAAAAA", Nick: "carol", User: "c", Host: "leaf", Server: remote, Channels: map[string]bool{}, Timestamp: 1700000000})
+
+	nick := &linking.Message{Source: "1BBAAAAAA", Command: "NICK", Params: []string{"carol2", "1700000100"}}
+	if err := srv.handleLinkMessage(nick, remote); err != nil {
+		t.Fatalf("handleLinkMessage failed: %v", err)
+	}
+
+	alice := client.NewMock(logger.New())
+	alice.SetNickname("alice")
+	alice.SetRegistered(true)
+	msg, _ := parser.Parse("ISON carol carol2")
+	if err := srv.handler.Handle(alice, msg); err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+	if sent := alice.SentMessages(); len(sent) != 1 || !strings.HasSuffix(sent[0], " 303 alice :carol2") {
+		t.Errorf("ISON after a remote NICK got %q, want only the new nick", sent)
+	}
+	if user, _ := srv.network.GetUserByUID("1BBAAAAAA"); user.Timestamp != 1700000100 {
+		t.Errorf("nick TS = %d, want the one from the NICK", user.Timestamp)
+	}
+}
+
+func TestCallerIDFollowsRemoteNick(t *testing.T) {
+	srv := newLinkingTestServer(t)
+
+	remote := &linking.Server{SID: "1BB", Name: "leaf.test"}
+	srv.network.AddServer(remote)
+	srv.network.AddUser(&linking.RemoteUser{UID: "1BBAAAAAA", Nick: "carol", User: "c", Host: "leaf", Server: remote, Channels: map[string]bool{}, Timestamp: 1700000000})
+	srv.network.AddUser(&linking.RemoteUser{UID: "1BBAAAAAB", Nick: "dave", User: "d", Host: "leaf", Server: remote, Channels: map[string]bool{}, Timestamp: 1600000000})
+
+	alice := client.NewMock(logger.New())
+	alice.SetNickname("alice")
+	alice.SetRegistered(true)
+	alice.SetMode('g', true)
+	alice.AddAccept("carol")
+	alice.AddAccept("carol2")
+	srv.AddClient(alice)
+
+	nick := func(newNick string) {
+		msg := &linking.Message{Source: "1BBAAAAAA", Command: "NICK", Params: []string{newNick, "1700000100"}}
+		if err := srv.handleLinkNick(msg, remote); err != nil {
+			t.Fatalf("handleLinkNick failed: %v", err)
+		}
+	}
+	privmsg := func(text string) bool {
+		alice.SentMessages()
+		msg := &linking.Message{Source: "1BBAAAAAA", Command: "PRIVMSG", Params: []string{"alice", text}}
+		if err := srv.handleLinkPrivmsg(msg, remote); err != nil {
+			t.Fatalf("handleLinkPrivmsg failed: %v", err)
+		}
+		for _, line := range alice.SentMessages() {
+			if strings.HasSuffix(line, "PRIVMSG alice :"+text) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// A NICK lost to an older user changes nothing
+	nick("dave")
+	if !privmsg("still carol") {
+		t.Error("rejected NICK dropped the sender's ACCEPT entry")
+	}
+
+	// The check uses the new nick, which alice accepted too
+	nick("carol2")
+	if !alice.IsAccepted("carol2") || alice.IsAccepted("carol") {
+		t.Errorf("ACCEPT list after a remote NICK = %v", alice.GetAcceptList())
+	}
+	if !privmsg("now carol2") {
+		t.Error("message under the accepted new nick was blocked")
+	}
+}
+
+func TestRemoteSAJOINRequiresOper(t *testing.T) {
+	srv := newLinkingTestServer(t)
+
+	remote := &linking.Server{SID: "1BB", Name: "leaf.test"}
+	srv.network.AddServer(remote)
+	srv.network.AddUser(&linking.RemoteUser{UID: "1BBAAAAAA", Nick: "carol", User: "c", Host: "leaf", Server: remote, Channels: map[string]bool{}})
+	srv.network.AddUser(&linking.RemoteUser{UID: "1BBAAAAAB", Nick: "dave", User: "d", Host: "leaf", Modes: "+o", Server: remote, Channels: map[string]bool{}})
+
+	alice := client.NewMock(logger.New())
+	alice.SetNickname("alice")
+	alice.SetUID("0AAAAAAAB")
+	alice.SetRegistered(true)
+	srv.AddClient(alice)
+
+	send := func(source, command string) {
+		msg := &linking.Message{Source: source, Command: command, Params: []string{"0AAAAAAAB", "#forced"}}
+		if err := srv.handleLinkMessage(msg, remote); err != nil {
+			t.Fatalf("%s from %s failed: %v", command, source, err)
+		}
+	}
+	inChannel := func() bool {
+		ch := srv.GetChannel("#forced")
+		return ch != nil && ch.HasMember(alice)
+	}
+
+	// Neither an ordinary user nor a bare server may force a join
+	for _, source := range []string{"1BBAAAAAA", "1BB", "1BBZZZZZZ"} {
+		send(source, "SAJOIN")
+		if inChannel() {
+			t.Fatalf("SAJOIN from %s was applied", source)
+		}
+	}
+	send("1BBAAAAAB", "SAJOIN")
+	if !inChannel() {
+		t.Fatal("SAJOIN from a remote operator was not applied")
+	}
+
+	send("1BBAAAAAA", "SAPART")
+	if !inChannel() {
+		t.Fatal("SAPART from a non-operator was applied")
+	}
+	send("1BBAAAAAB", "SAPART")
+	if inChannel() {
+		t.Error("SAPART from a remote operator was not applied")
+	}
+}
+
+func TestAwayOverLinks(t *testing.T) {
+	srv := newLinkingTestServer(t)
+	b := &linking.Server{SID: "1BB", Name: "leaf.test", Distance: 1}
+	srv.network.AddServer(b)
+	srv.network.AddUser(&linking.RemoteUser{UID: "1BBAAAAAA", Nick: "carol", User: "c", Host: "leaf", Server: b, Channels: map[string]bool{}})
+	toB := pipeLink(t, srv, "1BB")
+
+	alice := client.NewMock(logger.New())
+	alice.SetNickname("alice")
+	alice.SetUsername("alice", "Alice")
+	alice.SetRegistered(true)
+	srv.AddClient(alice)
+	send := func(line string) []string {
+		alice.SentMessages()
+		msg, _ := parser.Parse(line)
+		if err := srv.handler.Handle(alice, msg); err != nil {
+			t.Fatal(err)
+		}
+		return alice.SentMessages()
+	}
+
+	// A remote user's AWAY and OPER show up in USERHOST
+	away := &linking.Message{Source: "1BBAAAAAA", Command: "AWAY", Params: []string{"gone fishing"}}
+	if err := srv.handleLinkMessage(away, b); err != nil {
+		t.Fatalf("handleLinkMessage failed: %v", err)
+	}
+	oper := &linking.Message{Source: "1BBAAAAAA", Command: "MODE", Params: []string{"1BBAAAAAA", "+o"}}
+	if err := srv.handleLinkMessage(oper, b); err != nil {
+		t.Fatalf("handleLinkMessage failed: %v", err)
+	}
+	if sent := send("USERHOST carol"); len(sent) != 1 || !strings.HasSuffix(sent[0], " 302 alice :carol*=-c@leaf") {
+		t.Errorf("USERHOST for an away operator got %q", sent)
+	}
+	back := &linking.Message{Source: "1BBAAAAAA", Command: "AWAY"}
+	if err := srv.handleLinkMessage(back, b); err != nil {
+		t.Fatalf("handleLinkMessage failed: %v", err)
+	}
+	if sent := send("USERHOST carol"); len(sent) != 1 || !strings.HasSuffix(sent[0], " 302 alice :carol*=+c@leaf") {
+		t.Errorf("USERHOST after coming back got %q", sent)
+	}
+
+	// A local AWAY is sent to the other servers
+	send("AWAY :out to lunch")
+	var sent strings.Builder
+	deadline := time.After(time.Second)
+	for !strings.Contains(sent.String(), "lunch") {
+		select {
+		case line := <-toB:
+			sent.WriteString(line)
+		case <-deadline:
+			t.Fatalf("AWAY was not propagated, got %q", sent.String())
+		}
+	}
+	if !strings.Contains(sent.String(), ":"+alice.GetUID()+" AWAY :out to lunch") {
+		t.Errorf("unexpected AWAY on the link: %q", sent.String())
+	}
+}
+
+func TestRemoteUIDNickCollision(t *testing.T) {
+	// Remote nick TS relative to the local one
+	tests := []struct {
+		name     string
+		offset   int64
+		wantNick string
+	}{
+		{"Older remote wins", -3600, "0AAAAAAAB"},
+		{"Newer remote loses", 3600, "alice"},
+		{"Tie renames both", 0, "0AAAAAAAB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newLinkingTestServer(t)
+
+			alice := client.NewMock(logger.New())
+			alice.SetNickname("alice")
+			alice.SetUID("0AAAAAAAB")
+			alice.SetRegistered(true)
+			if err := srv.AddClient(alice); err != nil {
+				t.Fatalf("AddClient failed: %v", err)
+			}
+			ch := srv.CreateChannel("#test")
+			ch.AddMember(alice)
+			alice.JoinChannel("#test")
+
+			remote := &linking.Server{SID: "1BB", Name: "leaf.test"}
+			srv.network.AddServer(remote)
+
+			uid := &linking.Message{Source: "1BB", Command: "UID", Params: []string{
+				"alice", "1", strconv.FormatInt(alice.GetNickTS()+tt.offset, 10), "a", "leaf", "1BBAAAAAA", "Remote Alice",
+			}}
+			if err := srv.handleLinkUID(uid, remote); err != nil {
+				t.Fatalf("handleLinkUID failed: %v", err)
+			}
+
+			if got := alice.GetNickname(); got != tt.wantNick {
+				t.Fatalf("local nick = %q, want %q", got, tt.wantNick)
+			}
+			if srv.GetClient(tt.wantNick) != alice {
+				t.Errorf("registry does not map %q to the local user", tt.wantNick)
+			}
+			if tt.wantNick != "alice" {
+				if srv.GetClient("alice") != nil {
+					t.Error("old nick is still registered locally")
+				}
+				sent := strings.Join(alice.SentMessages(), "\n")
+				if !strings.Contains(sent, ":alice NICK :0AAAAAAAB") {
+					t.Errorf("local user was not told about the nick change: %q", sent)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoteNICKNickCollision(t *testing.T) {
+	// Remote nick TS relative to the local one
+	tests := []struct {
+		name     string
+		offset   int64
+		wantNick string
+	}{
+		{"Older remote wins", -3600, "0AAAAAAAB"},
+		{"Newer remote loses", 3600, "alice"},
+		{"Tie renames both", 0, "0AAAAAAAB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newLinkingTestServer(t)
+
+			alice := client.NewMock(logger.New())
+			alice.SetNickname("alice")
+			alice.SetUID("0AAAAAAAB")
+			alice.SetRegistered(true)
+			if err := srv.AddClient(alice); err != nil {
+				t.Fatalf("AddClient failed: %v", err)
+			}
+
+			remote := &linking.Server{SID: "1BB", Name: "leaf.test"}
+			srv.network.AddServer(remote)
+			srv.network.AddUser(&linking.RemoteUser{UID: "1BBAAAAAA", Nick: "carol", User: "c", Host: "leaf", Server: remote, Channels: map[string]bool{}, Timestamp: 1})
+
+			nick := &linking.Message{Source: "1BBAAAAAA", Command: "NICK", Params: []string{
+				"alice", strconv.FormatInt(alice.GetNickTS()+tt.offset, 10),
+			}}
+			if err := srv.handleLinkNick(nick, remote); err != nil {
+				t.Fatalf("handleLinkNick failed: %v", err)
+			}
+
+			if got := alice.GetNickname(); got != tt.wantNick {
+				t.Fatalf("local nick = %q, want %q", got, tt.wantNick)
+			}
+			if srv.GetClient(tt.wantNick) != alice {
+				t.Errorf("registry does not map %q to the local user", tt.wantNick)
+			}
+			if tt.wantNick != "alice" && srv.GetClient("alice") != nil {
+				t.Error("old nick is still registered locally")
+			}
+		})
+	}
+}
+
+func TestRemoteUIDRejectsLoopsAndDuplicates(t *testing.T) {
+	srv := newLinkingTestServer(t)
+	b := &linking.Server{SID: "1BB", Name: "b.test", Distance: 1}
+	srv.network.AddServer(b)
+	toB := pipeLink(t, srv, "1BB")
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+	uid := func(nick, id string) *linking.Message {
+		return &linking.Message{Source: "2CC", Command: "UID", Params: []string{nick, "1", ts, "u", "h", id, "Real"}}
+	}
+	forwarded := func() int {
+		time.Sleep(50 * time.Millisecond)
+		n := len(toB)
+		for len(toB) > 0 {
+			<-toB
+		}
+		return n
+	}
+
+	if err := srv.handleLinkUID(uid("carol", "2CCAAAAAA"), &linking.Server{SID: "2CC", Name: "c.test"}); err != nil {
+		t.Fatalf("handleLinkUID failed: %v", err)
+	}
+	if n := forwarded(); n != 1 {
+		t.Fatalf("new user was forwarded %d times, want 1", n)
+	}
+
+	// The same user arriving again along another path
+	if err := srv.handleLinkUID(uid("carol", "2CCAAAAAA"), b); err != nil {
+		t.Fatalf("handleLinkUID failed: %v", err)
+	}
+	// A different user losing the nick to carol
+	if err := srv.handleLinkUID(uid("carol", "2CCAAAAAB"), b); err != nil {
+		t.Fatalf("handleLinkUID failed: %v", err)
+	}
+	// One of our own users looped back to us
+	if err := srv.handleLinkUID(uid("alice", "0AAAAAAAA"), b); err == nil {
+		t.Error("UID for our own SID was accepted")
+	}
+	if _, ok := srv.network.GetUserByUID("0AAAAAAAA"); ok {
+		t.Error("our own user was added as a remote user")
+	}
+	if user, _ := srv.network.GetUserByNick("carol"); user == nil || user.UID != "2CCAAAAAA" {
+		t.Errorf("carol = %+v, want the first introduction to keep the nick", user)
+	}
+	if n := forwarded(); n != 0 {
+		t.Errorf("rejected introductions were forwarded %d times", n)
+	}
+}
+
+func TestShutdownStopsLinkGoroutines(t *testing.T) {
+	hub, err := New(&Config{
+		ServerName:     "hub.test",
+		LinkingEnabled: true,
+		LinkingHost:    "127.0.0.1",
+		LinkPassword:   "secret",
+		ServerID:       "0AA",
+	}, logger.New())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := hub.StartLinkListener(); err != nil {
+		t.Fatalf("StartLinkListener failed: %v", err)
+	}
+	port := hub.linkListener.Addr().(*net.TCPAddr).Port
+
+	leaf, err := New(&Config{
+		ServerName:     "leaf.test",
+		LinkingEnabled: true,
+		ServerID:       "1BB",
+	}, logger.New())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := leaf.ConnectToServer(LinkConfig{Name: "hub.test", SID: "0AA", Host: "127.0.0.1", Port: port, Password: "secret"}); err != nil {
+		t.Fatalf("ConnectToServer failed: %v", err)
+	}
+
+	waitForLinks := func(srv *Server, want int) bool {
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if srv.linkRegistry.GetLinkCount() == want {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return false
+	}
+	if !waitForLinks(hub, 1) {
+		t.Fatal("inbound link was never registered")
+	}
+
+	// Shutting down the leaf stops its outbound loop; the hub's inbound
+	// handler follows once the connection drops
+	leaf.Shutdown()
+	if !waitForLinks(leaf, 0) {
+		t.Error("outbound link goroutine did not exit after Shutdown")
+	}
+	if !waitForLinks(hub, 0) {
+		t.Error("inbound link goroutine did not exit after the peer shut down")
+	}
+
+	hub.Shutdown()
+	if _, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), time.Second); err == nil {
+		t.Error("link listener still accepting after Shutdown")
+	}
+}
+
+func TestMaxLinksRefusesExtraServer(t *testing.T) {
+	hub, err := New(&Config{
+		ServerName:     "hub.test",
+		LinkingEnabled: true,
+		LinkingHost:    "127.0.0.1",
+		LinkPassword:   "secret",
+		ServerID:       "0AA",
+		MaxLinks:       1,
+	}, logger.New())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := hub.StartLinkListener(); err != nil {
+		t.Fatalf("StartLinkListener failed: %v", err)
+	}
+	defer hub.Shutdown()
+	port := hub.linkListener.Addr().(*net.TCPAddr).Port
+
+	connect := func(name, sid string) error {
+		leaf, err := New(&Config{
+			ServerName:     name,
+			LinkingEnabled: true,
+			ServerID:       sid,
+		}, logger.New())
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		t.Cleanup(leaf.Shutdown)
+		return leaf.ConnectToServer(LinkConfig{Name: "hub.test", SID: "0AA", Host: "127.0.0.1", Port: port, Password: "secret"})
+	}
+
+	if err := connect("leaf1.test", "1BB"); err != nil {
+		t.Fatalf("first link failed: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.linkRegistry.GetLinkCount() != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := connect("leaf2.test", "2CC"); err == nil {
+		t.Fatal("second link was accepted beyond max_links")
+	}
+	if _, ok := hub.network.GetServer("2CC"); ok {
+		t.Error("refused server was added to the network")
+	}
+}
+
+func TestRemoteServerIntroductionDistance(t *testing.T) {
+	srv := newLinkingTestServer(t)
+
+	leaf := &linking.Server{SID: "1BB", Name: "leaf.test", Distance: 1}
+	srv.network.AddServer(leaf)
+
+	intro := linking.BuildServerIntro("1BB", "far.test", 2, "2CC", "Two hops away")
+	if err := srv.handleLinkMessage(intro, leaf); err != nil {
+		t.Fatalf("handleLinkMessage(SERVER) failed: %v", err)
+	}
+
+	far, ok := srv.network.GetServer("2CC")
+	if !ok {
+		t.Fatal("introduced server not added to the network")
+	}
+	if far.Distance != 2 {
+		t.Errorf("Distance = %d, want 2", far.Distance)
+	}
+	if far.Uplink != leaf {
+		t.Errorf("Uplink = %v, want leaf.test", far.Uplink)
+	}
+	if downlinks := leaf.GetDownlinks(); len(downlinks) != 1 || downlinks[0] != far {
+		t.Errorf("leaf.test downlinks = %v, want [far.test]", downlinks)
+	}
+
+	// A user on the far server is homed there, not on the link it came through
+	uid := &linking.Message{Source: "2CC", Command: "UID", Params: []string{
+		"carol", "2", "1000", "c", "far", "2CCAAAAAA", "Carol",
+	}}
+	if err := srv.handleLinkUID(uid, leaf); err != nil {
+		t.Fatalf("handleLinkUID failed: %v", err)
+	}
+	carol, ok := srv.network.GetUserByUID("2CCAAAAAA")
+	if !ok {
+		t.Fatal("remote user not added")
+	}
+	if carol.Server != far || carol.Hopcount != 2 {
+		t.Errorf("user server/hopcount = %s/%d, want far.test/2", carol.Server.Name, carol.Hopcount)
+	}
+
+	// Losing the leaf takes the server behind it along
+	srv.network.RemoveServer("1BB")
+	if _, ok := srv.network.GetServer("2CC"); ok {
+		t.Error("downlink survived removal of its uplink")
+	}
+}
+
+func TestThirdServerIntroducedToExistingLinks(t *testing.T) {
+	newServer := func(name, sid string) *Server {
+		srv, err := New(&Config{
+			ServerName:     name,
+			LinkingEnabled: true,
+			LinkingHost:    "127.0.0.1",
+			LinkPassword:   "secret",
+			ServerID:       sid,
+		}, logger.New())
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		t.Cleanup(srv.Shutdown)
+		return srv
+	}
+	waitForServer := func(srv *Server, sid string) *linking.Server {
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if known, ok := srv.network.GetServer(sid); ok {
+				return known
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return nil
+	}
+
+	hub := newServer("hub.test", "0AA")
+	if err := hub.StartLinkListener(); err != nil {
+		t.Fatalf("StartLinkListener failed: %v", err)
+	}
+	hubLink := LinkConfig{Name: "hub.test", SID: "0AA", Host: "127.0.0.1",
+		Port: hub.linkListener.Addr().(*net.TCPAddr).Port, Password: "secret"}
+
+	first := newServer("first.test", "1BB")
+	if err := first.ConnectToServer(hubLink); err != nil {
+		t.Fatalf("first ConnectToServer failed: %v", err)
+	}
+	if waitForServer(hub, "1BB") == nil {
+		t.Fatal("hub never registered the first server")
+	}
+
+	third := newServer("third.test", "2CC")
+	if err := third.ConnectToServer(hubLink); err != nil {
+		t.Fatalf("third ConnectToServer failed: %v", err)
+	}
+
+	// The first server hears about the new one through the hub
+	got := waitForServer(first, "2CC")
+	if got == nil {
+		t.Fatal("first server was never told about third.test")
+	}
+	if got.Distance != 2 || got.Uplink == nil || got.Uplink.SID != "0AA" {
+		t.Errorf("third.test as seen by first: distance %d, uplink %v; want 2 via hub.test", got.Distance, got.Uplink)
+	}
+
+	// And the new server learns about the first
+	got = waitForServer(third, "1BB")
+	if got == nil {
+		t.Fatal("third server was never told about first.test")
+	}
+	if got.Distance != 2 || got.Uplink == nil || got.Uplink.SID != "0AA" {
+		t.Errorf("first.test as seen by third: distance %d, uplink %v; want 2 via hub.test", got.Distance, got.Uplink)
+	}
+}
+
+func TestLusersReportsGlobalUsers(t *testing.T) {
+	srv := newLinkingTestServer(t)
+
+	remote := &linking.Server{SID: "1BB", Name: "leaf.test", Distance: 1}
+	srv.network.AddServer(remote)
+	for i, nick := range []string{"carol", "dave"} {
+		uid := "1BBAAAAA" + strconv.Itoa(i)
+		srv.network.AddUser(&linking.RemoteUser{UID: uid, Nick: nick, User: "u", Host: "leaf", Server: remote, Channels: map[string]bool{}})
+	}
+
+	alice := client.NewMock(logger.New())
+	alice.SetNickname("alice")
+	alice.SetRegistered(true)
+	srv.AddClient(alice)
+
+	msg, _ := parser.Parse("LUSERS")
+	if err := srv.handler.Handle(alice, msg); err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+
+	var local, global int
+	for _, line := range alice.SentMessages() {
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+		switch fields[1] {
+		case "265":
+			local, _ = strconv.Atoi(fields[3])
+		case "266":
+			global, _ = strconv.Atoi(fields[3])
+		case "251":
+			if !strings.HasSuffix(line, ":There are 3 users and 0 invisible on 2 servers") {
+				t.Errorf("RPL_LUSERCLIENT = %q", line)
+			}
+		}
+	}
+	if local != 1 {
+		t.Errorf("local users = %d, want 1", local)
+	}
+	if global != 3 {
+		t.Errorf("global users = %d, want 3", global)
+	}
+	if global <= local {
+		t.Error("global count does not exceed local count on a populated network")
+	}
+}
+
+func TestLinkedServerVersionInLinks(t *testing.T) {
+	srv := newLinkingTestServer(t)
+
+	leafNet := linking.NewNetwork("1BB", "leaf.test")
+	leafNet.LocalVersion = "ircd-leaf-2.0"
+
+	// A real socket, as net.Pipe's unbuffered writes would deadlock the handshake
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer ln.Close()
+	leafConn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer leafConn.Close()
+	hubConn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Accept failed: %v", err)
+	}
+	defer hubConn.Close()
+	hubLink := linking.NewLink(hubConn)
+	leafLink := linking.NewLink(leafConn)
+
+	leafErr := make(chan error, 1)
+	go func() {
+		leafErr <- leafLink.HandshakeClient(leafNet, "secret", "0AA", "hub.test")
+	}()
+	if err := hubLink.HandshakeServer(srv.network, "secret"); err != nil {
+		t.Fatalf("HandshakeServer failed: %v", err)
+	}
+	if err := <-leafErr; err != nil {
+		t.Fatalf("HandshakeClient failed: %v", err)
+	}
+
+	leaf := hubLink.GetServer()
+	if leaf.Version != "ircd-leaf-2.0" {
+		t.Errorf("hub sees leaf version %q, want ircd-leaf-2.0", leaf.Version)
+	}
+	if hub := leafLink.GetServer(); hub.Version != commands.ServerVersion() {
+		t.Errorf("leaf sees hub version %q, want %q", hub.Version, commands.ServerVersion())
+	}
+	srv.network.AddServer(leaf)
+
+	links := func(oper bool) string {
+		c := client.NewMock(logger.New())
+		c.SetNickname("alice")
+		c.SetRegistered(true)
+		c.SetMode('o', oper)
+		msg, _ := parser.Parse("LINKS")
+		if err := srv.handler.Handle(c, msg); err != nil {
+			t.Fatalf("LINKS failed: %v", err)
+		}
+		return strings.Join(c.SentMessages(), "\n")
+	}
+
+	if out := links(true); !strings.Contains(out, " 364 alice leaf.test hub.test :1 IRC Server [ircd-leaf-2.0] [lag ") {
+		t.Errorf("LINKS for an operator is missing the peer version:\n%s", out)
+	}
+	if out := links(false); strings.Contains(out, "ircd-leaf-2.0") {
+		t.Errorf("LINKS shows the peer version to a non-operator:\n%s", out)
+	}
+
+	// Servers behind the leaf are never pinged by us, so show no latency
+	srv.network.AddServer(&linking.Server{SID: "2CC", Name: "far.test", Description: "Far", Uplink: leaf, Distance: 2})
+	if out := links(true); !strings.Contains(out, " 364 alice far.test leaf.test :2 Far\n") {
+		t.Errorf("LINKS shows latency for a server behind another:\n%s", out)
+	}
+}
+
+func TestBurstChannelListsApplied(t *testing.T) {
+	srv := newLinkingTestServer(t)
+
+	alice := client.NewMock(logger.New())
+	alice.SetNickname("alice")
+	ch := srv.CreateChannel("#test")
+	ch.SetCreatedAt(time.Unix(1000, 0))
+	ch.AddMember(alice)
+	ch.AddBan("*!*@local.example")
+
+	// Our lists go out with the channel
+	for _, bc := range srv.GetBurstChannels() {
+		if bc.Name == "#test" && (len(bc.Bans) != 1 || bc.Bans[0] != "*!*@local.example") {
+			t.Errorf("burst bans = %v, want [*!*@local.example]", bc.Bans)
+		}
+	}
+
+	// A peer's lists for the same channel are merged in
+	srv.syncBurstChannelModes(&linking.BurstState{
+		ChanTS: map[string]int64{"#test": 1000},
+		Masks:  map[string]map[byte][]string{"#test": {'b': {"*!*@evil.example"}, 'q': {"loud!*@*"}}},
+	})
+	if bans := ch.GetBanList(); len(bans) != 2 {
+		t.Errorf("bans = %v, want the local and remote masks", bans)
+	}
+	if quiets := ch.GetQuietList(); len(quiets) != 1 {
+		t.Errorf("quiets = %v, want [loud!*@*]", quiets)
+	}
+	if out := strings.Join(alice.SentMessages(), "\n"); !strings.Contains(out, "MODE #test +b *!*@evil.example") {
+		t.Errorf("new ban not announced to local members:\n%s", out)
+	}
+
+	// Lists from a newer channel lost the TS merge
+	srv.syncBurstChannelModes(&linking.BurstState{
+		ChanTS: map[string]int64{"#test": 2000},
+		Masks:  map[string]map[byte][]string{"#test": {'b': {"*!*@late.example"}}},
+	})
+	if bans := ch.GetBanList(); len(bans) != 2 {
+		t.Errorf("bans = %v, masks from a newer channel should be ignored", bans)
+	}
+}
+
+func TestLinkBMASKAppliesMasks(t *testing.T) {
+	srv := newLinkingTestServer(t)
+
+	leaf := &linking.Server{SID: "1BB", Name: "leaf.test", Distance: 1}
+	srv.network.AddServer(leaf)
+
+	alice := client.NewMock(logger.New())
+	alice.SetNickname("alice")
+	ch := srv.CreateChannel("#test")
+	ch.SetCreatedAt(time.Unix(1000, 0))
+	ch.AddMember(alice)
+
+	bmask := linking.BuildBMASK("1BB", "#test", 1000, 'b', []string{"*!*@one.example", "*!*@two.example", "three!*@*"})
+	if err := srv.handleLinkMessage(bmask, leaf); err != nil {
+		t.Fatalf("handleLinkMessage(BMASK) failed: %v", err)
+	}
+	if bans := ch.GetBanList(); len(bans) != 3 {
+		t.Errorf("bans = %v, want all three masks", bans)
+	}
+	if out := strings.Join(alice.SentMessages(), "\n"); strings.Count(out, " MODE #test +b ") != 3 {
+		t.Errorf("expected three +b announcements, got:\n%s", out)
+	}
+
+	// A newer channel's masks lose to ours
+	late := linking.BuildBMASK("1BB", "#test", 2000, 'b', []string{"*!*@late.example"})
+	if err := srv.handleLinkMessage(late, leaf); err != nil {
+		t.Fatalf("handleLinkMessage(BMASK) failed: %v", err)
+	}
+	if bans := ch.GetBanList(); len(bans) != 3 {
+		t.Errorf("bans = %v, BMASK with a higher TS should be ignored", bans)
+	}
+}
+
+func TestWhoReportsRemoteServerAndHopcount(t *testing.T) {
+	srv := newLinkingTestServer(t)
+
+	leaf := &linking.Server{SID: "1BB", Name: "leaf.test", Distance: 1}
+	srv.network.AddServer(leaf)
+	intro := linking.BuildServerIntro("1BB", "far.test", 2, "2CC", "Two hops away")
+	if err := srv.handleLinkMessage(intro, leaf); err != nil {
+		t.Fatalf("handleLinkMessage(SERVER) failed: %v", err)
+	}
+	uid := &linking.Message{Source: "2CC", Command: "UID", Params: []string{
+		"carol", "2", "1000", "c", "far", "2CCAAAAAA", "Carol",
+	}}
+	if err := srv.handleLinkUID(uid, leaf); err != nil {
+		t.Fatalf("handleLinkUID failed: %v", err)
+	}
+	srv.network.AddChannel(&linking.RemoteChannel{Name: "#test", TS: 1000, Members: map[string]string{"2CCAAAAAA": "@"}})
+
+	alice := client.NewMock(logger.New())
+	alice.SetNickname("alice")
+	alice.SetRegistered(true)
+	run := func(line string) string {
+		msg, _ := parser.Parse(line)
+		if err := srv.handler.Handle(alice, msg); err != nil {
+			t.Fatalf("%s failed: %v", line, err)
+		}
+		return strings.Join(alice.SentMessages(), "\n")
+	}
+	run("JOIN #test")
+
+	who := run("WHO #test")
+	if !strings.Contains(who, " 352 alice #test c far far.test carol H@ :2 Carol") {
+		t.Errorf("WHO is missing carol on far.test at 2 hops:\n%s", who)
+	}
+	if !strings.Contains(who, " 352 alice #test ") || !strings.Contains(who, " hub.test alice ") {
+		t.Errorf("WHO is missing the local member:\n%s", who)
+	}
+}
+
+// newTLSLinkHub starts a hub whose only link port is TLS-only
+func newTLSLinkHub(t *testing.T) (*Server, string) {
+	t.Helper()
+	cert := selfSignedCert(t)
+	certFile, keyFile := writeCertFiles(t, t.TempDir(), cert)
+
+	hub, err := New(&Config{
+		ServerName:            "hub.test",
+		LinkingEnabled:        true,
+		LinkingHost:           "127.0.0.1",
+		LinkPassword:          "secret",
+		ServerID:              "0AA",
+		LinkTLSEnabled:        true,
+		LinkTLSCert:           certFile,
+		LinkTLSKey:            keyFile,
+		LinkPlaintextDisabled: true,
+	}, logger.New())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := hub.StartLinkListener(); err != nil {
+		t.Fatalf("StartLinkListener failed: %v", err)
+	}
+	t.Cleanup(hub.Shutdown)
+	if hub.linkListener != nil {
+		t.Fatal("plaintext link listener opened with disable_plaintext")
+	}
+
+	sum := sha256.Sum256(cert.Certificate[0])
+	return hub, hex.EncodeToString(sum[:])
+}
+
+func TestLinkTLSPortRejectsPlaintext(t *testing.T) {
+	hub, _ := newTLSLinkHub(t)
+
+	conn, err := net.Dial("tcp", hub.linkTLSListener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	// A plaintext server starts its handshake; the hub must hang up
+	// without ever answering in the link protocol
+	conn.Write([]byte("PASS secret TS 6 :1BB\r\nSERVER leaf.test 1 :Leaf\r\n"))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("connection not closed: %v", err)
+	}
+	for _, word := range []string{"PASS", "SERVER", "ERROR"} {
+		if strings.Contains(string(reply), word) {
+			t.Errorf("hub answered plaintext with %q", reply)
+		}
+	}
+	if n := hub.linkRegistry.GetLinkCount(); n != 0 {
+		t.Errorf("%d links registered from a plaintext connection", n)
+	}
+}
+
+func TestLinkOverTLS(t *testing.T) {
+	hub, fingerprint := newTLSLinkHub(t)
+	port := hub.linkTLSListener.Addr().(*net.TCPAddr).Port
+
+	newLeaf := func() *Server {
+		leaf, err := New(&Config{ServerName: "leaf.test", LinkingEnabled: true, ServerID: "1BB"}, logger.New())
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		t.Cleanup(leaf.Shutdown)
+		return leaf
+	}
+	link := LinkConfig{Name: "hub.test", SID: "0AA", Host: "127.0.0.1", Port: port, Password: "secret", TLS: true}
+
+	// A certificate that doesn't match the pinned fingerprint is refused
+	link.TLSFingerprint = strings.Repeat("00", sha256.Size)
+	if err := newLeaf().ConnectToServer(link); err == nil {
+		t.Fatal("linked despite a fingerprint mismatch")
+	}
+
+	link.TLSFingerprint = fingerprint
+	if err := newLeaf().ConnectToServer(link); err != nil {
+		t.Fatalf("ConnectToServer over TLS failed: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.linkRegistry.GetLinkCount() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("TLS link was never registered on the hub")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDelayedJoinPropagation(t *testing.T) {
+	srv := newLinkingTestServer(t)
+	b := &linking.Server{SID: "1BB", Name: "b.test", Distance: 1}
+	srv.network.AddServer(b)
+	srv.network.AddUser(&linking.RemoteUser{UID: "1BBAAAAAA", Nick: "carol", User: "c", Host: "c", Server: b, Channels: map[string]bool{"#big": true}})
+	srv.network.AddChannel(&linking.RemoteChannel{Name: "#big", TS: 1700000000, Members: map[string]string{"1BBAAAAAA": ""}})
+	toB := pipeLink(t, srv, "1BB")
+
+	newUser := func(nick string) *client.Client {
+		c := client.NewMock(logger.New())
+		c.SetNickname(nick)
+		c.SetUsername(nick, nick)
+		c.SetRegistered(true)
+		srv.AddClient(c)
+		return c
+	}
+	send := func(c *client.Client, line string) {
+		msg, _ := parser.Parse(line)
+		if err := srv.handler.Handle(c, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	owner := newUser("owner")
+	bob := newUser("bob")
+	dave := newUser("dave")
+	send(owner, "JOIN #big")
+	send(owner, "MODE #big +D")
+
+	// Links don't hear of a hidden member, nor of them leaving unseen
+	send(dave, "JOIN #big")
+	send(dave, "PART #big")
+	send(bob, "JOIN #big")
+	for done := time.After(50 * time.Millisecond); ; {
+		select {
+		case line := <-toB:
+			if strings.Contains(line, "#big") && !strings.Contains(line, owner.GetUID()) && !strings.Contains(line, "+o owner") {
+				t.Fatalf("hidden member propagated before speaking: %q", line)
+			}
+			continue
+		case <-done:
+		}
+		break
+	}
+
+	// Speaking sends the JOIN ahead of the message
+	send(bob, "PRIVMSG #big :hello")
+	var sent strings.Builder
+	deadline := time.After(time.Second)
+	for !strings.Contains(sent.String(), "PRIVMSG") {
+		select {
+		case line := <-toB:
+			sent.WriteString(line)
+		case <-deadline:
+			t.Fatalf("message was not propagated, got %q", sent.String())
+		}
+	}
+	join := strings.Index(sent.String(), " JOIN #big")
+	if join < 0 || join > strings.Index(sent.String(), "PRIVMSG") {
+		t.Errorf("expected the JOIN before the PRIVMSG, got %q", sent.String())
+	}
+}
+
+func TestWallchopsOverLinks(t *testing.T) {
+	srv := newLinkingTestServer(t)
+	b := &linking.Server{SID: "1BB", Name: "b.test", Distance: 1}
+	srv.network.AddServer(b)
+	srv.network.AddUser(&linking.RemoteUser{UID: "1BBAAAAAA", Nick: "carol", User: "c", Host: "c", Server: b, Channels: map[string]bool{"#test": true}})
+	srv.network.AddChannel(&linking.RemoteChannel{Name: "#test", TS: 1700000000, Members: map[string]string{"1BBAAAAAA": "@"}})
+	toB := pipeLink(t, srv, "1BB")
+
+	newUser := func(nick string) *client.Client {
+		c := client.NewMock(logger.New())
+		c.SetNickname(nick)
+		c.SetUsername(nick, nick)
+		c.SetRegistered(true)
+		srv.AddClient(c)
+		return c
+	}
+	alice := newUser("alice")
+	bob := newUser("bob")
+	ch := srv.CreateChannel("#test")
+	ch.AddMember(alice)
+	ch.AddMember(bob)
+	alice.JoinChannel("#test")
+	bob.JoinChannel("#test")
+	alice.SentMessages()
+	bob.SentMessages()
+
+	// A local WALLCHOPS goes to the servers with members of the channel
+	msg, _ := parser.Parse("WALLCHOPS #test :ops only")
+	if err := srv.handler.Handle(bob, msg); err != nil {
+		t.Fatal(err)
+	}
+	var sent strings.Builder
+	deadline := time.After(time.Second)
+	for !strings.Contains(sent.String(), "WALLCHOPS") {
+		select {
+		case line := <-toB:
+			sent.WriteString(line)
+		case <-deadline:
+			t.Fatalf("WALLCHOPS was not routed, got %q", sent.String())
+		}
+	}
+	if !strings.Contains(sent.String(), " WALLCHOPS #test :ops only") {
+		t.Errorf("unexpected WALLCHOPS on the link: %q", sent.String())
+	}
+
+	// A remote one reaches only the local operators
+	alice.SentMessages()
+	wallchops := &linking.Message{Source: "1BBAAAAAA", Command: "WALLCHOPS", Params: []string{"#test", "hi ops"}}
+	if err := srv.handleLinkMessage(wallchops, b); err != nil {
+		t.Fatalf("handleLinkMessage failed: %v", err)
+	}
+	if got := alice.SentMessages(); len(got) != 1 || got[0] != ":carol!c@c NOTICE @#test :hi ops" {
+		t.Errorf("operator got %q, want the WALLCHOPS notice", got)
+	}
+	if got := bob.SentMessages(); len(got) != 0 {
+		t.Errorf("non-operator got %q", got)
+	}
+}
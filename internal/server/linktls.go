@@ -0,0 +1,106 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// linkTLSHandshakeTimeout bounds the TLS handshake on the link TLS port, so
+// plaintext peers that wait for us to speak first are dropped too
+const linkTLSHandshakeTimeout = 10 * time.Second
+
+// startLinkTLSListener opens the TLS-only link port. Connections that don't
+// complete a TLS handshake are closed before the link handshake starts.
+func (s *Server) startLinkTLSListener() error {
+	certFile, keyFile := s.config.LinkTLSCert, s.config.LinkTLSKey
+	if certFile == "" {
+		certFile, keyFile = s.config.TLSCertFile, s.config.TLSKeyFile
+	}
+	certs, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load link TLS certificate: %w", err)
+	}
+	s.mu.Lock()
+	s.linkCerts = certs
+	s.mu.Unlock()
+
+	host := s.config.LinkTLSHost
+	if host == "" {
+		host = s.config.LinkingHost
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(s.config.LinkTLSPort))
+
+	listener, err := tls.Listen("tcp", addr, &tls.Config{
+		GetCertificate: certs.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start link TLS listener: %v", err)
+	}
+
+	s.linkTLSListener = listener
+	s.logger.Info("Server link TLS listener started on", "address", addr)
+
+	go s.acceptLinks(listener)
+	return nil
+}
+
+// completeLinkTLS finishes the TLS handshake of a connection accepted on the
+// link TLS port. Plain connections pass through untouched.
+func (s *Server) completeLinkTLS(conn net.Conn) error {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+
+	tlsConn.SetDeadline(time.Now().Add(linkTLSHandshakeTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	return tlsConn.SetDeadline(time.Time{})
+}
+
+// dialLink opens the connection for an outbound link, over TLS if the link
+// asks for it. With a fingerprint the peer's certificate is pinned instead
+// of checked against the system roots, which suits self-signed link certs.
+func dialLink(linkCfg LinkConfig) (net.Conn, error) {
+	addr := net.JoinHostPort(linkCfg.Host, strconv.Itoa(linkCfg.Port))
+	if !linkCfg.TLS {
+		return net.Dial("tcp", addr)
+	}
+
+	cfg := &tls.Config{
+		ServerName: linkCfg.Host,
+		MinVersion: tls.VersionTLS12,
+	}
+	if linkCfg.TLSFingerprint != "" {
+		want := normalizeFingerprint(linkCfg.TLSFingerprint)
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("no certificate from %s", linkCfg.Name)
+			}
+			sum := sha256.Sum256(rawCerts[0])
+			if got := hex.EncodeToString(sum[:]); got != want {
+				return fmt.Errorf("certificate fingerprint %s does not match the configured one", got)
+			}
+			return nil
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: linkTLSHandshakeTimeout}
+	return tls.DialWithDialer(dialer, "tcp", addr, cfg)
+}
+
+// normalizeFingerprint lowercases a SHA-256 fingerprint and drops the colons
+// it is often written with
+func normalizeFingerprint(fp string) string {
+	return strings.ToLower(strings.ReplaceAll(fp, ":", ""))
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/supamanluva/ircd/internal/client"
+)
+
+// Lookup defaults used when the config leaves them unset
+const (
+	defaultMaxLookups      = 32
+	defaultLookupQueueWait = 2 * time.Second
+	defaultLookupTimeout   = 5 * time.Second
+	identPort              = 113
+)
+
+// Resolver does the DNS queries behind hostname lookups; *net.Resolver
+// satisfies it
+type Resolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// IdentFunc asks the ident server on the client's host which user owns the
+// connection between local and remote
+type IdentFunc func(ctx context.Context, local, remote net.Addr) (string, error)
+
+// lookupLimiter bounds how many connections may have DNS/ident lookups in
+// flight at once, so a connection flood can't start unbounded lookups
+type lookupLimiter struct {
+	slots chan struct{}
+	wait  time.Duration
+}
+
+func newLookupLimiter(max int, wait time.Duration) *lookupLimiter {
+	if max <= 0 {
+		max = defaultMaxLookups
+	}
+	if wait <= 0 {
+		wait = defaultLookupQueueWait
+	}
+	return &lookupLimiter{slots: make(chan struct{}, max), wait: wait}
+}
+
+// acquire takes a lookup slot, waiting up to the queue wait for one to free
+// up. It reports false if none did.
+func (l *lookupLimiter) acquire() bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// release frees a slot taken by acquire
+func (l *lookupLimiter) release() {
+	<-l.slots
+}
+
+// lookupClient runs the enabled hostname and ident lookups for a new
+// connection before it registers. When every lookup slot stays busy for the
+// queue wait, the client goes on with its IP and an unverified username.
+func (s *Server) lookupClient(c *client.Client, local, remote net.Addr) {
+	if !s.config.HostnameLookup && !s.config.IdentLookup {
+		return
+	}
+
+	if !s.lookups.acquire() {
+		s.logger.Warn("Lookup queue full, skipping DNS/ident", "from", remote.String())
+		c.Send("NOTICE AUTH :*** Too many lookups in progress, using your IP address")
+		return
+	}
+	defer s.lookups.release()
+
+	timeout := s.config.LookupTimeout
+	if timeout <= 0 {
+		timeout = defaultLookupTimeout
+	}
+
+	if s.config.HostnameLookup {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		host := s.resolveHostname(ctx, remote)
+		cancel()
+		if host != "" {
+			c.SetHostname(host)
+			c.Send("NOTICE AUTH :*** Found your hostname")
+		} else {
+			c.Send("NOTICE AUTH :*** Couldn't look up your hostname")
+		}
+	}
+
+	if s.config.IdentLookup {
+		c.Send("NOTICE AUTH :*** Checking Ident")
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		user, err := s.identLookup(ctx, local, remote)
+		cancel()
+		if err == nil && user != "" {
+			c.SetIdent(user)
+			c.Send("NOTICE AUTH :*** Got Ident response")
+		} else {
+			c.Send("NOTICE AUTH :*** No Ident response")
+		}
+	}
+}
+
+// resolveHostname returns the reverse DNS name of addr's IP if it resolves
+// back to the same IP, or "" otherwise
+func (s *Server) resolveHostname(ctx context.Context, addr net.Addr) string {
+	ip := addrIP(addr)
+	if ip == "" {
+		return ""
+	}
+
+	names, err := s.resolver.LookupAddr(ctx, ip)
+	if err != nil || len(names) == 0 {
+		return ""
+	}
+	host := strings.TrimSuffix(names[0], ".")
+	if !validHostname(host) {
+		return ""
+	}
+
+	// Forward-confirm so a PTR record can't claim someone else's name
+	addrs, err := s.resolver.LookupHost(ctx, host)
+	if err != nil {
+		return ""
+	}
+	for _, a := range addrs {
+		if net.ParseIP(a).Equal(net.ParseIP(ip)) {
+			return host
+		}
+	}
+	return ""
+}
+
+// addrIP returns the IP of a TCP address, or "" for other address types
+func addrIP(addr net.Addr) string {
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		return tcp.IP.String()
+	}
+	return ""
+}
+
+// validHostname reports whether host is safe to use in a hostmask: a DNS
+// name of at most 253 characters whose labels are 1-63 letters, digits or
+// hyphens
+func validHostname(host string) bool {
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+		for _, ch := range label {
+			if !((ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') ||
+				(ch >= '0' && ch <= '9') || ch == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// queryIdent is the default IdentFunc, an RFC 1413 client
+func queryIdent(ctx context.Context, local, remote net.Addr) (string, error) {
+	l, ok := local.(*net.TCPAddr)
+	r, ok2 := remote.(*net.TCPAddr)
+	if !ok || !ok2 {
+		return "", fmt.Errorf("ident needs TCP addresses")
+	}
+
+	dialer := net.Dialer{LocalAddr: &net.TCPAddr{IP: l.IP}}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(r.IP.String(), fmt.Sprint(identPort)))
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := fmt.Fprintf(conn, "%d, %d\r\n", r.Port, l.Port); err != nil {
+		return "", err
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	// <ports> : USERID : <os> : <user>
+	fields := strings.SplitN(strings.TrimSpace(line), ":", 4)
+	if len(fields) != 4 || strings.TrimSpace(fields[1]) != "USERID" {
+		return "", fmt.Errorf("ident error: %s", strings.TrimSpace(line))
+	}
+	return strings.TrimSpace(fields[3]), nil
+}
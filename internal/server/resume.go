@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/supamanluva/ircd/internal/client"
+	"github.com/supamanluva/ircd/internal/parser"
+)
+
+// resumeSession is a WebSocket session that can be taken over by a new
+// connection presenting its token
+type resumeSession struct {
+	client  *client.Client
+	expires time.Time // Zero while the original connection is still open
+}
+
+// newResumeToken returns a random token for RESUME
+func newResumeToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// issueResumeToken gives a WebSocket client a resume token when it registers
+func (s *Server) issueResumeToken(c *client.Client) {
+	if s.config.WebSocketResume <= 0 || c.GetConnectionType() != client.WebSocket || !c.IsRegistered() {
+		return
+	}
+
+	s.resumeMu.Lock()
+	defer s.resumeMu.Unlock()
+
+	if _, issued := s.resumeTokens[c]; issued {
+		return
+	}
+
+	token, err := newResumeToken()
+	if err != nil {
+		s.logger.Error("Failed to generate resume token", "error", err)
+		return
+	}
+	s.resumeTokens[c] = token
+	s.resumeSessions[token] = &resumeSession{client: c}
+
+	c.Send(fmt.Sprintf(":%s RESUME TOKEN %s %d", s.config.ServerName, token, int(s.config.WebSocketResume.Seconds())))
+}
+
+// suspendSession keeps a dropped WebSocket client's nick and channels for the
+// resume window. It returns false if the client has no resumable session.
+func (s *Server) suspendSession(c *client.Client) bool {
+	s.resumeMu.Lock()
+	defer s.resumeMu.Unlock()
+
+	token, ok := s.resumeTokens[c]
+	if !ok {
+		return false
+	}
+	s.resumeSessions[token].expires = time.Now().Add(s.config.WebSocketResume)
+	s.logger.Info("Holding session for resume", "nickname", c.GetNickname(), "seconds", int(s.config.WebSocketResume.Seconds()))
+	return true
+}
+
+// forgetSession drops a client's resume token, e.g. after QUIT
+func (s *Server) forgetSession(c *client.Client) {
+	s.resumeMu.Lock()
+	defer s.resumeMu.Unlock()
+
+	if token, ok := s.resumeTokens[c]; ok {
+		delete(s.resumeSessions, token)
+		delete(s.resumeTokens, c)
+	}
+}
+
+// handleResume handles RESUME <token> from an unregistered connection,
+// taking over the nick and channels of a suspended session
+func (s *Server) handleResume(c *client.Client, msg *parser.Message) error {
+	if c.IsRegistered() || !msg.HasParam(0) {
+		s.handler.SendFail(c, "RESUME", "INVALID_TOKEN", "Cannot resume session")
+		return nil
+	}
+
+	s.resumeMu.Lock()
+	token := msg.GetParam(0)
+	session, ok := s.resumeSessions[token]
+	if !ok || session.expires.IsZero() || time.Now().After(session.expires) {
+		s.resumeMu.Unlock()
+		s.handler.SendFail(c, "RESUME", "INVALID_TOKEN", "Cannot resume session")
+		return nil
+	}
+	old := session.client
+	nick := old.GetNickname()
+
+	// Take the nick over only while the registry still holds the suspended
+	// session under it; otherwise the session is left to expire
+	s.mu.Lock()
+	if s.clients[nick] != old {
+		s.mu.Unlock()
+		s.resumeMu.Unlock()
+		s.logger.Warn("Resume refused: nick no longer held by the session", "nickname", nick)
+		s.handler.SendFail(c, "RESUME", "INVALID_TOKEN", "Cannot resume session")
+		return nil
+	}
+	s.clients[nick] = c
+	s.mu.Unlock()
+	delete(s.resumeSessions, token)
+	delete(s.resumeTokens, old)
+	s.resumeMu.Unlock()
+
+	// Take over the old session's identity
+	c.SetNickname(nick)
+	c.SetUsername(old.GetUsername(), old.GetRealname())
+	c.SetUID(old.GetUID())
+	c.SetAccount(old.GetAccount())
+	c.SetAway(old.GetAwayMessage())
+	for _, mode := range strings.TrimPrefix(old.GetModes(), "+") {
+		c.SetMode(mode, true)
+	}
+	c.SetRegistered(true)
+
+	// Swap the new connection into each channel, keeping status
+	for _, channelName := range old.GetChannels() {
+		if ch := s.GetChannel(channelName); ch != nil && ch.ReplaceMember(old, c) {
+			c.JoinChannel(channelName)
+		}
+	}
+
+	s.logger.Info("Session resumed", "nickname", nick)
+	s.handler.SendResumedState(c)
+	s.issueResumeToken(c)
+	return nil
+}
+
+// expireResumeSessions periodically ends suspended sessions that were not resumed
+func (s *Server) expireResumeSessions(ctx context.Context) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.sweepResumeSessions(now)
+		}
+	}
+}
+
+// sweepResumeSessions quits suspended sessions whose resume window has passed
+func (s *Server) sweepResumeSessions(now time.Time) {
+	var expired []*client.Client
+
+	s.resumeMu.Lock()
+	for token, session := range s.resumeSessions {
+		if !session.expires.IsZero() && now.After(session.expires) {
+			expired = append(expired, session.client)
+			delete(s.resumeSessions, token)
+			delete(s.resumeTokens, session.client)
+		}
+	}
+	s.resumeMu.Unlock()
+
+	for _, c := range expired {
+		s.logger.Info("Resume window expired", "nickname", c.GetNickname())
+		s.handler.Handle(c, &parser.Message{Command: "QUIT", Params: []string{"Connection lost"}})
+
+		s.mu.Lock()
+		if s.clients[c.GetNickname()] == c {
+			delete(s.clients, c.GetNickname())
+		}
+		s.mu.Unlock()
+	}
+}
@@ -3,9 +3,13 @@ package server
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"os"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -24,13 +28,58 @@ type Config struct {
 	Host            string
 	Port            int
 	MaxClients      int
+	MaxPerUserHost  int  // Registered non-oper clients allowed per user@host (0 = unlimited)
 	TLSEnabled      bool
 	TLSPort         int
 	TLSCertFile     string
 	TLSKeyFile      string
+	TLSStrictALPN   bool // Refuse TLS clients that only offer ALPN protocols other than "irc"
 	PingInterval    time.Duration
 	Timeout         time.Duration
+	RegistrationTimeout time.Duration // Unregistered connections are dropped after this long (0 = Timeout)
+	IdleKick        time.Duration // Registered clients sending only PING/PONG are dropped after this long (0 = disabled)
 	Operators       []Operator // Server operators for OPER command
+	Accounts        []Account  // Accounts for NickServ IDENTIFY; none disables NickServ
+	UserLen         int        // Maximum username length (USERLEN)
+	CTCPRate        float64    // CTCP queries per second per client (0 = unlimited)
+	CTCPBurst       float64    // CTCP query burst size
+	CTCPReplies     bool       // Server answers CTCP VERSION/PING/TIME/CLIENTINFO
+	JoinPartRate    float64    // JOINs and PARTs per second per client, combined (0 = unlimited)
+	JoinPartBurst   float64    // JOIN/PART burst size
+	HostnameLookup  bool          // Resolve client hostnames with forward-confirmed reverse DNS
+	IdentLookup     bool          // Ask the client's ident server for a verified username
+	MaxLookups      int           // Connections with DNS/ident lookups in flight at once (0 = default 32)
+	LookupQueueWait time.Duration // Wait for a lookup slot before going on with the IP (0 = default 2s)
+	LookupTimeout   time.Duration // Deadline for each lookup (0 = default 5s)
+	MaxTargets      int        // Targets per WHO/WHOIS/USERHOST query
+	MaxISON         int        // Nicknames per ISON query
+	Version         string     // Advertised version override for non-operators
+	HideBuildInfo   bool       // Hide build details in VERSION from non-operators
+	StatusGrace     time.Duration // Logged-in users rejoining within this get their channel status back (0 = off)
+	SendPaceLines   int           // Lines written to a client per SendPaceInterval (0 = no pacing)
+	ConnectNotices  []string      // NOTICE lines sent to every new connection before registration
+	OperMaxFailures int           // Failed OPER attempts per client/IP before a lockout (0 = default 3)
+	OperLockout     time.Duration // How long OPER is refused after too many failures (0 = default 1 minute)
+	NoticeLoopLimit int           // CTCP reply NOTICEs allowed between two users per NoticeLoopWindow (0 = unlimited)
+	NoticeLoopWindow time.Duration
+	MaxListEntries  int           // Masks per channel list, +b, +e, +I and +q each (0 = default 100)
+	MaxListTotal    int           // Masks across all of a channel's lists (0 = no combined limit)
+	KickCooldown    time.Duration // Kicked users may not rejoin the channel for this long (0 = off)
+	TopicChanges    int           // Topic changes allowed per channel per TopicWindow (0 = unlimited, +T overrides)
+	TopicWindow     time.Duration
+	InviteExpiry    time.Duration // Unused invites lapse after this long (0 = default 1 hour)
+	ResyncDuplicateJoin bool      // JOIN for a channel the client is already in resends topic and NAMES
+	NickProtectGrace time.Duration // Users of a nick reserved to another account are renamed after this long (0 = off)
+	GuestNickPattern string        // Nick given on enforcement, * replaced with a number (default "Guest*")
+	Lockdown         bool          // Start with registration limited to operators (LOCKDOWN toggles it)
+	ClientTags       []string      // Client-only tags relayed to message-tags clients (empty = any)
+	MaxTagLength     int           // Longest tag section a client may send (0 = default 4094)
+	SendPaceInterval time.Duration
+	ChannelExpiry   time.Duration // Empty permanent (+P) channels are removed after this long (0 = never)
+	MOTDFile        string        // Message of the day file, read at startup ("" = no MOTD)
+	NoStandardReplies bool        // Don't offer the standard-replies (FAIL/WARN/NOTE) capability
+	WhowasSize      int           // Departed users remembered for WHOWAS (0 = default 1000)
+	MaxAccept       int           // ACCEPT list size for caller ID (+g) users (0 = default 20)
 	WebSocketEnabled bool
 	WebSocketHost    string
 	WebSocketPort    int
@@ -38,15 +87,26 @@ type Config struct {
 	WebSocketTLS     bool
 	WebSocketCert    string
 	WebSocketKey     string
+	WebSocketResume  time.Duration // How long a dropped WebSocket session can be resumed (0 = disabled)
 	
 	// Server linking configuration
 	LinkingEnabled  bool
 	LinkingHost     string
 	LinkingPort     int
 	ServerID        string // SID (3 chars: 0AA, 1BB, etc)
+	ServerIDStrict  bool   // Refuse to start with a missing/invalid SID instead of generating one
 	ServerDesc      string // Server description
 	LinkPassword    string // Password for incoming links
 	Links           []LinkConfig // Configured links to other servers
+	LinkMaxLineLength int        // Maximum server protocol line length in bytes (0 = default)
+	MaxLinks        int          // Maximum simultaneously linked servers (0 = unlimited)
+	LinkMaxUsers    int          // Maximum users a single link may introduce in burst (0 = unlimited)
+	LinkTLSEnabled  bool         // Also accept links on a TLS-only port
+	LinkTLSHost     string       // Address of the TLS link port (default LinkingHost)
+	LinkTLSPort     int
+	LinkTLSCert     string       // Certificate for the TLS link port (default TLSCertFile)
+	LinkTLSKey      string
+	LinkPlaintextDisabled bool   // With LinkTLSEnabled, don't open the plaintext link port
 }
 
 // Operator represents a server operator
@@ -55,6 +115,13 @@ type Operator struct {
 	Password string // bcrypt hashed password
 }
 
+// Account represents an account clients log in to with NickServ IDENTIFY
+type Account struct {
+	Name     string
+	Password string   // bcrypt hashed password
+	Nicks    []string // Nicknames reserved to the account besides its name
+}
+
 // LinkConfig represents a configured server link
 type LinkConfig struct {
 	Name        string // Server name
@@ -64,6 +131,8 @@ type LinkConfig struct {
 	Password    string // Link password
 	AutoConnect bool   // Auto-connect on startup
 	IsHub       bool   // Can this server link other servers?
+	TLS         bool   // Connect to the peer's TLS link port
+	TLSFingerprint string // SHA-256 of the peer's certificate; pins it instead of verifying the chain
 }
 
 // Server represents the IRC server
@@ -73,7 +142,11 @@ type Server struct {
 	listener       net.Listener
 	tlsListener    net.Listener
 	linkListener   net.Listener // Server linking listener
+	linkTLSListener net.Listener // TLS-only server linking listener
 	wsServer       *http.Server
+	tlsCerts       *certReloader // Certificate of the TLS listener, reloaded by REHASH
+	wsCerts        *certReloader // Certificate of the WebSocket TLS listener
+	linkCerts      *certReloader // Certificate of the TLS link listener
 	clients        map[string]*client.Client  // nickname -> client
 	clientsAddr    map[string]*client.Client  // address -> client
 	channels       map[string]*channel.Channel
@@ -83,6 +156,12 @@ type Server struct {
 	mu             sync.RWMutex
 	shutdown       chan struct{}
 	handler        *commands.Handler
+	resumeSessions map[string]*resumeSession   // resume token -> WebSocket session
+	resumeTokens   map[*client.Client]string   // client -> its resume token
+	resumeMu       sync.Mutex
+	lookups        *lookupLimiter // Bounds concurrent DNS/ident lookups
+	resolver       Resolver
+	identLookup    IdentFunc
 }
 
 // GetClient returns a client by nickname
@@ -107,7 +186,7 @@ func (s *Server) AddClient(c *client.Client) error {
 	}
 	
 	// Assign UID if client is registered and doesn't have one yet (Phase 7.3)
-	if c.IsRegistered() && c.GetUID() == "" {
+	if c.IsRegistered() && c.GetUID() == "" && s.network != nil {
 		uid := s.network.GenerateUID()
 		c.SetUID(uid)
 		s.logger.Info("Assigned UID to client", "nick", nick, "uid", uid)
@@ -120,7 +199,7 @@ func (s *Server) AddClient(c *client.Client) error {
 				c.GetHostname(),
 				c.GetUID(),
 				c.GetRealname(),
-				time.Now().Unix(),
+				c.GetNickTS(),
 			); err != nil {
 				s.logger.Debug("Failed to propagate new user", "error", err, "nick", c.GetNickname())
 			} else {
@@ -144,6 +223,24 @@ func (s *Server) RemoveClient(c *client.Client) {
 	}
 }
 
+// RenameClient moves a client to its new nickname in the registry
+func (s *Server) RenameClient(oldNick, newNick string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.clients[oldNick]
+	if !ok {
+		return fmt.Errorf("no client with nickname %s", oldNick)
+	}
+	if other, exists := s.clients[newNick]; exists && other != c {
+		return fmt.Errorf("nickname already in use")
+	}
+
+	delete(s.clients, oldNick)
+	s.clients[newNick] = c
+	return nil
+}
+
 // IsNicknameInUse checks if a nickname is already taken
 func (s *Server) IsNicknameInUse(nickname string) bool {
 	s.mu.RLock()
@@ -152,6 +249,32 @@ func (s *Server) IsNicknameInUse(nickname string) bool {
 	return exists
 }
 
+// GetClientsByAccount returns every registered client logged in to an account
+func (s *Server) GetClientsByAccount(account string) []*client.Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	
+	var sessions []*client.Client
+	for _, c := range s.clients {
+		if c.GetAccount() != "" && strings.EqualFold(c.GetAccount(), account) {
+			sessions = append(sessions, c)
+		}
+	}
+	return sessions
+}
+
+// GetClients returns a snapshot of all local clients
+func (s *Server) GetClients() []*client.Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	
+	clients := make([]*client.Client, 0, len(s.clients))
+	for _, c := range s.clients {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
 // GetChannel returns a channel by name
 func (s *Server) GetChannel(name string) *channel.Channel {
 	s.mu.RLock()
@@ -176,13 +299,33 @@ func (s *Server) CreateChannel(name string) *channel.Channel {
 	return ch
 }
 
-// RemoveChannel removes a channel if it's empty
+// ListChannels returns a snapshot of all local channels sorted by name
+func (s *Server) ListChannels() []*channel.Channel {
+	channels := s.GetChannels()
+	sort.Slice(channels, func(i, j int) bool { return channels[i].GetName() < channels[j].GetName() })
+	return channels
+}
+
+// GetChannels returns a snapshot of all local channels
+func (s *Server) GetChannels() []*channel.Channel {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	
+	channels := make([]*channel.Channel, 0, len(s.channels))
+	for _, ch := range s.channels {
+		channels = append(channels, ch)
+	}
+	return channels
+}
+
+// RemoveChannel removes a channel if it's empty. Permanent (+P) channels are
+// kept until expireChannels removes them.
 func (s *Server) RemoveChannel(name string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	
 	if ch, exists := s.channels[name]; exists {
-		if ch.IsEmpty() {
+		if ch.IsEmpty() && !ch.IsPermanent() {
 			delete(s.channels, name)
 			s.logger.Info("Channel removed", "channel", name)
 		}
@@ -235,24 +378,24 @@ func (s *Server) GetBurstChannels() []linking.BurstChannel {
 		// In real implementation, we'd need to convert local clients to UIDs
 		// For now, this is a placeholder
 		for _, member := range ch.GetMembers() {
+			// Members hidden by +D are sent when they are revealed
+			if ch.IsHidden(member) {
+				continue
+			}
 			// TODO: Get UID for this client from network
 			// For now, just use nickname as placeholder
-			modes := ""
-			if ch.IsOperator(member) {
-				modes = "@"
-			} else if ch.IsVoiced(member) {
-				modes = "+"
-			}
-			members[member.GetNickname()] = modes
+			members[member.GetNickname()] = ch.GetPrefix(member)
 		}
 		
-		// TODO: Get actual channel creation time
-		// For now, use Unix epoch as placeholder
 		channels = append(channels, linking.BurstChannel{
 			Name:    name,
-			TS:      time.Now().Unix(),
+			TS:      ch.GetCreatedAt().Unix(),
 			Modes:   ch.GetModes(),
 			Members: members,
+			Bans:    ch.GetBanList(),
+			Excepts: ch.GetExceptionList(),
+			Invexes: ch.GetInviteExceptionList(),
+			Quiets:  ch.GetQuietList(),
 		})
 	}
 	
@@ -275,11 +418,21 @@ func New(cfg *Config, log *logger.Logger) (*Server, error) {
 		clientsAddr: make(map[string]*client.Client),
 		channels:    make(map[string]*channel.Channel),
 		shutdown:    make(chan struct{}),
+		resumeSessions: make(map[string]*resumeSession),
+		resumeTokens:   make(map[*client.Client]string),
+		lookups:        newLookupLimiter(cfg.MaxLookups, cfg.LookupQueueWait),
+		resolver:       net.DefaultResolver,
+		identLookup:    queryIdent,
 	}
 	
 	// Initialize network state if linking is enabled (Phase 7.1+)
-	if cfg.LinkingEnabled && cfg.ServerID != "" {
+	if cfg.LinkingEnabled {
+		if err := resolveServerID(cfg, log); err != nil {
+			return nil, err
+		}
+
 		srv.network = linking.NewNetwork(cfg.ServerID, cfg.ServerName)
+		srv.network.LocalVersion = commands.ServerVersion()
 		srv.linkRegistry = linking.NewLinkRegistry()
 		srv.router = linking.NewMessageRouter(srv.network, srv.linkRegistry)
 		log.Info("Server linking enabled", "sid", cfg.ServerID)
@@ -296,6 +449,63 @@ func New(cfg *Config, log *logger.Logger) (*Server, error) {
 	
 	// Initialize command handler with server as registry
 	srv.handler = commands.New(cfg.ServerName, log, srv, srv, cmdOperators)
+	srv.handler.SetOptions(commands.Options{
+		UserLen:       cfg.UserLen,
+		CTCPRate:      cfg.CTCPRate,
+		CTCPBurst:     cfg.CTCPBurst,
+		CTCPReplies:   cfg.CTCPReplies,
+		JoinPartRate:  cfg.JoinPartRate,
+		JoinPartBurst: cfg.JoinPartBurst,
+		MaxTargets:    cfg.MaxTargets,
+		MaxISON:       cfg.MaxISON,
+		Version:       cfg.Version,
+		HideBuildInfo: cfg.HideBuildInfo,
+		MaxPerUserHost: cfg.MaxPerUserHost,
+		StatusGrace:   cfg.StatusGrace,
+		OperMaxFailures: cfg.OperMaxFailures,
+		OperLockout:   cfg.OperLockout,
+		NoticeLoopLimit: cfg.NoticeLoopLimit,
+		NoticeLoopWindow: cfg.NoticeLoopWindow,
+		MaxListEntries: cfg.MaxListEntries,
+		MaxListTotal:  cfg.MaxListTotal,
+		KickCooldown:  cfg.KickCooldown,
+		TopicChanges:  cfg.TopicChanges,
+		TopicWindow:   cfg.TopicWindow,
+		InviteExpiry:  cfg.InviteExpiry,
+		ResyncDuplicateJoin: cfg.ResyncDuplicateJoin,
+		NickProtectGrace: cfg.NickProtectGrace,
+		GuestNickPattern: cfg.GuestNickPattern,
+		Lockdown:      cfg.Lockdown,
+		ClientTags:    cfg.ClientTags,
+		MaxTagLength:  cfg.MaxTagLength,
+		MOTD:          srv.loadMOTD(),
+		NoStandardReplies: cfg.NoStandardReplies,
+		WhowasSize:    cfg.WhowasSize,
+		MaxAccept:     cfg.MaxAccept,
+	})
+	
+	// Configured accounts are logged in to through NickServ
+	if len(cfg.Accounts) > 0 {
+		accounts := make([]commands.Account, len(cfg.Accounts))
+		for i, a := range cfg.Accounts {
+			accounts[i] = commands.Account{Name: a.Name, Password: a.Password, Nicks: a.Nicks}
+		}
+		srv.handler.SetAccounts(accounts)
+		if err := srv.RegisterService("NickServ", srv.handler.NickServ); err != nil {
+			return nil, err
+		}
+	}
+
+	// Operators reload the TLS certificates with REHASH
+	srv.handler.RegisterCommand("REHASH", srv.handleRehash, true)
+
+	// Operators check the running configuration with CONFIG
+	srv.handler.RegisterCommand("CONFIG", srv.handleConfig, true)
+
+	// WebSocket clients may take over a dropped session with RESUME <token>
+	if cfg.WebSocketResume > 0 {
+		srv.handler.RegisterCommand("RESUME", srv.handleResume, false)
+	}
 	
 	// Set router for the command handler if linking is enabled (Phase 7.4)
 	if cfg.LinkingEnabled && srv.router != nil {
@@ -305,6 +515,25 @@ func New(cfg *Config, log *logger.Logger) (*Server, error) {
 	return srv, nil
 }
 
+// resolveServerID validates the configured SID. A missing or malformed SID
+// is replaced with a generated one, unless ServerIDStrict is set.
+func resolveServerID(cfg *Config, log *logger.Logger) error {
+	if linking.ValidateSID(cfg.ServerID) {
+		return nil
+	}
+	if cfg.ServerIDStrict {
+		return fmt.Errorf("invalid server ID %q: must match [0-9][A-Z0-9][A-Z0-9]", cfg.ServerID)
+	}
+
+	sid, err := linking.GenerateSID()
+	if err != nil {
+		return err
+	}
+	log.Warn("Invalid or missing server ID, using generated SID", "configured", cfg.ServerID, "sid", sid)
+	cfg.ServerID = sid
+	return nil
+}
+
 // Start begins listening for connections
 func (s *Server) Start(ctx context.Context) error {
 	// Start regular TCP listener
@@ -340,6 +569,7 @@ func (s *Server) Start(ctx context.Context) error {
 		} else {
 			// Auto-connect to configured servers
 			s.AutoConnect()
+			go s.pingLinks(ctx)
 		}
 	}
 
@@ -349,23 +579,64 @@ func (s *Server) Start(ctx context.Context) error {
 	// Start maintenance routines
 	go s.pingClients(ctx)
 	go s.checkTimeouts(ctx)
+	if s.config.ChannelExpiry > 0 {
+		go s.expireChannels(ctx)
+	}
+	go s.expireInvites(ctx)
+	if s.config.WebSocketResume > 0 {
+		go s.expireResumeSessions(ctx)
+	}
 
 	// Wait for context cancellation
 	<-ctx.Done()
 	return nil
 }
 
+// alpnProtocol is the ALPN protocol id advertised on the TLS listener
+const alpnProtocol = "irc"
+
+// newTLSConfig builds the TLS config for client connections, taking the
+// certificate from getCert on every handshake. It offers the "irc" ALPN id so
+// a multiplexer sharing the port can route on it. With strictALPN, clients
+// that only offer other protocols fail the handshake; otherwise they are
+// accepted without ALPN.
+func newTLSConfig(getCert func(*tls.ClientHelloInfo) (*tls.Certificate, error), strictALPN bool) *tls.Config {
+	cfg := &tls.Config{
+		GetCertificate: getCert,
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{alpnProtocol},
+	}
+	if strictALPN {
+		return cfg
+	}
+
+	lenient := cfg.Clone()
+	lenient.NextProtos = nil
+	cfg.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		if len(hello.SupportedProtos) == 0 {
+			return nil, nil
+		}
+		for _, proto := range hello.SupportedProtos {
+			if proto == alpnProtocol {
+				return nil, nil
+			}
+		}
+		return lenient, nil
+	}
+	return cfg
+}
+
 // startTLSListener starts the TLS listener
 func (s *Server) startTLSListener(ctx context.Context) error {
-	cert, err := tls.LoadX509KeyPair(s.config.TLSCertFile, s.config.TLSKeyFile)
+	certs, err := newCertReloader(s.config.TLSCertFile, s.config.TLSKeyFile)
 	if err != nil {
-		return fmt.Errorf("failed to load TLS certificates: %w", err)
+		return err
 	}
+	s.mu.Lock()
+	s.tlsCerts = certs
+	s.mu.Unlock()
 
-	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		MinVersion:   tls.VersionTLS12,
-	}
+	tlsConfig := newTLSConfig(certs.GetCertificate, s.config.TLSStrictALPN)
 
 	tlsAddr := fmt.Sprintf("%s:%d", s.config.Host, s.config.TLSPort)
 	tlsListener, err := tls.Listen("tcp", tlsAddr, tlsConfig)
@@ -397,6 +668,7 @@ func (s *Server) startWebSocketListener(ctx context.Context) error {
 	mux := http.NewServeMux()
 	mux.Handle("/", wsHandler)
 	mux.HandleFunc("/health", websocket.HealthCheck)
+	mux.HandleFunc("/metrics", s.handleMetrics)
 	
 	// Create HTTP server
 	addr := fmt.Sprintf("%s:%d", s.config.WebSocketHost, s.config.WebSocketPort)
@@ -404,15 +676,29 @@ func (s *Server) startWebSocketListener(ctx context.Context) error {
 		Addr:    addr,
 		Handler: mux,
 	}
+	useTLS := s.config.WebSocketTLS && s.config.WebSocketCert != "" && s.config.WebSocketKey != ""
+	if useTLS {
+		certs, err := newCertReloader(s.config.WebSocketCert, s.config.WebSocketKey)
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		s.wsCerts = certs
+		s.mu.Unlock()
+		s.wsServer.TLSConfig = &tls.Config{
+			GetCertificate: certs.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+		}
+	}
 	
 	s.logger.Info("Starting WebSocket server", "address", addr)
 	
 	// Start server in goroutine
 	go func() {
 		var err error
-		if s.config.WebSocketTLS && s.config.WebSocketCert != "" && s.config.WebSocketKey != "" {
+		if useTLS {
 			s.logger.Info("WebSocket server listening (TLS)", "address", addr)
-			err = s.wsServer.ListenAndServeTLS(s.config.WebSocketCert, s.config.WebSocketKey)
+			err = s.wsServer.ListenAndServeTLS("", "") // Certificate comes from TLSConfig
 		} else {
 			s.logger.Info("WebSocket server listening", "address", addr)
 			err = s.wsServer.ListenAndServe()
@@ -438,6 +724,21 @@ func (s *Server) startWebSocketListener(ctx context.Context) error {
 	return nil
 }
 
+// handleMetrics serves server counters in the Prometheus text format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	clients := len(s.clients)
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# HELP ircd_clients Registered local clients.\n")
+	fmt.Fprintf(w, "# TYPE ircd_clients gauge\n")
+	fmt.Fprintf(w, "ircd_clients %d\n", clients)
+	fmt.Fprintf(w, "# HELP ircd_dropped_messages_total Lines dropped because a client's send queue was full.\n")
+	fmt.Fprintf(w, "# TYPE ircd_dropped_messages_total counter\n")
+	fmt.Fprintf(w, "ircd_dropped_messages_total %d\n", client.DroppedMessages())
+}
+
 // acceptConnections handles incoming client connections
 func (s *Server) acceptConnections(ctx context.Context, listener net.Listener, isTLS bool) {
 	connType := "TCP"
@@ -511,25 +812,104 @@ func (s *Server) checkTimeouts(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			s.mu.RLock()
-			clients := make([]*client.Client, 0, len(s.clientsAddr))
-			for _, c := range s.clientsAddr {
-				clients = append(clients, c)
-			}
-			s.mu.RUnlock()
+			s.sweepTimeouts()
+		}
+	}
+}
 
-			// Check for idle clients
-			for _, c := range clients {
-				if c.IsIdle(s.config.Timeout) {
-					s.logger.Info("Client timed out", "nickname", c.GetNickname())
-					c.Send("ERROR :Closing Link: (Ping timeout)")
-					c.Disconnect()
-				}
+// sweepTimeouts disconnects clients that never registered, stopped
+// answering PINGs, or (with IdleKick) sent nothing but PING/PONG for too long
+func (s *Server) sweepTimeouts() {
+	s.mu.RLock()
+	clients := make([]*client.Client, 0, len(s.clientsAddr))
+	for _, c := range s.clientsAddr {
+		clients = append(clients, c)
+	}
+	s.mu.RUnlock()
+
+	for _, c := range clients {
+		var reason string
+		switch {
+		case !c.IsRegistered() && s.config.RegistrationTimeout > 0 &&
+			time.Since(c.GetConnectTime()) > s.config.RegistrationTimeout:
+			reason = "Registration timeout"
+		case c.IsIdle(s.config.Timeout):
+			reason = fmt.Sprintf("Ping timeout: %d seconds", int(time.Since(c.GetLastActivity()).Seconds()))
+		case c.IsRegistered() && s.config.IdleKick > 0 &&
+			time.Since(c.GetLastCommand()) > s.config.IdleKick:
+			reason = "Idle timeout"
+		default:
+			continue
+		}
+
+		s.logger.Info("Client timed out", "nickname", c.GetNickname(), "reason", reason)
+		c.Send(fmt.Sprintf("ERROR :Closing Link: %s (%s)", c.GetHostname(), reason))
+		s.handler.QuitClient(c, reason)
+		c.Disconnect()
+	}
+}
+
+// expireChannels periodically removes permanent channels left empty too long
+func (s *Server) expireChannels(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.sweepExpiredChannels(now)
+		}
+	}
+}
+
+// sweepExpiredChannels removes empty permanent channels with no activity
+// within ChannelExpiry
+func (s *Server) sweepExpiredChannels(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, ch := range s.channels {
+		if ch.IsPermanent() && ch.IsEmpty() && now.Sub(ch.GetLastActivity()) > s.config.ChannelExpiry {
+			delete(s.channels, name)
+			s.logger.Info("Expired empty permanent channel", "channel", name)
+		}
+	}
+}
+
+// expireInvites periodically drops invites that lapsed without being used
+func (s *Server) expireInvites(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, ch := range s.GetChannels() {
+				ch.SweepInvites(now)
 			}
 		}
 	}
 }
 
+// loadMOTD reads MOTDFile into lines. A missing or unreadable file is logged
+// and leaves the server without a MOTD.
+func (s *Server) loadMOTD() []string {
+	if s.config.MOTDFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.config.MOTDFile)
+	if err != nil {
+		s.logger.Error("Failed to read MOTD file", "file", s.config.MOTDFile, "error", err)
+		return nil
+	}
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	return strings.Split(strings.TrimRight(text, "\n"), "\n")
+}
+
 // handleClient manages a single client connection
 func (s *Server) handleClient(conn net.Conn) {
 	defer func() {
@@ -544,6 +924,13 @@ func (s *Server) handleClient(conn net.Conn) {
 
 	// Create client instance
 	c := client.New(conn, s.logger)
+	c.SetSendPacing(s.config.SendPaceLines, s.config.SendPaceInterval)
+	switch cc := conn.(type) {
+	case *tls.Conn:
+		c.SetConnectionType(client.TCP, true)
+	case *websocket.Conn:
+		c.SetConnectionType(client.WebSocket, cc.IsSecure())
+	}
 
 	// Register client by address temporarily
 	s.mu.Lock()
@@ -552,8 +939,13 @@ func (s *Server) handleClient(conn net.Conn) {
 
 	// Send initial message
 	c.Send(fmt.Sprintf("NOTICE AUTH :*** Looking up your hostname..."))
+	s.lookupClient(c, conn.LocalAddr(), conn.RemoteAddr())
+	for _, notice := range s.config.ConnectNotices {
+		c.Send("NOTICE AUTH :" + notice)
+	}
 
 	// Message processing loop
+	quit := false
 	for {
 		// Read message from client
 		line, err := c.Receive()
@@ -572,29 +964,53 @@ func (s *Server) handleClient(conn net.Conn) {
 		// Parse IRC message
 		msg, err := parser.Parse(line)
 		if err != nil {
-			s.logger.Warn("Failed to parse message", "from", clientAddr, "line", line, "error", err)
+			// Blank lines are ignored; anything else gets a reply the client can debug
+			if !errors.Is(err, parser.ErrEmptyMessage) {
+				s.logger.Debug("Failed to parse message", "from", clientAddr, "line", line, "error", err)
+				s.handler.HandleMalformed(c, msg)
+			}
 			continue
 		}
 
+		// PING/PONG keep the link alive but don't count against the idle kick
+		if msg.Command != "PING" && msg.Command != "PONG" {
+			c.UpdateCommandTime()
+		}
+
 		// Handle the command
+		wasRegistered := c.IsRegistered()
 		if err := s.handler.Handle(c, msg); err != nil {
 			s.logger.Debug("Command handler error", "from", clientAddr, "command", msg.Command, "error", err)
 			// QUIT command returns an error to signal disconnect
 			if msg.Command == "QUIT" {
+				s.forgetSession(c)
+				quit = true
+				break
+			}
+			// The handler refused the client and sent it an ERROR
+			if errors.Is(err, commands.ErrCloseLink) {
 				break
 			}
 		}
+		if !wasRegistered && c.IsRegistered() {
+			s.issueResumeToken(c)
+		}
 	}
 
-	// Cleanup
+	// Cleanup; a resumable WebSocket session keeps its nick until it expires
+	suspended := s.suspendSession(c)
 	s.mu.Lock()
 	delete(s.clientsAddr, clientAddr)
-	if c.IsRegistered() {
+	if c.IsRegistered() && !suspended {
 		delete(s.clients, c.GetNickname())
 	}
 	s.mu.Unlock()
 
-	// TODO: Remove from channels in Phase 2
+	// Dropped connections leave their channels as if they had quit; QUIT and
+	// server-initiated disconnects (timeouts, shutdown) have already done so
+	if !quit && !suspended && !c.IsDisconnected() {
+		s.handler.QuitClient(c, "Connection closed")
+	}
 
 	c.Disconnect()
 	s.logger.Info("Client disconnected", "from", clientAddr, "nickname", c.GetNickname())
@@ -619,7 +1035,20 @@ func (s *Server) Shutdown() {
 	}
 	s.mu.Unlock()
 
+	// Stop accepting server links and drop the active ones; their
+	// goroutines see the closed shutdown channel and exit quietly
 	close(s.shutdown)
+	if s.linkListener != nil {
+		s.linkListener.Close()
+	}
+	if s.linkTLSListener != nil {
+		s.linkTLSListener.Close()
+	}
+	if s.linkRegistry != nil {
+		for _, link := range s.linkRegistry.GetAllLinks() {
+			link.Close()
+		}
+	}
 	s.logger.Info("Server shutdown complete")
 }
 
@@ -802,14 +1231,13 @@ func (s *Server) PropagateTopic(nick, user, host, uid, channel, topic string, ts
 		return fmt.Errorf("network not initialized")
 	}
 	
-	msg := &linking.Message{
-		Source:  uid,
-		Command: "TOPIC",
-		Params:  []string{channel, topic, fmt.Sprintf("%d", ts)},
-	}
+	setter := fmt.Sprintf("%s!%s@%s", nick, user, host)
+	msg := linking.BuildTOPIC(uid, channel, setter, ts, topic)
+	s.network.SetChannelTopic(channel, topic, setter, ts)
 	
-	// Broadcast to all linked servers except the source server
-	s.router.BroadcastToServers(msg, s.config.ServerID)
+	// Broadcast to all linked servers except the source server; those
+	// that don't know TOPICTS get the old format
+	s.router.BroadcastByCapability("TOPICTS", msg, linking.BuildLegacyTOPIC(uid, channel, topic), s.config.ServerID)
 	return nil
 }
 
@@ -830,6 +1258,18 @@ func (s *Server) PropagateKick(nick, user, host, uid, channel, target, reason st
 	return nil
 }
 
+// PropagateServerMode propagates a MODE change made by this server itself,
+// such as a flood ban, to all linked servers
+func (s *Server) PropagateServerMode(channel, modeString string, ts int64) error {
+	return s.PropagateMode("", "", "", s.config.ServerID, channel, modeString, ts)
+}
+
+// PropagateServerKick propagates a KICK made by this server itself to all
+// linked servers
+func (s *Server) PropagateServerKick(channel, target, reason string) error {
+	return s.PropagateKick("", "", "", s.config.ServerID, channel, target, reason)
+}
+
 // PropagateInvite propagates an INVITE to all linked servers (Phase 7.4.4)
 func (s *Server) PropagateInvite(nick, user, host, uid, target, channel string) error {
 	if s.network == nil {
@@ -847,6 +1287,43 @@ func (s *Server) PropagateInvite(nick, user, host, uid, target, channel string)
 	return nil
 }
 
+// PropagateWallops propagates a WALLOPS to all linked servers
+func (s *Server) PropagateWallops(nick, user, host, uid, text string) error {
+	if s.network == nil {
+		return fmt.Errorf("network not initialized")
+	}
+	
+	msg := &linking.Message{
+		Source:  uid,
+		Command: "WALLOPS",
+		Params:  []string{text},
+	}
+	
+	// Broadcast to all linked servers except the source server
+	s.router.BroadcastToServers(msg, s.config.ServerID)
+	return nil
+}
+
+// PropagateAway propagates an AWAY change to all linked servers
+func (s *Server) PropagateAway(uid, message string) error {
+	if s.network == nil {
+		return fmt.Errorf("network not initialized")
+	}
+	
+	// Format: :<UID> AWAY [:<message>]; no message means back
+	msg := &linking.Message{
+		Source:  uid,
+		Command: "AWAY",
+	}
+	if message != "" {
+		msg.Params = []string{message}
+	}
+	
+	// Broadcast to all linked servers except the source server
+	s.router.BroadcastToServers(msg, s.config.ServerID)
+	return nil
+}
+
 // PropagateUser propagates a new user registration to all linked servers
 func (s *Server) PropagateUser(nick, user, host, uid, realname string, ts int64) error {
 	if s.network == nil {
@@ -889,6 +1366,92 @@ func (s *Server) GetRemoteUserByUID(uid string) (*linking.RemoteUser, bool) {
 	return s.network.GetUserByUID(uid)
 }
 
+// GetRemoteUserByNick gets a remote user by nickname
+func (s *Server) GetRemoteUserByNick(nick string) (*linking.RemoteUser, bool) {
+	if s.network == nil {
+		return nil, false
+	}
+	return s.network.GetUserByNick(nick)
+}
+
+// GetRemoteUserCount returns the number of users on linked servers
+func (s *Server) GetRemoteUserCount() int {
+	if s.network == nil {
+		return 0
+	}
+	return s.network.GetUserCount()
+}
+
+// GetRemoteOperCount returns the number of operators on linked servers
+func (s *Server) GetRemoteOperCount() int {
+	if s.network == nil {
+		return 0
+	}
+	return s.network.GetOperCount()
+}
+
+// GetLinkedServers returns all servers known to the network (for LINKS)
+func (s *Server) GetLinkedServers() []*linking.Server {
+	if s.network == nil {
+		return nil
+	}
+	return s.network.GetServers()
+}
+
+// GetServerUplink returns the server srv is linked behind, or nil if it is
+// linked to us directly
+func (s *Server) GetServerUplink(srv *linking.Server) *linking.Server {
+	if s.network == nil {
+		return nil
+	}
+	return s.network.GetUplink(srv)
+}
+
+// RouteSajoin asks a remote user's server to force them into a channel
+func (s *Server) RouteSajoin(operUID, targetNick, channel string) error {
+	return s.routeToRemoteUser(operUID, targetNick, "SAJOIN", channel)
+}
+
+// RouteSapart asks a remote user's server to force them out of a channel
+func (s *Server) RouteSapart(operUID, targetNick, channel, reason string) error {
+	return s.routeToRemoteUser(operUID, targetNick, "SAPART", channel, reason)
+}
+
+// routeToRemoteUser sends an operator's command about a remote user
+// (:<oper uid> <command> <uid> <params...>) towards that user's server, which
+// checks that the source is an operator
+func (s *Server) routeToRemoteUser(operUID, targetNick, command string, params ...string) error {
+	if s.router == nil {
+		return fmt.Errorf("routing not available")
+	}
+	
+	remoteUser, ok := s.network.GetUserByNick(targetNick)
+	if !ok {
+		return fmt.Errorf("user %s not found in network", targetNick)
+	}
+	
+	msg := &linking.Message{
+		Source:  operUID,
+		Command: command,
+		Params:  append([]string{remoteUser.UID}, params...),
+	}
+	
+	return s.router.RouteToUser(operUID, remoteUser.UID, msg)
+}
+
+// getClientByUID finds a local client by UID
+func (s *Server) getClientByUID(uid string) *client.Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	
+	for _, c := range s.clients {
+		if c.GetUID() == uid {
+			return c
+		}
+	}
+	return nil
+}
+
 // DisconnectServer disconnects a linked server (Phase 7.4.5)
 func (s *Server) DisconnectServer(serverName, reason string) error {
 	if s.network == nil {
@@ -0,0 +1,1120 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/supamanluva/ircd/internal/channel"
+	"github.com/supamanluva/ircd/internal/client"
+	"github.com/supamanluva/ircd/internal/linking"
+	"github.com/supamanluva/ircd/internal/logger"
+	"github.com/supamanluva/ircd/internal/parser"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestListAllChannels(t *testing.T) {
+	srv, err := New(&Config{ServerName: "test.server"}, logger.New())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	member := client.NewMock(srv.logger)
+	member.SetNickname("member")
+	member.SetRegistered(true)
+	user := client.NewMock(srv.logger)
+	user.SetNickname("user")
+	user.SetRegistered(true)
+
+	srv.CreateChannel("#zeta").SetTopic("last")
+	srv.CreateChannel("#alpha").AddMember(member)
+	secret := srv.CreateChannel("#secret")
+	secret.AddMember(member)
+	secret.SetMode('s', true)
+
+	list := func(c *client.Client) []string {
+		c.SentMessages()
+		msg, _ := parser.Parse("LIST")
+		srv.handler.Handle(c, msg)
+		var names []string
+		for _, line := range c.SentMessages() {
+			if fields := strings.Fields(line); len(fields) > 4 && fields[1] == "322" {
+				names = append(names, fields[3]+" "+fields[4])
+			}
+		}
+		return names
+	}
+
+	if got, want := strings.Join(list(user), ","), "#alpha 1,#zeta 0"; got != want {
+		t.Errorf("LIST for a non-member = %q, want %q", got, want)
+	}
+	if got, want := strings.Join(list(member), ","), "#alpha 1,#secret 1,#zeta 0"; got != want {
+		t.Errorf("LIST for a member = %q, want %q", got, want)
+	}
+}
+
+func TestSweepExpiredChannels(t *testing.T) {
+	srv, err := New(&Config{ServerName: "test.server", ChannelExpiry: 50 * time.Millisecond}, logger.New())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	idle := srv.CreateChannel("#idle")
+	idle.SetMode('P', true)
+
+	active := srv.CreateChannel("#active")
+	active.SetMode('P', true)
+
+	occupied := srv.CreateChannel("#occupied")
+	occupied.SetMode('P', true)
+	occupied.AddMember(client.NewMock(logger.New()))
+
+	// Leaving the last member keeps a permanent channel around
+	srv.RemoveChannel("#idle")
+	if srv.GetChannel("#idle") == nil {
+		t.Fatal("permanent channel was removed when empty")
+	}
+
+	// After the TTL only #active has seen recent use
+	time.Sleep(100 * time.Millisecond)
+	active.Touch()
+	srv.sweepExpiredChannels(time.Now())
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"#idle", false},
+		{"#active", true},
+		{"#occupied", true},
+	}
+	for _, tt := range tests {
+		if got := srv.GetChannel(tt.name) != nil; got != tt.want {
+			t.Errorf("%s present = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPermanentChannelTakeover(t *testing.T) {
+	srv, err := New(&Config{ServerName: "test.server"}, logger.New())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	newUser := func(nick string) *client.Client {
+		c := client.NewMock(logger.New())
+		c.SetNickname(nick)
+		c.SetUsername(nick, nick)
+		c.SetRegistered(true)
+		srv.AddClient(c)
+		return c
+	}
+	run := func(c *client.Client, line string) {
+		msg, _ := parser.Parse(line)
+		if err := srv.handler.Handle(c, msg); err != nil {
+			t.Fatalf("%s failed: %v", line, err)
+		}
+	}
+
+	ch := srv.CreateChannel("#perm")
+	ch.SetMode('P', true)
+
+	// The first to join an empty permanent channel gets no ops
+	alice := newUser("alice")
+	run(alice, "JOIN #perm")
+	if ch.GetRank(alice) != channel.RankNone {
+		t.Errorf("first joiner of a permanent channel got rank %d", ch.GetRank(alice))
+	}
+	run(alice, "PART #perm")
+
+	// Dropping +P from the empty channel removes it
+	oper := newUser("oper")
+	oper.SetMode('o', true)
+	run(oper, "OMODE #perm -P")
+	if srv.GetChannel("#perm") != nil {
+		t.Error("empty channel was kept after -P")
+	}
+}
+
+func TestWebSocketResume(t *testing.T) {
+	newSession := func(t *testing.T) (*Server, *client.Client, string) {
+		srv, err := New(&Config{ServerName: "test.server", WebSocketResume: time.Minute}, logger.New())
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+
+		old := client.NewMock(logger.New())
+		old.SetNickname("alice")
+		old.SetUsername("~alice", "Alice")
+		old.SetUID("0AAAAAAAA")
+		old.SetConnectionType(client.WebSocket, false)
+		old.SetRegistered(true)
+		if err := srv.AddClient(old); err != nil {
+			t.Fatalf("AddClient failed: %v", err)
+		}
+		ch := srv.CreateChannel("#test")
+		ch.AddMember(old)
+		old.JoinChannel("#test")
+
+		srv.issueResumeToken(old)
+		token := srv.resumeTokens[old]
+		if token == "" {
+			t.Fatal("no resume token issued")
+		}
+		if !srv.suspendSession(old) {
+			t.Fatal("session was not suspended")
+		}
+		return srv, old, token
+	}
+
+	t.Run("Valid token", func(t *testing.T) {
+		srv, _, token := newSession(t)
+
+		c := client.NewMock(logger.New())
+		msg, _ := parser.Parse("RESUME " + token)
+		if err := srv.handler.Handle(c, msg); err != nil {
+			t.Fatalf("RESUME failed: %v", err)
+		}
+
+		if c.GetNickname() != "alice" || !c.IsRegistered() {
+			t.Fatalf("nick = %q registered = %v, want alice registered", c.GetNickname(), c.IsRegistered())
+		}
+		if srv.GetClient("alice") != c {
+			t.Error("registry does not point at the resumed connection")
+		}
+		ch := srv.GetChannel("#test")
+		if !ch.HasMember(c) || !ch.IsOperator(c) {
+			t.Error("resumed client lost channel membership or status")
+		}
+	})
+
+	t.Run("Expired token", func(t *testing.T) {
+		srv, old, token := newSession(t)
+		srv.sweepResumeSessions(time.Now().Add(2 * time.Minute))
+
+		c := client.NewMock(logger.New())
+		msg, _ := parser.Parse("RESUME " + token)
+		srv.handler.Handle(c, msg)
+
+		if c.IsRegistered() || c.GetNickname() != "" {
+			t.Error("expired token resumed the session")
+		}
+		if sent := strings.Join(c.SentMessages(), "\n"); !strings.Contains(sent, " 400 * RESUME :Cannot resume session") {
+			t.Errorf("expected ERR_UNKNOWNERROR without standard-replies, got %q", sent)
+		}
+		if srv.GetClient("alice") != nil {
+			t.Error("expired session still holds the nick")
+		}
+		if ch := srv.GetChannel("#test"); ch != nil && ch.HasMember(old) {
+			t.Error("expired session still in the channel")
+		}
+	})
+
+	t.Run("Nick held by another client", func(t *testing.T) {
+		srv, old, token := newSession(t)
+		other := client.NewMock(logger.New())
+		other.SetNickname("alice")
+		srv.mu.Lock()
+		srv.clients["alice"] = other
+		srv.mu.Unlock()
+
+		c := client.NewMock(logger.New())
+		c.SetCap("standard-replies", true)
+		msg, _ := parser.Parse("RESUME " + token)
+		srv.handler.Handle(c, msg)
+
+		if c.IsRegistered() || srv.GetClient("alice") != other {
+			t.Error("RESUME took over a nick the session no longer held")
+		}
+		if ch := srv.GetChannel("#test"); ch.HasMember(c) || !ch.HasMember(old) {
+			t.Error("refused RESUME changed the channel membership")
+		}
+		if sent := strings.Join(c.SentMessages(), "\n"); !strings.Contains(sent, "FAIL RESUME INVALID_TOKEN :Cannot resume session") {
+			t.Errorf("expected FAIL with standard-replies, got %q", sent)
+		}
+	})
+}
+
+// selfSignedCert returns a throwaway certificate for TLS tests
+func selfSignedCert(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"irc.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestTLSConfigALPN(t *testing.T) {
+	cert := selfSignedCert(t)
+	getCert := func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return &cert, nil }
+
+	if got := newTLSConfig(getCert, false).NextProtos; len(got) != 1 || got[0] != "irc" {
+		t.Fatalf("NextProtos = %v, want [irc]", got)
+	}
+
+	tests := []struct {
+		name      string
+		strict    bool
+		offered   []string
+		wantErr   bool
+		wantProto string
+	}{
+		{"irc client", false, []string{"irc"}, false, "irc"},
+		{"no ALPN", false, nil, false, ""},
+		{"other protocol, lenient", false, []string{"http/1.1"}, false, ""},
+		{"irc client, strict", true, []string{"h2", "irc"}, false, "irc"},
+		{"no ALPN, strict", true, nil, false, ""},
+		{"other protocol, strict", true, []string{"http/1.1"}, true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverConn, clientConn := net.Pipe()
+			defer serverConn.Close()
+			defer clientConn.Close()
+
+			go func() {
+				srv := tls.Server(serverConn, newTLSConfig(getCert, tt.strict))
+				srv.Handshake()
+				serverConn.Close()
+			}()
+
+			cl := tls.Client(clientConn, &tls.Config{InsecureSkipVerify: true, NextProtos: tt.offered})
+			err := cl.Handshake()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("handshake succeeded, want ALPN rejection")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("handshake failed: %v", err)
+			}
+			if got := cl.ConnectionState().NegotiatedProtocol; got != tt.wantProto {
+				t.Errorf("negotiated protocol = %q, want %q", got, tt.wantProto)
+			}
+		})
+	}
+}
+
+// writeCertFiles writes cert and its key as PEM files into dir
+func writeCertFiles(t *testing.T, dir string, cert tls.Certificate) (certFile, keyFile string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey failed: %v", err)
+	}
+	certFile = filepath.Join(dir, "server.crt")
+	keyFile = filepath.Join(dir, "server.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestRehashReloadsCertificate(t *testing.T) {
+	dir := t.TempDir()
+	oldCert, newCert := selfSignedCert(t), selfSignedCert(t)
+	certFile, keyFile := writeCertFiles(t, dir, oldCert)
+
+	srv, err := New(&Config{ServerName: "test.server", Host: "127.0.0.1", MaxClients: 10, TLSCertFile: certFile, TLSKeyFile: keyFile}, logger.New())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := srv.startTLSListener(ctx); err != nil {
+		t.Fatalf("startTLSListener failed: %v", err)
+	}
+	defer srv.tlsListener.Close()
+
+	presented := func() []byte {
+		conn, err := tls.Dial("tcp", srv.tlsListener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatalf("TLS dial failed: %v", err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Raw
+	}
+
+	if !bytes.Equal(presented(), oldCert.Certificate[0]) {
+		t.Fatal("server did not present the configured certificate")
+	}
+
+	// Renew the files on disk; an operator rehashes
+	writeCertFiles(t, dir, newCert)
+	oper := client.NewMock(logger.New())
+	oper.SetNickname("admin")
+	oper.SetRegistered(true)
+	oper.SetMode('o', true)
+	msg, _ := parser.Parse("REHASH")
+	if err := srv.handler.Handle(oper, msg); err != nil {
+		t.Fatalf("REHASH failed: %v", err)
+	}
+	if sent := strings.Join(oper.SentMessages(), "\n"); !strings.Contains(sent, " 382 admin ") || strings.Contains(sent, "NOTICE") {
+		t.Errorf("unexpected REHASH replies: %q", sent)
+	}
+
+	if !bytes.Equal(presented(), newCert.Certificate[0]) {
+		t.Error("server still presents the old certificate after REHASH")
+	}
+
+	// A broken file keeps the current certificate
+	os.WriteFile(certFile, []byte("garbage"), 0600)
+	if err := srv.Rehash(); err == nil {
+		t.Error("Rehash succeeded with an invalid certificate file")
+	}
+	if !bytes.Equal(presented(), newCert.Certificate[0]) {
+		t.Error("failed rehash replaced the certificate")
+	}
+
+	// Only operators may rehash
+	user := client.NewMock(logger.New())
+	user.SetNickname("user")
+	user.SetRegistered(true)
+	srv.handler.Handle(user, msg)
+	if sent := strings.Join(user.SentMessages(), "\n"); !strings.Contains(sent, " 481 user ") {
+		t.Errorf("non-operator REHASH got %q, want ERR_NOPRIVILEGES", sent)
+	}
+}
+
+func TestMetricsDroppedMessages(t *testing.T) {
+	srv, err := New(&Config{ServerName: "test.server"}, logger.New())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	scrape := func() string {
+		rec := httptest.NewRecorder()
+		srv.handleMetrics(rec, httptest.NewRequest("GET", "/metrics", nil))
+		return rec.Body.String()
+	}
+	dropped := func(body string) uint64 {
+		m := regexp.MustCompile(`(?m)^ircd_dropped_messages_total (\d+)$`).FindStringSubmatch(body)
+		if m == nil {
+			t.Fatalf("no dropped message counter in %q", body)
+		}
+		n, _ := strconv.ParseUint(m[1], 10, 64)
+		return n
+	}
+
+	before := dropped(scrape())
+	slow := client.NewMock(logger.New())
+	for i := 0; i < 110; i++ {
+		slow.Send("PING :flood")
+	}
+	if got := dropped(scrape()) - before; got != 10 {
+		t.Errorf("counter grew by %d, want 10", got)
+	}
+
+	// Operators see the same counter in STATS z
+	oper := client.NewMock(logger.New())
+	oper.SetNickname("admin")
+	oper.SetRegistered(true)
+	oper.SetMode('o', true)
+	msg, _ := parser.Parse("STATS z")
+	srv.handler.Handle(oper, msg)
+	want := fmt.Sprintf(" 249 admin z :Dropped messages (full send queues): %d", client.DroppedMessages())
+	if out := strings.Join(oper.SentMessages(), "\n"); !strings.Contains(out, want) {
+		t.Errorf("STATS z = %q, want %q", out, want)
+	}
+}
+
+func TestIdleKick(t *testing.T) {
+	srv, err := New(&Config{ServerName: "test.server", IdleKick: 50 * time.Millisecond}, logger.New())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	newClient := func(nick string, registered bool) *client.Client {
+		conn, peer := net.Pipe()
+		t.Cleanup(func() { peer.Close() })
+		c := client.NewMock(logger.New())
+		c.SetConn(conn)
+		c.SetNickname(nick)
+		c.SetRegistered(registered)
+		srv.clientsAddr[nick] = c
+		return c
+	}
+	idle := newClient("idle", true)
+	active := newClient("active", true)
+	pending := newClient("pending", false)
+
+	time.Sleep(80 * time.Millisecond)
+
+	// Answering PINGs keeps the connection alive but is not activity
+	idle.UpdatePingTime()
+	active.UpdateCommandTime()
+
+	srv.sweepTimeouts()
+
+	if !idle.IsDisconnected() {
+		t.Error("registered client sending only PING/PONG was not kicked")
+	}
+	if active.IsDisconnected() {
+		t.Error("client that sent a command was kicked")
+	}
+	if pending.IsDisconnected() {
+		t.Error("idle kick applied to an unregistered connection")
+	}
+}
+
+func TestPingTimeoutCleansUpClient(t *testing.T) {
+	srv, err := New(&Config{ServerName: "test.server", Timeout: 50 * time.Millisecond}, logger.New())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	newClient := func(nick string) *client.Client {
+		conn, peer := net.Pipe()
+		t.Cleanup(func() { peer.Close() })
+		c := client.NewMock(logger.New())
+		c.SetConn(conn)
+		c.SetNickname(nick)
+		c.SetUsername(nick, nick)
+		c.SetRegistered(true)
+		srv.clientsAddr[nick] = c
+		srv.clients[nick] = c
+		msg, _ := parser.Parse("JOIN #test")
+		srv.handler.Handle(c, msg)
+		c.SentMessages()
+		return c
+	}
+	stale := newClient("stale")
+	time.Sleep(80 * time.Millisecond)
+	alive := newClient("alive")
+	stale.SentMessages()
+
+	srv.sweepTimeouts()
+
+	if !stale.IsDisconnected() || alive.IsDisconnected() {
+		t.Fatalf("disconnected: stale=%v alive=%v, want true/false", stale.IsDisconnected(), alive.IsDisconnected())
+	}
+
+	errorLine := regexp.MustCompile(`^ERROR :Closing Link: test\.host \(Ping timeout: \d+ seconds\)$`)
+	if sent := stale.SentMessages(); len(sent) == 0 || !errorLine.MatchString(sent[0]) {
+		t.Errorf("timed-out client got %q, want the ping timeout ERROR with its duration", sent)
+	}
+
+	ch := srv.GetChannel("#test")
+	if ch == nil || ch.HasMember(stale) || len(stale.GetChannels()) != 0 {
+		t.Error("timed-out client was not removed from its channels")
+	}
+	if sent := strings.Join(alive.SentMessages(), "\n"); !strings.Contains(sent, ":stale!stale@test.host QUIT :Ping timeout: ") {
+		t.Errorf("channel members were not told about the timeout: %q", sent)
+	}
+}
+
+func TestMalformedLineReply(t *testing.T) {
+	srv, err := New(&Config{ServerName: "test.server"}, logger.New())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	go srv.handleClient(conn)
+
+	go func() {
+		// A blank line, a garbage line, then a PING to mark the end
+		peer.Write([]byte("\r\n#$%! junk\r\nPING done\r\n"))
+	}()
+
+	var replies []string
+	reader := bufio.NewReader(peer)
+	peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading replies: %v (got %q)", err, replies)
+		}
+		if strings.Contains(line, "PONG") {
+			break
+		}
+		if strings.Contains(line, " 421 ") {
+			replies = append(replies, strings.TrimSpace(line))
+		}
+	}
+
+	if len(replies) != 1 {
+		t.Fatalf("got %d ERR_UNKNOWNCOMMAND replies, want 1 (blank line ignored): %q", len(replies), replies)
+	}
+	if !strings.HasSuffix(replies[0], "#$%! :Unknown command") {
+		t.Errorf("reply = %q, want the offending command echoed", replies[0])
+	}
+}
+
+func TestConnectNotices(t *testing.T) {
+	notices := []string{"Welcome to the test network", "Rules: be nice", "Contact: admin@example.com"}
+	srv, err := New(&Config{ServerName: "test.server", ConnectNotices: notices}, logger.New())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	go srv.handleClient(conn)
+
+	reader := bufio.NewReader(peer)
+	peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	want := append([]string{"*** Looking up your hostname..."}, notices...)
+	for i, text := range want {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading notice %d: %v", i, err)
+		}
+		if got := strings.TrimSpace(line); got != "NOTICE AUTH :"+text {
+			t.Errorf("line %d = %q, want %q", i, got, "NOTICE AUTH :"+text)
+		}
+	}
+}
+
+func TestServerIDValidation(t *testing.T) {
+	// A valid SID is used verbatim
+	srv, err := New(&Config{ServerName: "a.test", LinkingEnabled: true, ServerID: "1AB"}, logger.New())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if srv.network == nil || srv.network.LocalSID != "1AB" {
+		t.Fatalf("expected network with SID 1AB, got %+v", srv.network)
+	}
+
+	// Invalid or empty SIDs are replaced with a generated one
+	for _, sid := range []string{"", "abc", "A00", "0AAA"} {
+		srv, err := New(&Config{ServerName: "b.test", LinkingEnabled: true, ServerID: sid}, logger.New())
+		if err != nil {
+			t.Fatalf("New(%q) failed: %v", sid, err)
+		}
+		if srv.network == nil {
+			t.Fatalf("SID %q: linking was disabled", sid)
+		}
+		if !linking.ValidateSID(srv.config.ServerID) || srv.network.LocalSID != srv.config.ServerID {
+			t.Errorf("SID %q: got generated SID %q", sid, srv.config.ServerID)
+		}
+	}
+
+	// Strict mode refuses to start instead
+	if _, err := New(&Config{ServerName: "c.test", LinkingEnabled: true, ServerID: "bad", ServerIDStrict: true}, logger.New()); err == nil {
+		t.Error("expected strict mode to reject an invalid SID")
+	}
+}
+
+func TestNickServIdentify(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword failed: %v", err)
+	}
+	srv, err := New(&Config{
+		ServerName:       "test.server",
+		Accounts:         []Account{{Name: "Alice", Password: string(hash), Nicks: []string{"alice_"}}},
+		NickProtectGrace: 50 * time.Millisecond,
+	}, logger.New())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	alice := client.NewMock(logger.New())
+	alice.SetNickname("alice")
+	alice.SetUsername("alice", "Alice")
+	alice.SetRegistered(true)
+	srv.AddClient(alice)
+
+	run := func(line string) string {
+		alice.SentMessages()
+		msg, _ := parser.Parse(line)
+		if err := srv.handler.Handle(alice, msg); err != nil {
+			t.Fatalf("%s failed: %v", line, err)
+		}
+		return strings.Join(alice.SentMessages(), "\n")
+	}
+
+	if out := run("PRIVMSG NickServ :IDENTIFY wrong"); !strings.Contains(out, "Invalid account or password") || alice.GetAccount() != "" {
+		t.Errorf("wrong password should be refused, got %q (account %q)", out, alice.GetAccount())
+	}
+
+	// The account defaults to the current nick
+	out := run("PRIVMSG NickServ :IDENTIFY secret")
+	if alice.GetAccount() != "Alice" {
+		t.Fatalf("expected to be logged in as Alice, got %q (%q)", alice.GetAccount(), out)
+	}
+	if !strings.Contains(out, " 900 alice alice!alice@test.host Alice :You are now logged in as Alice") {
+		t.Errorf("expected RPL_LOGGEDIN, got %q", out)
+	}
+
+	// A reserved nick is safe while logged in and enforced after LOGOUT
+	run("NICK alice_")
+	time.Sleep(100 * time.Millisecond)
+	if alice.GetNickname() != "alice_" {
+		t.Fatalf("logged-in owner lost their reserved nick: %q", alice.GetNickname())
+	}
+	if out := run("PRIVMSG NickServ :LOGOUT"); !strings.Contains(out, " 901 alice_ ") || alice.GetAccount() != "" {
+		t.Errorf("expected RPL_LOGGEDOUT, got %q (account %q)", out, alice.GetAccount())
+	}
+	time.Sleep(100 * time.Millisecond)
+	if alice.GetNickname() == "alice_" {
+		t.Error("expected the reserved nick to be enforced after LOGOUT")
+	}
+
+	// With no accounts configured there is no NickServ
+	plain, err := New(&Config{ServerName: "test.server"}, logger.New())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if plain.GetClient("NickServ") != nil {
+		t.Error("NickServ should only be registered when accounts are configured")
+	}
+}
+
+func TestRegisterService(t *testing.T) {
+	srv, err := New(&Config{ServerName: "test.server"}, logger.New())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	var gotFrom, gotText string
+	err = srv.RegisterService("NickServ", func(svc, from *client.Client, message string) {
+		gotFrom, gotText = from.GetNickname(), message
+		from.Send(fmt.Sprintf(":%s NOTICE %s :Received %s", svc.GetHostmask(), from.GetNickname(), message))
+	})
+	if err != nil {
+		t.Fatalf("RegisterService failed: %v", err)
+	}
+	if err := srv.RegisterService("NickServ", func(*client.Client, *client.Client, string) {}); err == nil {
+		t.Error("registering a service under a taken nick should fail")
+	}
+
+	alice := client.NewMock(logger.New())
+	alice.SetNickname("alice")
+	alice.SetUsername("alice", "Alice")
+	alice.SetRegistered(true)
+	srv.AddClient(alice)
+
+	run := func(line string) string {
+		alice.SentMessages()
+		msg, _ := parser.Parse(line)
+		if err := srv.handler.Handle(alice, msg); err != nil {
+			t.Fatalf("%s failed: %v", line, err)
+		}
+		return strings.Join(alice.SentMessages(), "\n")
+	}
+
+	out := run("PRIVMSG NickServ :IDENTIFY secret")
+	if gotFrom != "alice" || gotText != "IDENTIFY secret" {
+		t.Errorf("service handler got (%q, %q), want (alice, IDENTIFY secret)", gotFrom, gotText)
+	}
+	if !strings.Contains(out, ":NickServ!services@test.server NOTICE alice :Received IDENTIFY secret") {
+		t.Errorf("expected the service's reply, got %q", out)
+	}
+
+	// NOTICEs are not passed to the handler
+	gotText = ""
+	run("NOTICE NickServ :hello")
+	if gotText != "" {
+		t.Errorf("NOTICE reached the service handler: %q", gotText)
+	}
+
+	// The service is online for ISON and WHOIS
+	if out := run("ISON NickServ ChanServ"); !strings.Contains(out, ":NickServ") || strings.Contains(out, "ChanServ") {
+		t.Errorf("unexpected ISON reply: %q", out)
+	}
+	if out := run("WHOIS NickServ"); !strings.Contains(out, " 311 alice NickServ services test.server ") {
+		t.Errorf("expected WHOIS to find the service, got %q", out)
+	}
+}
+
+func TestNickChangeRekeysClient(t *testing.T) {
+	srv, err := New(&Config{ServerName: "test.server"}, logger.New())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	alice := client.NewMock(logger.New())
+	alice.SetNickname("alice")
+	alice.SetUsername("alice", "Alice")
+	alice.SetRegistered(true)
+	if err := srv.AddClient(alice); err != nil {
+		t.Fatalf("AddClient failed: %v", err)
+	}
+	bob := client.NewMock(logger.New())
+	bob.SetNickname("bob")
+	bob.SetRegistered(true)
+	srv.AddClient(bob)
+
+	for _, line := range []string{"JOIN #test", "NICK alicia"} {
+		msg, _ := parser.Parse(line)
+		if err := srv.handler.Handle(alice, msg); err != nil {
+			t.Fatalf("%s failed: %v", line, err)
+		}
+	}
+
+	if srv.GetClient("alicia") != alice {
+		t.Error("client not found under its new nick")
+	}
+	if srv.GetClient("alice") != nil || srv.IsNicknameInUse("alice") {
+		t.Error("old nick still maps to a client")
+	}
+
+	ch := srv.GetChannel("#test")
+	if !ch.HasMember(alice) || ch.GetMemberByNick("alice") != nil || !ch.IsOperator(alice) {
+		t.Error("channel membership and status did not follow the nick change")
+	}
+
+	// Renaming onto a nick held by someone else fails
+	if err := srv.RenameClient("alicia", "bob"); err == nil || srv.GetClient("bob") != bob {
+		t.Error("RenameClient took a nick already in use")
+	}
+}
+
+func TestRegistrationNickRace(t *testing.T) {
+	srv, err := New(&Config{ServerName: "test.server"}, logger.New())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	// Both connections have sent USER; their NICKs arrive at the same time
+	racers := make([]*client.Client, 2)
+	for i := range racers {
+		racers[i] = client.NewMock(logger.New())
+		msg, _ := parser.Parse(fmt.Sprintf("USER racer%d 0 * :Racer", i))
+		srv.handler.Handle(racers[i], msg)
+	}
+
+	start := make(chan struct{})
+	done := make(chan struct{})
+	for _, c := range racers {
+		go func(c *client.Client) {
+			defer func() { done <- struct{}{} }()
+			<-start
+			msg, _ := parser.Parse("NICK prize")
+			srv.handler.Handle(c, msg)
+		}(c)
+	}
+	close(start)
+	<-done
+	<-done
+
+	var winner, loser *client.Client
+	for _, c := range racers {
+		if c.IsRegistered() {
+			winner = c
+		} else {
+			loser = c
+		}
+	}
+	if winner == nil || loser == nil {
+		t.Fatalf("want exactly one registered client, got %v and %v", racers[0].IsRegistered(), racers[1].IsRegistered())
+	}
+	if srv.GetClient("prize") != winner {
+		t.Error("registry does not hold the winner under the nick")
+	}
+	if out := strings.Join(loser.SentMessages(), "\n"); !strings.Contains(out, " 433 * prize :Nickname is already in use") {
+		t.Errorf("loser was not told the nick is in use: %q", out)
+	}
+	if loser.GetNickname() != "" {
+		t.Errorf("loser kept nick %q", loser.GetNickname())
+	}
+
+	// The loser can pick another nick and finish registering
+	msg, _ := parser.Parse("NICK runnerup")
+	srv.handler.Handle(loser, msg)
+	if !loser.IsRegistered() || srv.GetClient("runnerup") != loser {
+		t.Error("loser could not register with another nick")
+	}
+}
+
+// stubResolver answers every reverse lookup with host after holding the
+// lookup for delay, recording how many lookups overlapped
+type stubResolver struct {
+	host    string
+	delay   time.Duration
+	block   chan struct{} // If set, lookups wait for it to close instead
+	mu      sync.Mutex
+	active  int
+	peak    int
+	started chan struct{}
+}
+
+func (r *stubResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	r.mu.Lock()
+	r.active++
+	if r.active > r.peak {
+		r.peak = r.active
+	}
+	r.mu.Unlock()
+	if r.started != nil {
+		r.started <- struct{}{}
+	}
+
+	if r.block != nil {
+		<-r.block
+	} else {
+		time.Sleep(r.delay)
+	}
+
+	r.mu.Lock()
+	r.active--
+	r.mu.Unlock()
+	return []string{r.host + "."}, nil
+}
+
+func (r *stubResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return []string{"192.0.2.1"}, nil
+}
+
+func TestLookupConcurrencyLimit(t *testing.T) {
+	srv, err := New(&Config{
+		ServerName:      "test.server",
+		HostnameLookup:  true,
+		IdentLookup:     true,
+		MaxLookups:      3,
+		LookupQueueWait: 5 * time.Second,
+	}, logger.New())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	resolver := &stubResolver{host: "host.example.net", delay: 10 * time.Millisecond}
+	srv.resolver = resolver
+	srv.identLookup = func(ctx context.Context, local, remote net.Addr) (string, error) {
+		return "alice", nil
+	}
+
+	local := &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 6667}
+	remote := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 40000}
+
+	var wg sync.WaitGroup
+	clients := make([]*client.Client, 30)
+	for i := range clients {
+		clients[i] = client.NewMock(srv.logger)
+		wg.Add(1)
+		go func(c *client.Client) {
+			defer wg.Done()
+			srv.lookupClient(c, local, remote)
+		}(clients[i])
+	}
+	wg.Wait()
+
+	if resolver.peak > 3 {
+		t.Errorf("%d lookups ran at once, want at most 3", resolver.peak)
+	}
+	for i, c := range clients {
+		if c.GetHostname() != "host.example.net" || c.GetIdent() != "alice" {
+			t.Errorf("client %d: hostname %q ident %q after lookup", i, c.GetHostname(), c.GetIdent())
+		}
+	}
+}
+
+func TestLookupQueueTimeout(t *testing.T) {
+	srv, err := New(&Config{
+		ServerName:      "test.server",
+		HostnameLookup:  true,
+		MaxLookups:      2,
+		LookupQueueWait: 20 * time.Millisecond,
+	}, logger.New())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	resolver := &stubResolver{host: "host.example.net", block: make(chan struct{}), started: make(chan struct{}, 2)}
+	srv.resolver = resolver
+	remote := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 40000}
+
+	// Fill every slot with a lookup that doesn't finish
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			srv.lookupClient(client.NewMock(srv.logger), remote, remote)
+		}()
+		<-resolver.started
+	}
+
+	// The next connection gives up waiting and keeps its address
+	c := client.NewMock(srv.logger)
+	start := time.Now()
+	srv.lookupClient(c, remote, remote)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("queued lookup waited %v", elapsed)
+	}
+	if c.GetHostname() != "test.host" {
+		t.Errorf("hostname = %q, want the unresolved address", c.GetHostname())
+	}
+	if sent := strings.Join(c.SentMessages(), "\n"); !strings.Contains(sent, "Too many lookups in progress") {
+		t.Errorf("queued client not told lookups were skipped: %q", sent)
+	}
+
+	close(resolver.block)
+	wg.Wait()
+	if resolver.peak != 2 {
+		t.Errorf("%d lookups ran at once, want 2", resolver.peak)
+	}
+}
+
+func TestValidHostname(t *testing.T) {
+	label := strings.Repeat("a", 63)
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"host.example.net", true},
+		{label + ".example.net", true},
+		{strings.Repeat(label+".", 3) + strings.Repeat("b", 61), true},
+		{"", false},
+		{label + "a.example.net", false},
+		{strings.Repeat(label+".", 3) + strings.Repeat("b", 62), false},
+		{"host..example.net", false},
+		{"host.example.net:1", false},
+		{"bad_host.example.net", false},
+	}
+	for _, tt := range tests {
+		if got := validHostname(tt.host); got != tt.want {
+			t.Errorf("validHostname(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestLoadMOTD(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ircd.motd")
+	if err := os.WriteFile(file, []byte("Welcome!\r\n\r\nBe nice.\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	srv, err := New(&Config{ServerName: "test.server", MOTDFile: file}, logger.New())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	got := srv.loadMOTD()
+	if len(got) != 3 || strings.Join(got, "|") != "Welcome!||Be nice." {
+		t.Errorf("loadMOTD() = %q, want [Welcome! \"\" Be nice.]", got)
+	}
+
+	srv.config.MOTDFile = filepath.Join(t.TempDir(), "missing.motd")
+	if got := srv.loadMOTD(); got != nil {
+		t.Errorf("loadMOTD() with a missing file = %q, want nil", got)
+	}
+}
+
+func TestConfigCommand(t *testing.T) {
+	srv, err := New(&Config{
+		ServerName:   "test.server",
+		Port:         6667,
+		MaxClients:   250,
+		TLSEnabled:   true,
+		TLSPort:      6697,
+		TLSKeyFile:   "/etc/ircd/secret-server.key",
+		LinkPassword: "hunter2",
+		Operators:    []Operator{{Name: "admin", Password: "$2a$10$operhashoperhash"}},
+		Links:        []LinkConfig{{Name: "hub.example.net", SID: "1BB", Host: "192.0.2.1", Port: 7777, Password: "linksecret"}},
+	}, logger.New())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	c := client.NewMock(srv.logger)
+	c.SetNickname("alice")
+	c.SetRegistered(true)
+	config := func() string {
+		c.SentMessages()
+		msg, _ := parser.Parse("CONFIG")
+		srv.handler.Handle(c, msg)
+		return strings.Join(c.SentMessages(), "\n")
+	}
+
+	if sent := config(); !strings.Contains(sent, " 481 alice ") || strings.Contains(sent, "MaxClients") {
+		t.Fatalf("non-operator CONFIG = %q, want only ERR_NOPRIVILEGES", sent)
+	}
+
+	c.SetMode('o', true)
+	sent := config()
+	for _, want := range []string{
+		"*** Port: 6667",
+		"*** MaxClients: 250",
+		"*** TLSEnabled: true",
+		"*** TLSPort: 6697",
+		"*** Operators: admin",
+		"*** Link: hub.example.net sid=1BB address=192.0.2.1:7777",
+		"*** LinkPassword: (set, hidden)",
+		"*** TLSKeyFile: (set, hidden)",
+		"*** End of CONFIG",
+	} {
+		if !strings.Contains(sent, want) {
+			t.Errorf("CONFIG output missing %q", want)
+		}
+	}
+	for _, secret := range []string{"hunter2", "operhash", "linksecret", "secret-server.key"} {
+		if strings.Contains(sent, secret) {
+			t.Errorf("CONFIG output leaks %q", secret)
+		}
+	}
+}
+
+func TestLusersCounts(t *testing.T) {
+	srv, err := New(&Config{ServerName: "test.server"}, logger.New())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	var clients []*client.Client
+	for _, nick := range []string{"alice", "bob", "carol", "dave"} {
+		c := client.NewMock(srv.logger)
+		c.SetNickname(nick)
+		c.SetRegistered(true)
+		if err := srv.AddClient(c); err != nil {
+			t.Fatalf("AddClient(%s) failed: %v", nick, err)
+		}
+		clients = append(clients, c)
+	}
+	clients[1].SetMode('o', true)
+	clients[2].SetMode('o', true)
+	clients[3].SetMode('i', true)
+	for _, name := range []string{"#one", "#two", "#three"} {
+		srv.CreateChannel(name)
+	}
+
+	alice := clients[0]
+	alice.SentMessages()
+	msg, _ := parser.Parse("LUSERS")
+	srv.handler.Handle(alice, msg)
+	sent := strings.Join(alice.SentMessages(), "\n")
+
+	for _, want := range []string{
+		" 251 alice :There are 3 users and 1 invisible on 1 servers",
+		" 252 alice 2 :operator(s) online",
+		" 254 alice 3 :channels formed",
+		" 255 alice :I have 4 clients and 0 servers",
+	} {
+		if !strings.Contains(sent, want) {
+			t.Errorf("LUSERS missing %q:\n%s", want, sent)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/supamanluva/ircd/internal/client"
+)
+
+// RegisterService adds an internal service pseudo-client (NickServ, ChanServ,
+// ...) under a reserved nick. PRIVMSGs to the nick are passed to handler;
+// the service shows as online in ISON and WHOIS like any other user.
+func (s *Server) RegisterService(nick string, handler client.ServiceHandler) error {
+	if nick == "" || handler == nil {
+		return fmt.Errorf("service needs a nickname and a handler")
+	}
+
+	svc := client.NewService(nick, s.config.ServerName, handler, s.logger)
+	if err := s.AddClient(svc); err != nil {
+		return fmt.Errorf("cannot register service %s: %v", nick, err)
+	}
+
+	s.logger.Info("Registered service", "nick", nick)
+	return nil
+}
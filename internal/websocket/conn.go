@@ -16,6 +16,7 @@ type Conn struct {
 	reader     io.Reader
 	remoteAddr net.Addr
 	localAddr  net.Addr
+	secure     bool // Upgraded from an HTTPS request
 }
 
 // NewConn creates a new WebSocket connection wrapper
@@ -27,6 +28,11 @@ func NewConn(ws *websocket.Conn) *Conn {
 	}
 }
 
+// IsSecure returns whether the WebSocket was established over TLS
+func (c *Conn) IsSecure() bool {
+	return c.secure
+}
+
 // Read implements net.Conn interface
 // Reads IRC protocol text from WebSocket text messages
 func (c *Conn) Read(b []byte) (int, error) {
@@ -125,6 +125,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// Wrap WebSocket in net.Conn interface
 	conn := NewConn(ws)
+	conn.secure = r.TLS != nil
 
 	h.logger.Info("WebSocket connection established", "remote", conn.RemoteAddr())
 